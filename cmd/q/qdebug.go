@@ -0,0 +1,318 @@
+// package qm stand alone command shell for Q language interpreter
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/x0ray/q/qs"
+	"github.com/x0ray/q/qs/qsdap"
+)
+
+const debugHelp = `Debug commands:
+   break [file:]line      Stop before the line runs, in the current file without file:
+   break proc             Stop at the first line of the proc
+   delete [n]             Delete breakpoint n, or all breakpoints
+   breaks                 List the breakpoints
+   continue | c           Run to the next breakpoint
+   step | s               Run to the next line, stepping into called procs
+   next | n               Run to the next line, stepping over called procs
+   finish | o             Run until the current proc returns
+   bt                     List the frames of the call stack
+   frame | f n            Select frame n, up and down select the next frames
+   locals | l             List the locals of the selected frame
+   upvalues | u           List the upvalues of the proc of the selected frame
+   globals | g            List the globals set by the script
+   print | p expr         Evaluate expr, or run statements, in the selected frame
+   list [line]            List the source around the line
+   help | h               Display this help
+   quit | q               Stop the script and quit
+An empty line repeats the last step, next, finish or continue.`
+
+// debugSession - the state of the q debug command
+type debugSession struct {
+	in      *bufio.Reader
+	out     io.Writer
+	pgm     string
+	frame   int // selected frame
+	last    string
+	quit    bool
+	sources map[string][]string
+}
+
+// debugScript - runs the script pgm under the command line debugger,
+// reading commands from stdin
+func debugScript(pgm string, args []string) int {
+	L := qs.NewState()
+	defer L.Close()
+
+	argtb := L.NewOAList()
+	for i, arg := range args {
+		L.RawSet(argtb, qs.LNumber(i+1), qs.LString(arg))
+	}
+	L.SetGlobal("_NAME", qs.LString(u.name))
+	L.SetGlobal("arg", argtb)
+
+	fn, err := L.LoadFile(pgm)
+	if err != nil {
+		log.Error().Str("pgm", pgm).Err(err).
+			Msgf("Q script compile error %v", err)
+		return RCERROR
+	}
+	s := &debugSession{in: bufio.NewReader(os.Stdin), out: os.Stdout, pgm: pgm, sources: map[string][]string{}}
+	d := qs.NewDebugger(L)
+	d.StopOnEntry = true
+	d.OnStop = s.stopped
+	fmt.Fprintf(s.out, "%s debugger, enter help for the commands\n", PGM)
+
+	L.Push(fn)
+	err = L.PCall(0, qs.MultRet, nil)
+	d.Close()
+	if s.quit {
+		fmt.Fprintln(s.out, "Script stopped")
+		return RCWARN
+	}
+	if err != nil {
+		fmt.Fprintf(s.out, "Script ended with an error: %v\n", err)
+		return RCERROR
+	}
+	fmt.Fprintln(s.out, "Script ended")
+	return RCOK
+}
+
+// stopped - shows where the script stopped and runs debug commands until
+// one of them resumes it
+func (s *debugSession) stopped(d *qs.Debugger, reason string, bp *qs.Breakpoint) qs.DebugAction {
+	s.frame = 0
+	if frames := d.Stack(); len(frames) > 0 {
+		top := frames[0]
+		if bp != nil {
+			fmt.Fprintf(s.out, "Breakpoint %s hit, ", bp)
+		} else {
+			fmt.Fprintf(s.out, "Stopped (%s), ", reason)
+		}
+		fmt.Fprintln(s.out, frameText(top))
+		s.listLines(top.Source, top.Line, top.Line, top.Line)
+	}
+	for {
+		fmt.Fprint(s.out, "(qdb) ")
+		line, err := s.in.ReadString('\n')
+		if err != nil && len(line) == 0 {
+			fmt.Fprintln(s.out)
+			s.quit = true
+			return qs.DebugAbort
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			line = s.last
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch cmd {
+		case "continue", "c":
+			s.last = cmd
+			return qs.DebugContinue
+		case "step", "s":
+			s.last = cmd
+			return qs.DebugStepIn
+		case "next", "n":
+			s.last = cmd
+			return qs.DebugStepOver
+		case "finish", "o":
+			s.last = cmd
+			return qs.DebugStepOut
+		case "quit", "q":
+			s.quit = true
+			return qs.DebugAbort
+		case "":
+		default:
+			s.command(d, cmd, arg)
+		}
+	}
+}
+
+// command - runs a debug command that does not resume the script
+func (s *debugSession) command(d *qs.Debugger, cmd, arg string) {
+	switch cmd {
+	case "break", "b":
+		s.setBreakpoint(d, arg)
+	case "delete", "d":
+		if len(arg) == 0 {
+			for _, bp := range d.Breakpoints() {
+				d.ClearBreakpoint(bp.ID)
+			}
+			fmt.Fprintln(s.out, "All breakpoints deleted")
+		} else if id, err := strconv.Atoi(arg); err != nil || !d.ClearBreakpoint(id) {
+			fmt.Fprintf(s.out, "No breakpoint %s\n", arg)
+		}
+	case "breaks":
+		for _, bp := range d.Breakpoints() {
+			fmt.Fprintf(s.out, "%s, hit %d times\n", bp, bp.Hits)
+		}
+	case "bt", "where":
+		for _, fr := range d.Stack() {
+			mark := " "
+			if fr.Level == s.frame {
+				mark = "*"
+			}
+			fmt.Fprintf(s.out, "%s#%d %s\n", mark, fr.Level, frameText(fr))
+		}
+	case "frame", "f", "up", "down":
+		level := s.frame
+		switch {
+		case cmd == "up":
+			level++
+		case cmd == "down":
+			level--
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintln(s.out, "frame needs a frame number")
+				return
+			}
+			level = n
+		}
+		fr, err := d.Frame(level)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		s.frame = level
+		fmt.Fprintf(s.out, "#%d %s\n", fr.Level, frameText(fr))
+		s.listLines(fr.Source, fr.Line, fr.Line, fr.Line)
+	case "locals", "l":
+		vars, err := d.Locals(s.frame)
+		s.showVars(vars, err)
+	case "upvalues", "u":
+		vars, err := d.Upvalues(s.frame)
+		s.showVars(vars, err)
+	case "globals", "g":
+		s.showVars(d.Globals(), nil)
+	case "print", "p":
+		values, err := d.Eval(s.frame, arg)
+		if err != nil {
+			fmt.Fprintln(s.out, strings.TrimSpace(err.Error()))
+			return
+		}
+		for _, v := range values {
+			fmt.Fprintln(s.out, qs.FormatValue(v))
+		}
+	case "list":
+		fr, err := d.Frame(s.frame)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		line := fr.Line
+		if len(arg) > 0 {
+			if line, err = strconv.Atoi(arg); err != nil {
+				fmt.Fprintln(s.out, "list needs a line number")
+				return
+			}
+		}
+		s.listLines(fr.Source, line-5, line+5, fr.Line)
+	case "help", "h":
+		fmt.Fprintln(s.out, debugHelp)
+	default:
+		fmt.Fprintf(s.out, "Unknown command %s, enter help for the commands\n", cmd)
+	}
+}
+
+// frameText - describes where a frame is
+func frameText(fr *qs.DebugFrame) string {
+	if fr.Line < 0 {
+		return fr.Name + " [G]"
+	}
+	return fmt.Sprintf("%s at %s:%d", fr.Name, fr.Source, fr.Line)
+}
+
+// setBreakpoint - sets the breakpoint named by the break command arg
+func (s *debugSession) setBreakpoint(d *qs.Debugger, arg string) {
+	if len(arg) == 0 {
+		fmt.Fprintln(s.out, "break needs a line or proc name")
+		return
+	}
+	source, where := s.pgm, arg
+	if fr, err := d.Frame(s.frame); err == nil && fr.Line >= 0 {
+		source = fr.Source
+	}
+	if i := strings.LastIndex(arg, ":"); i > 0 {
+		if _, err := strconv.Atoi(arg[i+1:]); err == nil {
+			source, where = arg[:i], arg[i+1:]
+		}
+	}
+	var bp *qs.Breakpoint
+	if line, err := strconv.Atoi(where); err == nil {
+		bp = d.SetBreakpoint(source, line)
+	} else {
+		bp = d.SetFuncBreakpoint(arg)
+	}
+	fmt.Fprintf(s.out, "Breakpoint %s\n", bp)
+}
+
+// showVars - lists named values, or the error getting them
+func (s *debugSession) showVars(vars []qs.DebugVar, err error) {
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	if len(vars) == 0 {
+		fmt.Fprintln(s.out, "none")
+	}
+	for _, v := range vars {
+		fmt.Fprintf(s.out, "%s = %s\n", v.Name, qs.FormatValue(v.Value))
+	}
+}
+
+// listLines - lists lines first to last of the source file, marking the line current
+func (s *debugSession) listLines(source string, first, last, current int) {
+	lines, ok := s.sources[source]
+	if !ok {
+		if data, err := os.ReadFile(source); err == nil {
+			lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		}
+		s.sources[source] = lines
+	}
+	if first < 1 {
+		first = 1
+	}
+	for n := first; n <= last && n <= len(lines); n++ {
+		mark := " "
+		if n == current {
+			mark = ">"
+		}
+		fmt.Fprintf(s.out, "%s%5d  %s\n", mark, n, lines[n-1])
+	}
+}
+
+// serveDAP - serves the debug adapter protocol on stdin and stdout, or to
+// one client on the TCP port of localhost. Script output is sent to the
+// client as output events.
+func serveDAP(port int) int {
+	if port > 0 {
+		addr := fmt.Sprintf("127.0.0.1:%d", port)
+		fmt.Fprintf(os.Stderr, "%s debug adapter listening on %s\n", PGM, addr)
+		if err := qsdap.ListenAndServe(addr); err != nil {
+			log.Error().Err(err).Msg("Debug adapter error")
+			return RCERROR
+		}
+		return RCOK
+	}
+	// the protocol owns stdout, the script output is sent as events
+	srv := qsdap.NewServer(os.Stdin, os.Stdout)
+	if err := srv.CaptureStdout(); err != nil {
+		log.Error().Err(err).Msg("Debug adapter error")
+		return RCERROR
+	}
+	if err := srv.Serve(); err != nil {
+		log.Error().Err(err).Msg("Debug adapter error")
+		return RCERROR
+	}
+	return RCOK
+}
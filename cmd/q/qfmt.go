@@ -0,0 +1,170 @@
+// package qm stand alone command shell for Q language interpreter
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/x0ray/q/qs/qsfmt"
+)
+
+// diffContext - the unchanged lines shown around a change by fmt -d
+const diffContext = 3
+
+// formatFiles - prints each Q source file in the canonical format, or
+// stdin when there are none. With write the files are rewritten in place,
+// with diff the changes are shown as a unified diff.
+func formatFiles(names []string, write, diff bool) int {
+	if len(names) == 0 {
+		if write {
+			log.Error().Msgf("-%s needs a Q program file to rewrite", nmWrite)
+			return RCERROR
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatSource(src, "<stdin>", false, diff)
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("Q script format error %v", err)
+			return RCERROR
+		}
+		return RCOK
+	}
+	rc := RCOK
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if err == nil {
+			err = formatSource(src, name, write, diff)
+		}
+		if err != nil {
+			log.Error().Str("pgm", name).Err(err).
+				Msgf("Q script format error %v", err)
+			rc = RCERROR
+		}
+	}
+	return rc
+}
+
+// formatSource - formats the Q source src of the file name
+func formatSource(src []byte, name string, write, diff bool) error {
+	out, err := qsfmt.Format(src, name)
+	if err != nil {
+		return err
+	}
+	if diff {
+		fmt.Print(unifiedDiff(name, string(src), string(out)))
+	}
+	if write {
+		if bytes.Equal(src, out) {
+			return nil
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(name, out, info.Mode().Perm())
+	}
+	if !diff {
+		os.Stdout.Write(out)
+	}
+	return nil
+}
+
+// unifiedDiff - returns the changes from text a to text b of the file name
+// as a unified diff, "" when they are the same
+func unifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	x := strings.SplitAfter(a, "\n")
+	y := strings.SplitAfter(b, "\n")
+	if x[len(x)-1] == "" {
+		x = x[:len(x)-1]
+	}
+	if y[len(y)-1] == "" {
+		y = y[:len(y)-1]
+	}
+	// lcs[i][j] - the length of the longest common lines of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	// ops - the lines in order, ' ' kept, '-' removed from a, '+' added by b
+	type op struct {
+		kind byte
+		text string
+		i, j int // the lines of a and b before it
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, op{' ', x[i], i, j})
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', x[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', y[j], i, j})
+			j++
+		}
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", name, name)
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// a hunk from the change at k to the last change with no more than
+		// twice the context between changes
+		first := k - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := k
+		for n := k; n < len(ops) && n-last <= 2*diffContext; n++ {
+			if ops[n].kind != ' ' {
+				last = n
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		na, nb := 0, 0
+		for _, o := range ops[first:end] {
+			if o.kind != '+' {
+				na++
+			}
+			if o.kind != '-' {
+				nb++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", ops[first].i+1, na, ops[first].j+1, nb)
+		for _, o := range ops[first:end] {
+			buf.WriteByte(o.kind)
+			buf.WriteString(o.text)
+			if !strings.HasSuffix(o.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return buf.String()
+}
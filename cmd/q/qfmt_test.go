@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFormatWrite - fmt -w rewrites a file in place, keeping its mode, and
+// leaves a file in the canonical form as it is
+func TestFormatWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "w.q")
+	if err := os.WriteFile(path, []byte("dcl a=1 ; put( a )\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if rc := formatFiles([]string{path}, true, false); rc != RCOK {
+		t.Fatalf("formatFiles rc %d", rc)
+	}
+	src, _ := os.ReadFile(path)
+	if string(src) != "dcl a = 1\nput(a)\n" {
+		t.Errorf("rewritten file %q", src)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("rewritten file mode %v", info.Mode())
+	}
+	before, _ := os.Stat(path)
+	if rc := formatFiles([]string{path}, true, false); rc != RCOK {
+		t.Fatalf("formatFiles rc %d", rc)
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("a file in the canonical form was rewritten")
+	}
+}
+
+// TestUnifiedDiff - fmt -d shows the changed lines with their context
+func TestUnifiedDiff(t *testing.T) {
+	a := "dcl a=1\nput(a)\nput(2)\nput(3)\nput(4)\nput(5)\nput(6)\nput(7)\nput(8)\nput(9)\ndcl b=2\n"
+	b := "dcl a = 1\nput(a)\nput(2)\nput(3)\nput(4)\nput(5)\nput(6)\nput(7)\nput(8)\nput(9)\ndcl b = 2\n"
+	want := "--- d.q\n+++ d.q\n" +
+		"@@ -1,4 +1,4 @@\n-dcl a=1\n+dcl a = 1\n put(a)\n put(2)\n put(3)\n" +
+		"@@ -8,4 +8,4 @@\n put(7)\n put(8)\n put(9)\n-dcl b=2\n+dcl b = 2\n"
+	if got := unifiedDiff("d.q", a, b); got != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", got, want)
+	}
+	if got := unifiedDiff("d.q", a, a); got != "" {
+		t.Errorf("diff of the same text %q", got)
+	}
+	if got := unifiedDiff("d.q", "put(1)", "put(1)\n"); got != "--- d.q\n+++ d.q\n@@ -1,1 +1,1 @@\n-put(1)\n\\ No newline at end of file\n+put(1)\n" {
+		t.Errorf("diff of a missing newline %q", got)
+	}
+}
@@ -0,0 +1,56 @@
+// package qm stand alone command shell for Q language interpreter
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/x0ray/q/qs"
+)
+
+// lintFiles - writes the issues found in each Q source file to stdout, as
+// a JSON list of all of them when asJSON is set, with the errors of the
+// files that cannot be read or compiled. It returns RCWARN when issues are
+// found and RCERROR when a file cannot be read or compiled.
+func lintFiles(names []string, asJSON bool) int {
+	if len(names) == 0 {
+		log.Error().Msg("No Q program file to lint")
+		return RCERROR
+	}
+	rc := RCOK
+	all := []*qs.LintIssue{}
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if err == nil {
+			var issues []*qs.LintIssue
+			if issues, err = qs.Lint(src, name); err == nil {
+				all = append(all, issues...)
+				continue
+			}
+		}
+		if asJSON {
+			all = append(all, qs.LintErrorIssue(err, name))
+		} else {
+			log.Error().Str("pgm", name).Err(err).
+				Msgf("Q script lint error %v", err)
+		}
+		rc = RCERROR
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			log.Error().Err(err).Msg("JSON output error")
+			return RCERROR
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, issue := range all {
+			fmt.Println(issue)
+		}
+	}
+	if len(all) > 0 && rc == RCOK {
+		rc = RCWARN
+	}
+	return rc
+}
@@ -0,0 +1,17 @@
+// package qm stand alone command shell for Q language interpreter
+package main
+
+import (
+	"os"
+
+	"github.com/x0ray/q/qs/qslsp"
+)
+
+// serveLSP - serves the language server protocol on stdin and stdout
+func serveLSP() int {
+	if err := qslsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		log.Error().Err(err).Msg("Language server error")
+		return RCERROR
+	}
+	return RCOK
+}
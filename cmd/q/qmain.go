@@ -3,10 +3,11 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
-	"runtime/pprof"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -39,12 +40,21 @@ const (
 )
 
 const (
+	nmCover  = "cover"
+	msgCover = "File name for the lcov line coverage of the Q program, an HTML report is written beside it"
+
 	nmDebug  = "debug"
 	msgDebug = "Display debugging information during OA program execution"
 
 	nmExec  = "exec"
 	msgExec = "String of OA language statements to execute directly"
 
+	nmFunc  = "func"
+	msgFunc = "Name of the proc to list, used by the disasm command"
+
+	nmDiff  = "d"
+	msgDiff = "Show the changes as a diff, used by the fmt command"
+
 	nmH     = "h"
 	nmHelp  = "help"
 	msgHelp = "Display help information and exit"
@@ -52,6 +62,9 @@ const (
 	nmInter  = "inter"
 	msgInter = "File name to use for profile data"
 
+	nmJSON  = "json"
+	msgJSON = "Write JSON output, used by the disasm and lint commands"
+
 	nmLib  = "lib"
 	msgLib = "OA library file name to access"
 
@@ -64,22 +77,34 @@ const (
 	nmLoquacity  = "loquacity"
 	msgLoquacity = "1-9 value, how much information is written to the log. 9 is more 1 is less."
 
+	nmOut  = "o"
+	msgOut = "Output file name used by the compile command"
+
 	nmName  = "name"
 	msgName = "Name used to name script for logging, and internal reference"
 
 	nmPgm  = "pgm"
 	msgPgm = "Name of file containing OA program"
 
+	nmPort  = "port"
+	msgPort = "TCP port on localhost the dap command listens on, stdin and stdout are used when 0"
+
 	nmProfile  = "profile"
-	msgProfile = "File name to use for profile data"
+	msgProfile = "File name to use for profile data, written in pprof format"
 
 	nmQuiet  = "quiet"
 	msgQuiet = "Hide program output during OA program execution"
 
+	nmStrict  = "strict"
+	msgStrict = "Run Q scripts in strict mode, where undeclared globals cannot be used"
+
 	nmV        = "v"
 	nmVersion  = "version"
 	msgVersion = "Display version information and exit"
 
+	nmWrite  = "w"
+	msgWrite = "Rewrite the files in place, used by the fmt command"
+
 	nmVerbose  = "verbose"
 	msgVerbose = "Displays more information for many functions that have display output"
 
@@ -106,6 +131,9 @@ var u struct {
 	// profile - file name to use for profile data
 	profile string
 
+	// cover - file name for lcov coverage data, the HTML report gets the .html extension
+	cover string
+
 	// log - file name to use for logging
 	log string
 
@@ -136,6 +164,9 @@ var u struct {
 	// q - (quiet) hide program output
 	q bool
 
+	// strict - run Q scripts in strict mode
+	strict bool
+
 	// verbose - display more information for many functions that have display output
 	verbose bool
 
@@ -145,6 +176,52 @@ var u struct {
 	// debug - show debug output on log
 	debug bool
 
+	// out - output file name used by the compile command
+	out string
+
+	// compile - not real flag option - indicates compile mode
+	//   q compile [-o out.qc] file.q ...
+	compile bool
+
+	// fn - name of the proc to list, used by the disasm command
+	fn string
+
+	// port - TCP port the dap command listens on, 0 for stdio
+	port int
+
+	// dap - not real flag option - indicates debug adapter mode
+	//   q dap [-port n]
+	dap bool
+
+	// lsp - not real flag option - indicates language server mode
+	//   q lsp
+	lsp bool
+
+	// json - write JSON output, used by the disasm and lint commands
+	json bool
+
+	// lint - not real flag option - indicates lint mode
+	//   q lint file.q ... [-json]
+	lint bool
+
+	// write - rewrite the files in place, used by the fmt command
+	write bool
+
+	// diff - show the changes as a diff, used by the fmt command
+	diff bool
+
+	// format - not real flag option - indicates fmt mode
+	//   q fmt [-w | -d] [file.q ...]
+	format bool
+
+	// disasm - not real flag option - indicates disassemble mode
+	//   q disasm file.q [-func name] [-json]
+	disasm bool
+
+	// debugger - not real flag option - indicates debug mode
+	//   q debug file.q [script-args]
+	debugger bool
+
 	// run - not real flag option - indicates run mode
 	// Can be in any style from- q [run] [-pgm fn] [fn.oa]	  For example:
 	//   q run test.oa
@@ -159,6 +236,7 @@ var (
 	status  int           = RCOK
 	oaArgs  []string      // q args before -- arg
 	scrArgs []string      // script args after -- arg
+	cmdArgs []string      // file name args of a sub command
 
 	log zerolog.Logger
 )
@@ -172,7 +250,14 @@ func init() {
 	flgs.StringVar(&u.exec, nmExec, "", msgExec)              // string of OA language statements to execute directly
 	flgs.StringVar(&u.lib, nmLib, "", msgLib)                 // OA library file name to access
 	flgs.StringVar(&u.profile, nmProfile, "", msgProfile)     // file name to use for profile data
+	flgs.StringVar(&u.cover, nmCover, "", msgCover)           // file name for lcov coverage data
 	flgs.StringVar(&u.log, nmLog, "", msgLog)                 // file name to use for logging
+	flgs.StringVar(&u.out, nmOut, "", msgOut)                 // output file name used by the compile command
+	flgs.StringVar(&u.fn, nmFunc, "", msgFunc)                // name of the proc to list, used by the disasm command
+	flgs.BoolVar(&u.json, nmJSON, false, msgJSON)             // write JSON output, used by the disasm and lint commands
+	flgs.IntVar(&u.port, nmPort, 0, msgPort)                  // TCP port of the dap command, 0 for stdio
+	flgs.BoolVar(&u.write, nmWrite, false, msgWrite)          // rewrite the files in place, used by the fmt command
+	flgs.BoolVar(&u.diff, nmDiff, false, msgDiff)             // show the changes as a diff, used by the fmt command
 	flgs.StringVar(&u.name, nmName, NAME, msgName)            // name used as tag for logging and internal ref _NAME
 	flgs.IntVar(&u.limit, nmLimit, MEMDFLT, msgLimit)         // sets a memory size limit for the executing OA program
 	flgs.IntVar(&u.loq, nmLoquacity, LOQUACITY, msgLoquacity) // level of INFO messages to log 0=low .. 9=high
@@ -188,6 +273,7 @@ func init() {
 	flgs.BoolVar(&u.v, nmV, false, msgVersion)             // display version then exit
 	flgs.BoolVar(&u.v, nmVersion, false, msgVersion)       //  "
 	flgs.BoolVar(&u.q, nmQuiet, false, msgQuiet)           // hide program output
+	flgs.BoolVar(&u.strict, nmStrict, false, msgStrict)    // run Q scripts in strict mode
 	flgs.BoolVar(&u.debug, nmDebug, false, msgDebug)       // show additional debugging information
 
 	flgs.Usage = func() {
@@ -231,6 +317,20 @@ func Main() int {
 			u.run = true
 		} else if subCmd == "int" {
 			u.inter = true
+		} else if subCmd == "compile" {
+			u.compile = true
+		} else if subCmd == "disasm" {
+			u.disasm = true
+		} else if subCmd == "debug" {
+			u.debugger = true
+		} else if subCmd == "dap" {
+			u.dap = true
+		} else if subCmd == "lsp" {
+			u.lsp = true
+		} else if subCmd == "lint" {
+			u.lint = true
+		} else if subCmd == "fmt" {
+			u.format = true
 		} else {
 			subCmd = ""
 		}
@@ -281,6 +381,13 @@ func Main() int {
 			if len(oaArgs) >= 2 {
 				flgs.Parse(oaArgs[2:]) // extract all additional -options
 			}
+		} else if subCmd == "compile" || subCmd == "disasm" || subCmd == "lint" || subCmd == "fmt" { // file names and -options in any order
+			cmdArgs = parseCmdArgs(oaArgs[2:])
+		} else if subCmd == "debug" { // script file then its args
+			if len(oaArgs) > 2 {
+				u.pgm = oaArgs[2]
+				scrArgs = append(oaArgs[3:len(oaArgs):len(oaArgs)], scrArgs...)
+			}
 		} else { // got subcmd - check for -options
 			if subCmd == "run" {
 				if !strings.HasPrefix(oaArgs[2], "-") {
@@ -347,6 +454,32 @@ func Main() int {
 		os.Exit(RCOK)
 	}
 
+	if u.compile {
+		return compileFiles(cmdArgs, u.out)
+	}
+	if u.disasm {
+		return disasmFiles(cmdArgs, u.fn, u.json)
+	}
+	if u.debugger {
+		if len(u.pgm) == 0 {
+			log.Error().Msg("No Q program file to debug")
+			return RCERROR
+		}
+		return debugScript(u.pgm, scrArgs)
+	}
+	if u.dap {
+		return serveDAP(u.port)
+	}
+	if u.lsp {
+		return serveLSP()
+	}
+	if u.lint {
+		return lintFiles(cmdArgs, u.json)
+	}
+	if u.format {
+		return formatFiles(cmdArgs, u.write, u.diff)
+	}
+
 	// set up logging
 	// Default level for this example is info, unless debug flag is present
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -355,24 +488,46 @@ func Main() int {
 	// allow a formatted stacktrace
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 
-	// is OA program profiling required
-	if len(u.profile) != 0 { // do profiling on OA code?
+	L := qs.NewState()
+	defer L.Close()
+
+	// is Q program profiling required
+	if len(u.profile) != 0 {
 		prof, err := os.Create(u.profile)
 		if err != nil {
 			log.Error().Err(err).
 				Msg("Profile open error")
 			return RCERROR
 		}
-		pprof.StartCPUProfile(prof)
-		defer pprof.StopCPUProfile()
+		L.StartProfiler(0)
+		defer func() {
+			if err := L.StopProfiler().Write(prof); err != nil {
+				log.Error().Err(err).
+					Msg("Profile write error")
+			}
+			prof.Close()
+		}()
+	}
+	// is Q program line coverage required
+	if len(u.cover) != 0 {
+		L.StartCoverage()
+		defer func() {
+			if err := writeCoverage(L.StopCoverage(), u.cover); err != nil {
+				log.Error().Err(err).
+					Msg("Coverage write error")
+			}
+		}()
 	}
 
-	L := qs.NewState()
-	defer L.Close()
 	// optionally set memory limit in MB
 	if u.limit > 0 {
 		log.Debug().Msgf("Set memory limit: %d", u.limit)
-		L.SetMx(u.limit)
+		L.SetMemoryLimit(int64(u.limit) * 1024 * 1024)
+	}
+
+	// optionally load the Q scripts in strict mode
+	if u.strict {
+		L.SetStrict()
 	}
 
 	// display version information if requested or interactive
@@ -473,6 +628,103 @@ func Main() int {
 	return RCOK
 }
 
+// parseCmdArgs - parses -options mixed with the file name args of a sub
+// command, returning the file names
+func parseCmdArgs(args []string) []string {
+	var names []string
+	for {
+		flgs.Parse(args)
+		if flgs.NArg() == 0 {
+			return names
+		}
+		names = append(names, flgs.Arg(0))
+		args = flgs.Args()[1:]
+	}
+}
+
+// compileFiles - compiles each Q source file to a precompiled .qc file,
+// out names the output file when a single source is compiled
+func compileFiles(names []string, out string) int {
+	if len(names) == 0 {
+		log.Error().Msg("No Q program file to compile")
+		return RCERROR
+	}
+	if len(out) > 0 && len(names) > 1 {
+		log.Error().Msgf("-%s can only be used when compiling a single file", nmOut)
+		return RCERROR
+	}
+	rc := RCOK
+	for _, name := range names {
+		qcname := out
+		if len(qcname) == 0 {
+			qcname = strings.TrimSuffix(name, EXTN) + qs.QcExtension
+		}
+		if err := compileFile(name, qcname); err != nil {
+			log.Error().Str("pgm", name).Err(err).
+				Msgf("Q script compile error %v", err)
+			rc = RCERROR
+		}
+	}
+	return rc
+}
+
+// compileFile - compiles the Q source file name and writes it to qcname
+func compileFile(name, qcname string) error {
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	proto, err := qs.CompileSource(src, name)
+	if err != nil {
+		return err
+	}
+	qcfile, err := os.Create(qcname)
+	if err != nil {
+		return err
+	}
+	if err = qs.DumpProto(qcfile, proto); err != nil {
+		qcfile.Close()
+		return err
+	}
+	return qcfile.Close()
+}
+
+// disasmFiles - writes the annotated disassembly of each Q source or .qc
+// file to stdout, only the proc fn when it is named
+func disasmFiles(names []string, fn string, asJSON bool) int {
+	if len(names) == 0 {
+		log.Error().Msg("No Q program file to disassemble")
+		return RCERROR
+	}
+	for _, name := range names {
+		proto, err := qs.LoadProto(name)
+		if err != nil {
+			log.Error().Str("pgm", name).Err(err).
+				Msgf("Q script compile error %v", err)
+			return RCERROR
+		}
+		dp := qs.Disassemble(proto, "main")
+		if len(fn) > 0 {
+			if dp = dp.Find(fn); dp == nil {
+				log.Error().Str("pgm", name).
+					Msgf("No proc named %s in %s", fn, name)
+				return RCERROR
+			}
+		}
+		if asJSON {
+			data, err := json.MarshalIndent(dp, "", "  ")
+			if err != nil {
+				log.Error().Err(err).Msg("JSON output error")
+				return RCERROR
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Print(dp.Text(nil))
+		}
+	}
+	return RCOK
+}
+
 // do read/eval/print/loop
 func doREPL(L *qs.LState) {
 	reader := bufio.NewReader(os.Stdin)
@@ -528,3 +780,32 @@ func multiline(ml string, reader *bufio.Reader, L *qs.LState) (string, error) {
 		}
 	}
 }
+
+// writeCoverage - writes the lcov coverage data to path, and the HTML report
+// to path with its extension replaced by .html
+func writeCoverage(cover *qs.Coverage, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := cover.WriteLcov(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	report := strings.TrimSuffix(path, filepath.Ext(path)) + ".html"
+	if report == path {
+		report = path + ".html"
+	}
+	file, err = os.Create(report)
+	if err != nil {
+		return err
+	}
+	if err := cover.WriteHTML(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
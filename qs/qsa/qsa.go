@@ -6,11 +6,23 @@ type PositionHolder interface {
 	SetLine(int)
 	LastLine() int
 	SetLastLine(int)
+	Column() int
+	SetColumn(int)
+	LastColumn() int
+	SetLastColumn(int)
+	SetPos(Position)
+	SetEnd(Position)
+	SetSpan(first, last PositionHolder)
 }
 
+// Node - the source span of a statement or expression, from the line and
+// column of its first character to the line and column of its last one.
+// Columns are byte offsets in the line starting at 1, 0 when not known.
 type Node struct {
-	line     int
-	lastline int
+	line       int
+	lastline   int
+	column     int
+	lastcolumn int
 }
 
 func (self *Node) Line() int {
@@ -28,3 +40,39 @@ func (self *Node) LastLine() int {
 func (self *Node) SetLastLine(line int) {
 	self.lastline = line
 }
+
+func (self *Node) Column() int {
+	return self.column
+}
+
+func (self *Node) SetColumn(column int) {
+	self.column = column
+}
+
+func (self *Node) LastColumn() int {
+	return self.lastcolumn
+}
+
+func (self *Node) SetLastColumn(column int) {
+	self.lastcolumn = column
+}
+
+// SetPos - sets the start of the node to pos, the start of a token
+func (self *Node) SetPos(pos Position) {
+	self.line = pos.Line
+	self.column = pos.Column
+}
+
+// SetEnd - sets the end of the node to pos, the end of a token
+func (self *Node) SetEnd(pos Position) {
+	self.lastline = pos.Line
+	self.lastcolumn = pos.Column
+}
+
+// SetSpan - sets the node to span from the start of first to the end of last
+func (self *Node) SetSpan(first, last PositionHolder) {
+	self.line = first.Line()
+	self.column = first.Column()
+	self.lastline = last.LastLine()
+	self.lastcolumn = last.LastColumn()
+}
@@ -59,6 +59,11 @@ type IdentExpr struct {
 	Value string
 }
 
+// SuperExpr - the class a class method is declared in extends
+type SuperExpr struct {
+	ExprBase
+}
+
 type AttrGetExpr struct {
 	ExprBase
 
@@ -79,6 +84,7 @@ type FuncCallExpr struct {
 	Receiver  Expr
 	Method    string
 	Args      []Expr
+	Named     []*NamedArg // the named arguments, after Args
 	AdjustRet bool
 }
 
@@ -105,6 +111,24 @@ type StringConcatOpExpr struct {
 	Rhs Expr
 }
 
+// FStringExpr - an interpolated string, f"...", the concatenation of its
+// Parts, which are literal StringExprs and embedded FStringValues
+type FStringExpr struct {
+	ExprBase
+
+	Parts []Expr
+}
+
+// FStringValue - an expression embedded in an f-string, {expr}, converted
+// to a string with its __tostring metamethod, or by string.format with
+// Format, like "%.2f", when it is {expr:%.2f}
+type FStringValue struct {
+	ExprBase
+
+	Expr   Expr
+	Format string
+}
+
 type ArithmeticOpExpr struct {
 	ExprBase
 
@@ -128,6 +152,11 @@ type UnaryLenOpExpr struct {
 	Expr Expr
 }
 
+type UnaryBNotOpExpr struct {
+	ExprBase
+	Expr Expr
+}
+
 type ProcExpr struct {
 	ExprBase
 
@@ -9,6 +9,47 @@ type Field struct {
 type ParList struct {
 	HasVargs bool
 	Names    []string
+	Defaults []Expr // the default values of Names, nil for a name without one
+}
+
+// Default - returns the default value of parameter i, nil when it has none
+func (pl *ParList) Default(i int) Expr {
+	if i < len(pl.Defaults) {
+		return pl.Defaults[i]
+	}
+	return nil
+}
+
+// NamedArg - an argument of a proc call given for the parameter Name
+type NamedArg struct {
+	Node
+
+	Name  string
+	Value Expr
+}
+
+// Pattern - a destructuring pattern of a dcl statement or for variable,
+// {key, key = name, ...rest} loads the fields of a list by key and
+// [name, name, ...rest] loads its elements by position
+type Pattern struct {
+	Node
+
+	Positional bool
+	Keys       []string // the keys of the fields loaded into Names, nil when Positional
+	Names      []string
+	Rest       string // the name of the list of the other fields or elements, or ""
+}
+
+// PatternName - the name of the hidden variable that holds the list a
+// Pattern is loaded from
+const PatternName = "(pattern)"
+
+// ClassMethod - a proc of a class, called with the object as self
+type ClassMethod struct {
+	Node
+
+	Name string
+	Func *ProcExpr
 }
 
 type FuncName struct {
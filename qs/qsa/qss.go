@@ -19,9 +19,30 @@ type AssignStmt struct {
 	Rhs []Expr
 }
 
+// CompoundAssignStmt - assigns Lhs the result of the arithmetic or
+// concatenation Operator applied to Lhs and Rhs, like Lhs += Rhs
+type CompoundAssignStmt struct {
+	StmtBase
+
+	Lhs      Expr
+	Operator string
+	Rhs      Expr
+}
+
 type LocalAssignStmt struct {
 	StmtBase
 
+	Names    []string
+	Exprs    []Expr
+	Patterns []*Pattern // the pattern of each name, nil for a plain name
+	Close    bool       // the <close> attribute, the __close of the value is called when the block ends
+}
+
+// GlobalStmt - declares the global names, for strict mode, and assigns
+// them the values of Exprs when there are any
+type GlobalStmt struct {
+	StmtBase
+
 	Names []string
 	Exprs []Expr
 }
@@ -60,6 +81,61 @@ type IfStmt struct {
 	Else      []Stmt
 }
 
+// SwitchStmt - runs the statements of the first case with a value equal
+// to Subject, or the Else statements when there is none
+type SwitchStmt struct {
+	StmtBase
+
+	Subject Expr
+	Cases   []*SwitchCase
+	Else    []Stmt
+}
+
+// DeferStmt - calls Expr when the proc ends, with the proc and the
+// arguments evaluated by the statement
+type DeferStmt struct {
+	StmtBase
+
+	Expr Expr
+}
+
+// ClassStmt - assigns Name a class with the Methods, that extends the
+// class Base when it is not nil
+type ClassStmt struct {
+	StmtBase
+
+	Name    *IdentExpr
+	Base    Expr
+	Methods []*ClassMethod
+}
+
+// TryStmt - runs Stmts, and the Catch statements when they raise an error,
+// the Finally statements run however the others are left
+type TryStmt struct {
+	StmtBase
+
+	Stmts   []Stmt
+	Catch   *TryClause // nil when there is no catch
+	Finally *TryClause // nil when there is no finally
+}
+
+// TryClause - the catch or finally of a try statement, its span is from
+// catch to then, or that of finally, Name is the error of a catch
+type TryClause struct {
+	Node
+
+	Name  string
+	Stmts []Stmt
+}
+
+// SwitchCase - a case of a switch statement, its span is from case to then
+type SwitchCase struct {
+	Node
+
+	Values []Expr
+	Stmts  []Stmt
+}
+
 type NumberForStmt struct {
 	StmtBase
 
@@ -73,9 +149,10 @@ type NumberForStmt struct {
 type GenericForStmt struct {
 	StmtBase
 
-	Names []string
-	Exprs []Expr
-	Stmts []Stmt
+	Names    []string
+	Exprs    []Expr
+	Patterns []*Pattern // the pattern of each name, nil for a plain name
+	Stmts    []Stmt
 }
 
 type FuncDefStmt struct {
@@ -94,3 +171,7 @@ type ReturnStmt struct {
 type BreakStmt struct {
 	StmtBase
 }
+
+type ContinueStmt struct {
+	StmtBase
+}
@@ -2,7 +2,10 @@
 package qsa
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 )
 
 type Position struct {
@@ -11,13 +14,88 @@ type Position struct {
 	Column int
 }
 
+// Token - a token of the source, Pos is the position of its first
+// character and End the position of its last one
 type Token struct {
 	Type int
 	Name string
 	Str  string
 	Pos  Position
+	End  Position
 }
 
 func (self *Token) String() string {
 	return fmt.Sprintf("<type:%v, str:%v>", self.Name, self.Str)
 }
+
+// Comment - a comment of the source with its // /* */ or #! marks, Pos is
+// the position of its first character and End the position of its last one
+type Comment struct {
+	Text string
+	Pos  Position
+	End  Position
+}
+
+// Excerpt - returns the source text of line number line with carets under
+// its columns first to last, like
+//
+//	3 | dcl x = y + 1
+//	  |         ^^^^^
+//
+// Without a first column only the line is returned. Tabs of the line are
+// kept in front of the carets so they line up.
+func Excerpt(line int, text string, first, last int) string {
+	text = strings.TrimRight(text, "\r\n")
+	num := fmt.Sprintf("%5d | ", line)
+	if first < 1 {
+		return num + text
+	}
+	if first > len(text)+1 {
+		first = len(text) + 1
+	}
+	if last < first {
+		last = first
+	}
+	if last > len(text) && last > first {
+		last = len(text)
+	}
+	var caret strings.Builder
+	caret.WriteString(strings.Repeat(" ", len(num)-2) + "| ")
+	// the columns count bytes, the carets are written under the runes
+	for _, r := range text[:first-1] {
+		if r == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	end := last
+	if end > len(text) {
+		end = len(text)
+	}
+	n := utf8.RuneCountInString(text[first-1 : end])
+	if n < 1 {
+		n = 1
+	}
+	caret.WriteString(strings.Repeat("^", n))
+	return num + text + "\n" + caret.String()
+}
+
+// SourceLine - returns line number line of the source src, or "" when it
+// has no such line
+func SourceLine(src []byte, line int) string {
+	for n := 1; len(src) > 0; n++ {
+		end := len(src)
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			end = i
+		}
+		if n == line {
+			return strings.TrimRight(string(src[:end]), "\r")
+		}
+		if end == len(src) {
+			break
+		}
+		src = src[end+1:]
+	}
+	return ""
+}
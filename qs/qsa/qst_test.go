@@ -0,0 +1,26 @@
+package qsa
+
+import (
+	"testing"
+)
+
+// TestExcerpt - the carets are under the columns of the excerpt, counted in
+// runes, with the tabs of the line kept
+func TestExcerpt(t *testing.T) {
+	for _, c := range []struct {
+		text        string
+		first, last int
+		want        string
+	}{
+		{"dcl x = y + 1", 9, 13, "    3 | dcl x = y + 1\n      |         ^^^^^"},
+		{`put("héllo", x.y)`, 15, 17, "    3 | put(\"héllo\", x.y)\n      |              ^^^"},
+		{`put("héllo")`, 5, 12, "    3 | put(\"héllo\")\n      |     ^^^^^^^"},
+		{"\tx = y", 6, 6, "    3 | \tx = y\n      | \t    ^"},
+		{"x = ", 5, 5, "    3 | x = \n      |     ^"},
+		{"x = 1", 0, 0, "    3 | x = 1"},
+	} {
+		if got := Excerpt(3, c.text, c.first, c.last); got != c.want {
+			t.Errorf("Excerpt(%q, %d, %d) =\n%s\nwant\n%s", c.text, c.first, c.last, got, c.want)
+		}
+	}
+}
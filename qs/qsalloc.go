@@ -27,6 +27,9 @@ type allocator struct {
 	fheader     *reflect.SliceHeader
 	itabLNumber unsafe.Pointer
 	preloads    [int(preloadLimit)]LValue
+	itabLInt    unsafe.Pointer
+	ipreloads   [int(preloadLimit)]LValue
+	mem         *memBudget
 }
 
 func newAllocator(size int) *allocator {
@@ -48,13 +51,17 @@ func newAllocator(size int) *allocator {
 	for i := 0; i < int(preloadLimit); i++ {
 		al.preloads[i] = LNumber(i)
 	}
+	var iv LValue = LInteger(0)
+	ivp := (*iface)(unsafe.Pointer(&iv))
+	al.itabLInt = ivp.itab
+	for i := 0; i < int(preloadLimit); i++ {
+		al.ipreloads[i] = LInteger(i)
+	}
 	return al
 }
 
-func (al *allocator) LNumber2I(v LNumber) LValue {
-	if v >= 0 && v < preloadLimit && float64(v) == float64(int64(v)) {
-		return al.preloads[int(v)]
-	}
+// next - returns the next free interface and its 8 byte value slot
+func (al *allocator) next() (LValue, unsafe.Pointer) {
 	if al.top == len(al.nptrs)-1 {
 		al.top = 0
 		al.nptrs = make([]LValue, al.size)
@@ -62,13 +69,196 @@ func (al *allocator) LNumber2I(v LNumber) LValue {
 		al.fptrs = make([]float64, al.size)
 		al.fheader = (*reflect.SliceHeader)(unsafe.Pointer(&al.fptrs))
 	}
-	fptr := (*float64)(unsafe.Pointer(al.fheader.Data + uintptr(al.top)*unsafe.Sizeof(_fv)))
+	fptr := unsafe.Pointer(al.fheader.Data + uintptr(al.top)*unsafe.Sizeof(_fv))
 	e := *(*LValue)(unsafe.Pointer(al.nheader.Data + uintptr(al.top)*unsafe.Sizeof(_uv)))
 	al.top++
+	return e, fptr
+}
 
+func (al *allocator) LNumber2I(v LNumber) LValue {
+	if v >= 0 && v < preloadLimit && float64(v) == float64(int64(v)) {
+		return al.preloads[int(v)]
+	}
+	e, ptr := al.next()
 	ep := (*iface)(unsafe.Pointer(&e))
 	ep.itab = al.itabLNumber
-	*fptr = float64(v)
-	ep.word = unsafe.Pointer(fptr)
+	*(*float64)(ptr) = float64(v)
+	ep.word = ptr
 	return e
 }
+
+func (al *allocator) LInteger2I(v LInteger) LValue {
+	if v >= 0 && v < LInteger(preloadLimit) {
+		return al.ipreloads[int(v)]
+	}
+	e, ptr := al.next()
+	ep := (*iface)(unsafe.Pointer(&e))
+	ep.itab = al.itabLInt
+	*(*int64)(ptr) = int64(v)
+	ep.word = ptr
+	return e
+}
+
+// approximate sizes, in bytes, charged to a memory budget
+const (
+	memSlotSize  = 16  // one LValue in an array part or the registry
+	memEntrySize = 48  // one key and value in a hash part
+	memListSize  = 96  // an empty list
+	memProcSize  = 64  // a closure, without its upvalues
+	memFrameSize = 80  // one call stack frame
+	memStrShared = 256 // strings at least this long are counted once
+)
+
+// memBudget - memory accounting shared by a state and its coroutines. Sizes
+// are charged as lists, strings and states grow; when the charges pass the
+// limit the reachable values are measured and an error is raised if they
+// are still over it.
+type memBudget struct {
+	ls    *LState // main thread, the measurement starts from its globals
+	limit int64   // bytes, 0 means no limit
+	used  int64   // last measured size plus the charges since then
+	since int64   // charges since the last measurement
+}
+
+// account - charges n bytes to the memory budget of this allocator
+func (al *allocator) account(n int) {
+	if al == nil || al.mem == nil {
+		return
+	}
+	m := al.mem
+	if prof := m.ls.G.prof; prof != nil {
+		L := m.ls.G.CurrentThread
+		if L == nil {
+			L = m.ls
+		}
+		prof.allocated(L, n)
+	}
+	if m.limit == 0 {
+		return
+	}
+	m.used += int64(n)
+	m.since += int64(n)
+	// measuring walks every reachable value, so after a measurement allow a
+	// quarter of the limit to be charged before measuring again
+	if m.used <= m.limit || m.since < m.limit/4 {
+		return
+	}
+	// the charge is for memory that is not reachable yet
+	m.since = 0
+	m.used = m.ls.memoryInUse() + int64(n)
+	if m.used > m.limit {
+		L := m.ls.G.CurrentThread
+		if L == nil {
+			L = m.ls
+		}
+		L.raiseMemoryError(m.limit)
+	}
+}
+
+// newString - returns s, a string made by a builtin or an instruction, after
+// charging its bytes to the memory budget
+func (ls *LState) newString(s string) LString {
+	ls.alloc.account(len(s))
+	return LString(s)
+}
+
+// memWalker - sums the sizes of the values reachable from its roots
+type memWalker struct {
+	seen    map[LValue]bool
+	strings map[uintptr]bool
+	todo    []LValue
+	total   int64
+}
+
+func (w *memWalker) value(lv LValue) {
+	switch v := lv.(type) {
+	case LString:
+		if len(v) >= memStrShared {
+			data := (*reflect.StringHeader)(unsafe.Pointer(&v)).Data
+			if w.strings[data] {
+				return
+			}
+			w.strings[data] = true
+		}
+		w.total += int64(len(v))
+	case *LOAList, *LProc, *LUserData, *LState:
+		if !w.seen[lv] {
+			w.seen[lv] = true
+			w.todo = append(w.todo, lv)
+		}
+	}
+}
+
+func (w *memWalker) walk() int64 {
+	for len(w.todo) > 0 {
+		lv := w.todo[len(w.todo)-1]
+		w.todo = w.todo[:len(w.todo)-1]
+		switch v := lv.(type) {
+		case *LOAList:
+			w.total += memListSize + int64(cap(v.array)+len(v.keys))*memSlotSize
+			w.total += int64(len(v.strdict)+len(v.dict)) * memEntrySize
+			w.value(v.Metalist)
+			for _, elem := range v.array {
+				w.value(elem)
+			}
+			for key, elem := range v.strdict {
+				w.total += int64(len(key))
+				w.value(elem)
+			}
+			for key, elem := range v.dict {
+				w.value(key)
+				w.value(elem)
+			}
+		case *LProc:
+			w.total += memProcSize + int64(len(v.Upvalues))*memSlotSize
+			if v.Env != nil {
+				w.value(v.Env)
+			}
+			for _, uv := range v.Upvalues {
+				if uv != nil {
+					w.value(uv.Value())
+				}
+			}
+		case *LUserData:
+			w.total += memListSize
+			w.value(v.Metalist)
+			if v.Env != nil {
+				w.value(v.Env)
+			}
+		case *LState:
+			w.total += int64(len(v.reg.array))*memSlotSize + int64(len(v.stack.array))*memFrameSize
+			if v.Env != nil {
+				w.value(v.Env)
+			}
+			for _, elem := range v.reg.array[:v.reg.top] {
+				w.value(elem)
+			}
+			for i := 0; i < v.stack.Sp(); i++ {
+				if fn := v.stack.At(i).Fn; fn != nil {
+					w.value(fn)
+				}
+			}
+		}
+	}
+	return w.total
+}
+
+// memoryInUse - measures the memory reachable from the globals, registry and
+// threads of this state
+func (ls *LState) memoryInUse() int64 {
+	w := &memWalker{seen: make(map[LValue]bool), strings: make(map[uintptr]bool)}
+	main := ls
+	if ls.G.MainThread != nil {
+		main = ls.G.MainThread
+	}
+	w.value(main)
+	w.value(ls.G.Registry)
+	w.value(ls.G.Global)
+	if ls.G.CurrentThread != nil {
+		w.value(ls.G.CurrentThread)
+	}
+	for _, mt := range ls.G.builtinMts {
+		w.value(mt)
+	}
+	return w.walk()
+}
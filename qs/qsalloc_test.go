@@ -0,0 +1,57 @@
+package qs
+
+import (
+	"testing"
+)
+
+// memLimitScripts - scripts making strings that grow past a limit of
+// 100000 bytes, by the path that makes them
+var memLimitScripts = map[string]string{
+	"concat op": `dcl s = rep("x", 1000)
+for i = 1, 12 do s = s .. s end`,
+	"rep": `dcl s = rep("x", 10000000)`,
+	"format": `dcl s = rep("x", 1000)
+for i = 1, 12 do s = format("%s%s", s, s) end`,
+	"gsub": `dcl s = rep("x", 1000)
+for i = 1, 12 do s = gsub(s, "x", "xx") end`,
+	"list concat": `dcl s = rep("x", 1000)
+for i = 1, 12 do s = concat({s, s}) end`,
+	"marshal": `dcl s = rep("x", 1000)
+for i = 1, 12 do s = marshal({s, s}) end`,
+	"f-string": `dcl t = {}
+for i = 1, 100 do t[i] = f"{i:%100000d}" end`,
+	"f-string concat": `dcl s = rep("x", 1000)
+for i = 1, 12 do s = f"{s}{s}" end`,
+}
+
+// TestMemoryLimitStrings - every way of making a string is charged to the
+// memory limit
+func TestMemoryLimitStrings(t *testing.T) {
+	for name, script := range memLimitScripts {
+		L := NewState()
+		L.SetMemoryLimit(100000)
+		err := L.DoString(script)
+		if aerr, ok := err.(*ApiError); !ok || aerr.Type != ApiErrorMemory {
+			t.Errorf("%s: error %v, want not enough memory", name, err)
+		}
+		L.Close()
+	}
+}
+
+// TestMemoryLimitCaught - the memory error can be caught by pcall and the
+// script goes on once the memory is released
+func TestMemoryLimitCaught(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetMemoryLimit(100000)
+	err := L.DoString(`dcl ok, err = pcall(proc()
+  dcl s = "x"
+  while true do s = format("%s%s", s, s) end
+end)
+assert(not ok and find(err, "not enough memory"), err)
+dcl s = rep("y", 1000)
+assert(#s == 1000)`)
+	if err != nil {
+		t.Errorf("DoString: %v", err)
+	}
+}
@@ -23,6 +23,9 @@ var (
 	CallStackSize    int    = 256
 	MaxOAListGetLoop int    = 100
 	MaxArrayIndex    int    = 67108864
+	ContextGrace     int    = 10000                 // instructions a canceled script may run to handle the error
+	ProfilePeriod           = 10 * time.Millisecond // default sampling period of StartProfiler
+	ProfileAllocRate int    = 512 * 1024            // bytes allocated between allocation samples
 	QsPath           string = "QS_PATH"
 	QsLDir           string
 	QsPathDefault    string
@@ -0,0 +1,70 @@
+// Package qs - q scripting language
+package qs
+
+import "strings"
+
+// makeClass - makes the list of the methods of a class statement the
+// class, the metalist of its objects, that extends the class base when
+// extends is true. The metalist of the class finds the methods of base
+// and makes the objects, the metamethods of base are copied as they are
+// not found through __index.
+func (ls *LState) makeClass(cls *LOAList, base LValue, extends bool) {
+	mt := ls.NewOAList()
+	if extends {
+		bcls, ok := base.(*LOAList)
+		if !ok {
+			ls.RaiseError("attempt to extend a non-list object(%v)", base.Type().String())
+		}
+		bcls.ForEach(func(key, value LValue) {
+			if s, ok := key.(LString); ok && strings.HasPrefix(string(s), "__") && s != "__index" {
+				if cls.RawGetString(string(s)) == LNil {
+					cls.RawSetString(string(s), value)
+				}
+			}
+		})
+		mt.RawSetString("__index", bcls)
+	}
+	cls.RawSetString("__index", cls)
+	if ls.G.classNew == nil {
+		ls.G.classNew = ls.NewProc(classNew)
+	}
+	mt.RawSetString("__call", ls.G.classNew)
+	ls.SetMetalist(cls, mt)
+}
+
+// classNew - the __call of a class, returns a new object of the class
+// after calling its init method, when it has one, with the arguments
+func classNew(L *LState) int {
+	cls := L.CheckOAList(1)
+	obj := L.NewOAList()
+	L.SetMetalist(obj, cls)
+	if init := L.GetField(cls, "init"); init != LNil {
+		nargs := L.GetTop() - 1
+		L.Push(init)
+		L.Push(obj)
+		for i := 2; i <= nargs+1; i++ {
+			L.Push(L.Get(i))
+		}
+		L.Call(nargs+1, 0)
+	}
+	L.Push(obj)
+	return 1
+}
+
+// instanceOf - reports whether lv is an object of the class cls, or of a
+// class that extends it
+func (ls *LState) instanceOf(lv LValue, cls *LOAList) bool {
+	seen := map[*LOAList]bool{}
+	for c, ok := ls.GetMetalist(lv).(*LOAList); ok && !seen[c]; {
+		if c == cls {
+			return true
+		}
+		seen[c] = true
+		mt, isList := ls.GetMetalist(c).(*LOAList)
+		if !isList {
+			return false
+		}
+		c, ok = mt.RawGetString("__index").(*LOAList)
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package qs
+
+import (
+	"testing"
+)
+
+const accountClasses = `class Account
+  proc init(owner, balance = 0)
+    self.owner = owner
+    self.balance = balance
+  end
+  proc deposit(n) self.balance += n return self end
+  proc __tostring() return f"{self.owner}: {self.balance}" end
+  proc __eq(other) return self.balance == other.balance end
+end
+class Savings extends Account
+  proc init(owner, rate)
+    super(owner)
+    self.rate = rate
+  end
+  proc deposit(n) return super.deposit(n * (1 + self.rate)) end
+end
+`
+
+// TestClasses - objects are made by calling their class, get its methods and
+// metamethods, and a class that extends another calls it with super
+func TestClasses(t *testing.T) {
+	checkScript(t, "objects", accountClasses+`dcl a = Account("ford", 42)
+assert(a.owner == "ford" and a.balance == 42)
+assert(a:deposit(8).balance == 50)
+assert(tostring(a) == "ford: 50", tostring(a))
+assert(getmetalist(a) == Account and instanceof(a, Account))`, "")
+	checkScript(t, "inheritance", accountClasses+`dcl s = Savings("arthur", 0.5):deposit(28)
+assert(s.balance == 42 and s.rate == 0.5)
+assert(tostring(s) == "arthur: 42", tostring(s))
+assert(s == Account("ford", 42))
+assert(instanceof(s, Savings) and instanceof(s, Account))
+assert(not instanceof(Account("x"), Savings))`, "")
+	checkScript(t, "super method with colon", `class A proc name() return "a" end end
+class B extends A proc name() return "b" .. super:name() end end
+assert(B():name() == "ba")`, "")
+	checkScript(t, "dcl class", `dcl proc make()
+  dcl Point
+  class Point proc init(x) self.x = x end end
+  return Point
+end
+dcl P = make()
+assert(P(3).x == 3 and Point == nil)`, "")
+	checkScript(t, "super without a base", `class A proc f() return super.f() end end`,
+		"super in class 'A' that extends no class")
+	checkScript(t, "super outside a class", `proc f() return super() end`,
+		"super outside the methods of a class")
+}
@@ -2,12 +2,16 @@
 package qs
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"os"
 	"reflect"
+	"strings"
+	"unicode"
 
 	"github.com/x0ray/q/qs/qsa"
+	"github.com/x0ray/q/qs/qsp"
 )
 
 const maxRegisters = 200
@@ -100,6 +104,14 @@ func raiseCompileError(context *funcContext, line int, format string, args ...in
 	panic(&CompileError{Context: context, Line: line, Message: msg})
 }
 
+// raiseCompileErrorAt - raises a compile error at the statement or
+// expression pos
+func raiseCompileErrorAt(context *funcContext, pos qsa.PositionHolder, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	panic(&CompileError{Context: context, Line: pos.Line(), Column: pos.Column(),
+		LastLine: pos.LastLine(), LastColumn: pos.LastColumn(), Message: msg})
+}
+
 func isVarArgReturnExpr(expr qsa.Expr) bool {
 	switch ex := expr.(type) {
 	case *qsa.FuncCallExpr:
@@ -110,46 +122,102 @@ func isVarArgReturnExpr(expr qsa.Expr) bool {
 	return false
 }
 
-func lnumberValue(expr qsa.Expr) (LNumber, bool) {
+func lnumberValue(expr qsa.Expr) (LValue, bool) {
 	if ex, ok := expr.(*qsa.NumberExpr); ok {
-		lv, err := parseNumber(ex.Value)
+		lv, err := parseNumberValue(ex.Value)
 		if err != nil {
 			lv = LNumber(math.NaN())
 		}
 		return lv, true
 	} else if ex, ok := expr.(*constLValueExpr); ok {
-		return ex.Value.(LNumber), true
+		return ex.Value, true
 	}
-	return 0, false
+	return nil, false
 }
 
+// arithOpcodes - maps arithmetic and bitwise operators onto their opcode
+var arithOpcodes = map[string]int{
+	"+": OP_ADD, "-": OP_SUB, "*": OP_MUL, "/": OP_DIV, "%": OP_MOD, "^": OP_POW,
+	"\\": OP_IDIV, "&": OP_BAND, "|": OP_BOR, "~": OP_BXOR, "<<": OP_SHL, ">>": OP_SHR,
+}
+
+// constArith - folds an arithmetic or bitwise operation on two constant nums,
+// ok is false when the operation must be left to raise its error at run time
+func constArith(opcode int, lhs, rhs LValue) (LValue, bool) {
+	if i1, ok1 := lhs.(LInteger); ok1 {
+		if i2, ok2 := rhs.(LInteger); ok2 {
+			return integerArith(opcode, i1, i2)
+		}
+	}
+	if opcode >= OP_BAND {
+		i1, ok1 := lvToInteger(lhs)
+		i2, ok2 := lvToInteger(rhs)
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		return integerArith(opcode, i1, i2)
+	}
+	return numberArith(nil, opcode, LVAsNumber(lhs), LVAsNumber(rhs)), true
+}
+
+// CompileError - an error compiling the source from Line and Column to
+// LastLine and LastColumn, the columns are 0 when not known. Text is the
+// source line of Line when it is known.
 type CompileError struct {
-	Context *funcContext
-	Line    int
-	Message string
+	Context    *funcContext
+	Line       int
+	Message    string
+	Column     int
+	LastLine   int
+	LastColumn int
+	Text       string
 }
 
 func (e *CompileError) Error() string {
-	return fmt.Sprintf("line (%v) compile error for %v - %v", e.Line, e.Context.Proto.SourceName, e.Message)
+	msg := fmt.Sprintf("line (%v) compile error for %v - %v", e.Line, e.Context.Proto.SourceName, e.Message)
+	if len(e.Text) > 0 {
+		last := len(e.Text)
+		if e.LastLine == e.Line {
+			last = e.LastColumn
+		}
+		msg += "\n" + qsa.Excerpt(e.Line, e.Text, e.Column, last)
+	}
+	return msg
 }
 
 type codeStore struct {
 	codes []uint32
 	lines []int
+	spans []DbgSpan
 	pc    int
+	pos   qsa.PositionHolder // the statement or expression being compiled
 }
 
 func (cd *codeStore) Add(inst uint32, line int) {
+	span := DbgSpan{}
+	if cd.pos != nil && cd.pos.Line() == line {
+		span = DbgSpan{cd.pos.Column(), cd.pos.LastLine(), cd.pos.LastColumn()}
+	}
 	if l := len(cd.codes); l <= 0 || cd.pc == l {
 		cd.codes = append(cd.codes, inst)
 		cd.lines = append(cd.lines, line)
+		cd.spans = append(cd.spans, span)
 	} else {
 		cd.codes[cd.pc] = inst
 		cd.lines[cd.pc] = line
+		cd.spans[cd.pc] = span
 	}
 	cd.pc++
 }
 
+// SetPos - sets the statement or expression whose columns are recorded
+// for the instructions added on its line, returns the one set before
+func (cd *codeStore) SetPos(pos qsa.PositionHolder) qsa.PositionHolder {
+	prev := cd.pos
+	cd.pos = pos
+	return prev
+}
+
 func (cd *codeStore) AddABC(op int, a int, b int, c int, line int) {
 	cd.Add(opCreateABC(op, a, b, c), line)
 }
@@ -233,6 +301,10 @@ func (cd *codeStore) PosList() []int {
 	return cd.lines[:cd.pc]
 }
 
+func (cd *codeStore) SpanList() []DbgSpan {
+	return cd.spans[:cd.pc]
+}
+
 func (cd *codeStore) LastPC() int {
 	return cd.pc - 1
 }
@@ -302,16 +374,30 @@ func (vp *varNamePool) Register(name string) int {
 }
 
 type codeBlock struct {
-	LocalVars  *varNamePool
-	BreakLabel int
-	Parent     *codeBlock
-	RefUpvalue bool
-	LineStart  int
-	LastLine   int
+	LocalVars      *varNamePool
+	BreakLabel     int
+	ContinueLabel  int
+	ContinueLocals int
+	Parent         *codeBlock
+	RefUpvalue     bool
+	LineStart      int
+	LastLine       int
+	DbgLocals      []int                   // indexes of the debug info of the local vars
+	Try            *tryRegion              // the try statement the block is run in, or nil
+	Procs          map[string]*qsa.ParList // the parameters of the local vars declared as procs
+	Class          *qsa.ClassStmt          // the class statement the block declares the methods of, or nil
+}
+
+// tryRegion - the statements of a try statement run with a catch or finally
+// handler in register Reg, Finally is the label of the finally statements
+// of a finally handler, labelNoJump for a catch handler
+type tryRegion struct {
+	Reg     int
+	Finally int
 }
 
 func newCodeBlock(localvars *varNamePool, blabel int, parent *codeBlock, pos qsa.PositionHolder) *codeBlock {
-	bl := &codeBlock{localvars, blabel, parent, false, 0, 0}
+	bl := &codeBlock{localvars, blabel, labelNoJump, -1, parent, false, 0, 0, nil, nil, nil, nil}
 	if pos != nil {
 		bl.LineStart = pos.Line()
 		bl.LastLine = pos.LastLine()
@@ -329,20 +415,31 @@ type funcContext struct {
 	regTop   int
 	labelId  int
 	labelPc  map[int]int
+	strict   *strictMode             // nil when the segment is not in strict mode
+	Defer    int                     // the (defer) register of the proc, -1 when it has no defer statements
+	procs    map[string]*qsa.ParList // the parameters of the global procs defined in the segment
+	assigned map[string]int          // the times each name is assigned in the segment, by any statement
 }
 
 func newFuncContext(sourcename string, parent *funcContext) *funcContext {
 	fc := &funcContext{
 		Proto:    newProcProto(sourcename),
-		Code:     &codeStore{make([]uint32, 0, 1024), make([]int, 0, 1024), 0},
+		Code:     &codeStore{make([]uint32, 0, 1024), make([]int, 0, 1024), make([]DbgSpan, 0, 1024), 0, nil},
 		Parent:   parent,
 		Upvalues: newVarNamePool(0),
 		Block:    newCodeBlock(newVarNamePool(0), labelNoJump, nil, nil),
 		regTop:   0,
 		labelId:  1,
 		labelPc:  map[int]int{},
+		Defer:    -1,
 	}
 	fc.Blocks = []*codeBlock{fc.Block}
+	if parent != nil {
+		fc.strict = parent.strict
+		fc.Proto.Strict = parent.strict != nil
+		fc.procs = parent.procs
+		fc.assigned = parent.assigned
+	}
 	return fc
 }
 
@@ -377,6 +474,7 @@ func (fc *funcContext) ConstIndex(value LValue) int {
 
 func (fc *funcContext) RegisterLocalVar(name string) int {
 	ret := fc.Block.LocalVars.Register(name)
+	fc.Block.DbgLocals = append(fc.Block.DbgLocals, len(fc.Proto.DbgLocals))
 	fc.Proto.DbgLocals = append(fc.Proto.DbgLocals, &DbgLocalInfo{Name: name, StartPc: fc.Code.LastPC() + 1})
 	fc.SetRegTop(fc.RegTop() + 1)
 	return ret
@@ -409,6 +507,11 @@ func (fc *funcContext) EnterBlock(blabel int, pos qsa.PositionHolder) {
 	fc.Blocks = append(fc.Blocks, fc.Block)
 }
 
+func (fc *funcContext) EnterLoopBlock(blabel int, clabel int, pos qsa.PositionHolder) {
+	fc.EnterBlock(blabel, pos)
+	fc.Block.ContinueLabel = clabel
+}
+
 func (fc *funcContext) CloseUpvalues() int {
 	n := -1
 	if fc.Block.RefUpvalue {
@@ -427,8 +530,10 @@ func (fc *funcContext) LeaveBlock() int {
 }
 
 func (fc *funcContext) EndScope() {
-	for _, vr := range fc.Block.LocalVars.List() {
-		fc.Proto.DbgLocals[vr.Index].EndPc = fc.Code.LastPC()
+	// the debug info index of a local differs from its register when
+	// registers of closed blocks are reused
+	for _, i := range fc.Block.DbgLocals {
+		fc.Proto.DbgLocals[i].EndPc = fc.Code.LastPC()
 	}
 }
 
@@ -444,8 +549,12 @@ func (fc *funcContext) RegTop() int {
 }
 
 func compileSeg(context *funcContext, segment []qsa.Stmt) {
-	for _, stmt := range segment {
+	for i, stmt := range segment {
 		compileStmt(context, stmt)
+		if st, ok := stmt.(*qsa.LocalAssignStmt); ok && st.Close {
+			compileCloseRegion(context, st, segment[i+1:])
+			return
+		}
 	}
 }
 
@@ -454,21 +563,23 @@ func compileBlock(context *funcContext, segment []qsa.Stmt) {
 		return
 	}
 	ph := &qsa.Node{}
-	ph.SetLine(sline(segment[0]))
-	ph.SetLastLine(eline(segment[len(segment)-1]))
+	ph.SetSpan(segment[0], segment[len(segment)-1])
 	context.EnterBlock(labelNoJump, ph)
-	for _, stmt := range segment {
-		compileStmt(context, stmt)
-	}
+	compileSeg(context, segment)
 	context.LeaveBlock()
 }
 
 func compileStmt(context *funcContext, stmt qsa.Stmt) {
+	defer context.Code.SetPos(context.Code.SetPos(stmt))
 	switch st := stmt.(type) {
 	case *qsa.AssignStmt:
 		compileAssignStmt(context, st)
+	case *qsa.CompoundAssignStmt:
+		compileCompoundAssignStmt(context, st)
 	case *qsa.LocalAssignStmt:
 		compileLocalAssignStmt(context, st)
+	case *qsa.GlobalStmt:
+		compileGlobalStmt(context, st)
 	case *qsa.FuncCallStmt:
 		compileFuncCallExpr(context, context.RegTop(), st.Expr.(*qsa.FuncCallExpr), ecnone(-1))
 	case *qsa.DoBlockStmt:
@@ -481,12 +592,22 @@ func compileStmt(context *funcContext, stmt qsa.Stmt) {
 		compileRepeatStmt(context, st)
 	case *qsa.FuncDefStmt:
 		compileFuncDefStmt(context, st)
+	case *qsa.ClassStmt:
+		compileClassStmt(context, st)
 	case *qsa.ReturnStmt:
 		compileReturnStmt(context, st)
 	case *qsa.IfStmt:
 		compileIfStmt(context, st)
+	case *qsa.SwitchStmt:
+		compileSwitchStmt(context, st)
+	case *qsa.TryStmt:
+		compileTryStmt(context, st)
+	case *qsa.DeferStmt:
+		compileDeferStmt(context, st)
 	case *qsa.BreakStmt:
 		compileBreakStmt(context, st)
+	case *qsa.ContinueStmt:
+		compileContinueStmt(context, st)
 	case *qsa.NumberForStmt:
 		compileNumberForStmt(context, st)
 	case *qsa.GenericForStmt:
@@ -505,6 +626,7 @@ func compileAssignStmtLeft(context *funcContext, stmt *qsa.AssignStmt) (int, []*
 			ec := &expcontext{identtype, regNotDefined, 0}
 			switch identtype {
 			case ecGlobal:
+				checkGlobal(context, st, true)
 				context.ConstIndex(LString(st.Value))
 			case ecUpvalue:
 				context.Upvalues.RegisterUnique(st.Value)
@@ -542,8 +664,7 @@ func compileAssignStmtRight(context *funcContext, stmt *qsa.AssignStmt, reg int,
 		var expr qsa.Expr = nil
 		if names_assigned >= lenexprs {
 			expr = &qsa.NilExpr{}
-			expr.SetLine(sline(stmt.Lhs[names_assigned]))
-			expr.SetLastLine(eline(stmt.Lhs[names_assigned]))
+			expr.SetSpan(stmt.Lhs[names_assigned], stmt.Lhs[names_assigned])
 		} else if isVarArgReturnExpr(stmt.Rhs[names_assigned]) && (lenexprs-names_assigned-1) <= 0 {
 			varargopt := lennames - names_assigned - 1
 			regstart := reg
@@ -624,6 +745,99 @@ func compileAssignStmt(context *funcContext, stmt *qsa.AssignStmt) {
 	}
 }
 
+// compileCompoundAssignStmt - compiles lhs op= rhs, the list and key of a
+// list item target are evaluated once and the item is read and written with
+// GETTABLE and SETTABLE, so __index and __newindex are honoured
+func compileCompoundAssignStmt(context *funcContext, stmt *qsa.CompoundAssignStmt) {
+	code := context.Code
+	reg := context.RegTop()
+	var identtype expContextType
+	var obj, key, cur, dst int
+	keyks := false
+	switch lhs := stmt.Lhs.(type) {
+	case *qsa.IdentExpr:
+		identtype = getIdentRefType(context, context, lhs)
+		switch identtype {
+		case ecGlobal:
+			checkGlobal(context, lhs, true)
+			code.AddABx(OP_GETGLOBAL, reg, context.ConstIndex(LString(lhs.Value)), sline(lhs))
+		case ecUpvalue:
+			code.AddABC(OP_GETUPVAL, reg, context.Upvalues.RegisterUnique(lhs.Value), 0, sline(lhs))
+		case ecLocal:
+			cur = context.FindLocalVar(lhs.Value)
+			dst = cur
+		}
+		if identtype != ecLocal {
+			cur, dst = reg, reg
+			reg++
+		}
+	case *qsa.AttrGetExpr:
+		identtype = ecOAList
+		compileExprWithKMVPropagation(context, lhs.Object, &reg, &obj)
+		compileExprWithKMVPropagation(context, lhs.Key, &reg, &key)
+		opcode := OP_GETTABLE
+		if _, ok := lhs.Key.(*qsa.StringExpr); ok {
+			keyks = true
+			opcode = OP_GETTABLEKS
+		}
+		code.AddABC(opcode, reg, obj, key, sline(lhs))
+		cur, dst = reg, reg
+		reg++
+	default:
+		raiseCompileErrorAt(context, stmt.Lhs, "cannot assign to this expression")
+	}
+
+	if stmt.Operator == ".." {
+		// CONCAT works on consecutive registers
+		if cur != reg-1 {
+			code.AddABC(OP_MOVE, reg, cur, 0, sline(stmt.Lhs))
+			cur = reg
+			reg++
+		}
+		compileExpr(context, reg, stmt.Rhs, ecnone(0))
+		code.AddABC(OP_CONCAT, dst, cur, reg, sline(stmt))
+	} else {
+		rk := reg
+		compileExprWithKMVPropagation(context, stmt.Rhs, &reg, &rk)
+		code.AddABC(arithOpcodes[stmt.Operator], dst, cur, rk, sline(stmt))
+	}
+
+	switch identtype {
+	case ecGlobal:
+		code.AddABx(OP_SETGLOBAL, dst, context.ConstIndex(LString(stmt.Lhs.(*qsa.IdentExpr).Value)), sline(stmt.Lhs))
+	case ecUpvalue:
+		code.AddABC(OP_SETUPVAL, dst, context.Upvalues.RegisterUnique(stmt.Lhs.(*qsa.IdentExpr).Value), 0, sline(stmt.Lhs))
+	case ecOAList:
+		opcode := OP_SETTABLE
+		if keyks {
+			opcode = OP_SETTABLEKS
+		}
+		code.AddABC(opcode, obj, key, dst, sline(stmt.Lhs))
+	}
+}
+
+// compileGlobalStmt - declares the names of a global statement, and
+// assigns them like an assignment statement when it has values
+func compileGlobalStmt(context *funcContext, stmt *qsa.GlobalStmt) {
+	lhs := make([]qsa.Expr, len(stmt.Names))
+	for i, name := range stmt.Names {
+		ident := &qsa.IdentExpr{Value: name}
+		ident.SetSpan(stmt, stmt)
+		if getIdentRefType(context, context, ident) != ecGlobal {
+			raiseCompileErrorAt(context, stmt, "global '%s' is hidden by a local of the same name", name)
+		}
+		if context.strict != nil {
+			context.strict.declared[name] = true
+		}
+		lhs[i] = ident
+	}
+	if len(stmt.Exprs) > 0 {
+		astmt := &qsa.AssignStmt{Lhs: lhs, Rhs: stmt.Exprs}
+		astmt.SetSpan(stmt, stmt)
+		compileAssignStmt(context, astmt)
+	}
+}
+
 func compileRegAssignment(context *funcContext, names []string, exprs []qsa.Expr, reg int, nvars int, line int) {
 	lennames := len(names)
 	lenexprs := len(exprs)
@@ -666,9 +880,17 @@ func compileRegAssignment(context *funcContext, names []string, exprs []qsa.Expr
 
 func compileLocalAssignStmt(context *funcContext, stmt *qsa.LocalAssignStmt) {
 	reg := context.RegTop()
-	if len(stmt.Names) == 1 && len(stmt.Exprs) == 1 {
-		if _, ok := stmt.Exprs[0].(*qsa.ProcExpr); ok {
+	block := context.Block
+	for _, name := range stmt.Names {
+		delete(block.Procs, name)
+	}
+	if len(stmt.Names) == 1 && len(stmt.Exprs) == 1 && stmt.Patterns == nil {
+		if fn, ok := stmt.Exprs[0].(*qsa.ProcExpr); ok {
 			context.RegisterLocalVar(stmt.Names[0])
+			if block.Procs == nil {
+				block.Procs = map[string]*qsa.ParList{}
+			}
+			block.Procs[stmt.Names[0]] = fn.ParList
 			compileRegAssignment(context, stmt.Names, stmt.Exprs, reg, len(stmt.Names), sline(stmt))
 			return
 		}
@@ -678,6 +900,52 @@ func compileLocalAssignStmt(context *funcContext, stmt *qsa.LocalAssignStmt) {
 	for _, name := range stmt.Names {
 		context.RegisterLocalVar(name)
 	}
+	compilePatterns(context, stmt.Patterns, reg)
+}
+
+// compilePatterns - declares the names of the patterns of the variables
+// from register reg on, and loads them from the list each variable holds
+func compilePatterns(context *funcContext, patterns []*qsa.Pattern, reg int) {
+	for i, pat := range patterns {
+		if pat == nil {
+			continue
+		}
+		code := context.Code
+		pos := code.SetPos(pat)
+		src := reg + i
+		for j, name := range pat.Names {
+			delete(context.Block.Procs, name)
+			dst := context.RegTop()
+			var key LValue = LNumber(j + 1)
+			opcode := OP_GETTABLE
+			if !pat.Positional {
+				key, opcode = LString(pat.Keys[j]), OP_GETTABLEKS
+			}
+			rk := context.ConstIndex(key)
+			if rk <= opMaxIndexRk {
+				rk = opRkAsk(rk)
+			} else {
+				code.AddABx(OP_LOADK, dst, rk, sline(pat))
+				rk = dst
+			}
+			code.AddABC(opcode, dst, src, rk, sline(pat))
+			context.RegisterLocalVar(name)
+		}
+		if pat.Rest != "" {
+			delete(context.Block.Procs, pat.Rest)
+			rest := &RestFields{Skip: -1, Keys: pat.Keys}
+			if pat.Positional {
+				rest = &RestFields{Skip: len(pat.Names)}
+			}
+			if len(context.Proto.RestFields) > opMaxArgsC {
+				raiseCompileErrorAt(context, pat, "too many ...rest names in a proc")
+			}
+			code.AddABC(OP_REST, context.RegTop(), src, len(context.Proto.RestFields), sline(pat))
+			context.Proto.RestFields = append(context.Proto.RestFields, rest)
+			context.RegisterLocalVar(pat.Rest)
+		}
+		code.SetPos(pos)
+	}
 }
 
 func compileReturnStmt(context *funcContext, stmt *qsa.ReturnStmt) {
@@ -696,7 +964,9 @@ func compileReturnStmt(context *funcContext, stmt *qsa.ReturnStmt) {
 			}
 		case *qsa.FuncCallExpr:
 			reg += compileExpr(context, reg, ex, ecnone(-2))
-			code.SetOpCode(code.LastPC(), OP_TAILCALL)
+			if !inTry(context) { // the try has to end after the call
+				code.SetOpCode(code.LastPC(), OP_TAILCALL)
+			}
 			code.AddABC(OP_RETURN, a, 0, 0, sline(stmt))
 			return
 		}
@@ -736,7 +1006,95 @@ func compileIfStmt(context *funcContext, stmt *qsa.IfStmt) {
 
 }
 
+// compileSwitchStmt - compiles a switch statement, the subject is held in
+// a hidden local. When every case value is a constant the statements are
+// found by an OP_SWITCH jump list, else by comparing the values in order.
+func compileSwitchStmt(context *funcContext, stmt *qsa.SwitchStmt) {
+	code := context.Code
+	elselabel := context.NewLabel()
+	endlabel := context.NewLabel()
+	caselabels := make([]int, len(stmt.Cases))
+	for i := range caselabels {
+		caselabels[i] = context.NewLabel()
+	}
+
+	context.EnterBlock(labelNoJump, stmt)
+	reg := context.RegTop()
+	subject := context.RegisterLocalVar("(switch)")
+	compileExpr(context, reg, stmt.Subject, &expcontext{ecLocal, subject, 0})
+
+	if table, ok := switchTable(context, stmt, caselabels); ok {
+		table.Default = elselabel
+		context.Proto.SwitchTables = append(context.Proto.SwitchTables, table)
+		code.AddABx(OP_SWITCH, subject, len(context.Proto.SwitchTables)-1, sline(stmt))
+	} else {
+		for i, c := range stmt.Cases {
+			for _, value := range c.Values {
+				reg := context.RegTop()
+				var rk int
+				compileExprWithKMVPropagation(context, value, &reg, &rk)
+				code.AddABC(OP_EQ, 1, subject, rk, sline(value))
+				code.AddASbx(OP_JMP, 0, caselabels[i], sline(value))
+			}
+		}
+		code.AddASbx(OP_JMP, 0, elselabel, sline(stmt))
+	}
+
+	for i, c := range stmt.Cases {
+		context.SetLabelPc(caselabels[i], code.LastPC())
+		compileBlock(context, c.Stmts)
+		if i < len(stmt.Cases)-1 || len(stmt.Else) > 0 {
+			code.AddASbx(OP_JMP, 0, endlabel, sline(stmt))
+		}
+	}
+	context.SetLabelPc(elselabel, code.LastPC())
+	compileBlock(context, stmt.Else)
+	context.SetLabelPc(endlabel, code.LastPC())
+	context.LeaveBlock()
+}
+
+// switchTable - returns the jump list of a switch statement with the case
+// labels as its jumps, ok is false when a case value is not a constant
+func switchTable(context *funcContext, stmt *qsa.SwitchStmt, caselabels []int) (table *SwitchTable, ok bool) {
+	table = &SwitchTable{}
+	seen := map[LValue]bool{}
+	for i, c := range stmt.Cases {
+		for _, value := range c.Values {
+			lv, ok := caseConstant(value)
+			if !ok {
+				return nil, false
+			}
+			if key := switchKey(lv); seen[key] {
+				raiseCompileErrorAt(context, value, "duplicate case value %v", lv)
+			} else {
+				seen[key] = true
+			}
+			table.Values = append(table.Values, lv)
+			table.Jumps = append(table.Jumps, caselabels[i])
+		}
+	}
+	return table, true
+}
+
+// caseConstant - returns the value of a case value that is a constant
+func caseConstant(expr qsa.Expr) (LValue, bool) {
+	switch ex := constFold(expr).(type) {
+	case *qsa.StringExpr:
+		return LString(ex.Value), true
+	case *qsa.TrueExpr:
+		return LTrue, true
+	case *qsa.FalseExpr:
+		return LFalse, true
+	case *qsa.NilExpr:
+		return LNil, true
+	case *qsa.NumberExpr, *constLValueExpr:
+		return lnumberValue(ex)
+	}
+	return nil, false
+}
+
 func compileBranchCondition(context *funcContext, reg int, expr qsa.Expr, thenlabel, elselabel int, hasnextcond bool) {
+	defer context.Code.SetPos(context.Code.SetPos(expr))
 	code := context.Code
 	flip := 0
 	jumplabel := elselabel
@@ -791,8 +1149,10 @@ func compileWhileStmt(context *funcContext, stmt *qsa.WhileStmt) {
 	context.SetLabelPc(condlabel, context.Code.LastPC())
 	compileBranchCondition(context, context.RegTop(), stmt.Condition, thenlabel, elselabel, false)
 	context.SetLabelPc(thenlabel, context.Code.LastPC())
-	context.EnterBlock(elselabel, stmt)
+	contlabel := context.NewLabel()
+	context.EnterLoopBlock(elselabel, contlabel, stmt)
 	compileSeg(context, stmt.Stmts)
+	context.SetLabelPc(contlabel, context.Code.LastPC())
 	context.CloseUpvalues()
 	context.Code.AddASbx(OP_JMP, 0, condlabel, eline(stmt))
 	context.LeaveBlock()
@@ -806,8 +1166,17 @@ func compileRepeatStmt(context *funcContext, stmt *qsa.RepeatStmt) {
 
 	context.SetLabelPc(initlabel, context.Code.LastPC())
 	context.SetLabelPc(elselabel, context.Code.LastPC())
-	context.EnterBlock(thenlabel, stmt)
+	contlabel := context.NewLabel()
+	context.EnterLoopBlock(thenlabel, contlabel, stmt)
 	compileSeg(context, stmt.Stmts)
+	if n := context.Block.ContinueLocals; n > -1 {
+		names := context.Block.LocalVars.Names()[n:]
+		if name := exprUsesName(stmt.Condition, names); name != "" {
+			raiseCompileErrorAt(context, stmt.Condition,
+				fmt.Sprintf("continue jumps into the scope of dcl '%v' used by until", name))
+		}
+	}
+	context.SetLabelPc(contlabel, context.Code.LastPC())
 	compileBranchCondition(context, context.RegTop(), stmt.Condition, thenlabel, elselabel, false)
 
 	context.SetLabelPc(thenlabel, context.Code.LastPC())
@@ -827,6 +1196,7 @@ func compileRepeatStmt(context *funcContext, stmt *qsa.RepeatStmt) {
 func compileBreakStmt(context *funcContext, stmt *qsa.BreakStmt) {
 	for block := context.Block; block != nil; block = block.Parent {
 		if label := block.BreakLabel; label != labelNoJump {
+			leaveTries(context, block, sline(stmt))
 			if block.RefUpvalue {
 				context.Code.AddABC(OP_CLOSE, block.Parent.LocalVars.LastIndex(), 0, 0, sline(stmt))
 			}
@@ -834,7 +1204,406 @@ func compileBreakStmt(context *funcContext, stmt *qsa.BreakStmt) {
 			return
 		}
 	}
-	raiseCompileError(context, sline(stmt), "no loop to break")
+	raiseCompileErrorAt(context, stmt, "no loop to break")
+}
+
+func compileContinueStmt(context *funcContext, stmt *qsa.ContinueStmt) {
+	refupvalue := false
+	for block := context.Block; block != nil; block = block.Parent {
+		if label := block.ContinueLabel; label != labelNoJump {
+			leaveTries(context, block, sline(stmt))
+			if refupvalue {
+				context.Code.AddABC(OP_CLOSE, block.LocalVars.LastIndex(), 0, 0, sline(stmt))
+			}
+			if n := len(block.LocalVars.Names()); block.ContinueLocals < 0 || n < block.ContinueLocals {
+				block.ContinueLocals = n
+			}
+			context.Code.AddASbx(OP_JMP, 0, label, sline(stmt))
+			return
+		}
+		refupvalue = refupvalue || block.RefUpvalue
+	}
+	raiseCompileErrorAt(context, stmt, "no loop to continue")
+}
+
+// compileTryStmt - compiles a try statement, its statements run with a catch
+// handler when it has a catch, and with a finally handler around them and
+// the catch statements when it has a finally. The finally statements end
+// with the error, return or jump that left the others, see tryPending.
+func compileTryStmt(context *funcContext, stmt *qsa.TryStmt) {
+	code := context.Code
+	context.EnterBlock(labelNoJump, stmt)
+	freg, finally := 0, labelNoJump
+	if stmt.Finally != nil {
+		finally = context.NewLabel()
+		freg = context.RegisterLocalVar("(finally)")
+		code.AddASbx(OP_FINALLY, freg, finally, sline(stmt))
+		context.EnterBlock(labelNoJump, stmt)
+		context.Block.Try = &tryRegion{Reg: freg, Finally: finally}
+	}
+	if stmt.Catch != nil {
+		catch := context.NewLabel()
+		after := context.NewLabel()
+		ereg := context.RegTop()
+		code.AddASbx(OP_TRY, ereg, catch, sline(stmt))
+		context.EnterBlock(labelNoJump, stmt)
+		context.Block.Try = &tryRegion{Reg: ereg, Finally: labelNoJump}
+		compileSeg(context, stmt.Stmts)
+		context.LeaveBlock()
+		code.AddABC(OP_ENDTRY, 0, 0, 0, sline(stmt.Catch))
+		code.AddASbx(OP_JMP, 0, after, sline(stmt.Catch))
+		context.SetLabelPc(catch, code.LastPC())
+		context.EnterBlock(labelNoJump, stmt.Catch)
+		if len(stmt.Catch.Name) > 0 {
+			context.RegisterLocalVar(stmt.Catch.Name) // set to the error in ereg
+		}
+		compileSeg(context, stmt.Catch.Stmts)
+		context.LeaveBlock()
+		context.SetLabelPc(after, code.LastPC())
+	} else {
+		compileSeg(context, stmt.Stmts)
+	}
+	if stmt.Finally != nil {
+		context.LeaveBlock()
+		code.AddABC(OP_ENDTRY, 0, 0, 0, sline(stmt.Finally))
+		context.SetLabelPc(finally, code.LastPC())
+		context.EnterBlock(labelNoJump, stmt.Finally)
+		compileSeg(context, stmt.Finally.Stmts)
+		context.LeaveBlock()
+		code.AddABC(OP_ENDFINALLY, freg, 0, 0, eline(stmt))
+	}
+	context.LeaveBlock()
+}
+
+// compileDeferStmt - compiles a defer statement, the proc and arguments of
+// the call are evaluated and added to the deferred calls of the proc
+func compileDeferStmt(context *funcContext, stmt *qsa.DeferStmt) {
+	code := context.Code
+	compileExpr(context, context.RegTop(), stmt.Expr, ecnone(-1))
+	code.SetOpCode(code.LastPC(), OP_DEFER)
+	code.SetC(code.LastPC(), context.Defer)
+}
+
+// compileCloseRegion - compiles the statements of a block that follow the
+// declaration of a <close> variable, the __close of its value is called
+// however they are left
+func compileCloseRegion(context *funcContext, stmt *qsa.LocalAssignStmt, rest []qsa.Stmt) {
+	ph := &qsa.Node{}
+	ph.SetSpan(stmt, stmt)
+	if len(rest) > 0 {
+		ph.SetSpan(stmt, rest[len(rest)-1])
+	}
+	reg := context.FindLocalVar(stmt.Names[0])
+	compileDeferRegion(context, ph, func(dreg int) {
+		context.Code.AddABC(OP_DEFERCLOSE, dreg, reg, 0, sline(stmt))
+		compileSeg(context, rest)
+	})
+}
+
+// compileDeferRegion - compiles the statements of body with a finally
+// handler that runs the deferred calls of the (defer) register given to
+// body, the last one first
+func compileDeferRegion(context *funcContext, pos qsa.PositionHolder, body func(dreg int)) {
+	code := context.Code
+	finally := context.NewLabel()
+	freg := context.RegisterLocalVar("(finally)")
+	dreg := context.RegisterLocalVar("(defer)")
+	code.AddASbx(OP_FINALLY, freg, finally, sline(pos))
+	code.AddABC(OP_LOADNIL, dreg, dreg, 0, sline(pos))
+	context.EnterBlock(labelNoJump, pos)
+	context.Block.Try = &tryRegion{Reg: freg, Finally: finally}
+	body(dreg)
+	context.LeaveBlock()
+	code.AddABC(OP_ENDTRY, 0, 0, 0, eline(pos))
+	context.SetLabelPc(finally, code.LastPC())
+	code.AddABC(OP_RUNDEFER, freg, 0, 0, eline(pos))
+	code.AddABC(OP_ENDFINALLY, freg, 0, 0, eline(pos))
+}
+
+// hasDefer - reports whether the statements of a proc have a defer
+// statement, not counting the procs defined in them
+func hasDefer(stmts []qsa.Stmt) bool {
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *qsa.DeferStmt:
+			return true
+		case *qsa.DoBlockStmt:
+			if hasDefer(st.Stmts) {
+				return true
+			}
+		case *qsa.WhileStmt:
+			if hasDefer(st.Stmts) {
+				return true
+			}
+		case *qsa.RepeatStmt:
+			if hasDefer(st.Stmts) {
+				return true
+			}
+		case *qsa.IfStmt:
+			if hasDefer(st.Then) || hasDefer(st.Else) {
+				return true
+			}
+		case *qsa.SwitchStmt:
+			for _, c := range st.Cases {
+				if hasDefer(c.Stmts) {
+					return true
+				}
+			}
+			if hasDefer(st.Else) {
+				return true
+			}
+		case *qsa.NumberForStmt:
+			if hasDefer(st.Stmts) {
+				return true
+			}
+		case *qsa.GenericForStmt:
+			if hasDefer(st.Stmts) {
+				return true
+			}
+		case *qsa.TryStmt:
+			if hasDefer(st.Stmts) || st.Catch != nil && hasDefer(st.Catch.Stmts) ||
+				st.Finally != nil && hasDefer(st.Finally.Stmts) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leaveTries - ends the try statements of the blocks that a break or
+// continue leaves to jump out of block, running their finally statements
+func leaveTries(context *funcContext, block *codeBlock, line int) {
+	for b := context.Block; b != nil && b != block; b = b.Parent {
+		if t := b.Try; t == nil {
+			continue
+		} else if t.Finally == labelNoJump {
+			context.Code.AddABC(OP_ENDTRY, 0, 0, 0, line)
+		} else {
+			context.Code.AddASbx(OP_LEAVE, t.Reg, t.Finally, line)
+		}
+	}
+}
+
+// inTry - reports whether the current block is run in a try statement
+func inTry(context *funcContext) bool {
+	for b := context.Block; b != nil; b = b.Parent {
+		if b.Try != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// exprUsesName - returns the first of names referred to by expr, or ""
+func exprUsesName(expr qsa.Expr, names []string) string {
+	if len(names) == 0 || expr == nil {
+		return ""
+	}
+	switch ex := expr.(type) {
+	case *qsa.IdentExpr:
+		for _, name := range names {
+			if ex.Value == name {
+				return name
+			}
+		}
+	case *qsa.AttrGetExpr:
+		if name := exprUsesName(ex.Object, names); name != "" {
+			return name
+		}
+		return exprUsesName(ex.Key, names)
+	case *qsa.OAListExpr:
+		for _, field := range ex.Fields {
+			if name := exprUsesName(field.Key, names); name != "" {
+				return name
+			}
+			if name := exprUsesName(field.Value, names); name != "" {
+				return name
+			}
+		}
+	case *qsa.FuncCallExpr:
+		if name := exprUsesName(ex.Func, names); name != "" {
+			return name
+		}
+		if name := exprUsesName(ex.Receiver, names); name != "" {
+			return name
+		}
+		for _, arg := range ex.Args {
+			if name := exprUsesName(arg, names); name != "" {
+				return name
+			}
+		}
+		for _, arg := range ex.Named {
+			if name := exprUsesName(arg.Value, names); name != "" {
+				return name
+			}
+		}
+	case *qsa.LogicalOpExpr:
+		if name := exprUsesName(ex.Lhs, names); name != "" {
+			return name
+		}
+		return exprUsesName(ex.Rhs, names)
+	case *qsa.RelationalOpExpr:
+		if name := exprUsesName(ex.Lhs, names); name != "" {
+			return name
+		}
+		return exprUsesName(ex.Rhs, names)
+	case *qsa.StringConcatOpExpr:
+		if name := exprUsesName(ex.Lhs, names); name != "" {
+			return name
+		}
+		return exprUsesName(ex.Rhs, names)
+	case *qsa.FStringExpr:
+		for _, part := range ex.Parts {
+			if name := exprUsesName(part, names); name != "" {
+				return name
+			}
+		}
+	case *qsa.FStringValue:
+		return exprUsesName(ex.Expr, names)
+	case *qsa.ArithmeticOpExpr:
+		if name := exprUsesName(ex.Lhs, names); name != "" {
+			return name
+		}
+		return exprUsesName(ex.Rhs, names)
+	case *qsa.UnaryMinusOpExpr:
+		return exprUsesName(ex.Expr, names)
+	case *qsa.UnaryNotOpExpr:
+		return exprUsesName(ex.Expr, names)
+	case *qsa.UnaryLenOpExpr:
+		return exprUsesName(ex.Expr, names)
+	case *qsa.UnaryBNotOpExpr:
+		return exprUsesName(ex.Expr, names)
+	case *qsa.ProcExpr:
+		// the names a proc uses are its upvalues, unless its parameters hide them
+		for _, def := range ex.ParList.Defaults {
+			if name := exprUsesName(def, names); name != "" {
+				return name
+			}
+		}
+		return stmtsUseName(ex.Stmts, withoutNames(names, ex.ParList.Names))
+	}
+	return ""
+}
+
+// stmtsUseName - returns the first of names referred to by stmts, or "", a
+// name declared by a dcl statement is hidden in the statements after it
+func stmtsUseName(stmts []qsa.Stmt, names []string) string {
+	for _, stmt := range stmts {
+		if name := stmtUsesName(stmt, names); name != "" {
+			return name
+		}
+		if st, ok := stmt.(*qsa.LocalAssignStmt); ok {
+			names = withoutNames(names, st.Names)
+			for _, pat := range st.Patterns {
+				if pat != nil {
+					names = withoutNames(names, append([]string{pat.Rest}, pat.Names...))
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// stmtUsesName - returns the first of names referred to by stmt, or ""
+func stmtUsesName(stmt qsa.Stmt, names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var exprs []qsa.Expr
+	var blocks [][]qsa.Stmt
+	switch st := stmt.(type) {
+	case *qsa.AssignStmt:
+		exprs = append(append(exprs, st.Lhs...), st.Rhs...)
+	case *qsa.CompoundAssignStmt:
+		exprs = append(exprs, st.Lhs, st.Rhs)
+	case *qsa.LocalAssignStmt:
+		exprs = st.Exprs
+	case *qsa.GlobalStmt:
+		exprs = st.Exprs
+	case *qsa.FuncCallStmt:
+		exprs = append(exprs, st.Expr)
+	case *qsa.DeferStmt:
+		exprs = append(exprs, st.Expr)
+	case *qsa.ReturnStmt:
+		exprs = st.Exprs
+	case *qsa.FuncDefStmt:
+		exprs = append(exprs, st.Name.Func, st.Name.Receiver, st.Func)
+	case *qsa.ClassStmt:
+		exprs = append(exprs, st.Name, st.Base)
+		for _, m := range st.Methods {
+			exprs = append(exprs, m.Func)
+		}
+	case *qsa.DoBlockStmt:
+		blocks = append(blocks, st.Stmts)
+	case *qsa.WhileStmt:
+		exprs = append(exprs, st.Condition)
+		blocks = append(blocks, st.Stmts)
+	case *qsa.RepeatStmt:
+		// the condition is in the scope of the dcl statements of the body
+		until := &qsa.ReturnStmt{Exprs: []qsa.Expr{st.Condition}}
+		if name := stmtsUseName(append(append([]qsa.Stmt{}, st.Stmts...), until), names); name != "" {
+			return name
+		}
+	case *qsa.IfStmt:
+		exprs = append(exprs, st.Condition)
+		blocks = append(blocks, st.Then, st.Else)
+	case *qsa.SwitchStmt:
+		exprs = append(exprs, st.Subject)
+		for _, c := range st.Cases {
+			exprs = append(exprs, c.Values...)
+			blocks = append(blocks, c.Stmts)
+		}
+		blocks = append(blocks, st.Else)
+	case *qsa.TryStmt:
+		blocks = append(blocks, st.Stmts)
+		if st.Catch != nil {
+			if name := stmtsUseName(st.Catch.Stmts, withoutNames(names, []string{st.Catch.Name})); name != "" {
+				return name
+			}
+		}
+		if st.Finally != nil {
+			blocks = append(blocks, st.Finally.Stmts)
+		}
+	case *qsa.NumberForStmt:
+		exprs = append(exprs, st.Init, st.Limit, st.Step)
+		if name := stmtsUseName(st.Stmts, withoutNames(names, []string{st.Name})); name != "" {
+			return name
+		}
+	case *qsa.GenericForStmt:
+		exprs = st.Exprs
+		inner := withoutNames(names, st.Names)
+		for _, pat := range st.Patterns {
+			if pat != nil {
+				inner = withoutNames(inner, append([]string{pat.Rest}, pat.Names...))
+			}
+		}
+		if name := stmtsUseName(st.Stmts, inner); name != "" {
+			return name
+		}
+	}
+	for _, expr := range exprs {
+		if name := exprUsesName(expr, names); name != "" {
+			return name
+		}
+	}
+	for _, block := range blocks {
+		if name := stmtsUseName(block, names); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// withoutNames - returns names without those hidden by the names of a
+// nested scope
+func withoutNames(names []string, hidden []string) []string {
+	var kept []string
+	for _, name := range names {
+		if !containsString(hidden, name) {
+			kept = append(kept, name)
+		}
+	}
+	return kept
 }
 
 func compileFuncDefStmt(context *funcContext, stmt *qsa.FuncDefStmt) {
@@ -847,18 +1616,106 @@ func compileFuncDefStmt(context *funcContext, stmt *qsa.FuncDefStmt) {
 		context.Code.AddABC(OP_SETTABLE, treg, kreg, reg, sline(stmt.Name.Receiver))
 	} else {
 		astmt := &qsa.AssignStmt{Lhs: []qsa.Expr{stmt.Name.Func}, Rhs: []qsa.Expr{stmt.Func}}
-		astmt.SetLine(sline(stmt.Func))
-		astmt.SetLastLine(eline(stmt.Func))
+		astmt.SetSpan(stmt.Func, stmt.Func)
 		compileAssignStmt(context, astmt)
 	}
 }
 
+// compileClassStmt - compiles a class statement to a list of its methods,
+// made the class by OP_CLASS. The methods find the base class in the
+// local (super) of the block of the statement.
+func compileClassStmt(context *funcContext, stmt *qsa.ClassStmt) {
+	code := context.Code
+	context.EnterBlock(labelNoJump, stmt)
+	base := context.RegTop()
+	var exprs []qsa.Expr
+	if stmt.Base != nil {
+		exprs = []qsa.Expr{stmt.Base}
+	}
+	compileRegAssignment(context, []string{"(super)"}, exprs, base, 1, sline(stmt))
+	context.RegisterLocalVar("(super)")
+	cls := context.RegisterLocalVar("(class)")
+	code.AddABC(OP_NEWTABLE, cls, 0, 0, sline(stmt))
+	context.Block.Class = stmt
+
+	for _, method := range stmt.Methods {
+		reg := context.RegTop()
+		kreg := loadRk(context, &reg, method.Func, LString(method.Name))
+		compileExpr(context, reg, method.Func, ecfuncdef)
+		code.AddABC(OP_SETTABLE, cls, kreg, reg, sline(method))
+	}
+	extends := 0
+	if stmt.Base != nil {
+		extends = 1
+	}
+	code.AddABC(OP_CLASS, cls, base, extends, sline(stmt))
+
+	value := &qsa.IdentExpr{Value: "(class)"}
+	value.SetSpan(stmt.Name, stmt.Name)
+	astmt := &qsa.AssignStmt{Lhs: []qsa.Expr{stmt.Name}, Rhs: []qsa.Expr{value}}
+	astmt.SetSpan(stmt, stmt)
+	compileAssignStmt(context, astmt)
+	context.LeaveBlock()
+}
+
+// superClass - returns the class statement the proc being compiled is a
+// method of, or is in one of, or nil
+func superClass(context *funcContext) *qsa.ClassStmt {
+	for fc := context; fc != nil; fc = fc.Parent {
+		for block := fc.Block; block != nil; block = block.Parent {
+			if block.Class != nil {
+				return block.Class
+			}
+		}
+	}
+	return nil
+}
+
+// superCall - returns the call, passing self, of the method of the base
+// class a call of super, the init method, super.name or super:name is,
+// or nil when expr is not one of these
+func superCall(expr *qsa.FuncCallExpr) *qsa.FuncCallExpr {
+	var fn, super qsa.Expr
+	switch {
+	case expr.Func == nil:
+		if _, ok := expr.Receiver.(*qsa.SuperExpr); !ok {
+			return nil
+		}
+		super = expr.Receiver
+		key := &qsa.StringExpr{Value: expr.Method}
+		key.SetSpan(expr, expr)
+		fn = &qsa.AttrGetExpr{Object: super, Key: key}
+		fn.SetSpan(expr, expr)
+	default:
+		if _, ok := expr.Func.(*qsa.SuperExpr); ok {
+			super = expr.Func
+			key := &qsa.StringExpr{Value: "init"}
+			key.SetSpan(super, super)
+			fn = &qsa.AttrGetExpr{Object: super, Key: key}
+			fn.SetSpan(expr, expr)
+		} else if get, ok := expr.Func.(*qsa.AttrGetExpr); ok {
+			if _, ok := get.Object.(*qsa.SuperExpr); !ok {
+				return nil
+			}
+			super, fn = get.Object, get
+		} else {
+			return nil
+		}
+	}
+	self := &qsa.IdentExpr{Value: "self"}
+	self.SetSpan(super, super)
+	call := &qsa.FuncCallExpr{Func: fn, Args: append([]qsa.Expr{self}, expr.Args...), Named: expr.Named, AdjustRet: expr.AdjustRet}
+	call.SetSpan(expr, expr)
+	return call
+}
+
 func compileNumberForStmt(context *funcContext, stmt *qsa.NumberForStmt) {
 	code := context.Code
 	endlabel := context.NewLabel()
 	ec := &expcontext{}
 
-	context.EnterBlock(endlabel, stmt)
+	contlabel := context.NewLabel()
+	context.EnterLoopBlock(endlabel, contlabel, stmt)
 	reg := context.RegTop()
 	rindex := context.RegisterLocalVar("(for index)")
 	ecupdate(ec, ecLocal, rindex, 0)
@@ -873,7 +1730,7 @@ func compileNumberForStmt(context *funcContext, stmt *qsa.NumberForStmt) {
 	rstep := context.RegisterLocalVar("(for step)")
 	if stmt.Step == nil {
 		stmt.Step = &qsa.NumberExpr{Value: "1"}
-		stmt.Step.SetLine(sline(stmt.Init))
+		stmt.Step.SetSpan(stmt.Init, stmt.Init)
 	}
 	ecupdate(ec, ecLocal, rstep, 0)
 	compileExpr(context, reg, stmt.Step, ec)
@@ -885,6 +1742,7 @@ func compileNumberForStmt(context *funcContext, stmt *qsa.NumberForStmt) {
 	bodypc := code.LastPC()
 	compileSeg(context, stmt.Stmts)
 
+	context.SetLabelPc(contlabel, code.LastPC())
 	context.LeaveBlock()
 
 	flpc := code.LastPC()
@@ -902,7 +1760,8 @@ func compileGenericForStmt(context *funcContext, stmt *qsa.GenericForStmt) {
 	fllabel := context.NewLabel()
 	nnames := len(stmt.Names)
 
-	context.EnterBlock(endlabel, stmt)
+	contlabel := context.NewLabel()
+	context.EnterLoopBlock(endlabel, contlabel, stmt)
 	rgen := context.RegisterLocalVar("(for generator)")
 	context.RegisterLocalVar("(for state)")
 	context.RegisterLocalVar("(for control)")
@@ -916,8 +1775,10 @@ func compileGenericForStmt(context *funcContext, stmt *qsa.GenericForStmt) {
 	}
 
 	context.SetLabelPc(bodylabel, code.LastPC())
+	compilePatterns(context, stmt.Patterns, rgen+3)
 	compileSeg(context, stmt.Stmts)
 
+	context.SetLabelPc(contlabel, code.LastPC())
 	context.LeaveBlock()
 
 	context.SetLabelPc(fllabel, code.LastPC())
@@ -928,6 +1789,7 @@ func compileGenericForStmt(context *funcContext, stmt *qsa.GenericForStmt) {
 }
 
 func compileExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcontext) int {
+	defer context.Code.SetPos(context.Code.SetPos(expr))
 	code := context.Code
 	sreg := savereg(ec, reg)
 	sused := 1
@@ -940,7 +1802,7 @@ func compileExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcontext) i
 		code.AddABx(OP_LOADK, sreg, context.ConstIndex(LString(ex.Value)), sline(ex))
 		return sused
 	case *qsa.NumberExpr:
-		num, err := parseNumber(ex.Value)
+		num, err := parseNumberValue(ex.Value)
 		if err != nil {
 			num = LNumber(math.NaN())
 		}
@@ -961,6 +1823,7 @@ func compileExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcontext) i
 	case *qsa.IdentExpr:
 		switch getIdentRefType(context, context, ex) {
 		case ecGlobal:
+			checkGlobal(context, ex, false)
 			code.AddABx(OP_GETGLOBAL, sreg, context.ConstIndex(LString(ex.Value)), sline(ex))
 		case ecUpvalue:
 			code.AddABC(OP_GETUPVAL, sreg, context.Upvalues.RegisterUnique(ex.Value), 0, sline(ex))
@@ -971,7 +1834,7 @@ func compileExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcontext) i
 		return sused
 	case *qsa.Comma3Expr:
 		if context.Proto.IsVarArg == 0 {
-			raiseCompileError(context, sline(ex), "cannot use '...' outside a vararg proc")
+			raiseCompileErrorAt(context, ex, "cannot use '...' outside a vararg proc")
 		}
 		context.Proto.IsVarArg &= ^VarArgNeedsArg
 		code.AddABC(OP_VARARG, sreg, 2+ec.varargopt, 0, sline(ex))
@@ -994,13 +1857,26 @@ func compileExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcontext) i
 	case *qsa.OAListExpr:
 		compileOAListExpr(context, reg, ex, ec)
 		return 1
+	case *qsa.SuperExpr:
+		class := superClass(context)
+		if class == nil {
+			raiseCompileErrorAt(context, ex, "super outside the methods of a class")
+		} else if class.Base == nil {
+			raiseCompileErrorAt(context, ex, "super in class '%s' that extends no class", class.Name.Value)
+		}
+		ident := &qsa.IdentExpr{Value: "(super)"}
+		ident.SetSpan(ex, ex)
+		return compileExpr(context, reg, ident, ec)
 	case *qsa.ArithmeticOpExpr:
 		compileArithmeticOpExpr(context, reg, ex, ec)
 		return sused
 	case *qsa.StringConcatOpExpr:
 		compileStringConcatOpExpr(context, reg, ex, ec)
 		return sused
-	case *qsa.UnaryMinusOpExpr, *qsa.UnaryNotOpExpr, *qsa.UnaryLenOpExpr:
+	case *qsa.FStringExpr:
+		compileFStringExpr(context, reg, ex, ec)
+		return sused
+	case *qsa.UnaryMinusOpExpr, *qsa.UnaryNotOpExpr, *qsa.UnaryLenOpExpr, *qsa.UnaryBNotOpExpr:
 		compileUnaryOpExpr(context, reg, ex, ec)
 		return sused
 	case *qsa.RelationalOpExpr:
@@ -1066,22 +1942,15 @@ func constFold(exp qsa.Expr) qsa.Expr {
 		lvalue, lisconst := lnumberValue(expr.Lhs)
 		rvalue, risconst := lnumberValue(expr.Rhs)
 		if lisconst && risconst {
-			switch expr.Operator {
-			case "+":
-				return &constLValueExpr{Value: lvalue + rvalue}
-			case "-":
-				return &constLValueExpr{Value: lvalue - rvalue}
-			case "*":
-				return &constLValueExpr{Value: lvalue * rvalue}
-			case "/":
-				return &constLValueExpr{Value: lvalue / rvalue}
-			case "%":
-				return &constLValueExpr{Value: oaModulo(lvalue, rvalue)}
-			case "^":
-				return &constLValueExpr{Value: LNumber(math.Pow(float64(lvalue), float64(rvalue)))}
-			default:
+			opcode, ok := arithOpcodes[expr.Operator]
+			if !ok {
 				log.Error().Msgf("Binary operator %s invalid", expr.Operator)
+				return exp
+			}
+			if value, ok := constArith(opcode, lvalue, rvalue); ok {
+				return &constLValueExpr{Value: value}
 			}
+			return exp
 		} else {
 			retexpr := *expr
 			retexpr.Lhs = constFold(expr.Lhs)
@@ -1091,14 +1960,20 @@ func constFold(exp qsa.Expr) qsa.Expr {
 	case *qsa.UnaryMinusOpExpr:
 		expr.Expr = constFold(expr.Expr)
 		if value, ok := lnumberValue(expr.Expr); ok {
-			return &constLValueExpr{Value: LNumber(-value)}
+			return &constLValueExpr{Value: numberNegate(value)}
+		}
+		return expr
+	case *qsa.UnaryBNotOpExpr:
+		expr.Expr = constFold(expr.Expr)
+		if value, ok := lnumberValue(expr.Expr); ok {
+			if it, ok := lvToInteger(value); ok {
+				return &constLValueExpr{Value: ^it}
+			}
 		}
 		return expr
 	default:
-
 		return exp
 	}
-	return exp
 }
 
 func compileProcExpr(context *funcContext, funcexpr *qsa.ProcExpr, ec *expcontext) {
@@ -1124,13 +1999,22 @@ func compileProcExpr(context *funcContext, funcexpr *qsa.ProcExpr, ec *expcontex
 		}
 		context.Proto.IsVarArg |= VarArgIsVarArg
 	}
+	compileDefaults(context, funcexpr.ParList)
 
-	compileSeg(context, funcexpr.Stmts)
+	if hasDefer(funcexpr.Stmts) {
+		compileDeferRegion(context, funcexpr, func(dreg int) {
+			context.Defer = dreg
+			compileSeg(context, funcexpr.Stmts)
+		})
+	} else {
+		compileSeg(context, funcexpr.Stmts)
+	}
 
 	context.Code.AddABC(OP_RETURN, 0, 1, 0, eline(funcexpr))
 	context.EndScope()
 	context.Proto.Code = context.Code.List()
 	context.Proto.DbgSourcePositions = context.Code.PosList()
+	context.Proto.DbgSourceSpans = context.Code.SpanList()
 	context.Proto.DbgUpvalues = context.Upvalues.Names()
 	context.Proto.NumUpvalues = uint8(len(context.Proto.DbgUpvalues))
 	for _, clv := range context.Proto.Constants {
@@ -1143,6 +2027,26 @@ func compileProcExpr(context *funcContext, funcexpr *qsa.ProcExpr, ec *expcontex
 	patchCode(context)
 }
 
+// compileDefaults - compiles the prologue of a proc setting the parameters
+// with a default value that are nil to the value
+func compileDefaults(context *funcContext, parlist *qsa.ParList) {
+	code := context.Code
+	for i, name := range parlist.Names {
+		def := parlist.Default(i)
+		if def == nil {
+			continue
+		}
+		reg := context.FindLocalVar(name)
+		nilreg := context.RegTop()
+		skip := context.NewLabel()
+		code.AddABC(OP_LOADNIL, nilreg, nilreg, 0, sline(def))
+		code.AddABC(OP_EQ, 0, reg, nilreg, sline(def))
+		code.AddASbx(OP_JMP, 0, skip, sline(def))
+		compileExpr(context, nilreg, def, &expcontext{ecLocal, reg, 0})
+		context.SetLabelPc(skip, code.LastPC())
+	}
+}
+
 func compileOAListExpr(context *funcContext, reg int, ex *qsa.OAListExpr, ec *expcontext) {
 	code := context.Code
 	listreg := reg
@@ -1211,7 +2115,7 @@ func compileOAListExpr(context *funcContext, reg int, ex *qsa.OAListExpr, ec *ex
 func compileArithmeticOpExpr(context *funcContext, reg int, expr *qsa.ArithmeticOpExpr, ec *expcontext) {
 	exp := constFold(expr)
 	if ex, ok := exp.(*constLValueExpr); ok {
-		exp.SetLine(sline(expr))
+		exp.SetSpan(expr, expr)
 		compileExpr(context, reg, ex, ec)
 		return
 	}
@@ -1222,21 +2126,7 @@ func compileArithmeticOpExpr(context *funcContext, reg int, expr *qsa.Arithmetic
 	c := reg
 	compileExprWithKMVPropagation(context, expr.Rhs, &reg, &c)
 
-	op := 0
-	switch expr.Operator {
-	case "+":
-		op = OP_ADD
-	case "-":
-		op = OP_SUB
-	case "*":
-		op = OP_MUL
-	case "/":
-		op = OP_DIV
-	case "%":
-		op = OP_MOD
-	case "^":
-		op = OP_POW
-	}
+	op := arithOpcodes[expr.Operator]
 	context.Code.AddABC(op, a, b, c, sline(expr))
 }
 
@@ -1255,12 +2145,47 @@ func compileStringConcatOpExpr(context *funcContext, reg int, expr *qsa.StringCo
 	basereg := reg
 	reg += compileExpr(context, reg, expr.Lhs, ecnone(0))
 	reg += compileExpr(context, reg, expr.Rhs, ecnone(0))
-	for pc := code.LastPC(); pc != 0 && opGetOpCode(code.At(pc)) == OP_CONCAT; pc-- {
+	// the concat of a nested a .. b is replaced, that of an f-string is not
+	if _, ok := expr.Rhs.(*qsa.StringConcatOpExpr); ok && opGetOpCode(code.Last()) == OP_CONCAT {
 		code.Pop()
 	}
 	code.AddABC(OP_CONCAT, a, basereg, basereg+crange, sline(expr))
 }
 
+// compileFStringExpr - compiles an f-string into the concatenation of its
+// parts, the embedded values are converted to strings with OP_TOSTRING
+func compileFStringExpr(context *funcContext, reg int, expr *qsa.FStringExpr, ec *expcontext) {
+	code := context.Code
+	a := savereg(ec, reg)
+	if len(expr.Parts) == 0 {
+		code.AddABx(OP_LOADK, a, context.ConstIndex(LString("")), sline(expr))
+		return
+	}
+	basereg := reg
+	for i, part := range expr.Parts {
+		slot := basereg + i
+		if len(expr.Parts) == 1 {
+			slot = a
+		}
+		value, ok := part.(*qsa.FStringValue)
+		if !ok {
+			compileExpr(context, slot, part, ecnone(0))
+			continue
+		}
+		reg = basereg + i
+		b := reg
+		compileExprWithKMVPropagation(context, value.Expr, &reg, &b)
+		format := &qsa.StringExpr{Value: value.Format}
+		format.SetSpan(value, value)
+		c := reg
+		compileExprWithKMVPropagation(context, format, &reg, &c)
+		code.AddABC(OP_TOSTRING, slot, b, c, sline(value))
+	}
+	if len(expr.Parts) > 1 {
+		code.AddABC(OP_CONCAT, a, basereg, basereg+len(expr.Parts)-1, sline(expr))
+	}
+}
+
 func compileUnaryOpExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcontext) {
 	opcode := 0
 	code := context.Code
@@ -1269,13 +2194,23 @@ func compileUnaryOpExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcon
 	case *qsa.UnaryMinusOpExpr:
 		exp := constFold(ex)
 		if lvexpr, ok := exp.(*constLValueExpr); ok {
-			exp.SetLine(sline(expr))
+			exp.SetSpan(expr, expr)
 			compileExpr(context, reg, lvexpr, ec)
 			return
 		}
 		ex, _ = exp.(*qsa.UnaryMinusOpExpr)
 		operandexpr = ex.Expr
 		opcode = OP_UNM
+	case *qsa.UnaryBNotOpExpr:
+		exp := constFold(ex)
+		if lvexpr, ok := exp.(*constLValueExpr); ok {
+			exp.SetSpan(expr, expr)
+			compileExpr(context, reg, lvexpr, ec)
+			return
+		}
+		ex, _ = exp.(*qsa.UnaryBNotOpExpr)
+		operandexpr = ex.Expr
+		opcode = OP_BNOT
 	case *qsa.UnaryNotOpExpr:
 		switch ex.Expr.(type) {
 		case *qsa.TrueExpr:
@@ -1300,6 +2235,7 @@ func compileUnaryOpExpr(context *funcContext, reg int, expr qsa.Expr, ec *expcon
 }
 
 func compileRelationalOpExprAux(context *funcContext, reg int, expr *qsa.RelationalOpExpr, flip int, label int) {
+	defer context.Code.SetPos(context.Code.SetPos(expr))
 	code := context.Code
 	b := reg
 	compileExprWithKMVPropagation(context, expr.Lhs, &reg, &b)
@@ -1364,6 +2300,7 @@ func compileLogicalOpExpr(context *funcContext, reg int, expr *qsa.LogicalOpExpr
 }
 
 func compileLogicalOpExprAux(context *funcContext, reg int, expr qsa.Expr, ec *expcontext, thenlabel, elselabel int, hasnextcond bool, lb *lblabels) {
+	defer context.Code.SetPos(context.Code.SetPos(expr))
 	code := context.Code
 	flip := 0
 	jumplabel := elselabel
@@ -1451,6 +2388,10 @@ func compileLogicalOpExprAux(context *funcContext, reg int, expr qsa.Expr, ec *e
 }
 
 func compileFuncCallExpr(context *funcContext, reg int, expr *qsa.FuncCallExpr, ec *expcontext) int {
+	if call := superCall(expr); call != nil {
+		expr = call
+	}
+	defer context.Code.SetPos(context.Code.SetPos(expr))
 	funcreg := reg
 	if ec.ctype == ecLocal && ec.reg == (int(context.Proto.NumParameters)-1) {
 		funcreg = ec.reg
@@ -1479,7 +2420,7 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *qsa.FuncCallExpr,
 	}
 
 	for i, ar := range expr.Args {
-		islastvararg = (i == len(expr.Args)-1) && isVarArgReturnExpr(ar)
+		islastvararg = (i == len(expr.Args)-1) && len(expr.Named) == 0 && isVarArgReturnExpr(ar)
 		if islastvararg {
 			compileExpr(context, reg, ar, ecnone(-2))
 		} else {
@@ -1490,6 +2431,17 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *qsa.FuncCallExpr,
 	if islastvararg {
 		b = 0
 	}
+	if len(expr.Named) > 0 {
+		names := make([]string, len(expr.Named))
+		for i, arg := range expr.Named {
+			names[i] = arg.Name
+			reg += compileExpr(context, reg, arg.Value, ecnone(0))
+		}
+		checkNamedArgs(context, expr, argc)
+		context.Proto.CallNames = append(context.Proto.CallNames, &CallNames{Args: argc, Names: names})
+		context.Code.AddABx(OP_NAMEDARGS, funcreg, len(context.Proto.CallNames)-1, sline(expr))
+		b = 0 // the arguments end at the top set by OP_NAMEDARGS
+	}
 	context.Code.AddABC(OP_CALL, funcreg, b, ec.varargopt+2, sline(expr))
 	context.Proto.DbgCalls = append(context.Proto.DbgCalls, DbgCall{Pc: context.Code.LastPC(), Name: name})
 
@@ -1503,6 +2455,219 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *qsa.FuncCallExpr,
 	return ec.varargopt + 1
 }
 
+// checkNamedArgs - raises a compile error for a named argument given twice,
+// or, when the proc called is known, for a name that is not one of its
+// parameters or is that of a parameter given by position
+func checkNamedArgs(context *funcContext, expr *qsa.FuncCallExpr, argc int) {
+	var parlist *qsa.ParList
+	if id, ok := expr.Func.(*qsa.IdentExpr); ok {
+		parlist = knownProc(context, id.Value)
+	}
+	given := map[string]bool{}
+	for _, arg := range expr.Named {
+		if given[arg.Name] {
+			raiseCompileErrorAt(context, arg, "argument '%s' given twice", arg.Name)
+		}
+		given[arg.Name] = true
+		if parlist == nil {
+			continue
+		}
+		i := 0
+		for i < len(parlist.Names) && parlist.Names[i] != arg.Name {
+			i++
+		}
+		switch {
+		case i == len(parlist.Names):
+			raiseCompileErrorAt(context, arg, "proc '%s' has no parameter '%s'", getExprName(context, expr.Func), arg.Name)
+		case i < argc:
+			raiseCompileErrorAt(context, arg, "argument '%s' given twice", arg.Name)
+		}
+	}
+}
+
+// knownProc - returns the parameters of the proc the name refers to, when
+// it is a local declared as a proc or a global proc defined in the segment
+// and the name is not assigned anything else, nil when it is not known
+func knownProc(context *funcContext, name string) *qsa.ParList {
+	for fc := context; fc != nil; fc = fc.Parent {
+		if idx, block := fc.FindLocalVarAndBlock(name); idx > -1 {
+			if context.assigned[name] > 0 {
+				return nil
+			}
+			return block.Procs[name]
+		}
+	}
+	// the proc statement of a global proc is one of its assignments
+	if context.assigned[name] > 1 {
+		return nil
+	}
+	return context.procs[name]
+}
+
+// globalProcs - adds the parameters of the global procs defined by the
+// statements to procs, nil for a name defined twice
+func globalProcs(stmts []qsa.Stmt, procs map[string]*qsa.ParList) {
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *qsa.FuncDefStmt:
+			if id, ok := st.Name.Func.(*qsa.IdentExpr); ok {
+				if _, twice := procs[id.Value]; twice {
+					procs[id.Value] = nil
+				} else {
+					procs[id.Value] = st.Func.ParList
+				}
+			}
+		case *qsa.DoBlockStmt:
+			globalProcs(st.Stmts, procs)
+		case *qsa.IfStmt:
+			globalProcs(st.Then, procs)
+			globalProcs(st.Else, procs)
+		}
+	}
+}
+
+// assignedNames - counts the assignments to each name by the statements,
+// and by those of the procs defined in them, in assigned
+func assignedNames(stmts []qsa.Stmt, assigned map[string]int) {
+	for _, stmt := range stmts {
+		var exprs []qsa.Expr
+		var blocks [][]qsa.Stmt
+		switch st := stmt.(type) {
+		case *qsa.AssignStmt:
+			for _, lhs := range st.Lhs {
+				if id, ok := lhs.(*qsa.IdentExpr); ok {
+					assigned[id.Value]++
+				}
+			}
+			exprs = append(append(exprs, st.Lhs...), st.Rhs...)
+		case *qsa.CompoundAssignStmt:
+			if id, ok := st.Lhs.(*qsa.IdentExpr); ok {
+				assigned[id.Value]++
+			}
+			exprs = append(exprs, st.Lhs, st.Rhs)
+		case *qsa.LocalAssignStmt:
+			exprs = st.Exprs
+		case *qsa.GlobalStmt:
+			if len(st.Exprs) > 0 {
+				for _, name := range st.Names {
+					assigned[name]++
+				}
+			}
+			exprs = st.Exprs
+		case *qsa.FuncCallStmt:
+			exprs = append(exprs, st.Expr)
+		case *qsa.DeferStmt:
+			exprs = append(exprs, st.Expr)
+		case *qsa.ReturnStmt:
+			exprs = st.Exprs
+		case *qsa.FuncDefStmt:
+			if id, ok := st.Name.Func.(*qsa.IdentExpr); ok && st.Name.Receiver == nil {
+				assigned[id.Value]++
+			}
+			exprs = append(exprs, st.Name.Func, st.Name.Receiver, st.Func)
+		case *qsa.ClassStmt:
+			assigned[st.Name.Value]++
+			exprs = append(exprs, st.Base)
+			for _, m := range st.Methods {
+				exprs = append(exprs, m.Func)
+			}
+		case *qsa.DoBlockStmt:
+			blocks = append(blocks, st.Stmts)
+		case *qsa.WhileStmt:
+			exprs = append(exprs, st.Condition)
+			blocks = append(blocks, st.Stmts)
+		case *qsa.RepeatStmt:
+			exprs = append(exprs, st.Condition)
+			blocks = append(blocks, st.Stmts)
+		case *qsa.IfStmt:
+			exprs = append(exprs, st.Condition)
+			blocks = append(blocks, st.Then, st.Else)
+		case *qsa.SwitchStmt:
+			exprs = append(exprs, st.Subject)
+			for _, c := range st.Cases {
+				exprs = append(exprs, c.Values...)
+				blocks = append(blocks, c.Stmts)
+			}
+			blocks = append(blocks, st.Else)
+		case *qsa.TryStmt:
+			blocks = append(blocks, st.Stmts)
+			if st.Catch != nil {
+				blocks = append(blocks, st.Catch.Stmts)
+			}
+			if st.Finally != nil {
+				blocks = append(blocks, st.Finally.Stmts)
+			}
+		case *qsa.NumberForStmt:
+			exprs = append(exprs, st.Init, st.Limit, st.Step)
+			blocks = append(blocks, st.Stmts)
+		case *qsa.GenericForStmt:
+			exprs = st.Exprs
+			blocks = append(blocks, st.Stmts)
+		}
+		for _, expr := range exprs {
+			exprAssignedNames(expr, assigned)
+		}
+		for _, block := range blocks {
+			assignedNames(block, assigned)
+		}
+	}
+}
+
+// exprAssignedNames - counts the assignments to each name by the procs
+// defined in expr in assigned
+func exprAssignedNames(expr qsa.Expr, assigned map[string]int) {
+	switch ex := expr.(type) {
+	case *qsa.AttrGetExpr:
+		exprAssignedNames(ex.Object, assigned)
+		exprAssignedNames(ex.Key, assigned)
+	case *qsa.OAListExpr:
+		for _, field := range ex.Fields {
+			exprAssignedNames(field.Key, assigned)
+			exprAssignedNames(field.Value, assigned)
+		}
+	case *qsa.FuncCallExpr:
+		exprAssignedNames(ex.Func, assigned)
+		exprAssignedNames(ex.Receiver, assigned)
+		for _, arg := range ex.Args {
+			exprAssignedNames(arg, assigned)
+		}
+		for _, arg := range ex.Named {
+			exprAssignedNames(arg.Value, assigned)
+		}
+	case *qsa.LogicalOpExpr:
+		exprAssignedNames(ex.Lhs, assigned)
+		exprAssignedNames(ex.Rhs, assigned)
+	case *qsa.RelationalOpExpr:
+		exprAssignedNames(ex.Lhs, assigned)
+		exprAssignedNames(ex.Rhs, assigned)
+	case *qsa.StringConcatOpExpr:
+		exprAssignedNames(ex.Lhs, assigned)
+		exprAssignedNames(ex.Rhs, assigned)
+	case *qsa.ArithmeticOpExpr:
+		exprAssignedNames(ex.Lhs, assigned)
+		exprAssignedNames(ex.Rhs, assigned)
+	case *qsa.FStringExpr:
+		for _, part := range ex.Parts {
+			exprAssignedNames(part, assigned)
+		}
+	case *qsa.FStringValue:
+		exprAssignedNames(ex.Expr, assigned)
+	case *qsa.UnaryMinusOpExpr:
+		exprAssignedNames(ex.Expr, assigned)
+	case *qsa.UnaryNotOpExpr:
+		exprAssignedNames(ex.Expr, assigned)
+	case *qsa.UnaryLenOpExpr:
+		exprAssignedNames(ex.Expr, assigned)
+	case *qsa.UnaryBNotOpExpr:
+		exprAssignedNames(ex.Expr, assigned)
+	case *qsa.ProcExpr:
+		for _, def := range ex.ParList.Defaults {
+			exprAssignedNames(def, assigned)
+		}
+		assignedNames(ex.Stmts, assigned)
+	}
+}
+
 func loadRk(context *funcContext, reg *int, expr qsa.Expr, cnst LValue) int {
 	cindex := context.ConstIndex(cnst)
 	if cindex <= opMaxIndexRk {
@@ -1527,6 +2692,142 @@ func getIdentRefType(context *funcContext, current *funcContext, expr *qsa.Ident
 	return getIdentRefType(context, current.Parent, expr)
 }
 
+// strictMode - the globals a segment compiled in strict mode may use, an
+// undeclared global cannot be assigned, or read unless it is known
+type strictMode struct {
+	on       bool
+	declared map[string]bool        // by global statements, assignments outside procs and the allow-list
+	known    func(name string) bool // reports the globals defined when the segment is compiled
+}
+
+// strictPragma - the comment that puts a script in strict mode, the
+// names after it are allowed globals
+const strictPragma = "q:strict"
+
+// newStrictMode - returns a strict mode, that is off until the pragma is
+// found, for the globals of a new state and the allowed globals
+func newStrictMode(on bool, allow []string) *strictMode {
+	sm := &strictMode{on: on, declared: map[string]bool{}, known: func(name string) bool {
+		return defaultGlobals()[name]
+	}}
+	for _, name := range allow {
+		sm.declared[name] = true
+	}
+	return sm
+}
+
+// pragma - turns strict mode on when a comment before the first statement
+// is the strict pragma, and allows the global names following it
+func (sm *strictMode) pragma(segment []qsa.Stmt, comments []*qsa.Comment) {
+	for _, c := range comments {
+		if len(segment) > 0 && c.Pos.Line >= segment[0].Line() {
+			break
+		}
+		text := strings.TrimSuffix(c.Text, "*/")
+		if len(text) >= 2 {
+			text = text[2:] // the // /* or #! marks
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		if len(fields) > 0 && fields[0] == strictPragma {
+			sm.on = true
+			for _, name := range fields[1:] {
+				sm.declared[name] = true
+			}
+		}
+	}
+}
+
+// declare - declares the globals of global statements and of assignments
+// outside procs, which can be used by the whole segment
+func (sm *strictMode) declare(stmts []qsa.Stmt) {
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *qsa.AssignStmt:
+			for _, lhs := range st.Lhs {
+				if id, ok := lhs.(*qsa.IdentExpr); ok {
+					sm.declared[id.Value] = true
+				}
+			}
+		case *qsa.GlobalStmt:
+			for _, name := range st.Names {
+				sm.declared[name] = true
+			}
+		case *qsa.FuncDefStmt:
+			if id, ok := st.Name.Func.(*qsa.IdentExpr); ok {
+				sm.declared[id.Value] = true
+			}
+		case *qsa.ClassStmt:
+			sm.declared[st.Name.Value] = true
+		case *qsa.DoBlockStmt:
+			sm.declare(st.Stmts)
+		case *qsa.WhileStmt:
+			sm.declare(st.Stmts)
+		case *qsa.RepeatStmt:
+			sm.declare(st.Stmts)
+		case *qsa.IfStmt:
+			sm.declare(st.Then)
+			sm.declare(st.Else)
+		case *qsa.SwitchStmt:
+			for _, c := range st.Cases {
+				sm.declare(c.Stmts)
+			}
+			sm.declare(st.Else)
+		case *qsa.TryStmt:
+			sm.declare(st.Stmts)
+			if st.Catch != nil {
+				sm.declare(st.Catch.Stmts)
+			}
+			if st.Finally != nil {
+				sm.declare(st.Finally.Stmts)
+			}
+		case *qsa.NumberForStmt:
+			sm.declare(st.Stmts)
+		case *qsa.GenericForStmt:
+			sm.declare(st.Stmts)
+		}
+	}
+}
+
+// checkGlobal - raises a compile error when a segment in strict mode
+// assigns the global ex, or reads it, without it being declared
+func checkGlobal(context *funcContext, ex *qsa.IdentExpr, assign bool) {
+	sm := context.strict
+	if sm == nil || sm.declared[ex.Value] {
+		return
+	}
+	if assign {
+		raiseCompileErrorAt(context, ex, "assignment to undeclared global '%s'", ex.Value)
+	} else if !sm.known(ex.Value) {
+		raiseCompileErrorAt(context, ex, "undeclared global '%s'", ex.Value)
+	} else if !containsString(context.Proto.StrictGlobals, ex.Value) {
+		// known when compiled, it may have no value when it is read
+		context.Proto.StrictGlobals = append(context.Proto.StrictGlobals, ex.Value)
+	}
+}
+
+// defaultGlobalNames - the globals of a new state and those set by the q
+// command, see defaultGlobals
+var defaultGlobalNames map[string]bool
+
+// defaultGlobals - returns the globals of a new state and those set by the
+// q command
+func defaultGlobals() map[string]bool {
+	if defaultGlobalNames == nil {
+		globals := map[string]bool{"arg": true, "_NAME": true}
+		L := NewState()
+		L.G.Global.ForEach(func(k, v LValue) {
+			if ks, ok := k.(LString); ok {
+				globals[string(ks)] = true
+			}
+		})
+		L.Close()
+		defaultGlobalNames = globals
+	}
+	return defaultGlobalNames
+}
+
 func getExprName(context *funcContext, expr qsa.Expr) string {
 	switch ex := expr.(type) {
 	case *qsa.IdentExpr:
@@ -1560,6 +2861,22 @@ func patchCode(context *funcContext) {
 			OP_TAILCALL, OP_RETURN, OP_FORPREP, OP_FORLOOP, OP_TFORLOOP,
 			OP_SETLIST, OP_CLOSE:
 			/* nothing to do */
+		case OP_DEFER:
+			if reg := opGetArgA(inst) + opGetArgB(inst) - 1; reg > maxreg {
+				maxreg = reg
+			}
+		case OP_TRY, OP_FINALLY, OP_LEAVE: // label to pc offset
+			context.Code.SetSbx(pc, context.GetLabelPc(opGetArgSbx(inst))-pc)
+			if reg := opGetArgA(inst); reg > maxreg {
+				maxreg = reg
+			}
+		case OP_SWITCH: // labels to pc offsets
+			table := context.Proto.SwitchTables[opGetArgBx(inst)]
+			for i, label := range table.Jumps {
+				table.Jumps[i] = context.GetLabelPc(label) - pc
+			}
+			table.Default = context.GetLabelPc(table.Default) - pc
+			table.makeIndex()
 		case OP_CALL:
 			if reg := opGetArgA(inst) + opGetArgC(inst) - 2; reg > maxreg {
 				maxreg = reg
@@ -1619,7 +2936,48 @@ func patchCode(context *funcContext) {
 	context.Proto.NumUsedRegisters = uint8(maxreg)
 }
 
+// CompileSource - parses and compiles the q source src, the error of a
+// source that does not compile has the source line of the error. A source
+// with the strict pragma comment is compiled in strict mode.
+func CompileSource(src []byte, name string) (*ProcProto, error) {
+	return compileSource(src, name, newStrictMode(false, nil))
+}
+
+// compileSource - compiles the q source src, in the strict mode sm when
+// it is on or src has the strict pragma
+func compileSource(src []byte, name string, sm *strictMode) (*ProcProto, error) {
+	segment, comments, err := qsp.ParseComments(bytes.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	sm.pragma(segment, comments)
+	if !sm.on {
+		sm = nil
+	}
+	proto, err := compile(segment, name, sm)
+	if cerr, ok := err.(*CompileError); ok {
+		cerr.Text = qsa.SourceLine(src, cerr.Line)
+	}
+	if proto != nil {
+		proto.setSource(src)
+	}
+	return proto, err
+}
+
+// setSource - records the source of a proto and the protos in it
+func (fp *ProcProto) setSource(src []byte) {
+	fp.source = src
+	for _, p := range fp.ProcPrototypes {
+		p.setSource(src)
+	}
+}
+
 func Compile(segment []qsa.Stmt, name string) (proto *ProcProto, err error) {
+	return compile(segment, name, nil)
+}
+
+// compile - compiles a segment, in strict mode when sm is not nil
+func compile(segment []qsa.Stmt, name string, sm *strictMode) (proto *ProcProto, err error) {
 	defer func() {
 		if rcv := recover(); rcv != nil {
 			if _, ok := rcv.(*CompileError); ok {
@@ -1633,6 +2991,15 @@ func Compile(segment []qsa.Stmt, name string) (proto *ProcProto, err error) {
 	parlist := &qsa.ParList{HasVargs: true, Names: []string{}}
 	funcexpr := &qsa.ProcExpr{ParList: parlist, Stmts: segment}
 	context := newFuncContext(name, nil)
+	context.procs = map[string]*qsa.ParList{}
+	globalProcs(segment, context.procs)
+	context.assigned = map[string]int{}
+	assignedNames(segment, context.assigned)
+	if sm != nil {
+		sm.declare(segment)
+		context.strict = sm
+		context.Proto.Strict = true
+	}
 	compileProcExpr(context, funcexpr, ecnone(0))
 	proto = context.Proto
 	return
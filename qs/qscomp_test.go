@@ -0,0 +1,246 @@
+package qs
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkScript - runs src in a new state and reports an error when it fails
+// or, with want not empty, when it does not fail with an error containing want
+func checkScript(t *testing.T, name, src, want string) {
+	t.Helper()
+	L := NewState()
+	defer L.Close()
+	err := L.DoString(src)
+	switch {
+	case len(want) == 0 && err != nil:
+		t.Errorf("%s: %v", name, err)
+	case len(want) > 0 && err == nil:
+		t.Errorf("%s: no error, want %q", name, want)
+	case len(want) > 0 && !strings.Contains(err.Error(), want):
+		t.Errorf("%s: error %v, want %q", name, err, want)
+	}
+}
+
+// TestStrictMode - undeclared globals are compile errors and declared ones
+// can be read when they are nil
+func TestStrictMode(t *testing.T) {
+	checkScript(t, "declared nil global", `// q:strict
+global cfg
+dcl seen = "unset"
+if cfg == nil then seen = "nil" end
+assert(seen == "nil")`, "")
+	checkScript(t, "assigned nil global", `// q:strict
+x = nil
+proc f() return x end
+assert(f() == nil)`, "")
+	checkScript(t, "pragma global", `// q:strict config
+assert(config == nil)`, "")
+	checkScript(t, "undeclared read", `// q:strict
+proc f() return nosuch end`, "undeclared global 'nosuch'")
+	checkScript(t, "undeclared assignment", `// q:strict
+proc f() nosuch = 1 end`, "assignment to undeclared global 'nosuch'")
+	checkScript(t, "known global without a value", `// q:strict
+rawset(_G, "sleep", nil)
+sleep(1)`, "undefined global 'sleep'")
+}
+
+// TestContinue - continue skips to the next iteration of every loop, and
+// cannot skip a dcl used by the until of a repeat loop
+func TestContinue(t *testing.T) {
+	checkScript(t, "for loops", `dcl s = 0
+for i = 1, 10 do
+  if i % 2 == 0 then continue end
+  s = s + i
+end
+for _, v in ipairs({1, 2, 3}) do
+  if v == 2 then continue end
+  s = s + v * 100
+end
+assert(s == 425, s)`, "")
+	checkScript(t, "while loop", `dcl i, n = 0, 0
+while i < 5 do
+  i = i + 1
+  if i == 3 then continue end
+  n = n + 1
+end
+assert(n == 4, n)`, "")
+	checkScript(t, "repeat loop", `dcl i, n = 0, 0
+repeat
+  i = i + 1
+  if i < 3 then continue end
+  dcl m = i
+  n = n + m
+until i >= 5
+assert(n == 12, n)`, "")
+	checkScript(t, "until uses a skipped dcl", `repeat
+  if true then continue end
+  dcl done = true
+until done`, "continue jumps into the scope of dcl 'done' used by until")
+	checkScript(t, "until closure uses a skipped dcl", `repeat
+  if true then continue end
+  dcl done = true
+until (proc() return done end)()`, "continue jumps into the scope of dcl 'done' used by until")
+	checkScript(t, "until closure hides a skipped dcl", `dcl i = 0
+repeat
+  i = i + 1
+  if i < 3 then continue end
+  dcl done = true
+until (proc(done) return done end)(i >= 3)`, "")
+	checkScript(t, "continue outside a loop", `continue`, "continue")
+}
+
+// TestFStrings - f-strings format their expressions, and f with a space
+// before a string is still a call of the proc f
+func TestFStrings(t *testing.T) {
+	checkScript(t, "format", `dcl name, items, price = "ann", {1, 2, 3}, 3.14159
+dcl s = f"user {name} has {#items} items at {price:%.2f} {{each}} {nil}"
+assert(s == "user ann has 3 items at 3.14 {each} nil", s)`, "")
+	checkScript(t, "call of f", `proc f(s) return "called " .. s end
+assert(f "text" == "called text")
+assert(f("text") == "called text")
+assert(f"text" == "text")`, "")
+}
+
+// TestSwitch - the first case equal to the value runs, by a jump list for
+// constant cases and by comparing otherwise, and break applies to the loop
+func TestSwitch(t *testing.T) {
+	checkScript(t, "constant cases", `proc kind(v)
+  switch v
+  case "add", "plus" then return "sum"
+  case 1, 2.5 then return "number"
+  case true then return "yes"
+  case nil then return "none"
+  else return "other"
+  end
+end
+assert(kind("plus") == "sum" and kind("add") == "sum")
+assert(kind(1) == "number" and kind(2.5) == "number")
+assert(kind(true) == "yes" and kind(nil) == "none")
+assert(kind(false) == "other" and kind("mul") == "other")`, "")
+	checkScript(t, "evaluated cases", `dcl calls = 0
+proc val(x) calls = calls + 1 return x end
+dcl s
+switch 3
+case val(1) then s = "one"
+case val(3) then s = "three"
+case val(5) then s = "five"
+end
+assert(s == "three" and calls == 2, calls)`, "")
+	checkScript(t, "no case and no else", `dcl s = "unset"
+switch 9 case 1 then s = "one" end
+assert(s == "unset")`, "")
+	checkScript(t, "break and continue", `dcl n = 0
+for i = 1, 10 do
+  switch i
+  case 2 then continue
+  case 5 then break
+  end
+  n = n + i
+end
+assert(n == 8, n)`, "")
+	checkScript(t, "duplicate case", `switch 1 case 1 then case 2, 1 then end`, "duplicate case value 1")
+}
+
+// TestCompoundAssignment - the operator is applied to the variable or list
+// item, whose list and key are evaluated once
+func TestCompoundAssignment(t *testing.T) {
+	checkScript(t, "operators", `dcl n, s = 10, "a"
+n += 5 n -= 3 n *= 2 n /= 4 n %= 4 n ^= 3
+s ..= "b"
+assert(n == 8, n)
+assert(s == "ab")`, "")
+	checkScript(t, "list item evaluated once", `dcl t, keys = {n = 1, {2}}, 0
+proc key() keys = keys + 1 return "n" end
+t[key()] += 10
+t[1][1] *= 5
+assert(t.n == 11 and keys == 1 and t[1][1] == 10)`, "")
+	checkScript(t, "metamethods", `dcl log = {}
+dcl t = setmetalist({}, {__index = proc(t, k) return 1 end,
+  __newindex = proc(t, k, v) log[#log + 1] = k .. "=" .. v end})
+t.x += 1
+assert(log[1] == "x=2" and rawget(t, "x") == nil)`, "")
+}
+
+// TestNamedArgs - defaults are evaluated when an argument is missing or nil,
+// and named arguments are checked when the called proc is known
+func TestNamedArgs(t *testing.T) {
+	checkScript(t, "defaults", `proc connect(host, port = 80, secure = port == 443)
+  return host .. ":" .. port .. ":" .. tostring(secure)
+end
+assert(connect("a") == "a:80:false")
+assert(connect("b", 443) == "b:443:true")
+assert(connect("c", nil, true) == "c:80:true")`, "")
+	checkScript(t, "default evaluated each call", `dcl n = 0
+proc next() n = n + 1 return n end
+proc f(v = next()) return v end
+assert(f() == 1 and f() == 2 and f(10) == 10 and n == 2)`, "")
+	checkScript(t, "named", `proc sub(a, b = 1) return a - b end
+assert(sub(b: 2, a: 10) == 8)
+assert(sub(10, b: 3) == 7)
+assert(sub(a: 5) == 4)`, "")
+	checkScript(t, "named to an unknown proc", `dcl t = {sub = proc(a, b) return a - b end}
+dcl g = t.sub
+assert(g(b: 1, a: 3) == 2)
+dcl ok, err = pcall(proc() return g(c: 1) end)
+assert(not ok and find(err, "proc has no parameter 'c'"), err)`, "")
+	checkScript(t, "spaced method call", `dcl obj = {v = 5}
+proc obj:m() return self.v end
+proc g(a) return a end
+assert(g(obj: m()) == 5)
+assert(g(obj:
+  m()) == 5)
+assert(g(obj: m "x") == 5 and g(obj: m {}) == 5)`, "")
+	checkScript(t, "named values", `dcl z = 7
+proc g(a, b) return b end
+proc k() return 9 end
+assert(g(a: 1, b: z) == 7)
+assert(g(b: (k()), a: 1) == 9)
+assert(g(b: f"{z}") == "7" and g(b: nil) == nil)`, "")
+	checkScript(t, "unknown parameter", `proc f(a) return a end
+f(b: 1)`, "proc 'f' has no parameter 'b'")
+	checkScript(t, "reassigned dcl proc", `dcl proc f(a) return a end
+f = proc(b) return b end
+assert(f(b: 1) == 1)`, "")
+	checkScript(t, "reassigned global proc", `proc later(p) return p end
+later = proc(q) return q end
+assert(later(q: 2) == 2)`, "")
+	checkScript(t, "global proc reassigned by a proc", `proc g(p) return p end
+proc swap() g = proc(q) return q end end
+swap()
+assert(g(q: 3) == 3)`, "")
+	checkScript(t, "global proc defined twice", `proc h(p) return p end
+if true then proc h(q) return q end end
+assert(h(q: 4) == 4)`, "")
+	checkScript(t, "reassigned proc runtime check", `proc k(p) return p end
+k = proc(q) return q end
+k(p: 1)`, "proc has no parameter 'p'")
+	checkScript(t, "named and positional", `proc f(a, b) return a end
+f(1, a: 2)`, "argument 'a' given twice")
+	checkScript(t, "named twice", `dcl g = put
+g(a: 1, a: 2)`, "argument 'a' given twice")
+	checkScript(t, "named to a Go proc", `dcl g = tostring
+g(v: 1)`, "named arguments to a Go proc")
+}
+
+// TestDestructuring - list patterns declare locals from fields and elements,
+// with rest lists of the others, in dcl and for in statements
+func TestDestructuring(t *testing.T) {
+	checkScript(t, "fields", `dcl {host, port = p, ...rest} = {host = "ford", port = 42, user = "zaphod"}
+assert(host == "ford" and p == 42 and rest.user == "zaphod")
+assert(rest.host == nil and rest.port == nil)`, "")
+	checkScript(t, "elements", `dcl [first, second, ...others] = {1, 2, 3, 4}
+assert(first == 1 and second == 2 and #others == 2 and others[1] == 3)
+dcl [x, y] = {5}
+assert(x == 5 and y == nil)`, "")
+	checkScript(t, "with other names", `dcl n, [a, b], {c} = 1, {2, 3}, {c = 4}
+assert(n + a + b + c == 10)`, "")
+	checkScript(t, "index metamethod", `dcl {v} = setmetalist({}, {__index = proc(t, k) return k .. "!" end})
+assert(v == "v!")`, "")
+	checkScript(t, "for in", `dcl sum = 0
+for _, {x, y = z} in ipairs({{x = 1, y = 2}, {x = 3, y = 4}}) do
+  sum = sum + x * z
+end
+assert(sum == 14, sum)`, "")
+	checkScript(t, "not a list", `dcl {a} = 5`, "attempt to index a non-list object")
+}
@@ -0,0 +1,264 @@
+// Package qs - q scripting language
+package qs
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+)
+
+/*
+  Coverage counts the instructions run by the procs of a state and its
+  coroutines, using the hook main loop. When the main segment of a chunk
+  first runs, it and all the procs nested in it are registered, so procs
+  that are never called are reported as not run. A source line is
+  executable when an instruction was compiled for it; the RETURN the
+  compiler adds at the end of every proc does not count.
+*/
+
+// coverProc - the instruction counts of a proc
+type coverProc struct {
+	proto *ProcProto
+	name  string
+	hits  []uint32
+}
+
+// Coverage - records the source lines run by q procs
+type Coverage struct {
+	procs     map[*ProcProto]*coverProc
+	order     []*coverProc
+	lastProto *ProcProto
+	lastHits  []uint32
+}
+
+// CoverFile - the coverage of one source file
+type CoverFile struct {
+	Name  string
+	Lines map[int]int // hits of the executable lines
+	Procs []CoverProc
+}
+
+// CoverProc - the coverage of a proc
+type CoverProc struct {
+	Name string
+	Line int
+	Hits int // calls of the proc
+}
+
+// StartCoverage - starts recording the lines run by this state and the
+// coroutines it creates
+func (ls *LState) StartCoverage() *Coverage {
+	c := &Coverage{procs: make(map[*ProcProto]*coverProc)}
+	ls.G.cover = c
+	ls.updateMainLoop()
+	return c
+}
+
+// StopCoverage - stops the recording started by StartCoverage and returns it
+func (ls *LState) StopCoverage() *Coverage {
+	c := ls.G.cover
+	if c != nil {
+		ls.G.cover = nil
+		ls.updateMainLoop()
+	}
+	return c
+}
+
+// hit - counts a run of the instruction at pc of proto
+func (c *Coverage) hit(proto *ProcProto, pc int) {
+	if proto != c.lastProto {
+		cp, ok := c.procs[proto]
+		if !ok {
+			cp = c.register(proto, "main segment")
+		}
+		c.lastProto = proto
+		c.lastHits = cp.hits
+	}
+	c.lastHits[pc]++
+}
+
+// register - adds proto and the procs nested in it
+func (c *Coverage) register(proto *ProcProto, name string) *coverProc {
+	cp := &coverProc{proto: proto, name: name, hits: make([]uint32, len(proto.Code))}
+	c.procs[proto] = cp
+	c.order = append(c.order, cp)
+	names := make([]string, len(proto.ProcPrototypes))
+	for pc, inst := range proto.Code {
+		if opGetOpCode(inst) == OP_CLOSURE {
+			if bx := opGetArgBx(inst); bx < len(names) {
+				names[bx] = closureName(proto, pc, opGetArgA(inst), int(proto.ProcPrototypes[bx].NumUpvalues))
+			}
+		}
+	}
+	for i, fp := range proto.ProcPrototypes {
+		if _, ok := c.procs[fp]; ok {
+			continue
+		}
+		pname := names[i]
+		if len(pname) == 0 {
+			pname = fmt.Sprintf("proc@%d", fp.LineDefined)
+		}
+		c.register(fp, pname)
+	}
+	return cp
+}
+
+// Files - returns the coverage of the source files run, sorted by name.
+// Chunks loaded more than once from the same file are merged.
+func (c *Coverage) Files() []*CoverFile {
+	files := map[string]*CoverFile{}
+	for _, cp := range c.order {
+		proto := cp.proto
+		f, ok := files[proto.SourceName]
+		if !ok {
+			f = &CoverFile{Name: proto.SourceName, Lines: map[int]int{}}
+			files[proto.SourceName] = f
+		}
+		code := len(proto.Code)
+		if code > 0 && opGetOpCode(proto.Code[code-1]) == OP_RETURN && opGetArgB(proto.Code[code-1]) == 1 {
+			code-- // the return added by the compiler
+		}
+		// a line ran as often as its most run instruction
+		lines := map[int]int{}
+		for pc := 0; pc < code && pc < len(proto.DbgSourcePositions); pc++ {
+			line := proto.DbgSourcePositions[pc]
+			if n := int(cp.hits[pc]); line > 0 && n >= lines[line] {
+				lines[line] = n
+			}
+		}
+		for line, n := range lines {
+			f.Lines[line] += n
+		}
+		calls := 0
+		if len(cp.hits) > 0 {
+			calls = int(cp.hits[0])
+		}
+		start := proto.LineDefined
+		if start == 0 {
+			start = 1 // main segment
+		}
+		f.Procs = append(f.Procs, CoverProc{Name: cp.name, Line: start, Hits: calls})
+	}
+	result := make([]*CoverFile, 0, len(files))
+	for _, f := range files {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// sortedLines - returns the executable lines of f in order
+func (f *CoverFile) sortedLines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for line := range f.Lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Summary - returns the number of executable lines of f and how many ran
+func (f *CoverFile) Summary() (found, hit int) {
+	for _, n := range f.Lines {
+		found++
+		if n > 0 {
+			hit++
+		}
+	}
+	return found, hit
+}
+
+// WriteLcov - writes the coverage in the lcov tracefile format
+func (c *Coverage) WriteLcov(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range c.Files() {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.Name)
+		fnhit := 0
+		for _, p := range f.Procs {
+			fmt.Fprintf(bw, "FN:%d,%s\n", p.Line, p.Name)
+		}
+		for _, p := range f.Procs {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", p.Hits, p.Name)
+			if p.Hits > 0 {
+				fnhit++
+			}
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(f.Procs), fnhit)
+		for _, line := range f.sortedLines() {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, f.Lines[line])
+		}
+		found, hit := f.Summary()
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", found, hit)
+	}
+	return bw.Flush()
+}
+
+const coverHTMLHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Q coverage</title>
+<style>
+body { font-family: sans-serif; }
+table.src { border-collapse: collapse; font-family: monospace; white-space: pre; }
+table.src td { padding: 0 6px; }
+td.num { text-align: right; color: #888; }
+tr.hit { background: #d8f5d8; }
+tr.miss { background: #f8d0d0; }
+tr.none { color: #666; }
+</style>
+</head>
+<body>
+<h1>Q coverage</h1>
+<p>Green lines ran, red lines did not run, grey lines have no code.</p>
+`
+
+// WriteHTML - writes a report of the covered lines of every file, with the
+// source read from the files
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	files := c.Files()
+	bw.WriteString(coverHTMLHead)
+	bw.WriteString("<table>\n<tr><th>File</th><th>Lines</th><th>Run</th><th>Coverage</th></tr>\n")
+	for i, f := range files {
+		found, hit := f.Summary()
+		fmt.Fprintf(bw, "<tr><td><a href=\"#file%d\">%s</a></td><td>%d</td><td>%d</td><td>%s</td></tr>\n",
+			i, html.EscapeString(f.Name), found, hit, percent(hit, found))
+	}
+	bw.WriteString("</table>\n")
+	for i, f := range files {
+		found, hit := f.Summary()
+		fmt.Fprintf(bw, "<h2 id=\"file%d\">%s %s</h2>\n", i, html.EscapeString(f.Name), percent(hit, found))
+		src := readSourceLines(f.Name)
+		if src == nil {
+			bw.WriteString("<p>source not available</p>\n")
+			continue
+		}
+		bw.WriteString("<table class=\"src\">\n")
+		for n, text := range src {
+			line := n + 1
+			class, count := "none", ""
+			if hits, ok := f.Lines[line]; ok {
+				class, count = "miss", "0"
+				if hits > 0 {
+					class, count = "hit", fmt.Sprint(hits)
+				}
+			}
+			fmt.Fprintf(bw, "<tr class=\"%s\"><td class=\"num\">%d</td><td class=\"num\">%s</td><td>%s</td></tr>\n",
+				class, line, count, html.EscapeString(text))
+		}
+		bw.WriteString("</table>\n")
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// percent - formats part of total as a percentage
+func percent(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+}
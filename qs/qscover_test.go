@@ -0,0 +1,69 @@
+package qs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// coverScript - the branch of the if on line 3 is never taken and proc
+// unused is never called
+const coverScript = `proc sign(n)
+  if n < 0 then
+    return -1
+  end
+  return 1
+end
+proc unused()
+  return 0
+end
+dcl s = 0
+for i = 1, 3 do s = s + sign(i) end
+`
+
+// TestCoverLcov - the lcov tracefile counts the lines of a branch that is
+// never taken as executable lines that did not run
+func TestCoverLcov(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	fn, err := L.Load(strings.NewReader(coverScript), "cover.q")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	c := L.StartCoverage()
+	L.Push(fn)
+	err = L.PCall(0, 0, nil)
+	L.StopCoverage()
+	if err != nil {
+		t.Fatalf("PCall: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := c.WriteLcov(&buf); err != nil {
+		t.Fatalf("WriteLcov: %v", err)
+	}
+	want := `TN:
+SF:cover.q
+FN:1,main segment
+FN:1,sign
+FN:7,unused
+FNDA:1,main segment
+FNDA:3,sign
+FNDA:0,unused
+FNF:3
+FNH:2
+DA:1,1
+DA:2,3
+DA:3,0
+DA:5,3
+DA:7,1
+DA:8,0
+DA:10,1
+DA:11,4
+LF:8
+LH:6
+end_of_record
+`
+	if got := buf.String(); got != want {
+		t.Errorf("lcov\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,657 @@
+// package qsdap q language debug adapter protocol server
+package qsdap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/x0ray/q/qs"
+)
+
+/*
+  The server speaks the Debug Adapter Protocol used by editors like VS Code
+  and Neovim. Messages are JSON with a Content-Length header. The script
+  runs in its own goroutine under a qs.Debugger, when it stops the debugger
+  waits for jobs from the server, the requests that inspect the stopped
+  script are run as jobs on the script goroutine and a step or continue
+  request ends the wait. All coroutines are reported as the one thread.
+*/
+
+const threadID = 1
+
+// message - a DAP request, response or event
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"` // set for responses
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       interface{}     `json:"body,omitempty"`
+}
+
+// job - runs on the script goroutine while it is stopped, resume is true
+// when the script goes on with action
+type job func() (action qs.DebugAction, resume bool)
+
+// varRef - what a variables reference of the stopped script refers to
+type varRef struct {
+	scope string // "locals", "upvalues" or "globals", empty for a list
+	level int
+	list  *qs.LOAList
+}
+
+// Server - a debug adapter for one client
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	wmu sync.Mutex // guards out and seq
+	seq int
+
+	mu          sync.Mutex // guards the fields below
+	L           *qs.LState
+	d           *qs.Debugger
+	program     string
+	args        []string
+	stopOnEntry bool
+	launched    bool
+	configured  bool
+	running     bool
+	stopped     bool
+	aborted     bool
+	refs        []varRef
+	jobs        chan job
+	done        chan struct{}
+
+	stdout    *os.File      // os.Stdout replaced by CaptureStdout
+	pipe      *os.File      // the write end of the pipe replacing it
+	forwarded chan struct{} // closed when all the output was sent
+}
+
+// NewServer - returns a server reading requests from r and writing
+// responses and events to w
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{in: bufio.NewReader(r), out: w, jobs: make(chan job), done: make(chan struct{})}
+}
+
+// ListenAndServe - waits for a client on the TCP address addr, like
+// "127.0.0.1:4711", and serves it
+func ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return NewServer(conn, conn).Serve()
+}
+
+// Serve - handles requests until the client disconnects or the input ends
+func (s *Server) Serve() error {
+	defer s.shutdown()
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if s.handle(req) {
+			return nil
+		}
+	}
+}
+
+// CaptureStdout - replaces os.Stdout by a pipe until the script ends, what
+// the script writes is sent to the client as output events. It is used
+// when the protocol is served on stdout, before Serve is called.
+func (s *Server) CaptureStdout() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	s.stdout, s.pipe = os.Stdout, w
+	s.forwarded = make(chan struct{})
+	os.Stdout = w
+	go func() {
+		defer close(s.forwarded)
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if len(line) > 0 {
+				s.event("output", map[string]interface{}{"category": "stdout", "output": line})
+			}
+			if err != nil {
+				r.Close()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// endCapture - restores os.Stdout and waits until the output of the script
+// was sent
+func (s *Server) endCapture() {
+	if s.pipe == nil {
+		return
+	}
+	os.Stdout = s.stdout
+	s.pipe.Close()
+	s.pipe = nil
+	<-s.forwarded
+}
+
+// read - reads a message
+func (s *Server) read() (*message, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		if i := strings.Index(line, ":"); i > 0 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil {
+				return nil, fmt.Errorf("bad Content-Length header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.in, data); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("bad message: %v", err)
+	}
+	return msg, nil
+}
+
+// write - writes a message with the next sequence number
+func (s *Server) write(msg *message) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	msg.Seq = s.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(&message{Seq: s.seq, Type: "event", Event: "output",
+			Body: map[string]string{"category": "stderr", "output": err.Error() + "\n"}})
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// respond - writes the response to req, body may be nil
+func (s *Server) respond(req *message, body interface{}) {
+	success := true
+	s.write(&message{Type: "response", Command: req.Command, RequestSeq: req.Seq, Success: &success, Body: body})
+}
+
+// fail - writes an error response to req
+func (s *Server) fail(req *message, format string, a ...interface{}) {
+	success := false
+	s.write(&message{Type: "response", Command: req.Command, RequestSeq: req.Seq, Success: &success,
+		Message: fmt.Sprintf(format, a...)})
+}
+
+// event - writes an event
+func (s *Server) event(event string, body interface{}) {
+	s.write(&message{Type: "event", Event: event, Body: body})
+}
+
+// handle - handles a request, returns true when the session ends
+func (s *Server) handle(req *message) bool {
+	var args struct {
+		Program     string   `json:"program"`
+		Args        []string `json:"args"`
+		StopOnEntry bool     `json:"stopOnEntry"`
+		Source      struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int    `json:"line"`
+			Name string `json:"name"`
+		} `json:"breakpoints"`
+		Lines              []int  `json:"lines"`
+		ThreadID           int    `json:"threadId"`
+		StartFrame         int    `json:"startFrame"`
+		Levels             int    `json:"levels"`
+		FrameID            int    `json:"frameId"`
+		VariablesReference int    `json:"variablesReference"`
+		Expression         string `json:"expression"`
+	}
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			s.fail(req, "bad arguments: %v", err)
+			return false
+		}
+	}
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		if len(args.Program) == 0 {
+			s.fail(req, "launch needs a program")
+			return false
+		}
+		s.mu.Lock()
+		s.program, s.args, s.stopOnEntry = args.Program, args.Args, args.StopOnEntry
+		s.launched = true
+		s.mu.Unlock()
+		s.setArgs()
+		s.respond(req, nil)
+		s.start()
+	case "configurationDone":
+		s.mu.Lock()
+		s.configured = true
+		s.mu.Unlock()
+		s.respond(req, nil)
+		s.start()
+	case "setBreakpoints":
+		d := s.debugger()
+		if len(args.Breakpoints) == 0 {
+			for _, line := range args.Lines {
+				args.Breakpoints = append(args.Breakpoints, struct {
+					Line int    `json:"line"`
+					Name string `json:"name"`
+				}{Line: line})
+			}
+		}
+		d.ClearBreakpoints(args.Source.Path)
+		bps := []map[string]interface{}{}
+		for _, b := range args.Breakpoints {
+			bp := d.SetBreakpoint(args.Source.Path, b.Line)
+			bps = append(bps, map[string]interface{}{"id": bp.ID, "verified": true, "line": bp.Line})
+		}
+		s.respond(req, map[string]interface{}{"breakpoints": bps})
+	case "setFunctionBreakpoints":
+		d := s.debugger()
+		d.ClearBreakpoints("")
+		bps := []map[string]interface{}{}
+		for _, b := range args.Breakpoints {
+			bp := d.SetFuncBreakpoint(b.Name)
+			bps = append(bps, map[string]interface{}{"id": bp.ID, "verified": true})
+		}
+		s.respond(req, map[string]interface{}{"breakpoints": bps})
+	case "setExceptionBreakpoints":
+		s.respond(req, map[string]interface{}{"breakpoints": []interface{}{}})
+	case "threads":
+		s.respond(req, map[string]interface{}{"threads": []map[string]interface{}{{"id": threadID, "name": "main"}}})
+	case "stackTrace":
+		s.inspect(req, func(d *qs.Debugger) (interface{}, error) {
+			return s.stackTrace(d, args.StartFrame, args.Levels), nil
+		})
+	case "scopes":
+		s.inspect(req, func(d *qs.Debugger) (interface{}, error) {
+			return s.scopes(d, args.FrameID-1)
+		})
+	case "variables":
+		s.inspect(req, func(d *qs.Debugger) (interface{}, error) {
+			return s.variables(d, args.VariablesReference)
+		})
+	case "evaluate":
+		s.inspect(req, func(d *qs.Debugger) (interface{}, error) {
+			level := 0
+			if args.FrameID > 0 {
+				level = args.FrameID - 1
+			}
+			values, err := d.Eval(level, args.Expression)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]string, len(values))
+			ref := 0
+			for i, v := range values {
+				result[i] = s.valueText(v)
+			}
+			if len(values) == 1 {
+				ref = s.listRef(values[0])
+			}
+			return map[string]interface{}{"result": strings.Join(result, ", "), "variablesReference": ref}, nil
+		})
+	case "continue":
+		s.resume(req, qs.DebugContinue, map[string]interface{}{"allThreadsContinued": true})
+	case "next":
+		s.resume(req, qs.DebugStepOver, nil)
+	case "stepIn":
+		s.resume(req, qs.DebugStepIn, nil)
+	case "stepOut":
+		s.resume(req, qs.DebugStepOut, nil)
+	case "pause":
+		s.debugger().Pause()
+		s.respond(req, nil)
+	case "terminate":
+		s.abort()
+		s.respond(req, nil)
+	case "disconnect":
+		s.abort()
+		s.respond(req, nil)
+		return true
+	default:
+		s.fail(req, "unsupported request %s", req.Command)
+	}
+	return false
+}
+
+// debugger - returns the debugger, creating the state it debugs when
+// breakpoints are set before the launch
+func (s *Server) debugger() *qs.Debugger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		s.L = qs.NewState()
+		s.d = qs.NewDebugger(s.L)
+		s.d.OnStop = s.onStop
+	}
+	return s.d
+}
+
+// setArgs - sets the arg global of the state to the script args
+func (s *Server) setArgs() {
+	d := s.debugger()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.StopOnEntry = s.stopOnEntry
+	argtb := s.L.NewOAList()
+	for i, arg := range s.args {
+		s.L.RawSet(argtb, qs.LNumber(i+1), qs.LString(arg))
+	}
+	s.L.SetGlobal("arg", argtb)
+}
+
+// start - runs the script once it is launched and configured
+func (s *Server) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.launched || !s.configured || s.running {
+		return
+	}
+	s.running = true
+	L, d, program := s.L, s.d, s.program
+	go func() {
+		defer close(s.done)
+		exitCode := 0
+		if err := L.DoFile(program); err != nil {
+			exitCode = 1
+			s.mu.Lock()
+			aborted := s.aborted
+			s.mu.Unlock()
+			if !aborted {
+				s.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+			}
+		}
+		d.Close()
+		s.endCapture()
+		s.event("exited", map[string]interface{}{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// abort - stops the script and waits for it to end
+func (s *Server) abort() {
+	s.mu.Lock()
+	running, d := s.running, s.d
+	s.aborted = true
+	s.mu.Unlock()
+	if !running {
+		return
+	}
+	d.Abort()
+	for {
+		select {
+		case s.jobs <- func() (qs.DebugAction, bool) { return qs.DebugAbort, true }:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// shutdown - stops a script still running when the session ends
+func (s *Server) shutdown() {
+	s.abort()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		s.endCapture()
+	}
+	if s.L != nil {
+		s.L.Close()
+	}
+}
+
+// onStop - tells the client the script stopped and runs jobs until one
+// resumes the script
+func (s *Server) onStop(d *qs.Debugger, reason string, bp *qs.Breakpoint) qs.DebugAction {
+	s.mu.Lock()
+	s.stopped = true
+	s.refs = nil
+	s.mu.Unlock()
+	body := map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true}
+	if bp != nil {
+		if len(bp.Func) > 0 {
+			body["reason"] = "function breakpoint"
+		}
+		body["hitBreakpointIds"] = []int{bp.ID}
+	}
+	s.event("stopped", body)
+	for j := range s.jobs {
+		if action, resume := j(); resume {
+			return action
+		}
+	}
+	return qs.DebugAbort
+}
+
+// inspect - runs fn on the stopped script and responds with its result
+func (s *Server) inspect(req *message, fn func(d *qs.Debugger) (interface{}, error)) {
+	s.mu.Lock()
+	stopped, d := s.stopped, s.d
+	s.mu.Unlock()
+	if !stopped {
+		s.fail(req, "the script is not stopped")
+		return
+	}
+	var body interface{}
+	var err error
+	wait := make(chan struct{})
+	s.jobs <- func() (qs.DebugAction, bool) {
+		body, err = fn(d)
+		close(wait)
+		return qs.DebugContinue, false
+	}
+	<-wait
+	if err != nil {
+		s.fail(req, "%s", strings.TrimSpace(err.Error()))
+		return
+	}
+	s.respond(req, body)
+}
+
+// resume - responds to req and resumes the stopped script with action
+func (s *Server) resume(req *message, action qs.DebugAction, body interface{}) {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.stopped = false
+	s.mu.Unlock()
+	if !stopped {
+		s.fail(req, "the script is not stopped")
+		return
+	}
+	s.respond(req, body)
+	s.jobs <- func() (qs.DebugAction, bool) { return action, true }
+}
+
+// stackTrace - the body of a stackTrace response, frame ids are levels + 1
+func (s *Server) stackTrace(d *qs.Debugger, start, levels int) interface{} {
+	frames := d.Stack()
+	list := []map[string]interface{}{}
+	for _, fr := range frames {
+		if fr.Level < start || levels > 0 && fr.Level >= start+levels {
+			continue
+		}
+		sf := map[string]interface{}{"id": fr.Level + 1, "name": fr.Name, "line": fr.Line, "column": 1}
+		if fr.Line < 0 {
+			sf["line"] = 0
+			sf["presentationHint"] = "subtle"
+		} else {
+			path := fr.Source
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			sf["source"] = map[string]string{"name": filepath.Base(path), "path": path}
+		}
+		list = append(list, sf)
+	}
+	return map[string]interface{}{"stackFrames": list, "totalFrames": len(frames)}
+}
+
+// scopes - the body of a scopes response
+func (s *Server) scopes(d *qs.Debugger, level int) (interface{}, error) {
+	if _, err := d.Frame(level); err != nil {
+		return nil, err
+	}
+	scope := func(name, kind string, expensive bool) map[string]interface{} {
+		ref := s.addRef(varRef{scope: kind, level: level})
+		return map[string]interface{}{"name": name, "variablesReference": ref, "expensive": expensive}
+	}
+	return map[string]interface{}{"scopes": []map[string]interface{}{
+		scope("Locals", "locals", false),
+		scope("Upvalues", "upvalues", false),
+		scope("Globals", "globals", true),
+	}}, nil
+}
+
+// variables - the body of a variables response
+func (s *Server) variables(d *qs.Debugger, ref int) (interface{}, error) {
+	s.mu.Lock()
+	if ref < 1 || ref > len(s.refs) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("no variables reference %d", ref)
+	}
+	vr := s.refs[ref-1]
+	s.mu.Unlock()
+	var vars []qs.DebugVar
+	var err error
+	switch vr.scope {
+	case "locals":
+		vars, err = d.Locals(vr.level)
+	case "upvalues":
+		vars, err = d.Upvalues(vr.level)
+	case "globals":
+		vars = d.Globals()
+	default:
+		vars = listItems(vr.list)
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []map[string]interface{}{}
+	for _, v := range vars {
+		list = append(list, map[string]interface{}{
+			"name":               v.Name,
+			"value":              s.valueText(v.Value),
+			"type":               v.Value.Type().String(),
+			"variablesReference": s.listRef(v.Value),
+		})
+	}
+	return map[string]interface{}{"variables": list}, nil
+}
+
+// addRef - returns a new variables reference to vr
+func (s *Server) addRef(vr varRef) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs = append(s.refs, vr)
+	return len(s.refs)
+}
+
+// listRef - returns a variables reference to the items of lv when it is a
+// list that is not empty, 0 otherwise
+func (s *Server) listRef(lv qs.LValue) int {
+	if lst, ok := lv.(*qs.LOAList); ok {
+		if k, _ := lst.Next(qs.LNil); k != qs.LNil {
+			return s.addRef(varRef{list: lst})
+		}
+	}
+	return 0
+}
+
+// valueText - formats a value on one line
+func (s *Server) valueText(lv qs.LValue) string {
+	text := strings.Join(strings.Fields(qs.FormatValue(lv)), " ")
+	if _, ok := lv.(qs.LString); ok {
+		text = qs.FormatValue(lv)
+	}
+	if len(text) > 100 {
+		text = text[:97] + "..."
+	}
+	return text
+}
+
+// listItems - the items of a list, the array items first and then the
+// other keys in order
+func listItems(lst *qs.LOAList) []qs.DebugVar {
+	n := lst.Len()
+	var vars, keyed []qs.DebugVar
+	for i := 1; i <= n; i++ {
+		vars = append(vars, qs.DebugVar{Name: "[" + strconv.Itoa(i) + "]", Value: lst.RawGetInt(i)})
+	}
+	lst.ForEach(func(k, v qs.LValue) {
+		if i, ok := arrayIndex(k); ok && i >= 1 && i <= n {
+			return
+		}
+		name := k.String()
+		if _, ok := k.(qs.LString); !ok {
+			name = "[" + name + "]"
+		}
+		keyed = append(keyed, qs.DebugVar{Name: name, Value: v})
+	})
+	sort.Slice(keyed, func(i, j int) bool { return keyed[i].Name < keyed[j].Name })
+	return append(vars, keyed...)
+}
+
+// arrayIndex - returns k as an int when it is an integer number
+func arrayIndex(k qs.LValue) (int, bool) {
+	switch n := k.(type) {
+	case qs.LInteger:
+		return int(n), true
+	case qs.LNumber:
+		if float64(n) == float64(int(n)) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
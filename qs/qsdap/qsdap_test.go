@@ -0,0 +1,316 @@
+package qsdap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testScript = `// dap test script
+proc add(a, b)
+  dcl s = a + b
+  return s
+end
+
+dcl total = 0
+dcl cfg = {host = "localhost", port = 80}
+for i = 1, 3 do
+  total = add(total, i)
+end
+cfg.total = total
+`
+
+// testClient - a scripted DAP client talking to a server over pipes
+type testClient struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	msgs   chan map[string]interface{}
+	seq    int
+	events []map[string]interface{}
+	done   chan error
+}
+
+// newTestClient - starts a server for the client
+func newTestClient(t *testing.T) *testClient {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	c := &testClient{t: t, w: cw, r: bufio.NewReader(cr), done: make(chan error, 1),
+		msgs: make(chan map[string]interface{}, 100)}
+	go func() {
+		err := NewServer(sr, sw).Serve()
+		sw.Close()
+		c.done <- err
+	}()
+	go c.readAll()
+	return c
+}
+
+// writeScript - writes the test script to a temporary file
+func writeScript(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "dap.q")
+	if err := os.WriteFile(path, []byte(testScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAll - reads the messages from the server, so the server never waits
+// for the client to read them
+func (c *testClient) readAll() {
+	defer close(c.msgs)
+	for {
+		length := -1
+		for {
+			line, err := c.r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if len(line) == 0 {
+				break
+			}
+			if strings.HasPrefix(line, "Content-Length:") {
+				length, _ = strconv.Atoi(strings.TrimSpace(line[len("Content-Length:"):]))
+			}
+		}
+		if length < 0 {
+			return
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return
+		}
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			msg = map[string]interface{}{"type": "bad", "data": string(data)}
+		}
+		c.msgs <- msg
+	}
+}
+
+// read - returns the next message from the server
+func (c *testClient) read() map[string]interface{} {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	return nil
+}
+
+// request - sends a request and returns its response, keeping the events
+// read before it
+func (c *testClient) request(command string, args interface{}) map[string]interface{} {
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	for {
+		msg := c.read()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg["type"] != "response" || int(msg["request_seq"].(float64)) != c.seq {
+			c.t.Fatalf("unexpected message %v", msg)
+		}
+		return msg
+	}
+}
+
+// ok - sends a request that must succeed and returns the response body
+func (c *testClient) ok(command string, args interface{}) map[string]interface{} {
+	resp := c.request(command, args)
+	if resp["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, resp["message"])
+	}
+	body, _ := resp["body"].(map[string]interface{})
+	return body
+}
+
+// event - returns the body of the next event named name
+func (c *testClient) event(name string) map[string]interface{} {
+	for {
+		var msg map[string]interface{}
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+// top - returns the name and line of the top frame of the stopped script
+func (c *testClient) top() (string, int) {
+	body := c.ok("stackTrace", map[string]interface{}{"threadId": 1})
+	frames := body["stackFrames"].([]interface{})
+	fr := frames[0].(map[string]interface{})
+	return fr["name"].(string), int(fr["line"].(float64))
+}
+
+// vars - returns the values of the variables of ref by name
+func (c *testClient) vars(ref float64) map[string]string {
+	body := c.ok("variables", map[string]interface{}{"variablesReference": ref})
+	vars := map[string]string{}
+	for _, v := range body["variables"].([]interface{}) {
+		vm := v.(map[string]interface{})
+		vars[vm["name"].(string)] = vm["value"].(string)
+	}
+	return vars
+}
+
+// scope - returns the variables reference of the named scope of frame id
+func (c *testClient) scope(id int, name string) float64 {
+	body := c.ok("scopes", map[string]interface{}{"frameId": id})
+	for _, s := range body["scopes"].([]interface{}) {
+		sm := s.(map[string]interface{})
+		if sm["name"] == name {
+			return sm["variablesReference"].(float64)
+		}
+	}
+	c.t.Fatalf("no scope %s", name)
+	return 0
+}
+
+// finish - waits for the server to end
+func (c *testClient) finish() {
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Fatalf("server error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("server did not end")
+	}
+}
+
+// TestBreakpointsAndInspection - stops at a line breakpoint, inspects the
+// frames, scopes and variables, evaluates expressions and steps
+func TestBreakpointsAndInspection(t *testing.T) {
+	path := writeScript(t)
+	c := newTestClient(t)
+	body := c.ok("initialize", map[string]interface{}{"adapterID": "q"})
+	if body["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("initialize capabilities: %v", body)
+	}
+	c.event("initialized")
+	body = c.ok("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 3}},
+	})
+	bps := body["breakpoints"].([]interface{})
+	if len(bps) != 1 || bps[0].(map[string]interface{})["verified"] != true {
+		t.Fatalf("setBreakpoints: %v", body)
+	}
+	c.ok("launch", map[string]interface{}{"program": path})
+	c.ok("configurationDone", nil)
+
+	stop := c.event("stopped")
+	if stop["reason"] != "breakpoint" {
+		t.Errorf("stopped reason %v", stop["reason"])
+	}
+	body = c.ok("stackTrace", map[string]interface{}{"threadId": 1})
+	frames := body["stackFrames"].([]interface{})
+	if len(frames) != 2 {
+		t.Fatalf("stackTrace frames: %v", frames)
+	}
+	fr := frames[0].(map[string]interface{})
+	if fr["name"] != "add" || fr["line"].(float64) != 3 {
+		t.Errorf("top frame: %v", fr)
+	}
+	if src := fr["source"].(map[string]interface{}); src["path"] != path {
+		t.Errorf("top frame source: %v", src)
+	}
+
+	locals := c.vars(c.scope(1, "Locals"))
+	if locals["a"] != "0" || locals["b"] != "1" {
+		t.Errorf("locals of add: %v", locals)
+	}
+	body = c.ok("evaluate", map[string]interface{}{"expression": "a + b * 10", "frameId": 1})
+	if body["result"] != "10" {
+		t.Errorf("evaluate a + b * 10: %v", body)
+	}
+	body = c.ok("evaluate", map[string]interface{}{"expression": "cfg", "frameId": 2})
+	ref, _ := body["variablesReference"].(float64)
+	if ref == 0 {
+		t.Fatalf("evaluate cfg has no variables: %v", body)
+	}
+	if items := c.vars(ref); items["host"] != `"localhost"` || items["port"] != "80" {
+		t.Errorf("items of cfg: %v", items)
+	}
+	if resp := c.request("evaluate", map[string]interface{}{"expression": "nosuch.x", "frameId": 1}); resp["success"] != false {
+		t.Errorf("evaluate of a bad expression succeeded: %v", resp)
+	}
+
+	c.ok("next", map[string]interface{}{"threadId": 1})
+	c.event("stopped")
+	if name, line := c.top(); name != "add" || line != 4 {
+		t.Errorf("after next at %s:%d", name, line)
+	}
+	// the last line of add, its locals are still in scope
+	locals = c.vars(c.scope(1, "Locals"))
+	if locals["a"] != "0" || locals["b"] != "1" || locals["s"] != "1" {
+		t.Errorf("locals of add at return: %v", locals)
+	}
+	c.ok("stepOut", map[string]interface{}{"threadId": 1})
+	c.event("stopped")
+	if name, _ := c.top(); name != "main segment" {
+		t.Errorf("after stepOut in %s", name)
+	}
+
+	// no breakpoints, runs to the end
+	c.ok("setBreakpoints", map[string]interface{}{"source": map[string]string{"path": path}, "breakpoints": []interface{}{}})
+	c.ok("continue", map[string]interface{}{"threadId": 1})
+	if exit := c.event("exited"); exit["exitCode"].(float64) != 0 {
+		t.Errorf("exit code %v", exit["exitCode"])
+	}
+	c.event("terminated")
+	c.ok("disconnect", nil)
+	c.finish()
+}
+
+// TestFunctionBreakpointAndDisconnect - stops on entry and at a proc
+// breakpoint, then disconnects while the script is stopped
+func TestFunctionBreakpointAndDisconnect(t *testing.T) {
+	path := writeScript(t)
+	c := newTestClient(t)
+	c.ok("initialize", nil)
+	c.ok("setFunctionBreakpoints", map[string]interface{}{"breakpoints": []map[string]string{{"name": "add"}}})
+	c.ok("launch", map[string]interface{}{"program": path, "stopOnEntry": true})
+	c.ok("configurationDone", nil)
+
+	if stop := c.event("stopped"); stop["reason"] != "entry" {
+		t.Errorf("stopped reason %v, want entry", stop["reason"])
+	}
+	if resp := c.request("variables", map[string]interface{}{"variablesReference": 99}); resp["success"] != false {
+		t.Errorf("variables of a bad reference succeeded")
+	}
+	c.ok("continue", map[string]interface{}{"threadId": 1})
+	if stop := c.event("stopped"); stop["reason"] != "function breakpoint" {
+		t.Errorf("stopped reason %v, want function breakpoint", stop["reason"])
+	}
+	if name, line := c.top(); name != "add" || line != 3 {
+		t.Errorf("function breakpoint at %s:%d", name, line)
+	}
+	globals := c.vars(c.scope(2, "Globals"))
+	if _, ok := globals["add"]; !ok {
+		t.Errorf("globals without add: %v", globals)
+	}
+	c.ok("disconnect", nil)
+	c.finish()
+}
@@ -0,0 +1,652 @@
+// Package qs - q scripting language
+package qs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+  The debugger stops a script at breakpoints and steps through it, using the
+  call and line hooks (see qshook.go). When the script stops, OnStop is
+  called on the goroutine running the script, it inspects the stopped
+  script with Stack, Locals, Upvalues, Globals and Eval and returns how the
+  script goes on. Stepping compares the number of frames of the stopped
+  thread and the threads that resumed it with the number when the step
+  started: step in stops at the next line, step over at the next line that
+  is not in a called proc and step out at the next line of a caller.
+  Breakpoints can be set, and the script paused or aborted, from any
+  goroutine, the other methods are used while the script is stopped.
+*/
+
+// DebugAction - how a stopped script goes on
+type DebugAction int
+
+const (
+	DebugContinue DebugAction = iota // run to the next breakpoint
+	DebugStepIn                      // stop at the next line, also in called procs
+	DebugStepOver                    // stop at the next line of this proc or a caller
+	DebugStepOut                     // stop at the next line of a caller
+	DebugAbort                       // stop the script, errors are raised until it ends
+)
+
+// Breakpoint - a source line or proc name the script stops at
+type Breakpoint struct {
+	ID     int
+	Source string // source file, for line breakpoints
+	Line   int
+	Func   string // proc name, for proc breakpoints
+	Hits   int
+}
+
+// String - describes the breakpoint as used by the debug command
+func (bp *Breakpoint) String() string {
+	if len(bp.Func) > 0 {
+		return fmt.Sprintf("%d: proc %s", bp.ID, bp.Func)
+	}
+	return fmt.Sprintf("%d: %s:%d", bp.ID, bp.Source, bp.Line)
+}
+
+// DebugFrame - a frame of the stopped script, level 0 is the proc that stopped
+type DebugFrame struct {
+	Level  int
+	Name   string
+	Source string // "[G]" for built in procs
+	Line   int    // -1 for built in procs
+	Proc   *LProc
+	thread *LState
+	frame  *callFrame
+	pc     int // the locals in scope are those of the instruction at pc
+}
+
+// localName - returns the name of local no of the frame, "" if there is none
+func (df *DebugFrame) localName(no int) string {
+	name, _ := df.Proc.LocalName(no, df.pc)
+	return name
+}
+
+// local - returns the value of local no of the frame
+func (df *DebugFrame) local(no int) LValue {
+	return df.thread.reg.Get(df.frame.LocalBase + no - 1)
+}
+
+// setLocal - sets local no of the frame
+func (df *DebugFrame) setLocal(no int, lv LValue) {
+	df.thread.reg.Set(df.frame.LocalBase+no-1, lv)
+}
+
+// DebugVar - a named value of a frame
+type DebugVar struct {
+	Name  string
+	Value LValue
+}
+
+// Debugger - stops a script at breakpoints and steps through it
+type Debugger struct {
+	// OnStop is called when the script stops, reason is "entry",
+	// "breakpoint", "step" or "pause", bp is the breakpoint hit if any
+	OnStop      func(d *Debugger, reason string, bp *Breakpoint) DebugAction
+	StopOnEntry bool // stop at the first line run
+
+	L        *LState
+	mu       sync.Mutex // guards the breakpoints
+	nextID   int
+	bps      []*Breakpoint
+	lines    map[int][]*Breakpoint // line breakpoints by line
+	funcs    []*Breakpoint         // proc breakpoints
+	funcHit  *Breakpoint           // proc breakpoint to stop at on the next line
+	action   DebugAction
+	depth    int
+	pause    int32
+	aborted  int32
+	thread   *LState // the stopped thread, nil while running
+	frames   []*DebugFrame
+	builtins map[LValue]bool // globals set before the script ran
+}
+
+// NewDebugger - installs a debugger on L, it stops the scripts run by L and
+// the coroutines they create
+func NewDebugger(L *LState) *Debugger {
+	d := &Debugger{L: L, lines: map[int][]*Breakpoint{}, builtins: map[LValue]bool{}}
+	L.G.Global.ForEach(func(k, v LValue) { d.builtins[k] = true })
+	L.SetHook(MaskCall|MaskLine, 0, d.hook)
+	return d
+}
+
+// Close - removes the hook of the debugger
+func (d *Debugger) Close() {
+	d.L.SetHook(0, 0, nil)
+}
+
+// SetBreakpoint - stops the script before line of the source file runs. The
+// source matches the file name the script was loaded with, its absolute
+// path, or only the base name when source has no directory.
+func (d *Debugger) SetBreakpoint(source string, line int) *Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextID++
+	bp := &Breakpoint{ID: d.nextID, Source: source, Line: line}
+	d.bps = append(d.bps, bp)
+	d.lines[line] = append(d.lines[line], bp)
+	return bp
+}
+
+// SetFuncBreakpoint - stops the script at the first line of the procs called
+// name, a method name matches calls like obj.name and obj:name
+func (d *Debugger) SetFuncBreakpoint(name string) *Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nextID++
+	bp := &Breakpoint{ID: d.nextID, Func: name}
+	d.bps = append(d.bps, bp)
+	d.funcs = append(d.funcs, bp)
+	return bp
+}
+
+// ClearBreakpoint - removes the breakpoint with id, false when there is none
+func (d *Debugger) ClearBreakpoint(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, bp := range d.bps {
+		if bp.ID == id {
+			d.bps = append(d.bps[:i], d.bps[i+1:]...)
+			d.indexLines()
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints - removes the line breakpoints of source, or the proc
+// breakpoints when source is empty
+func (d *Debugger) ClearBreakpoints(source string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	kept := d.bps[:0]
+	for _, bp := range d.bps {
+		if len(source) == 0 && len(bp.Func) > 0 || len(source) > 0 && bp.Source == source {
+			continue
+		}
+		kept = append(kept, bp)
+	}
+	d.bps = kept
+	d.indexLines()
+}
+
+// Breakpoints - returns copies of the breakpoints in the order they were set
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bps := make([]*Breakpoint, len(d.bps))
+	for i, bp := range d.bps {
+		c := *bp
+		bps[i] = &c
+	}
+	return bps
+}
+
+// indexLines - rebuilds the line breakpoints by line and the proc breakpoints
+func (d *Debugger) indexLines() {
+	d.lines = map[int][]*Breakpoint{}
+	d.funcs = nil
+	for _, bp := range d.bps {
+		if len(bp.Func) > 0 {
+			d.funcs = append(d.funcs, bp)
+		} else {
+			d.lines[bp.Line] = append(d.lines[bp.Line], bp)
+		}
+	}
+}
+
+// Pause - stops the running script at the next line, it can be called from
+// any goroutine
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.pause, 1)
+}
+
+// Abort - stops the script, errors are raised at every call and line until
+// it ends, it can be called from any goroutine
+func (d *Debugger) Abort() {
+	atomic.StoreInt32(&d.aborted, 1)
+}
+
+// Stopped - reports if the script is stopped
+func (d *Debugger) Stopped() bool {
+	return d.thread != nil
+}
+
+// hook - the hook of the debugger, stops the script when a breakpoint is hit
+// or a step ends
+func (d *Debugger) hook(L *LState, event HookEvent, line int) {
+	if atomic.LoadInt32(&d.aborted) != 0 {
+		L.RaiseError("script stopped by the debugger")
+	}
+	cf := L.currentFrame
+	if cf == nil || cf.Fn.IsG {
+		return
+	}
+	if event == HookCall {
+		if d.funcHit == nil {
+			d.mu.Lock()
+			d.funcHit = d.funcBreakpoint(L, cf)
+			d.mu.Unlock()
+		}
+		return
+	}
+	if event != HookLine {
+		return
+	}
+	var bp *Breakpoint
+	reason := ""
+	if d.funcHit != nil {
+		bp, d.funcHit = d.funcHit, nil
+		reason = "breakpoint"
+	} else if bp = d.lineBreakpoint(cf.Fn.Proto.SourceName, line); bp != nil {
+		reason = "breakpoint"
+	} else if atomic.CompareAndSwapInt32(&d.pause, 1, 0) {
+		reason = "pause"
+	} else if d.StopOnEntry {
+		reason = "entry"
+	} else {
+		switch d.action {
+		case DebugStepIn:
+			reason = "step"
+		case DebugStepOver:
+			if threadDepth(L) <= d.depth {
+				reason = "step"
+			}
+		case DebugStepOut:
+			if threadDepth(L) < d.depth {
+				reason = "step"
+			}
+		}
+	}
+	if len(reason) == 0 {
+		return
+	}
+	d.StopOnEntry = false
+	if bp != nil {
+		d.mu.Lock()
+		bp.Hits++
+		c := *bp
+		d.mu.Unlock()
+		bp = &c
+	}
+	d.stop(L, reason, bp)
+}
+
+// stop - calls OnStop for the stopped thread L and records how to go on
+func (d *Debugger) stop(L *LState, reason string, bp *Breakpoint) {
+	action := DebugContinue
+	d.thread = L
+	d.frames = nil
+	if d.OnStop != nil {
+		action = d.OnStop(d, reason, bp)
+	}
+	d.thread = nil
+	d.frames = nil
+	d.action = action
+	d.depth = threadDepth(L)
+	if action == DebugAbort {
+		// raised again at every call and line, so pcall and coroutines
+		// can not catch it
+		d.Abort()
+		L.RaiseError("script stopped by the debugger")
+	}
+}
+
+// threadDepth - the number of frames of L and the threads that resumed it
+func threadDepth(L *LState) int {
+	n := 0
+	for ls := L; ls != nil; ls = ls.Parent {
+		n += ls.stack.Sp()
+	}
+	return n
+}
+
+// lineBreakpoint - returns the breakpoint at line of source, if any
+func (d *Debugger) lineBreakpoint(source string, line int) *Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, bp := range d.lines[line] {
+		if sameSource(bp.Source, source) {
+			return bp
+		}
+	}
+	return nil
+}
+
+// funcBreakpoint - returns the proc breakpoint of the proc called in cf, if any
+func (d *Debugger) funcBreakpoint(L *LState, cf *callFrame) *Breakpoint {
+	if len(d.funcs) == 0 {
+		return nil
+	}
+	name, _ := L.frameFuncName(cf)
+	for _, bp := range d.funcs {
+		if name == bp.Func || strings.HasSuffix(bp.Func, "."+name) || strings.HasSuffix(bp.Func, ":"+name) {
+			return bp
+		}
+	}
+	return nil
+}
+
+// sameSource - reports if the breakpoint source bpsrc names the source file
+// src of a proc
+func sameSource(bpsrc, src string) bool {
+	if bpsrc == src || filepath.Clean(bpsrc) == filepath.Clean(src) {
+		return true
+	}
+	if !strings.ContainsRune(bpsrc, filepath.Separator) {
+		return filepath.Base(src) == bpsrc
+	}
+	abs1, err1 := filepath.Abs(bpsrc)
+	abs2, err2 := filepath.Abs(src)
+	return err1 == nil && err2 == nil && abs1 == abs2
+}
+
+// Stack - returns the frames of the stopped script, the frames of the
+// threads that resumed a stopped coroutine follow its own
+func (d *Debugger) Stack() []*DebugFrame {
+	if d.thread == nil {
+		return nil
+	}
+	if d.frames != nil {
+		return d.frames
+	}
+	for ls := d.thread; ls != nil; ls = ls.Parent {
+		for fr := ls.currentFrame; fr != nil; fr = fr.Parent {
+			// stopped before the instruction at Pc-1 runs, or in the call at Pc-1
+			df := &DebugFrame{Level: len(d.frames), Proc: fr.Fn, thread: ls, frame: fr, Line: -1, pc: fr.Pc - 1}
+			df.Name, _ = ls.frameFuncName(fr)
+			if fr.Fn.IsG {
+				df.Source = "[G]"
+			} else {
+				proto := fr.Fn.Proto
+				df.Source = proto.SourceName
+				df.Line = proto.LineDefined
+				if fr.Pc > 0 && fr.Pc <= len(proto.DbgSourcePositions) {
+					df.Line = proto.DbgSourcePositions[fr.Pc-1]
+				}
+			}
+			d.frames = append(d.frames, df)
+		}
+	}
+	return d.frames
+}
+
+// Frame - returns the frame at level of the stopped script
+func (d *Debugger) Frame(level int) (*DebugFrame, error) {
+	frames := d.Stack()
+	if d.thread == nil {
+		return nil, fmt.Errorf("the script is not stopped")
+	}
+	if level < 0 || level >= len(frames) {
+		return nil, fmt.Errorf("no frame at level %d", level)
+	}
+	return frames[level], nil
+}
+
+// Locals - returns the local variables of the frame at level that are in
+// scope, a local shadowed by a later one with the same name is left out
+func (d *Debugger) Locals(level int) ([]DebugVar, error) {
+	df, err := d.Frame(level)
+	if err != nil {
+		return nil, err
+	}
+	var vars []DebugVar
+	index := map[string]int{}
+	for no := 1; ; no++ {
+		name := df.localName(no)
+		if len(name) == 0 {
+			break
+		}
+		value := df.local(no)
+		if strings.HasPrefix(name, "(") {
+			continue
+		}
+		if i, ok := index[name]; ok {
+			vars[i].Value = value
+			continue
+		}
+		index[name] = len(vars)
+		vars = append(vars, DebugVar{Name: name, Value: value})
+	}
+	return vars, nil
+}
+
+// Upvalues - returns the upvalues of the proc of the frame at level
+func (d *Debugger) Upvalues(level int) ([]DebugVar, error) {
+	df, err := d.Frame(level)
+	if err != nil {
+		return nil, err
+	}
+	var vars []DebugVar
+	for no := 1; no <= len(df.Proc.Upvalues); no++ {
+		name, value := df.thread.GetUpvalue(df.Proc, no)
+		if len(name) > 0 {
+			vars = append(vars, DebugVar{Name: name, Value: value})
+		}
+	}
+	return vars, nil
+}
+
+// Globals - returns the globals set by the script, sorted by name. The
+// globals set before the debugger was created, like the built in procs,
+// are left out.
+func (d *Debugger) Globals() []DebugVar {
+	var vars []DebugVar
+	d.L.G.Global.ForEach(func(k, v LValue) {
+		if !d.builtins[k] {
+			vars = append(vars, DebugVar{Name: k.String(), Value: v})
+		}
+	})
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// Eval - evaluates the expression, or runs the statements, expr in the
+// frame at level. The locals and upvalues of the frame can be read and set
+// by name, other names are globals.
+func (d *Debugger) Eval(level int, expr string) ([]LValue, error) {
+	df, err := d.Frame(level)
+	if err != nil {
+		return nil, err
+	}
+	L := d.thread
+	fn, err := L.LoadString("return " + expr)
+	if err != nil {
+		if fn, err = L.LoadString(expr); err != nil {
+			return nil, err
+		}
+	}
+	fn.Env = d.frameEnv(df)
+
+	cf, top := L.currentFrame, L.GetTop()
+	defer func() { L.currentFrame = cf }()
+	L.Push(fn)
+	if err := L.PCall(0, MultRet, nil); err != nil {
+		if aerr, ok := err.(*ApiError); ok {
+			return nil, fmt.Errorf("%v", aerr.Object)
+		}
+		return nil, err
+	}
+	var values []LValue
+	for i := top + 1; i <= L.GetTop(); i++ {
+		values = append(values, L.Get(i))
+	}
+	L.SetTop(top)
+	return values, nil
+}
+
+// frameEnv - returns a list that resolves names to the locals and upvalues
+// of df and then to the globals of its proc
+func (d *Debugger) frameEnv(df *DebugFrame) *LOAList {
+	globals := df.Proc.Env
+	// find - returns the local or upvalue number of name, 0 if there is none
+	find := func(name string) (local, upvalue int) {
+		for no := 1; ; no++ {
+			lname := df.localName(no)
+			if len(lname) == 0 {
+				break
+			}
+			if lname == name {
+				local = no // the last one wins, it is the innermost
+			}
+		}
+		if local > 0 {
+			return local, 0
+		}
+		for no := 1; no <= len(df.Proc.Upvalues); no++ {
+			if uname, _ := df.thread.GetUpvalue(df.Proc, no); uname == name {
+				return 0, no
+			}
+		}
+		return 0, 0
+	}
+	L := d.thread
+	env := L.NewOAList()
+	mt := L.NewOAList()
+	mt.RawSetString("__index", L.NewProc(func(L *LState) int {
+		key := L.Get(2)
+		if name, ok := key.(LString); ok {
+			if local, upvalue := find(string(name)); local > 0 {
+				L.Push(df.local(local))
+				return 1
+			} else if upvalue > 0 {
+				_, value := df.thread.GetUpvalue(df.Proc, upvalue)
+				L.Push(value)
+				return 1
+			}
+		}
+		L.Push(L.GetField(globals, key.String()))
+		return 1
+	}))
+	mt.RawSetString("__newindex", L.NewProc(func(L *LState) int {
+		key, value := L.Get(2), L.Get(3)
+		if name, ok := key.(LString); ok {
+			if local, upvalue := find(string(name)); local > 0 {
+				df.setLocal(local, value)
+				return 0
+			} else if upvalue > 0 {
+				df.thread.SetUpvalue(df.Proc, upvalue, value)
+				return 0
+			}
+		}
+		L.SetField(globals, key.String(), value)
+		return 0
+	}))
+	L.SetMetalist(env, mt)
+	return env
+}
+
+// FormatValue - formats lv for display, strings are quoted and lists are
+// shown with their contents, on several lines when they do not fit on one
+func FormatValue(lv LValue) string {
+	var sb strings.Builder
+	formatValue(&sb, lv, "", map[*LOAList]bool{})
+	return sb.String()
+}
+
+const (
+	formatWidth = 72 // lists longer than this are shown on several lines
+	formatItems = 100
+)
+
+// formatValue - writes lv to sb, indent is the indent of the line lv is on
+func formatValue(sb *strings.Builder, lv LValue, indent string, seen map[*LOAList]bool) {
+	switch v := lv.(type) {
+	case LString:
+		sb.WriteString(fmt.Sprintf("%q", string(v)))
+	case *LOAList:
+		if seen[v] {
+			sb.WriteString("<" + v.String() + ">")
+			return
+		}
+		seen[v] = true
+		defer delete(seen, v)
+		var items []string
+		n := 0
+		for i := 1; i <= v.Len(); i++ {
+			items = append(items, formatItem("", v.RawGetInt(i), indent, seen))
+			n++
+		}
+		var keys []LValue
+		v.ForEach(func(k, _ LValue) {
+			if i, ok := arrayIndex(k); ok && i >= 1 && i <= v.Len() {
+				return
+			}
+			keys = append(keys, k)
+		})
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if n == formatItems {
+				items = append(items, "...")
+				break
+			}
+			items = append(items, formatItem(formatKey(k), v.RawGet(k), indent, seen))
+			n++
+		}
+		if len(items) == 0 {
+			sb.WriteString("{}")
+			return
+		}
+		line := "{" + strings.Join(items, ", ") + "}"
+		if len(indent)+len(line) <= formatWidth && !strings.Contains(line, "\n") {
+			sb.WriteString(line)
+			return
+		}
+		sb.WriteString("{\n")
+		for _, item := range items {
+			sb.WriteString(indent + "  " + item + ",\n")
+		}
+		sb.WriteString(indent + "}")
+	default:
+		sb.WriteString(lv.String())
+	}
+}
+
+// arrayIndex - returns k as an int when it is an integer number
+func arrayIndex(k LValue) (int, bool) {
+	switch n := k.(type) {
+	case LInteger:
+		return int(n), true
+	case LNumber:
+		if float64(n) == float64(int(n)) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// formatItem - formats a list item, with key unless it is empty
+func formatItem(key string, lv LValue, indent string, seen map[*LOAList]bool) string {
+	var sb strings.Builder
+	if len(key) > 0 {
+		sb.WriteString(key + " = ")
+	}
+	formatValue(&sb, lv, indent+"  ", seen)
+	return sb.String()
+}
+
+// formatKey - formats a list key, names are shown as they are
+func formatKey(k LValue) string {
+	if s, ok := k.(LString); ok {
+		name := string(s)
+		ident := len(name) > 0
+		for i, c := range name {
+			if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+				ident = false
+				break
+			}
+		}
+		if ident {
+			return name
+		}
+		return "[" + fmt.Sprintf("%q", name) + "]"
+	}
+	return "[" + k.String() + "]"
+}
@@ -0,0 +1,71 @@
+package qs
+
+import (
+	"testing"
+)
+
+const debugScript = `proc add(a, b)
+  dcl s = a + b
+  return s
+end
+dcl s = 0
+for k = 1, 3 do
+  s = s + k
+end
+dcl r = add(s, 1)
+`
+
+// debugLocals - runs debugScript with a breakpoint at line and returns the
+// locals of the frame that stopped, by name, at the first stop
+func debugLocals(t *testing.T, line int) map[string]LValue {
+	L := NewState()
+	defer L.Close()
+	d := NewDebugger(L)
+	defer d.Close()
+	d.SetBreakpoint("<string>", line)
+	var locals map[string]LValue
+	d.OnStop = func(d *Debugger, reason string, bp *Breakpoint) DebugAction {
+		if locals != nil {
+			return DebugContinue
+		}
+		vars, err := d.Locals(0)
+		if err != nil {
+			t.Errorf("Locals at line %d: %v", line, err)
+		}
+		locals = map[string]LValue{}
+		for _, v := range vars {
+			locals[v.Name] = v.Value
+		}
+		return DebugContinue
+	}
+	if err := L.DoString(debugScript); err != nil {
+		t.Fatalf("DoString: %v", err)
+	}
+	if locals == nil {
+		t.Fatalf("the script did not stop at line %d", line)
+	}
+	return locals
+}
+
+// TestDebugLocalsLastLine - the locals of a block are in scope at its last line
+func TestDebugLocalsLastLine(t *testing.T) {
+	locals := debugLocals(t, 3)
+	for name, want := range map[string]string{"a": "6", "b": "1", "s": "7"} {
+		if got, ok := locals[name]; !ok {
+			t.Errorf("local %s not in scope at line 3", name)
+		} else if got.String() != want {
+			t.Errorf("local %s at line 3 = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// TestDebugLocalsLoop - the loop variable is in scope in the loop body
+func TestDebugLocalsLoop(t *testing.T) {
+	locals := debugLocals(t, 7)
+	if got, ok := locals["k"]; !ok || got.String() != "1" {
+		t.Errorf("local k at line 7 = %v, want 1", got)
+	}
+	if got, ok := locals["s"]; !ok || got.String() != "0" {
+		t.Errorf("local s at line 7 = %v, want 0", got)
+	}
+}
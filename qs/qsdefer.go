@@ -0,0 +1,93 @@
+// Package qs - q scripting language
+package qs
+
+// deferredCall - a call of a defer statement, or of the __close of a
+// <close> variable, with the proc and arguments it was given
+type deferredCall struct {
+	fn   LValue
+	args []LValue
+}
+
+// deferList - the deferred calls of a proc or block, held by the (defer)
+// register that follows its (finally) register
+type deferList struct {
+	calls []deferredCall
+}
+
+// deferred - returns the deferred calls of register reg, adding them when
+// there are none
+func (ls *LState) deferred(reg int) *deferList {
+	if ud, ok := ls.reg.Get(reg).(*LUserData); ok {
+		if list, ok := ud.Value.(*deferList); ok {
+			return list
+		}
+	}
+	list := &deferList{}
+	ud := ls.NewUserData()
+	ud.Value = list
+	ls.reg.Set(reg, ud)
+	return list
+}
+
+// deferCall - adds the call of the proc in register RA, with the nargs
+// arguments that follow it, to the deferred calls of register reg
+func (ls *LState) deferCall(reg, RA, nargs int) {
+	fn := ls.reg.Get(RA)
+	if callable, _ := ls.metaCall(fn); callable == nil {
+		ls.RaiseError("attempt to defer a call of a non-proc object")
+	}
+	args := make([]LValue, nargs)
+	for i := range args {
+		args[i] = ls.reg.Get(RA + 1 + i)
+	}
+	list := ls.deferred(reg)
+	list.calls = append(list.calls, deferredCall{fn: fn, args: args})
+}
+
+// deferClose - adds the call of the __close of the value of the <close>
+// variable in register RB to the deferred calls of register reg, nil and
+// false are not closed
+func (ls *LState) deferClose(reg, RB int, name string) {
+	lv := ls.reg.Get(RB)
+	if LVIsFalse(lv) {
+		return
+	}
+	fn := ls.metaOp1(lv, "__close")
+	if callable, _ := ls.metaCall(fn); callable == nil {
+		ls.RaiseError("variable '%s' got a value without __close", name)
+	}
+	list := ls.deferred(reg)
+	list.calls = append(list.calls, deferredCall{fn: fn, args: []LValue{lv}})
+}
+
+// runDeferred - runs the deferred calls of the register after the (finally)
+// register RA, the last one first, an error raised by one of them replaces
+// the pending action of the finally statements and the others still run
+func (ls *LState) runDeferred(RA int) {
+	ud, ok := ls.reg.Get(RA + 1).(*LUserData)
+	if !ok {
+		return
+	}
+	list, ok := ud.Value.(*deferList)
+	if !ok {
+		return
+	}
+	ls.reg.Set(RA+1, LNil)
+	cf := ls.currentFrame
+	for n := len(list.calls); n > 0; n = len(list.calls) {
+		call := list.calls[n-1]
+		list.calls = list.calls[:n-1]
+		ls.resetTop()
+		ls.Push(call.fn)
+		for _, arg := range call.args {
+			ls.Push(arg)
+		}
+		if err := ls.PCall(len(call.args), 0, nil); err != nil {
+			ls.currentFrame = cf // left by the error
+			if aerr, ok := err.(*ApiError); ok {
+				ls.setPending(RA, &tryPending{err: aerr})
+			}
+		}
+	}
+	ls.resetTop()
+}
@@ -0,0 +1,45 @@
+package qs
+
+import (
+	"testing"
+)
+
+// TestDefer - deferred calls run in reverse order when a proc ends, by its
+// end, a return or an error, with the arguments of the defer statement
+func TestDefer(t *testing.T) {
+	checkScript(t, "order and arguments", `dcl log = {}
+proc add(s) log[#log + 1] = s end
+proc f(n)
+  defer add("first")
+  defer add(n)
+  n = n + 1
+  add("body")
+  return n
+end
+assert(f(1) == 2)
+assert(concat(log, " ") == "body 1 first", concat(log, " "))`, "")
+	checkScript(t, "error", `dcl closed = false
+proc f()
+  defer (proc() closed = true end)()
+  error("failed")
+end
+dcl ok, err = pcall(f)
+assert(not ok and find(err, "failed") and closed)`, "")
+	checkScript(t, "error in a deferred call", `proc f()
+  defer error("second")
+  defer error("first")
+  return 1
+end
+dcl ok, err = pcall(f)
+assert(not ok and find(err, "second"), err)`, "")
+	checkScript(t, "close", `dcl log = {}
+dcl mt = {__close = proc(v) log[#log + 1] = v.name end}
+do
+  dcl a <close> = setmetalist({name = "a"}, mt)
+  dcl b <close> = setmetalist({name = "b"}, mt)
+  dcl c <close> = nil
+end
+assert(concat(log, " ") == "b a", concat(log, " "))`, "")
+	checkScript(t, "close without __close", `do dcl a <close> = {} end`, "__close")
+	checkScript(t, "defer without a call", `proc f() defer x end`, "proc call expected after defer")
+}
@@ -0,0 +1,548 @@
+// Package qs - q scripting language
+package qs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DisasmProc - annotated disassembly of a compiled proc and its nested procs
+type DisasmProc struct {
+	Name            string        `json:"name"`
+	Source          string        `json:"source"`
+	LineDefined     int           `json:"linedefined"`
+	LastLineDefined int           `json:"lastlinedefined"`
+	NumParameters   int           `json:"params"`
+	IsVarArg        bool          `json:"vararg"`
+	Strict          bool          `json:"strict"`
+	NumRegisters    int           `json:"registers"`
+	Upvalues        []string      `json:"upvalues"`
+	Constants       []string      `json:"constants"`
+	Locals          []DisasmLocal `json:"locals"`
+	Code            []DisasmInst  `json:"code"`
+	Procs           []*DisasmProc `json:"procs"`
+}
+
+// DisasmLocal - a local variable and the pc range where it is live
+type DisasmLocal struct {
+	Name    string `json:"name"`
+	StartPc int    `json:"startpc"`
+	EndPc   int    `json:"endpc"`
+}
+
+// DisasmInst - a single instruction, pc and target are 1-based, target is 0
+// when the instruction does not jump
+type DisasmInst struct {
+	Pc      int    `json:"pc"`
+	Line    int    `json:"line"`
+	Op      string `json:"op"`
+	Args    []int  `json:"args"`
+	Target  int    `json:"target,omitempty"`
+	Comment string `json:"comment"`
+}
+
+// Disassemble - builds the annotated disassembly of proto, name is used for
+// the outermost proc
+func Disassemble(proto *ProcProto, name string) *DisasmProc {
+	dp := &DisasmProc{
+		Name:            name,
+		Source:          proto.SourceName,
+		LineDefined:     proto.LineDefined,
+		LastLineDefined: proto.LastLineDefined,
+		NumParameters:   int(proto.NumParameters),
+		IsVarArg:        proto.IsVarArg != 0,
+		Strict:          proto.Strict,
+		NumRegisters:    int(proto.NumUsedRegisters),
+		Upvalues:        append([]string{}, proto.DbgUpvalues...),
+		Constants:       make([]string, 0, len(proto.Constants)),
+		Locals:          make([]DisasmLocal, 0, len(proto.DbgLocals)),
+		Code:            make([]DisasmInst, 0, len(proto.Code)),
+		Procs:           make([]*DisasmProc, 0, len(proto.ProcPrototypes)),
+	}
+	for _, c := range proto.Constants {
+		dp.Constants = append(dp.Constants, constString(c))
+	}
+	for _, li := range proto.DbgLocals {
+		dp.Locals = append(dp.Locals, DisasmLocal{Name: li.Name, StartPc: li.StartPc, EndPc: li.EndPc})
+	}
+	protoNames := make([]string, len(proto.ProcPrototypes))
+	var capturing *ProcProto // closure whose upvalue captures follow
+	captured := 0
+	for pc := 0; pc < len(proto.Code); pc++ {
+		inst := proto.Code[pc]
+		op := opGetOpCode(inst)
+		di := DisasmInst{Pc: pc + 1, Op: opProps[op].Name}
+		if pc < len(proto.DbgSourcePositions) {
+			di.Line = proto.DbgSourcePositions[pc]
+		}
+		switch opProps[op].Type {
+		case opTypeABC:
+			di.Args = []int{opGetArgA(inst), opGetArgB(inst), opGetArgC(inst)}
+		case opTypeABx:
+			di.Args = []int{opGetArgA(inst), opGetArgBx(inst)}
+		case opTypeASbx:
+			di.Args = []int{opGetArgA(inst), opGetArgSbx(inst)}
+		}
+		if op == OP_CLOSURE {
+			bx := opGetArgBx(inst)
+			if bx < len(protoNames) {
+				protoNames[bx] = closureName(proto, pc, opGetArgA(inst), int(proto.ProcPrototypes[bx].NumUpvalues))
+			}
+		}
+		if capturing != nil && captured < int(capturing.NumUpvalues) {
+			di.Comment = captureComment(proto, pc, inst, capturing, captured)
+			captured++
+		} else {
+			capturing = nil
+			di.Target, di.Comment = annotate(proto, pc, inst, protoNames)
+		}
+		if op == OP_CLOSURE && opGetArgBx(inst) < len(proto.ProcPrototypes) {
+			capturing = proto.ProcPrototypes[opGetArgBx(inst)]
+			captured = 0
+		}
+		dp.Code = append(dp.Code, di)
+		// SETLIST with C == 0 keeps its block number in the next word
+		if op == OP_SETLIST && opGetArgC(inst) == 0 && pc+1 < len(proto.Code) {
+			pc++
+			dp.Code = append(dp.Code, DisasmInst{Pc: pc + 1, Line: di.Line, Op: "EXTRAARG",
+				Args: []int{int(proto.Code[pc])}, Comment: "block number of SETLIST"})
+		}
+	}
+	for i, fp := range proto.ProcPrototypes {
+		pname := protoNames[i]
+		if len(pname) == 0 {
+			pname = fmt.Sprintf("proc@%d", fp.LineDefined)
+		}
+		dp.Procs = append(dp.Procs, Disassemble(fp, pname))
+	}
+	return dp
+}
+
+// Find - returns the proc whose name, or last name component, matches name
+func (dp *DisasmProc) Find(name string) *DisasmProc {
+	if dp.Name == name || strings.HasSuffix(dp.Name, "."+name) || strings.HasSuffix(dp.Name, ":"+name) {
+		return dp
+	}
+	for _, sub := range dp.Procs {
+		if found := sub.Find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Text - the disassembly listing with source lines interleaved, src holds the
+// source lines, when nil the source file is read if it can be found
+func (dp *DisasmProc) Text(src []string) string {
+	if src == nil {
+		src = readSourceLines(dp.Source)
+	}
+	var buf strings.Builder
+	dp.text(&buf, src)
+	return buf.String()
+}
+
+func (dp *DisasmProc) text(buf *strings.Builder, src []string) {
+	vararg := ""
+	if dp.IsVarArg {
+		vararg = " and vararg"
+	}
+	fmt.Fprintf(buf, "proc %s <%s:%d,%d> (%d instructions)\n", dp.Name, dp.Source,
+		dp.LineDefined, dp.LastLineDefined, len(dp.Code))
+	strict := ""
+	if dp.Strict {
+		strict = ", strict"
+	}
+	fmt.Fprintf(buf, "%d%s params, %d registers, %d upvalues, %d locals, %d constants, %d procs%s\n",
+		dp.NumParameters, vararg, dp.NumRegisters, len(dp.Upvalues), len(dp.Locals), len(dp.Constants), len(dp.Procs), strict)
+	line := -1
+	for _, di := range dp.Code {
+		if di.Line != line {
+			line = di.Line
+			switch {
+			case line == 0:
+				// code with no source line, like the implicit return
+			case line > 0 && line <= len(src):
+				fmt.Fprintf(buf, "%5d  %s\n", line, strings.TrimRight(src[line-1], " \t\r"))
+			default:
+				fmt.Fprintf(buf, "%5d\n", line)
+			}
+		}
+		args := make([]string, len(di.Args))
+		for i, arg := range di.Args {
+			args[i] = strconv.Itoa(arg)
+		}
+		fmt.Fprintf(buf, "       [%03d] %-10s %-12s ; %s\n", di.Pc, di.Op, strings.Join(args, " "), di.Comment)
+	}
+	if len(dp.Constants) > 0 {
+		fmt.Fprintf(buf, "constants (%d):\n", len(dp.Constants))
+		for i, c := range dp.Constants {
+			fmt.Fprintf(buf, "       K(%d) %s\n", i, c)
+		}
+	}
+	if len(dp.Locals) > 0 {
+		fmt.Fprintf(buf, "locals (%d):\n", len(dp.Locals))
+		for i, li := range dp.Locals {
+			fmt.Fprintf(buf, "       %d %s [%03d..%03d]\n", i, li.Name, li.StartPc+1, li.EndPc)
+		}
+	}
+	if len(dp.Upvalues) > 0 {
+		fmt.Fprintf(buf, "upvalues (%d):\n", len(dp.Upvalues))
+		for i, name := range dp.Upvalues {
+			fmt.Fprintf(buf, "       U(%d) %s\n", i, name)
+		}
+	}
+	for _, sub := range dp.Procs {
+		buf.WriteString("\n")
+		sub.text(buf, src)
+	}
+}
+
+// readSourceLines - returns the lines of a source file, or nil if the file
+// can not be read
+func readSourceLines(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// constString - a constant as it would be written in q source
+func constString(lv LValue) string {
+	if s, ok := lv.(LString); ok {
+		return strconv.Quote(string(s))
+	}
+	return lv.String()
+}
+
+// localName - the name of the local variable held in register reg at pc,
+// pc is the 0-based index of the instruction using the register
+func localName(proto *ProcProto, reg, pc int) (string, bool) {
+	regno := reg + 1
+	for i := 0; i < len(proto.DbgLocals) && proto.DbgLocals[i].StartPc <= pc; i++ {
+		if pc <= proto.DbgLocals[i].EndPc {
+			regno--
+			if regno == 0 {
+				return proto.DbgLocals[i].Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// closureName - works out the name a closure created at pc into register
+// reg is stored under, from the instruction following its upvalue captures
+func closureName(proto *ProcProto, pc, reg, nupvalues int) string {
+	next := pc + 1 + nupvalues
+	if next < len(proto.Code) {
+		inst := proto.Code[next]
+		switch opGetOpCode(inst) {
+		case OP_SETGLOBAL:
+			if opGetArgA(inst) == reg {
+				return kstName(proto, opGetArgBx(inst))
+			}
+		case OP_SETTABLE, OP_SETTABLEKS:
+			b, c := opGetArgB(inst), opGetArgC(inst)
+			if !opIsK(c) && c == reg && opIsK(b) {
+				if key, ok := proto.Constants[b & ^opBitRk].(LString); ok {
+					return regOrigin(proto, next, opGetArgA(inst)) + "." + string(key)
+				}
+			}
+		case OP_MOVE:
+			if opGetArgB(inst) == reg {
+				if name, ok := localName(proto, opGetArgA(inst), next+1); ok {
+					return name
+				}
+			}
+		}
+	}
+	if name, ok := localName(proto, reg, pc); ok {
+		return name
+	}
+	if name, ok := localName(proto, reg, next); ok {
+		return name
+	}
+	return ""
+}
+
+// regOrigin - names the value held in register reg at pc, from a live local
+// or from the global or field it was last loaded from
+func regOrigin(proto *ProcProto, pc, reg int) string {
+	if name, ok := localName(proto, reg, pc); ok {
+		return name
+	}
+	for i := pc - 1; i >= 0; i-- {
+		inst := proto.Code[i]
+		if opGetArgA(inst) != reg {
+			continue
+		}
+		switch opGetOpCode(inst) {
+		case OP_GETGLOBAL:
+			return kstName(proto, opGetArgBx(inst))
+		case OP_GETTABLE, OP_GETTABLEKS:
+			c := opGetArgC(inst)
+			if opIsK(c) {
+				if key, ok := proto.Constants[c & ^opBitRk].(LString); ok {
+					return regOrigin(proto, i, opGetArgB(inst)) + "." + string(key)
+				}
+			}
+			return "?"
+		case OP_MOVE:
+			return regOrigin(proto, i, opGetArgB(inst))
+		case OP_GETUPVAL:
+			if b := opGetArgB(inst); b < len(proto.DbgUpvalues) {
+				return proto.DbgUpvalues[b]
+			}
+			return "?"
+		default:
+			if opProps[opGetOpCode(inst)].SetRegA {
+				return "?"
+			}
+		}
+	}
+	return "?"
+}
+
+// captureComment - describes the pseudo instruction following a CLOSURE
+// that captures upvalue idx of the new closure
+func captureComment(proto *ProcProto, pc int, inst uint32, closure *ProcProto, idx int) string {
+	name := fmt.Sprintf("U%d", idx)
+	if idx < len(closure.DbgUpvalues) {
+		name = closure.DbgUpvalues[idx]
+	}
+	b := opGetArgB(inst)
+	if opGetOpCode(inst) == OP_GETUPVAL {
+		if b < len(proto.DbgUpvalues) {
+			return fmt.Sprintf("capture upvalue %s from upvalue %s", name, proto.DbgUpvalues[b])
+		}
+		return fmt.Sprintf("capture upvalue %s from U%d", name, b)
+	}
+	if local, ok := localName(proto, b, pc); ok {
+		return fmt.Sprintf("capture upvalue %s from %s", name, local)
+	}
+	return fmt.Sprintf("capture upvalue %s from R%d", name, b)
+}
+
+// kstName - the string constant idx without quotes
+func kstName(proto *ProcProto, idx int) string {
+	if idx < len(proto.Constants) {
+		if s, ok := proto.Constants[idx].(LString); ok {
+			return string(s)
+		}
+		return proto.Constants[idx].String()
+	}
+	return "?"
+}
+
+// annotate - describes the instruction at pc in terms of local, upvalue and
+// constant names, returning the 1-based pc it may jump to, or 0
+func annotate(proto *ProcProto, pc int, inst uint32, protoNames []string) (int, string) {
+	a, b, c := opGetArgA(inst), opGetArgB(inst), opGetArgC(inst)
+	bx, sbx := opGetArgBx(inst), opGetArgSbx(inst)
+	r := func(reg int) string {
+		if name, ok := localName(proto, reg, pc); ok {
+			return name
+		}
+		return fmt.Sprintf("R%d", reg)
+	}
+	rk := func(v int) string {
+		if opIsK(v) {
+			idx := v & ^opBitRk
+			if idx < len(proto.Constants) {
+				return constString(proto.Constants[idx])
+			}
+			return fmt.Sprintf("K%d", idx)
+		}
+		return r(v)
+	}
+	upv := func(idx int) string {
+		if idx < len(proto.DbgUpvalues) {
+			return "upvalue " + proto.DbgUpvalues[idx]
+		}
+		return fmt.Sprintf("U%d", idx)
+	}
+	rng := func(from, n int) string {
+		switch {
+		case n < 0:
+			return fmt.Sprintf("%s...", r(from))
+		case n == 0:
+			return ""
+		case n == 1:
+			return r(from)
+		}
+		return fmt.Sprintf("%s..%s", r(from), r(from+n-1))
+	}
+	count := func(n int) string {
+		if n < 0 {
+			return "all"
+		}
+		return strconv.Itoa(n)
+	}
+	skip := pc + 3 // 1-based pc of the instruction after next
+
+	switch op := opGetOpCode(inst); op {
+	case OP_MOVE:
+		return 0, fmt.Sprintf("%s := %s", r(a), r(b))
+	case OP_MOVEN:
+		return 0, fmt.Sprintf("%s := %s; followed by %d MOVE", r(a), r(b), c)
+	case OP_LOADK:
+		return 0, fmt.Sprintf("%s := %s", r(a), rk(bx|opBitRk))
+	case OP_LOADBOOL:
+		if c != 0 {
+			return skip, fmt.Sprintf("%s := %v; goto [%03d]", r(a), b != 0, skip)
+		}
+		return 0, fmt.Sprintf("%s := %v", r(a), b != 0)
+	case OP_LOADNIL:
+		return 0, fmt.Sprintf("%s := nil", rng(a, b-a+1))
+	case OP_GETUPVAL:
+		return 0, fmt.Sprintf("%s := %s", r(a), upv(b))
+	case OP_SETUPVAL:
+		return 0, fmt.Sprintf("%s := %s", upv(b), r(a))
+	case OP_GETGLOBAL:
+		return 0, fmt.Sprintf("%s := global %s", r(a), kstName(proto, bx))
+	case OP_SETGLOBAL:
+		return 0, fmt.Sprintf("global %s := %s", kstName(proto, bx), r(a))
+	case OP_GETTABLE, OP_GETTABLEKS:
+		return 0, fmt.Sprintf("%s := %s[%s]", r(a), r(b), rk(c))
+	case OP_SETTABLE, OP_SETTABLEKS:
+		return 0, fmt.Sprintf("%s[%s] := %s", r(a), rk(b), rk(c))
+	case OP_NEWTABLE:
+		return 0, fmt.Sprintf("%s := {}", r(a))
+	case OP_SELF:
+		return 0, fmt.Sprintf("R%d := %s; %s := %s[%s]", a+1, r(b), r(a), r(b), rk(c))
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_IDIV, OP_BAND, OP_BOR, OP_BXOR, OP_SHL, OP_SHR:
+		opsym := map[int]string{OP_ADD: "+", OP_SUB: "-", OP_MUL: "*", OP_DIV: "/", OP_MOD: "%", OP_POW: "^",
+			OP_IDIV: "\\", OP_BAND: "&", OP_BOR: "|", OP_BXOR: "~", OP_SHL: "<<", OP_SHR: ">>"}[op]
+		return 0, fmt.Sprintf("%s := %s %s %s", r(a), rk(b), opsym, rk(c))
+	case OP_UNM:
+		return 0, fmt.Sprintf("%s := -%s", r(a), r(b))
+	case OP_BNOT:
+		return 0, fmt.Sprintf("%s := ~%s", r(a), r(b))
+	case OP_NOT:
+		return 0, fmt.Sprintf("%s := not %s", r(a), r(b))
+	case OP_LEN:
+		return 0, fmt.Sprintf("%s := #%s", r(a), r(b))
+	case OP_CONCAT:
+		return 0, fmt.Sprintf("%s := concat %s", r(a), rng(b, c-b+1))
+	case OP_JMP:
+		target := pc + 2 + sbx
+		return target, fmt.Sprintf("goto [%03d]", target)
+	case OP_EQ, OP_LT, OP_LE:
+		opsym := map[int]string{OP_EQ: "==", OP_LT: "<", OP_LE: "<="}[op]
+		not := ""
+		if a != 0 {
+			not = "not "
+		}
+		return skip, fmt.Sprintf("if %s(%s %s %s) then goto [%03d]", not, rk(b), opsym, rk(c), skip)
+	case OP_TEST:
+		if c != 0 {
+			return skip, fmt.Sprintf("if not %s then goto [%03d]", r(a), skip)
+		}
+		return skip, fmt.Sprintf("if %s then goto [%03d]", r(a), skip)
+	case OP_TESTSET:
+		if c != 0 {
+			return skip, fmt.Sprintf("if %s then %s := %s else goto [%03d]", r(b), r(a), r(b), skip)
+		}
+		return skip, fmt.Sprintf("if not %s then %s := %s else goto [%03d]", r(b), r(a), r(b), skip)
+	case OP_CALL:
+		callee := regOrigin(proto, pc, a)
+		return 0, fmt.Sprintf("%s(%s) args %s, results %s", callee, rng(a+1, b-1), count(b-1), count(c-1))
+	case OP_TAILCALL:
+		callee := regOrigin(proto, pc, a)
+		return 0, fmt.Sprintf("return %s(%s) args %s", callee, rng(a+1, b-1), count(b-1))
+	case OP_RETURN:
+		return 0, fmt.Sprintf("return %s", rng(a, b-1))
+	case OP_FORLOOP:
+		target := pc + 2 + sbx
+		return target, fmt.Sprintf("%s += step; if in range goto [%03d]", r(a), target)
+	case OP_FORPREP:
+		target := pc + 2 + sbx
+		return target, fmt.Sprintf("prepare loop %s; goto [%03d]", r(a), target)
+	case OP_TFORLOOP:
+		return skip, fmt.Sprintf("%s := %s(%s, %s); if %s == nil then goto [%03d]",
+			rng(a+3, c), r(a), r(a+1), r(a+2), r(a+3), skip)
+	case OP_SETLIST:
+		return 0, fmt.Sprintf("%s[...] := %s", r(a), rng(a+1, b))
+	case OP_CLOSE:
+		return 0, fmt.Sprintf("close upvalues from %s", r(a))
+	case OP_CLOSURE:
+		name := ""
+		if bx < len(protoNames) {
+			name = protoNames[bx]
+		}
+		if len(name) == 0 && bx < len(proto.ProcPrototypes) {
+			name = fmt.Sprintf("proc@%d", proto.ProcPrototypes[bx].LineDefined)
+		}
+		return 0, fmt.Sprintf("%s := closure(%s)", r(a), name)
+	case OP_VARARG:
+		return 0, fmt.Sprintf("%s := ...", rng(a, b-1))
+	case OP_TOSTRING:
+		if f := rk(c); f != `""` {
+			return 0, fmt.Sprintf("%s := format(%s, %s)", r(a), f, rk(b))
+		}
+		return 0, fmt.Sprintf("%s := tostring(%s)", r(a), rk(b))
+	case OP_TRY:
+		target := pc + 2 + sbx
+		return target, fmt.Sprintf("try, on error %s := error; goto [%03d]", r(a), target)
+	case OP_FINALLY:
+		target := pc + 2 + sbx
+		return target, fmt.Sprintf("try, on error or return goto finally [%03d]", target)
+	case OP_ENDTRY:
+		return 0, "end try"
+	case OP_LEAVE:
+		target := pc + 2 + sbx
+		return target, fmt.Sprintf("end try; goto finally [%03d]", target)
+	case OP_ENDFINALLY:
+		return 0, fmt.Sprintf("end finally, do the pending action of %s", r(a))
+	case OP_DEFER:
+		callee := regOrigin(proto, pc, a)
+		return 0, fmt.Sprintf("defer %s(%s) args %s", callee, rng(a+1, b-1), count(b-1))
+	case OP_DEFERCLOSE:
+		return 0, fmt.Sprintf("defer %s.__close(%s)", r(b), r(b))
+	case OP_RUNDEFER:
+		return 0, fmt.Sprintf("run the deferred calls of %s", r(a+1))
+	case OP_NAMEDARGS:
+		callee := regOrigin(proto, pc, a)
+		if bx >= len(proto.CallNames) {
+			return 0, fmt.Sprintf("put the named args of %s in order", callee)
+		}
+		cn := proto.CallNames[bx]
+		return 0, fmt.Sprintf("put the named args %s of %s in order", strings.Join(cn.Names, ", "), callee)
+	case OP_REST:
+		if c >= len(proto.RestFields) || proto.RestFields[c].Skip >= 0 {
+			return 0, fmt.Sprintf("%s := the other elements of %s", r(a), r(b))
+		}
+		return 0, fmt.Sprintf("%s := the other fields of %s", r(a), r(b))
+	case OP_CLASS:
+		if c == 0 {
+			return 0, fmt.Sprintf("make %s a class", r(a))
+		}
+		return 0, fmt.Sprintf("make %s a class that extends %s", r(a), r(b))
+	case OP_SWITCH:
+		if bx >= len(proto.SwitchTables) {
+			return 0, fmt.Sprintf("switch %s", r(a))
+		}
+		st := proto.SwitchTables[bx]
+		cases := make([]string, 0, len(st.Values)+1)
+		for i, v := range st.Values {
+			cases = append(cases, fmt.Sprintf("%s goto [%03d]", constString(v), pc+2+st.Jumps[i]))
+		}
+		target := pc + 2 + st.Default
+		cases = append(cases, fmt.Sprintf("else goto [%03d]", target))
+		return target, fmt.Sprintf("switch %s: %s", r(a), strings.Join(cases, ", "))
+	case OP_NOP:
+		return 0, ""
+	}
+	return 0, ""
+}
@@ -0,0 +1,26 @@
+package qs
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDisasmText - source lines come before their code and the implicit
+// return, which has no source line, follows the last line
+func TestDisasmText(t *testing.T) {
+	src := "dcl x = 1\nput(x)\n"
+	proto, err := CompileSource([]byte(src), "d.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := Disassemble(proto, "main").Text(strings.Split(src, "\n"))
+	if !strings.Contains(text, "    1  dcl x = 1\n") || !strings.Contains(text, "    2  put(x)\n") {
+		t.Errorf("source lines missing:\n%s", text)
+	}
+	if strings.Contains(text, "    0\n") {
+		t.Errorf("blank line 0 before the implicit return:\n%s", text)
+	}
+	if !strings.Contains(text, "RETURN") {
+		t.Errorf("no implicit return:\n%s", text)
+	}
+}
@@ -0,0 +1,479 @@
+// Package qs - q scripting language
+package qs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+/*
+  Precompiled q segments (.qc files) are a serialized ProcProto:
+
+  +--------------------------------------------------------+
+  | signature "\x1bQc" | version uint16 | opcode max uint8 |
+  +--------------------------------------------------------+
+  | main segment proto                                     |
+  +--------------------------------------------------------+
+
+  Each proto is written as its source name, line information, counts,
+  code, constants, nested protos, switch tables and then the debug
+  information. Integers are unsigned or signed varints, floats are their
+  IEEE 754 bits.
+*/
+
+// QcSignature - first bytes of every precompiled q file
+const QcSignature = "\x1bQc"
+
+// QcVersion - bytecode format version, must be raised whenever the
+// instruction set or the serialized layout changes
+const QcVersion = 11
+
+// QcExtension - file name extension used for precompiled q files
+const QcExtension = ".qc"
+
+// constant type tags
+const (
+	qcConstNil byte = iota
+	qcConstFalse
+	qcConstTrue
+	qcConstNumber
+	qcConstInteger
+	qcConstString
+)
+
+// IsPrecompiled - reports if the data starts with the precompiled q signature
+func IsPrecompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(QcSignature))
+}
+
+// dumpWriter - writes proto fields, remembering the first error
+type dumpWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (dw *dumpWriter) bytes(b []byte) {
+	if dw.err == nil {
+		_, dw.err = dw.w.Write(b)
+	}
+}
+
+func (dw *dumpWriter) byte(b byte) {
+	if dw.err == nil {
+		dw.err = dw.w.WriteByte(b)
+	}
+}
+
+func (dw *dumpWriter) uint(v uint64) {
+	n := binary.PutUvarint(dw.buf[:], v)
+	dw.bytes(dw.buf[:n])
+}
+
+func (dw *dumpWriter) int(v int64) {
+	n := binary.PutVarint(dw.buf[:], v)
+	dw.bytes(dw.buf[:n])
+}
+
+func (dw *dumpWriter) string(s string) {
+	dw.uint(uint64(len(s)))
+	if dw.err == nil {
+		_, dw.err = dw.w.WriteString(s)
+	}
+}
+
+// constant - writes a constant with its type tag
+func (dw *dumpWriter) constant(c LValue) {
+	switch v := c.(type) {
+	case *LNilType:
+		dw.byte(qcConstNil)
+	case LBool:
+		if v {
+			dw.byte(qcConstTrue)
+		} else {
+			dw.byte(qcConstFalse)
+		}
+	case LNumber:
+		dw.byte(qcConstNumber)
+		dw.uint(math.Float64bits(float64(v)))
+	case LInteger:
+		dw.byte(qcConstInteger)
+		dw.int(int64(v))
+	case LString:
+		dw.byte(qcConstString)
+		dw.string(string(v))
+	default:
+		if dw.err == nil {
+			dw.err = fmt.Errorf("cannot dump constant of type %v", c.Type())
+		}
+	}
+}
+
+func (dw *dumpWriter) proto(p *ProcProto) {
+	dw.string(p.SourceName)
+	dw.int(int64(p.LineDefined))
+	dw.int(int64(p.LastLineDefined))
+	dw.byte(p.NumUpvalues)
+	dw.byte(p.NumParameters)
+	dw.byte(p.IsVarArg)
+	dw.byte(p.NumUsedRegisters)
+	if p.Strict {
+		dw.byte(1)
+	} else {
+		dw.byte(0)
+	}
+	dw.uint(uint64(len(p.StrictGlobals)))
+	for _, name := range p.StrictGlobals {
+		dw.string(name)
+	}
+
+	dw.uint(uint64(len(p.Code)))
+	for _, inst := range p.Code {
+		dw.uint(uint64(inst))
+	}
+
+	dw.uint(uint64(len(p.Constants)))
+	for _, c := range p.Constants {
+		dw.constant(c)
+	}
+
+	dw.uint(uint64(len(p.ProcPrototypes)))
+	for _, fp := range p.ProcPrototypes {
+		dw.proto(fp)
+	}
+
+	dw.uint(uint64(len(p.SwitchTables)))
+	for _, st := range p.SwitchTables {
+		dw.int(int64(st.Default))
+		dw.uint(uint64(len(st.Values)))
+		for i, v := range st.Values {
+			dw.constant(v)
+			dw.int(int64(st.Jumps[i]))
+		}
+	}
+
+	dw.uint(uint64(len(p.CallNames)))
+	for _, cn := range p.CallNames {
+		dw.uint(uint64(cn.Args))
+		dw.uint(uint64(len(cn.Names)))
+		for _, name := range cn.Names {
+			dw.string(name)
+		}
+	}
+	dw.uint(uint64(len(p.RestFields)))
+	for _, rf := range p.RestFields {
+		dw.int(int64(rf.Skip))
+		dw.uint(uint64(len(rf.Keys)))
+		for _, key := range rf.Keys {
+			dw.string(key)
+		}
+	}
+
+	dw.uint(uint64(len(p.DbgSourcePositions)))
+	for _, pos := range p.DbgSourcePositions {
+		dw.int(int64(pos))
+	}
+	dw.uint(uint64(len(p.DbgSourceSpans)))
+	for _, span := range p.DbgSourceSpans {
+		dw.int(int64(span.Column))
+		dw.int(int64(span.LastLine))
+		dw.int(int64(span.LastColumn))
+	}
+	dw.uint(uint64(len(p.DbgLocals)))
+	for _, li := range p.DbgLocals {
+		dw.string(li.Name)
+		dw.int(int64(li.StartPc))
+		dw.int(int64(li.EndPc))
+	}
+	dw.uint(uint64(len(p.DbgCalls)))
+	for _, dc := range p.DbgCalls {
+		dw.string(dc.Name)
+		dw.int(int64(dc.Pc))
+	}
+	dw.uint(uint64(len(p.DbgUpvalues)))
+	for _, name := range p.DbgUpvalues {
+		dw.string(name)
+	}
+}
+
+// DumpProto - writes the compiled proto, with its nested protos and debug
+// information, to w in the precompiled q format
+func DumpProto(w io.Writer, proto *ProcProto) error {
+	dw := &dumpWriter{w: bufio.NewWriter(w)}
+	dw.bytes([]byte(QcSignature))
+	dw.bytes([]byte{byte(QcVersion), byte(QcVersion >> 8), byte(opCodeMax)})
+	dw.proto(proto)
+	if dw.err != nil {
+		return dw.err
+	}
+	return dw.w.Flush()
+}
+
+// undumpReader - reads proto fields, remembering the first error
+type undumpReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (ur *undumpReader) fail(err error) {
+	if ur.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		ur.err = err
+	}
+}
+
+func (ur *undumpReader) byte() byte {
+	if ur.err != nil {
+		return 0
+	}
+	b, err := ur.r.ReadByte()
+	if err != nil {
+		ur.fail(err)
+	}
+	return b
+}
+
+func (ur *undumpReader) uint() uint64 {
+	if ur.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(ur.r)
+	if err != nil {
+		ur.fail(err)
+	}
+	return v
+}
+
+func (ur *undumpReader) int() int64 {
+	if ur.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(ur.r)
+	if err != nil {
+		ur.fail(err)
+	}
+	return v
+}
+
+// count - reads a slice length, rejecting impossible lengths
+func (ur *undumpReader) count() int {
+	n := ur.uint()
+	if n > math.MaxInt32 {
+		ur.fail(fmt.Errorf("corrupt precompiled data, length %d", n))
+		return 0
+	}
+	return int(n)
+}
+
+// capHint - bounds the capacity preallocated for n elements, so a corrupt
+// length can not exhaust memory before the data runs out
+func capHint(n int) int {
+	if n > 1024 {
+		return 1024
+	}
+	return n
+}
+
+func (ur *undumpReader) string() string {
+	n := ur.count()
+	if ur.err != nil || n == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, ur.r, int64(n)); err != nil {
+		ur.fail(err)
+		return ""
+	}
+	return sb.String()
+}
+
+// constant - reads a constant written by dumpWriter.constant
+func (ur *undumpReader) constant() LValue {
+	switch tag := ur.byte(); tag {
+	case qcConstNil:
+		return LNil
+	case qcConstFalse:
+		return LFalse
+	case qcConstTrue:
+		return LTrue
+	case qcConstNumber:
+		return LNumber(math.Float64frombits(ur.uint()))
+	case qcConstInteger:
+		return LInteger(ur.int())
+	case qcConstString:
+		return LString(ur.string())
+	default:
+		ur.fail(fmt.Errorf("corrupt precompiled data, constant type %d", tag))
+	}
+	return LNil
+}
+
+func (ur *undumpReader) proto() *ProcProto {
+	p := &ProcProto{}
+	p.SourceName = ur.string()
+	p.LineDefined = int(ur.int())
+	p.LastLineDefined = int(ur.int())
+	p.NumUpvalues = ur.byte()
+	p.NumParameters = ur.byte()
+	p.IsVarArg = ur.byte()
+	p.NumUsedRegisters = ur.byte()
+	p.Strict = ur.byte() != 0
+	n := ur.count()
+	for i := 0; i < n && ur.err == nil; i++ {
+		p.StrictGlobals = append(p.StrictGlobals, ur.string())
+	}
+
+	n = ur.count()
+	p.Code = make([]uint32, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		inst := ur.uint()
+		if inst > math.MaxUint32 || opGetOpCode(uint32(inst)) > opCodeMax {
+			ur.fail(fmt.Errorf("corrupt precompiled data, invalid instruction %#x", inst))
+		}
+		p.Code = append(p.Code, uint32(inst))
+	}
+
+	n = ur.count()
+	p.Constants = make([]LValue, 0, capHint(n))
+	p.stringConstants = make([]string, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		c := ur.constant()
+		sv := ""
+		if ls, ok := c.(LString); ok {
+			sv = string(ls)
+		}
+		p.Constants = append(p.Constants, c)
+		p.stringConstants = append(p.stringConstants, sv)
+	}
+
+	n = ur.count()
+	p.ProcPrototypes = make([]*ProcProto, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		p.ProcPrototypes = append(p.ProcPrototypes, ur.proto())
+	}
+
+	n = ur.count()
+	p.SwitchTables = make([]*SwitchTable, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		st := &SwitchTable{Default: int(ur.int())}
+		m := ur.count()
+		for j := 0; j < m && ur.err == nil; j++ {
+			st.Values = append(st.Values, ur.constant())
+			st.Jumps = append(st.Jumps, int(ur.int()))
+		}
+		st.makeIndex()
+		p.SwitchTables = append(p.SwitchTables, st)
+	}
+
+	n = ur.count()
+	p.CallNames = make([]*CallNames, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		cn := &CallNames{Args: ur.count()}
+		m := ur.count()
+		for j := 0; j < m && ur.err == nil; j++ {
+			cn.Names = append(cn.Names, ur.string())
+		}
+		p.CallNames = append(p.CallNames, cn)
+	}
+
+	n = ur.count()
+	p.RestFields = make([]*RestFields, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		rf := &RestFields{Skip: int(ur.int())}
+		m := ur.count()
+		for j := 0; j < m && ur.err == nil; j++ {
+			rf.Keys = append(rf.Keys, ur.string())
+		}
+		p.RestFields = append(p.RestFields, rf)
+	}
+
+	n = ur.count()
+	p.DbgSourcePositions = make([]int, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		p.DbgSourcePositions = append(p.DbgSourcePositions, int(ur.int()))
+	}
+	n = ur.count()
+	p.DbgSourceSpans = make([]DbgSpan, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		span := DbgSpan{Column: int(ur.int())}
+		span.LastLine = int(ur.int())
+		span.LastColumn = int(ur.int())
+		p.DbgSourceSpans = append(p.DbgSourceSpans, span)
+	}
+	n = ur.count()
+	p.DbgLocals = make([]*DbgLocalInfo, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		li := &DbgLocalInfo{Name: ur.string()}
+		li.StartPc = int(ur.int())
+		li.EndPc = int(ur.int())
+		p.DbgLocals = append(p.DbgLocals, li)
+	}
+	n = ur.count()
+	p.DbgCalls = make([]DbgCall, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		dc := DbgCall{Name: ur.string()}
+		dc.Pc = int(ur.int())
+		p.DbgCalls = append(p.DbgCalls, dc)
+	}
+	n = ur.count()
+	p.DbgUpvalues = make([]string, 0, capHint(n))
+	for i := 0; i < n && ur.err == nil; i++ {
+		p.DbgUpvalues = append(p.DbgUpvalues, ur.string())
+	}
+	return p
+}
+
+// UndumpProto - reads a proto written by DumpProto, name is used in error
+// messages. Data written for a different bytecode version is rejected.
+func UndumpProto(r io.Reader, name string) (*ProcProto, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	header := make([]byte, len(QcSignature)+3)
+	if _, err := io.ReadFull(br, header); err != nil || !IsPrecompiled(header) {
+		return nil, fmt.Errorf("%s: not a precompiled q file", name)
+	}
+	version := int(header[len(QcSignature)]) | int(header[len(QcSignature)+1])<<8
+	opmax := int(header[len(QcSignature)+2])
+	if version != QcVersion {
+		return nil, fmt.Errorf("%s: precompiled with bytecode version %d, this q supports version %d, recompile the source with 'q compile'",
+			name, version, QcVersion)
+	}
+	if opmax != opCodeMax {
+		return nil, fmt.Errorf("%s: precompiled for an incompatible instruction set, recompile the source with 'q compile'", name)
+	}
+	ur := &undumpReader{r: br}
+	proto := ur.proto()
+	if ur.err != nil {
+		return nil, fmt.Errorf("%s: %v", name, ur.err)
+	}
+	return proto, nil
+}
+
+// LoadProto - compiles the q source file at path, or reads it when it is a
+// precompiled file, without running it
+func LoadProto(path string) (*ProcProto, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	if head, _ := reader.Peek(len(QcSignature)); IsPrecompiled(head) {
+		return UndumpProto(reader, path)
+	}
+	src, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return CompileSource(src, path)
+}
@@ -0,0 +1,99 @@
+package qs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const dumpScript = `// q:strict
+global total = 0
+proc add(a, b = 10) return a + b end
+dcl {x, y = z} = {x = 1, y = 2}
+dcl [first, ...rest] = {3, 4, 5}
+switch first
+case 3 then total = add(x, b: z)
+else total = -1
+end
+class Counter
+  proc init(n) self.n = n end
+  proc inc() self.n = self.n + 1 return self.n end
+end
+dcl c = Counter(tonumber(tostring(total)))
+return f"{c:inc()} {#rest} {3 \ 2}"
+`
+
+// dumpSegment - compiles src and returns its precompiled form
+func dumpSegment(t *testing.T, src string) []byte {
+	t.Helper()
+	proto, err := CompileSource([]byte(src), "dump.q")
+	if err != nil {
+		t.Fatalf("CompileSource: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := DumpProto(&buf, proto); err != nil {
+		t.Fatalf("DumpProto: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestDumpRoundTrip - a precompiled segment runs like its source
+func TestDumpRoundTrip(t *testing.T) {
+	data := dumpSegment(t, dumpScript)
+	if !IsPrecompiled(data) {
+		t.Fatalf("no signature in %q", data[:8])
+	}
+	L := NewState()
+	defer L.Close()
+	fn, err := L.LoadMode(bytes.NewReader(data), "dump.qc", "b")
+	if err != nil {
+		t.Fatalf("LoadMode: %v", err)
+	}
+	L.Push(fn)
+	if err := L.PCall(0, 1, nil); err != nil {
+		t.Fatalf("PCall: %v", err)
+	}
+	if got := L.Get(-1).String(); got != "4 2 1" {
+		t.Errorf("result %q, want %q", got, "4 2 1")
+	}
+	proto := fn.Proto
+	if !proto.Strict || proto.SourceName != "dump.q" || len(proto.ProcPrototypes) == 0 {
+		t.Errorf("loaded proto strict %v source %q procs %d", proto.Strict, proto.SourceName, len(proto.ProcPrototypes))
+	}
+	if !containsString(proto.StrictGlobals, "tostring") {
+		t.Errorf("loaded proto strict globals %v", proto.StrictGlobals)
+	}
+}
+
+// TestLoadMode - source and precompiled segments are loaded as the mode
+// allows, Load and loadstring only load source
+func TestLoadMode(t *testing.T) {
+	data := dumpSegment(t, "return 1")
+	L := NewState()
+	defer L.Close()
+	for _, c := range []struct {
+		src, mode, err string
+	}{
+		{"return 1", "t", ""},
+		{"return 1", "bt", ""},
+		{"return 1", "b", "attempt to load a text segment (mode is 'b')"},
+		{string(data), "b", ""},
+		{string(data), "bt", ""},
+		{string(data), "t", "attempt to load a binary segment (mode is 't')"},
+	} {
+		_, err := L.LoadMode(strings.NewReader(c.src), "mode", c.mode)
+		if len(c.err) == 0 && err != nil || len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("mode %s: error %v, want %q", c.mode, err, c.err)
+		}
+	}
+	if _, err := L.LoadString(string(data)); err == nil {
+		t.Errorf("LoadString loaded a precompiled segment")
+	}
+	L.SetGlobal("data", LString(data))
+	if err := L.DoString(`dcl fn, err = loadstring(data)
+assert(fn == nil and find(err, "binary segment"), err)
+assert(loadstring(data, "data", "b")() == 1)
+assert(load(proc() dcl s = data data = nil return s end, "data", "bt")() == 1)`); err != nil {
+		t.Errorf("loadstring: %v", err)
+	}
+}
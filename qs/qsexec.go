@@ -25,6 +25,99 @@ func mainLoop(L *LState, baseframe *callFrame) {
 		cf = L.currentFrame
 		inst = cf.Fn.Proto.Code[cf.Pc]
 		cf.Pc++
+		if r := jumpOAList[int(inst>>26)](L, inst, baseframe); r != 0 {
+			if r == 1 {
+				return
+			}
+			if L.hookLoop() || L.ctx != nil {
+				L.mainLoop(L, baseframe)
+				return
+			}
+		}
+	}
+}
+
+// mainLoopWithContext - mainLoop checking before each instruction if the
+// context of L is done
+func mainLoopWithContext(L *LState, baseframe *callFrame) {
+	var inst uint32
+	var cf *callFrame
+
+	if L.stack.IsEmpty() {
+		return
+	}
+
+	L.currentFrame = L.stack.Last()
+	if L.currentFrame.Fn.IsG {
+		callGProc(L, false)
+		return
+	}
+
+	done := L.ctx.Done()
+	for {
+		cf = L.currentFrame
+		inst = cf.Fn.Proto.Code[cf.Pc]
+		cf.Pc++
+		select {
+		case <-done:
+			if L.ctxRaised && L.ctxGrace > 0 {
+				L.ctxGrace--
+			} else {
+				L.raiseContextError()
+			}
+		default:
+		}
+		if r := jumpOAList[int(inst>>26)](L, inst, baseframe); r != 0 {
+			if r == 1 {
+				return
+			}
+			if L.hookLoop() {
+				L.mainLoop(L, baseframe)
+				return
+			}
+		}
+	}
+}
+
+// mainLoopWithHook - mainLoop calling the line and count hooks before each
+// instruction, and checking the context of L when it has one
+func mainLoopWithHook(L *LState, baseframe *callFrame) {
+	var inst uint32
+	var cf *callFrame
+
+	if L.stack.IsEmpty() {
+		return
+	}
+
+	L.currentFrame = L.stack.Last()
+	if L.currentFrame.Fn.IsG {
+		callGProc(L, false)
+		return
+	}
+
+	done := L.contextDone()
+	for {
+		cf = L.currentFrame
+		inst = cf.Fn.Proto.Code[cf.Pc]
+		cf.Pc++
+		select {
+		case <-done:
+			if L.ctxRaised && L.ctxGrace > 0 {
+				L.ctxGrace--
+			} else {
+				L.raiseContextError()
+			}
+		default:
+		}
+		if L.hookMask != 0 {
+			L.instructionHook(cf)
+		}
+		if L.G.prof != nil {
+			L.G.prof.tick(L)
+		}
+		if L.G.cover != nil {
+			L.G.cover.hit(cf.Fn.Proto, cf.Pc-1)
+		}
 		if jumpOAList[int(inst>>26)](L, inst, baseframe) == 1 {
 			return
 		}
@@ -84,6 +177,12 @@ func switchToParentThread(L *LState, nargs int, haserror bool, kill bool) {
 func callGProc(L *LState, tailcall bool) bool {
 	frame := L.currentFrame
 	gfnret := frame.Fn.GProc(L)
+	if L.hookMask&MaskReturn != 0 && gfnret >= 0 {
+		L.callHook(HookReturn, -1)
+	}
+	if L.G.prof != nil {
+		L.G.prof.tick(L)
+	}
 	if tailcall {
 		L.stack.Remove(L.stack.Sp() - 2) // remove caller oa proc frame
 		L.currentFrame = L.stack.Last()
@@ -151,7 +250,7 @@ func threadRun(L *LState) {
 			}
 		}
 	}()
-	mainLoop(L, nil)
+	L.runLoop(nil)
 }
 
 type instFunc func(*LState, uint32, *callFrame) int
@@ -196,6 +295,12 @@ func init() {
 		opArith, // OP_DIV
 		opArith, // OP_MOD
 		opArith, // OP_POW
+		opArith, // OP_IDIV
+		opArith, // OP_BAND
+		opArith, // OP_BOR
+		opArith, // OP_BXOR
+		opArith, // OP_SHL
+		opArith, // OP_SHR
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_UNM
 			reg := L.reg
 			cf := L.currentFrame
@@ -206,6 +311,8 @@ func init() {
 			unaryv := L.rkValue(B)
 			if nm, ok := unaryv.(LNumber); ok {
 				reg.SetNumber(RA, -nm)
+			} else if it, ok := unaryv.(LInteger); ok {
+				reg.SetInteger(RA, -it)
 			} else {
 				op := L.metaOp1(unaryv, "__unm")
 				if op.Type() == LTProc {
@@ -214,8 +321,8 @@ func init() {
 					L.Call(1, 1)
 					reg.Set(RA, reg.Pop())
 				} else if str, ok1 := unaryv.(LString); ok1 {
-					if num, err := parseNumber(string(str)); err == nil {
-						reg.Set(RA, -num)
+					if num, err := parseNumberValue(string(str)); err == nil {
+						reg.Set(RA, numberNegate(num))
 					} else {
 						L.RaiseError("__unm undefined")
 					}
@@ -225,6 +332,33 @@ func init() {
 			}
 			return 0
 		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_BNOT
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff) //GETB
+			unaryv := L.rkValue(B)
+			if it, ok := unaryv.(LInteger); ok {
+				reg.SetInteger(RA, ^it)
+			} else {
+				op := L.metaOp1(unaryv, "__bnot")
+				if op.Type() == LTProc {
+					reg.Push(op)
+					reg.Push(unaryv)
+					L.Call(1, 1)
+					reg.Set(RA, reg.Pop())
+				} else if it, ok := lvToInteger(unaryv); ok {
+					reg.SetInteger(RA, ^it)
+				} else if unaryv.Type() == LTNumber {
+					L.RaiseError("number has no integer representation")
+				} else {
+					L.RaiseError("__bnot undefined")
+				}
+			}
+			return 0
+		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_NOT
 			reg := L.reg
 			cf := L.currentFrame
@@ -248,7 +382,7 @@ func init() {
 			B := int(inst & 0x1ff) //GETB
 			switch lv := L.rkValue(B).(type) {
 			case LString:
-				reg.SetNumber(RA, LNumber(len(lv)))
+				reg.SetInteger(RA, LInteger(len(lv)))
 			default:
 				op := L.metaOp1(lv, "__len")
 				if op.Type() == LTProc {
@@ -257,7 +391,7 @@ func init() {
 					L.Call(1, 1)
 					reg.Set(RA, reg.Pop())
 				} else if lv.Type() == LTOAList {
-					reg.SetNumber(RA, LNumber(lv.(*LOAList).Len()))
+					reg.SetInteger(RA, LInteger(lv.(*LOAList).Len()))
 				} else {
 					L.RaiseError("__len undefined")
 				}
@@ -303,6 +437,18 @@ func init() {
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
 			B := int(inst & 0x1ff) //GETB
+			if n := len(L.tries); n > 0 && L.tries[n-1].sp == L.stack.Sp() {
+				nret := B - 1
+				if B == 0 {
+					nret = reg.Top() - RA
+				}
+				if L.returnFinally(RA, nret) {
+					return 0
+				}
+			}
+			if L.hookMask&MaskReturn != 0 {
+				L.callHook(HookReturn, -1)
+			}
 			{
 				ls := L
 				idx := lbase
@@ -502,7 +648,11 @@ func init() {
 			RA := lbase + A
 			Bx := int(inst & 0x3ffff) //GETBX
 			//reg.Set(RA, L.getField(cf.Fn.Env, cf.Fn.Proto.Constants[Bx]))
-			reg.Set(RA, L.getFieldString(cf.Fn.Env, cf.Fn.Proto.stringConstants[Bx]))
+			value := L.getFieldString(cf.Fn.Env, cf.Fn.Proto.stringConstants[Bx])
+			if value == LNil && cf.Fn.Proto.Strict && containsString(cf.Fn.Proto.StrictGlobals, cf.Fn.Proto.stringConstants[Bx]) {
+				L.RaiseError("undefined global '%s'", cf.Fn.Proto.stringConstants[Bx])
+			}
+			reg.Set(RA, value)
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_LOADK
@@ -558,6 +708,21 @@ func init() {
 			lbase := cf.LocalBase
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
+			if init, ok1 := reg.Get(RA).(LInteger); ok1 {
+				// integer loop, R(A+1) holds the count of iterations left
+				count := reg.Get(RA + 1).(LInteger)
+				if count != 0 {
+					init += reg.Get(RA + 2).(LInteger)
+					reg.SetInteger(RA, init)
+					reg.SetInteger(RA+1, count-1)
+					Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
+					cf.Pc += Sbx
+					reg.SetInteger(RA+3, init)
+				} else {
+					reg.SetTop(RA + 1)
+				}
+				return 0
+			}
 			if init, ok1 := reg.Get(RA).assertFloat64(); ok1 {
 				if limit, ok2 := reg.Get(RA + 1).assertFloat64(); ok2 {
 					if step, ok3 := reg.Get(RA + 2).assertFloat64(); ok3 {
@@ -588,6 +753,10 @@ func init() {
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
 			Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
+			if forPrepInteger(L, RA) {
+				cf.Pc += Sbx
+				return 0
+			}
 			if init, ok1 := reg.Get(RA).assertFloat64(); ok1 {
 				if step, ok2 := reg.Get(RA + 2).assertFloat64(); ok2 {
 					reg.SetNumber(RA, LNumber(init-step))
@@ -670,7 +839,7 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			reg.Set(RA, newLOAList(B, C))
+			reg.Set(RA, newLOAList(L.alloc, B, C))
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SELF
@@ -738,7 +907,9 @@ func init() {
 			rhs := L.rkValue(C)
 			ret := false
 
-			if v1, ok1 := lhs.assertFloat64(); ok1 {
+			if c, ok := integerCompare(lhs, rhs); ok {
+				ret = c <= 0
+			} else if v1, ok1 := lhs.assertFloat64(); ok1 {
 				if v2, ok2 := rhs.assertFloat64(); ok2 {
 					ret = v1 <= v2
 				} else {
@@ -886,7 +1057,7 @@ func init() {
 							if CompatVarArg {
 								ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 								if (proto.IsVarArg & VarArgNeedsArg) != 0 {
-									argtb := newLOAList(nvarargs, 0)
+									argtb := newLOAList(L.alloc, nvarargs, 0)
 									for i := 0; i < nvarargs; i++ {
 										argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 									}
@@ -904,9 +1075,18 @@ func init() {
 					}
 				}
 				ls.currentFrame = newcf
+				if ls.hookMask&MaskCall != 0 {
+					ls.callHook(HookCall, -1)
+				}
 			}
-			if callable.IsG && callGProc(L, false) {
-				return 1
+			if callable.IsG {
+				if callGProc(L, false) {
+					return 1
+				}
+				if L.loopChanged {
+					// a hook or context was set, the loop may have to change
+					return 2
+				}
 			}
 			return 0
 		},
@@ -1037,7 +1217,7 @@ func init() {
 							if CompatVarArg {
 								ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 								if (proto.IsVarArg & VarArgNeedsArg) != 0 {
-									argtb := newLOAList(nvarargs, 0)
+									argtb := newLOAList(L.alloc, nvarargs, 0)
 									for i := 0; i < nvarargs; i++ {
 										argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 									}
@@ -1071,6 +1251,9 @@ func init() {
 				}
 				cf.Base = base
 				cf.LocalBase = base + (cf.LocalBase - lbase + 1)
+				if L.hookMask&MaskCall != 0 {
+					L.callHook(HookCall, -1)
+				}
 			}
 			return 0
 		},
@@ -1097,10 +1280,128 @@ func init() {
 			}
 			return 0
 		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SWITCH
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			Bx := int(inst & 0x3ffff) //GETBX
+			cf.Pc += cf.Fn.Proto.SwitchTables[Bx].jump(reg.Get(RA))
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_TOSTRING
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			v := L.rkValue(B)
+			if format, ok := L.rkValue(C).(LString); ok && len(format) > 0 {
+				reg.Set(RA, L.newString(strFormatArgs(string(format), []interface{}{v})))
+			} else {
+				reg.Set(RA, L.toString(v))
+			}
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_TRY
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff              //GETA
+			Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
+			L.pushTry(cf.LocalBase+A, cf.Pc+Sbx, false)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_FINALLY
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff              //GETA
+			Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
+			L.reg.Set(cf.LocalBase+A, LNil)
+			L.pushTry(cf.LocalBase+A, cf.Pc+Sbx, true)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_ENDTRY
+			L.popTry()
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_LEAVE
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff //GETA
+			RA := cf.LocalBase + A
+			Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
+			L.popTry()
+			L.closeUpvalues(RA)
+			L.setPending(RA, &tryPending{pc: cf.Pc})
+			cf.Pc += Sbx
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_ENDFINALLY
+			A := int(inst>>18) & 0xff //GETA
+			return L.endFinally(L.currentFrame.LocalBase+A, baseframe)
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_DEFER
+			reg := L.reg
+			lbase := L.currentFrame.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			nargs := B - 1
+			if B == 0 {
+				nargs = reg.Top() - (RA + 1)
+			}
+			L.deferCall(lbase+C, RA, nargs)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_DEFERCLOSE
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff //GETA
+			B := int(inst & 0x1ff)    //GETB
+			name, ok := cf.Fn.LocalName(B+1, cf.Pc-1)
+			if !ok {
+				name = "?"
+			}
+			L.deferClose(cf.LocalBase+A, cf.LocalBase+B, name)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_RUNDEFER
+			A := int(inst>>18) & 0xff //GETA
+			L.runDeferred(L.currentFrame.LocalBase + A)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_NAMEDARGS
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff //GETA
+			Bx := int(inst & 0x3ffff) //GETBX
+			L.nameArgs(cf.LocalBase+A, cf.Fn.Proto.CallNames[Bx])
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_REST
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			reg.Set(RA, L.restFields(reg.Get(lbase+B), cf.Fn.Proto.RestFields[C]))
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_CLASS
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			L.makeClass(reg.Get(lbase+A).(*LOAList), reg.Get(lbase+B), C != 0)
+			return 0
+		},
 	}
 }
 
-func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW
+func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_IDIV, OP_BAND, OP_BOR, OP_BXOR, OP_SHL, OP_SHR
 	reg := L.reg
 	cf := L.currentFrame
 	lbase := cf.LocalBase
@@ -1111,9 +1412,15 @@ func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SU
 	C := int(inst>>9) & 0x1ff //GETC
 	lhs := L.rkValue(B)
 	rhs := L.rkValue(C)
+	if i1, ok1 := lhs.(LInteger); ok1 {
+		if i2, ok2 := rhs.(LInteger); ok2 {
+			reg.Set(RA, integerArithWithError(L, opcode, i1, i2))
+			return 0
+		}
+	}
 	v1, ok1 := lhs.assertFloat64()
 	v2, ok2 := rhs.assertFloat64()
-	if ok1 && ok2 {
+	if ok1 && ok2 && opcode < OP_BAND {
 		reg.SetNumber(RA, numberArith(L, opcode, LNumber(v1), LNumber(v2)))
 	} else {
 		reg.Set(RA, objectArith(L, opcode, lhs, rhs))
@@ -1147,11 +1454,148 @@ func numberArith(L *LState, opcode int, lhs, rhs LNumber) LNumber {
 		flhs := float64(lhs)
 		frhs := float64(rhs)
 		return LNumber(math.Pow(flhs, frhs))
+	case OP_IDIV:
+		return LNumber(math.Floor(float64(lhs / rhs)))
 	}
 	panic("should not reach here")
 	return LNumber(0)
 }
 
+// integerArith - performs an arithmetic or bitwise operation on two integers,
+// ok is false for an integer division or modulo by zero
+func integerArith(opcode int, lhs, rhs LInteger) (LValue, bool) {
+	switch opcode {
+	case OP_ADD:
+		return lhs + rhs, true
+	case OP_SUB:
+		return lhs - rhs, true
+	case OP_MUL:
+		return lhs * rhs, true
+	case OP_DIV, OP_POW:
+		return numberArith(nil, opcode, LNumber(lhs), LNumber(rhs)), true
+	case OP_MOD:
+		if rhs == 0 {
+			return LInteger(0), false
+		}
+		if rhs == -1 {
+			return LInteger(0), true
+		}
+		v := lhs % rhs
+		if v != 0 && (v^rhs) < 0 {
+			v += rhs
+		}
+		return v, true
+	case OP_IDIV:
+		if rhs == 0 {
+			return LInteger(0), false
+		}
+		if rhs == -1 {
+			return -lhs, true
+		}
+		v := lhs / rhs
+		if (lhs%rhs != 0) && ((lhs < 0) != (rhs < 0)) {
+			v--
+		}
+		return v, true
+	case OP_BAND:
+		return lhs & rhs, true
+	case OP_BOR:
+		return lhs | rhs, true
+	case OP_BXOR:
+		return lhs ^ rhs, true
+	case OP_SHL:
+		return integerShiftLeft(lhs, rhs), true
+	case OP_SHR:
+		return integerShiftLeft(lhs, -rhs), true
+	}
+	panic("should not reach here")
+}
+
+// integerShiftLeft - logical shift of lhs by rhs bits, negative rhs shifts right
+func integerShiftLeft(lhs, rhs LInteger) LInteger {
+	switch {
+	case rhs <= -64 || rhs >= 64:
+		return 0
+	case rhs >= 0:
+		return LInteger(uint64(lhs) << uint(rhs))
+	default:
+		return LInteger(uint64(lhs) >> uint(-rhs))
+	}
+}
+
+func integerArithWithError(L *LState, opcode int, lhs, rhs LInteger) LValue {
+	v, ok := integerArith(opcode, lhs, rhs)
+	if !ok {
+		if opcode == OP_MOD {
+			L.RaiseError("attempt to perform '%v'", "n%0")
+		}
+		L.RaiseError("attempt to perform integer division by zero")
+	}
+	return v
+}
+
+// numberNegate - returns the negative of a num, keeping its subtype
+func numberNegate(v LValue) LValue {
+	if it, ok := v.(LInteger); ok {
+		return -it
+	}
+	return -LVAsNumber(v)
+}
+
+// forPrepInteger - prepares an integer numeric for loop, returning false if
+// the init and step values are not both integers. The limit register is
+// replaced by the count of iterations to run, so that the loop can not
+// overflow.
+func forPrepInteger(L *LState, RA int) bool {
+	reg := L.reg
+	init, ok1 := reg.Get(RA).(LInteger)
+	step, ok2 := reg.Get(RA + 2).(LInteger)
+	if !ok1 || !ok2 {
+		return false
+	}
+	if step == 0 {
+		L.RaiseError("for statement step is zero")
+	}
+	var limit LInteger
+	switch lv := reg.Get(RA + 1).(type) {
+	case LInteger:
+		limit = lv
+	case LNumber:
+		f := float64(lv)
+		if step < 0 {
+			f = math.Ceil(f)
+		} else {
+			f = math.Floor(f)
+		}
+		switch {
+		case math.IsNaN(f):
+			reg.SetInteger(RA+1, 0)
+			return true
+		case f >= math.MaxInt64:
+			limit = math.MaxInt64
+		case f <= math.MinInt64:
+			limit = math.MinInt64
+		default:
+			limit = LInteger(f)
+		}
+	default:
+		L.RaiseError("for statement limit must be a number")
+	}
+	var count uint64
+	switch {
+	case step > 0 && init > limit, step < 0 && init < limit:
+		reg.SetInteger(RA+1, 0)
+		return true
+	case step > 0:
+		count = (uint64(limit) - uint64(init)) / uint64(step)
+	default:
+		count = (uint64(init) - uint64(limit)) / (uint64(-(step + 1)) + 1)
+	}
+	reg.SetInteger(RA+1, LInteger(count+1))
+	reg.SetInteger(RA, init-step)
+	return true
+}
+
 func objectArith(L *LState, opcode int, lhs, rhs LValue) LValue {
 	event := ""
 	switch opcode {
@@ -1167,6 +1611,18 @@ func objectArith(L *LState, opcode int, lhs, rhs LValue) LValue {
 		event = "__mod"
 	case OP_POW:
 		event = "__pow"
+	case OP_IDIV:
+		event = "__idiv"
+	case OP_BAND:
+		event = "__band"
+	case OP_BOR:
+		event = "__bor"
+	case OP_BXOR:
+		event = "__bxor"
+	case OP_SHL:
+		event = "__shl"
+	case OP_SHR:
+		event = "__shr"
 	}
 	op := L.metaOp2(lhs, rhs, event)
 	if op.Type() == LTProc {
@@ -1177,18 +1633,34 @@ func objectArith(L *LState, opcode int, lhs, rhs LValue) LValue {
 		return L.reg.Pop()
 	}
 	if str, ok := lhs.(LString); ok {
-		if lnum, err := parseNumber(string(str)); err == nil {
+		if lnum, err := parseNumberValue(string(str)); err == nil {
 			lhs = lnum
 		}
 	}
 	if str, ok := rhs.(LString); ok {
-		if rnum, err := parseNumber(string(str)); err == nil {
+		if rnum, err := parseNumberValue(string(str)); err == nil {
 			rhs = rnum
 		}
 	}
-	if v1, ok1 := lhs.assertFloat64(); ok1 {
-		if v2, ok2 := rhs.assertFloat64(); ok2 {
-			return numberArith(L, opcode, LNumber(v1), LNumber(v2))
+	if opcode >= OP_BAND {
+		if lhs.Type() == LTNumber && rhs.Type() == LTNumber {
+			i1, ok1 := lvToInteger(lhs)
+			i2, ok2 := lvToInteger(rhs)
+			if !ok1 || !ok2 {
+				L.RaiseError("number has no integer representation")
+			}
+			return integerArithWithError(L, opcode, i1, i2)
+		}
+	} else {
+		if i1, ok1 := lhs.(LInteger); ok1 {
+			if i2, ok2 := rhs.(LInteger); ok2 {
+				return integerArithWithError(L, opcode, i1, i2)
+			}
+		}
+		if v1, ok1 := lhs.assertFloat64(); ok1 {
+			if v2, ok2 := rhs.assertFloat64(); ok2 {
+				return numberArith(L, opcode, LNumber(v1), LNumber(v2))
+			}
 		}
 	}
 	L.RaiseError(fmt.Sprintf("cannot perform %v operation between %v and %v",
@@ -1228,6 +1700,11 @@ func stringConcat(L *LState, total, last int) LValue {
 				i--
 				total--
 			}
+			size := 0
+			for _, s := range buf {
+				size += len(s)
+			}
+			L.alloc.account(size)
 			rhs = LString(strings.Join(buf, ""))
 		}
 	}
@@ -1235,6 +1712,9 @@ func stringConcat(L *LState, total, last int) LValue {
 }
 
 func lessThan(L *LState, lhs, rhs LValue) bool {
+	if c, ok := integerCompare(lhs, rhs); ok {
+		return c < 0
+	}
 	// optimization for numbers
 	if v1, ok1 := lhs.assertFloat64(); ok1 {
 		if v2, ok2 := rhs.assertFloat64(); ok2 {
@@ -1266,6 +1746,9 @@ func equals(L *LState, lhs, rhs LValue, raw bool) bool {
 	case LTNil:
 		ret = true
 	case LTNumber:
+		if c, ok := integerCompare(lhs, rhs); ok {
+			return c == 0
+		}
 		v1, _ := lhs.assertFloat64()
 		v2, _ := rhs.assertFloat64()
 		ret = v1 == v2
@@ -1290,6 +1773,60 @@ func equals(L *LState, lhs, rhs LValue, raw bool) bool {
 	return ret
 }
 
+// integerCompare - compares two nums exactly when either is an integer,
+// ok is false when neither is an integer or either is not a num.
+func integerCompare(lhs, rhs LValue) (int, bool) {
+	i1, ok1 := lhs.(LInteger)
+	i2, ok2 := rhs.(LInteger)
+	switch {
+	case ok1 && ok2:
+	case ok1:
+		f2, ok := rhs.(LNumber)
+		if !ok {
+			return 0, false
+		}
+		return -compareFloatInteger(float64(f2), i1), true
+	case ok2:
+		f1, ok := lhs.(LNumber)
+		if !ok {
+			return 0, false
+		}
+		return compareFloatInteger(float64(f1), i2), true
+	default:
+		return 0, false
+	}
+	switch {
+	case i1 < i2:
+		return -1, true
+	case i1 > i2:
+		return 1, true
+	}
+	return 0, true
+}
+
+// compareFloatInteger - compares a float with an integer without loss of
+// precision, NaN compares as greater so that only ~= holds.
+func compareFloatInteger(f float64, i LInteger) int {
+	switch {
+	case math.IsNaN(f):
+		return 2
+	case f >= math.MaxInt64:
+		return 1
+	case f < math.MinInt64:
+		return -1
+	}
+	fi := math.Floor(f)
+	switch {
+	case LInteger(fi) < i:
+		return -1
+	case LInteger(fi) > i:
+		return 1
+	case fi < f:
+		return 1
+	}
+	return 0
+}
+
 func objectRationalWithError(L *LState, lhs, rhs LValue, event string) bool {
 	switch objectRational(L, lhs, rhs, event) {
 	case 1:
@@ -0,0 +1,42 @@
+package qs
+
+import (
+	"testing"
+)
+
+// TestIntegers - integer arithmetic, bitwise operators and their errors,
+// both folded by the compiler and run by the vm
+func TestIntegers(t *testing.T) {
+	checkScript(t, "constants", `assert(tostring(7 \ 2) == "3")
+assert(tostring(7 / 2) == "3.5")
+assert(-7 \ 2 == -4 and -7 % 2 == 1)
+assert(5 & 3 == 1 and 5 | 3 == 7 and 5 ~ 3 == 6 and ~0 == -1)
+assert(1 << 4 == 16 and -1 >> 63 == 1)
+assert(tostring(9007199254740993 + 1) == "9007199254740994")`, "")
+	checkScript(t, "registers", `dcl a, b, big = 7, 2, 9223372036854775807
+assert(tostring(a \ b) == "3" and a % b == 1)
+assert(tostring(a / b) == "3.5")
+assert(a & b == 2 and a | b == 7 and a ~ b == 5 and ~a == -8)
+assert(a << b == 28 and a >> 1 == 3)
+assert(big + 1 == -9223372036854775807 - 1)
+assert(7.0 & 3 == 3)`, "")
+	checkScript(t, "list keys", `dcl t = {}
+t[1 << 60] = "i"
+assert(1 << 60 == 2^60 and t[2^60] == "i")
+t[2^61] = "f"
+assert(t[1 << 61] == "f")
+t[3] = "small"
+assert(t[3.0] == "small")
+dcl n = 0
+for k, v in pairs(t) do n = n + 1 end
+assert(n == 3, n)
+t[2^60] = nil
+assert(t[1 << 60] == nil)`, "")
+	checkScript(t, "modulo by zero", `dcl a, b = 5, 0
+dcl c = a % b`, "attempt to perform 'n%0'")
+	checkScript(t, "folded modulo by zero", `dcl c = 5 % 0`, "attempt to perform 'n%0'")
+	checkScript(t, "division by zero", `dcl a, b = 5, 0
+dcl c = a \ b`, "attempt to perform integer division by zero")
+	checkScript(t, "bitwise float", `dcl a = 1.5
+dcl c = a | 1`, "number has no integer representation")
+}
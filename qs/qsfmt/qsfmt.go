@@ -0,0 +1,850 @@
+// package qsfmt q language source formatter
+package qsfmt
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/x0ray/q/qs/qsa"
+	"github.com/x0ray/q/qs/qsp"
+)
+
+/*
+  Format prints the syntax tree of a q source in the canonical form:
+
+    - each statement on a line of its own, blocks indented by two spaces,
+      no semicolons, and at most one blank line kept between statements
+    - proc for func, .. for ||, != for ~= and name.key for name["key"]
+    - spaces around binary operators and after commas, parentheses only
+      where precedence needs them
+    - a list constructor or an anonymous proc written on one line stays on
+      one line, one written on more lines has a line for each field or
+      statement
+
+  Strings and numbers are printed as written. The comments of the source
+  are printed where they were, by their positions relative to the nodes of
+  the tree: before a statement, at the end of the line of a statement or
+  block header, and before the end of a block. A comment inside a one line
+  construct is moved to the end of its statement.
+*/
+
+// indentText - the indentation of a block
+const indentText = "  "
+
+// precedences of the operators, higher binds tighter
+const (
+	precOr = iota + 1
+	precAnd
+	precCompare
+	precBOr
+	precBXor
+	precBAnd
+	precShift
+	precConcat
+	precAdd
+	precMul
+	precUnary
+	precPow
+	precAtom
+)
+
+// endOfSource - a position after all the source
+var endOfSource = qsa.Position{Line: int(^uint(0) >> 1)}
+
+// printer - the state of Format
+type printer struct {
+	buf      bytes.Buffer
+	lines    []string       // of the source
+	comments []*qsa.Comment // not yet printed
+	indent   int
+	inline   int  // > 0 while printing a construct on one line
+	pending  bool // the indentation of the line is not yet written
+	closed   bool // a line comment ended the line
+	last     int  // source line of the last item printed in a block, 0 for none
+}
+
+// Format - returns the q source src in the canonical form, or the error of
+// a source that does not parse
+func Format(src []byte, name string) ([]byte, error) {
+	segment, comments, err := qsp.ParseComments(bytes.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{comments: comments}
+	for _, line := range strings.Split(string(src), "\n") {
+		p.lines = append(p.lines, strings.TrimSuffix(line, "\r"))
+	}
+	p.block(segment, endOfSource)
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+	return p.buf.Bytes(), nil
+}
+
+// before - reports whether position a is before position b
+func before(a, b qsa.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// start - returns the position of the first character of a node
+func start(node qsa.PositionHolder) qsa.Position {
+	return qsa.Position{Line: node.Line(), Column: node.Column()}
+}
+
+// endKeyword - returns the position of the end closing a node
+func endKeyword(node qsa.PositionHolder) qsa.Position {
+	return qsa.Position{Line: node.LastLine(), Column: node.LastColumn() - len("end") + 1}
+}
+
+// write - writes s, indenting it when it starts a line
+func (p *printer) write(s string) {
+	if p.pending {
+		p.buf.WriteString(strings.Repeat(indentText, p.indent))
+		p.pending = false
+	}
+	p.buf.WriteString(s)
+}
+
+// nl - ends the line, or writes a space on one line
+func (p *printer) nl() {
+	if p.inline > 0 {
+		p.buf.WriteByte(' ')
+		return
+	}
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+	p.pending = true
+	p.closed = false
+}
+
+// item - starts the line of a statement, comment or field on source line,
+// after a blank line when there is one in the source
+func (p *printer) item(line int) {
+	p.nl()
+	if p.inline == 0 && p.last > 0 && line > p.last+1 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// leading - prints the comments before pos, each on its own line
+func (p *printer) leading(pos qsa.Position) {
+	if p.inline > 0 {
+		return
+	}
+	for len(p.comments) > 0 && before(p.comments[0].Pos, pos) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.item(c.Pos.Line)
+		p.comment(c)
+		p.last = c.End.Line
+	}
+}
+
+// trailing - prints the comments starting on or before source line and
+// before pos at the end of the output line
+func (p *printer) trailing(line int, pos qsa.Position) {
+	if p.inline > 0 {
+		return
+	}
+	for len(p.comments) > 0 && p.comments[0].Pos.Line <= line && before(p.comments[0].Pos, pos) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		if p.closed {
+			p.item(c.Pos.Line)
+		} else {
+			p.write(" ")
+		}
+		p.comment(c)
+	}
+}
+
+// comment - writes a comment, a line comment ends the line
+func (p *printer) comment(c *qsa.Comment) {
+	text := c.Text
+	if !strings.HasPrefix(text, "/*") {
+		text = strings.TrimRight(text, " \t")
+		p.closed = true
+	}
+	p.write(text)
+}
+
+// source - returns the source text from pos to end
+func (p *printer) source(pos, end qsa.Position) string {
+	if pos.Line < 1 || end.Line > len(p.lines) || end.Line < pos.Line {
+		return ""
+	}
+	if pos.Line == end.Line {
+		text := p.lines[pos.Line-1]
+		if pos.Column < 1 || end.Column > len(text) || end.Column < pos.Column {
+			return ""
+		}
+		return text[pos.Column-1 : end.Column]
+	}
+	first := p.lines[pos.Line-1]
+	last := p.lines[end.Line-1]
+	if pos.Column < 1 || pos.Column > len(first) || end.Column > len(last) {
+		return ""
+	}
+	parts := []string{first[pos.Column-1:]}
+	parts = append(parts, p.lines[pos.Line:end.Line-1]...)
+	return strings.Join(append(parts, last[:end.Column]), "\n")
+}
+
+// block - prints the statements of a block ending at the keyword at end
+func (p *printer) block(stmts []qsa.Stmt, end qsa.Position) {
+	p.last = 0
+	for _, stmt := range stmts {
+		p.leading(start(stmt))
+		p.item(stmt.Line())
+		if startsWithParen(stmt) {
+			p.write(";") // not the arguments of a call on the line before
+		}
+		p.stmt(stmt)
+		p.trailing(stmt.LastLine(), endOfSource)
+		p.last = stmt.LastLine()
+	}
+	p.leading(end)
+}
+
+// body - prints the block of a statement with the header ending on source
+// line, and the end of the block at end
+func (p *printer) body(header int, stmts []qsa.Stmt, end qsa.Position) {
+	first := end
+	if len(stmts) > 0 {
+		first = start(stmts[0])
+	}
+	p.trailing(header, first)
+	p.indent++
+	p.block(stmts, end)
+	p.indent--
+	p.nl()
+}
+
+// declaration - prints a dcl or global statement
+func (p *printer) declaration(keyword string, names []string, exprs []qsa.Expr) {
+	if len(names) == 1 && len(exprs) == 1 {
+		if fn, ok := exprs[0].(*qsa.ProcExpr); ok {
+			p.write(keyword + " proc " + names[0])
+			p.proc(fn)
+			return
+		}
+	}
+	p.write(keyword + " " + strings.Join(names, ", "))
+	if len(exprs) > 0 {
+		p.write(" = ")
+		p.exprs(exprs)
+	}
+}
+
+// bindings - returns the names of a dcl statement or for, a name with a
+// pattern as the pattern
+func bindings(names []string, patterns []*qsa.Pattern) string {
+	if patterns == nil {
+		return strings.Join(names, ", ")
+	}
+	texts := make([]string, len(names))
+	for i, name := range names {
+		pat := patterns[i]
+		if pat == nil {
+			texts[i] = name
+			continue
+		}
+		items := make([]string, 0, len(pat.Names)+1)
+		for j, name := range pat.Names {
+			if !pat.Positional && pat.Keys[j] != name {
+				name = pat.Keys[j] + " = " + name
+			}
+			items = append(items, name)
+		}
+		if pat.Rest != "" {
+			items = append(items, "..."+pat.Rest)
+		}
+		if pat.Positional {
+			texts[i] = "[" + strings.Join(items, ", ") + "]"
+		} else {
+			texts[i] = "{" + strings.Join(items, ", ") + "}"
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// stmt - prints a statement
+func (p *printer) stmt(stmt qsa.Stmt) {
+	switch st := stmt.(type) {
+	case *qsa.AssignStmt:
+		p.exprs(st.Lhs)
+		p.write(" = ")
+		p.exprs(st.Rhs)
+	case *qsa.CompoundAssignStmt:
+		p.expr(st.Lhs, 0)
+		p.write(" " + st.Operator + "= ")
+		p.expr(st.Rhs, 0)
+	case *qsa.LocalAssignStmt:
+		if st.Close {
+			p.write("dcl " + st.Names[0] + " <close> = ")
+			p.exprs(st.Exprs)
+			return
+		}
+		if st.Patterns != nil {
+			p.write("dcl " + bindings(st.Names, st.Patterns) + " = ")
+			p.exprs(st.Exprs)
+			return
+		}
+		p.declaration("dcl", st.Names, st.Exprs)
+	case *qsa.GlobalStmt:
+		p.declaration("global", st.Names, st.Exprs)
+	case *qsa.FuncCallStmt:
+		p.expr(st.Expr, 0)
+	case *qsa.DoBlockStmt:
+		p.write("do")
+		p.body(st.Line(), st.Stmts, endKeyword(st))
+		p.write("end")
+	case *qsa.WhileStmt:
+		p.write("while ")
+		p.expr(st.Condition, 0)
+		p.write(" do")
+		p.body(st.Condition.LastLine(), st.Stmts, endKeyword(st))
+		p.write("end")
+	case *qsa.RepeatStmt:
+		p.write("repeat")
+		p.body(st.Line(), st.Stmts, start(st.Condition))
+		p.write("until ")
+		p.expr(st.Condition, 0)
+	case *qsa.IfStmt:
+		p.ifStmt(st)
+	case *qsa.SwitchStmt:
+		p.switchStmt(st)
+	case *qsa.TryStmt:
+		p.tryStmt(st)
+	case *qsa.DeferStmt:
+		p.write("defer ")
+		p.expr(st.Expr, 0)
+	case *qsa.NumberForStmt:
+		p.write("for " + st.Name + " = ")
+		p.expr(st.Init, 0)
+		p.write(", ")
+		p.expr(st.Limit, 0)
+		header := st.Limit.LastLine()
+		if st.Step != nil {
+			p.write(", ")
+			p.expr(st.Step, 0)
+			header = st.Step.LastLine()
+		}
+		p.write(" do")
+		p.body(header, st.Stmts, endKeyword(st))
+		p.write("end")
+	case *qsa.GenericForStmt:
+		p.write("for " + bindings(st.Names, st.Patterns) + " in ")
+		p.exprs(st.Exprs)
+		p.write(" do")
+		p.body(st.Exprs[len(st.Exprs)-1].LastLine(), st.Stmts, endKeyword(st))
+		p.write("end")
+	case *qsa.FuncDefStmt:
+		p.write("proc ")
+		if st.Name.Func != nil {
+			p.expr(st.Name.Func, precAtom)
+		} else {
+			p.expr(st.Name.Receiver, precAtom)
+			p.write(":" + st.Name.Method)
+		}
+		p.proc(st.Func)
+	case *qsa.ClassStmt:
+		p.classStmt(st)
+	case *qsa.ReturnStmt:
+		p.write("return")
+		if len(st.Exprs) > 0 {
+			p.write(" ")
+			p.exprs(st.Exprs)
+		}
+	case *qsa.BreakStmt:
+		p.write("break")
+	case *qsa.ContinueStmt:
+		p.write("continue")
+	}
+}
+
+// ifStmt - prints an if statement, with elseif for an if statement ending
+// with the end of the one before in its else part
+func (p *printer) ifStmt(st *qsa.IfStmt) {
+	p.write("if ")
+	for cur := st; ; {
+		p.expr(cur.Condition, 0)
+		p.write(" then")
+		var elseif *qsa.IfStmt
+		if len(cur.Else) == 1 {
+			if next, ok := cur.Else[0].(*qsa.IfStmt); ok && next.LastLine() == st.LastLine() &&
+				next.LastColumn() == st.LastColumn() {
+				elseif = next
+			}
+		}
+		end := endKeyword(st)
+		if len(cur.Else) > 0 {
+			end = start(cur.Else[0])
+		}
+		p.body(cur.Condition.LastLine(), cur.Then, end)
+		if elseif != nil {
+			p.write("elseif ")
+			cur = elseif
+			continue
+		}
+		if len(cur.Else) > 0 {
+			p.write("else")
+			p.body(0, cur.Else, endKeyword(st))
+		}
+		break
+	}
+	p.write("end")
+}
+
+// switchStmt - prints a switch statement with its cases at the indent of
+// the switch
+func (p *printer) switchStmt(st *qsa.SwitchStmt) {
+	p.write("switch ")
+	p.expr(st.Subject, 0)
+	p.trailing(st.Subject.LastLine(), start(st.Cases[0]))
+	p.leading(start(st.Cases[0]))
+	p.nl()
+	for i, c := range st.Cases {
+		p.write("case ")
+		p.exprs(c.Values)
+		p.write(" then")
+		end := endKeyword(st)
+		if i+1 < len(st.Cases) {
+			end = start(st.Cases[i+1])
+		} else if len(st.Else) > 0 {
+			end = start(st.Else[0])
+		}
+		p.body(c.LastLine(), c.Stmts, end)
+	}
+	if len(st.Else) > 0 {
+		p.write("else")
+		p.body(0, st.Else, endKeyword(st))
+	}
+	p.write("end")
+}
+
+// classStmt - prints a class statement with a method on each line
+func (p *printer) classStmt(st *qsa.ClassStmt) {
+	p.write("class " + st.Name.Value)
+	header := st.Name.LastLine()
+	if st.Base != nil {
+		p.write(" extends ")
+		p.expr(st.Base, 0)
+		header = st.Base.LastLine()
+	}
+	end := endKeyword(st)
+	first := end
+	if len(st.Methods) > 0 {
+		first = start(st.Methods[0])
+	}
+	p.trailing(header, first)
+	p.indent++
+	p.last = 0
+	for _, method := range st.Methods {
+		p.leading(start(method))
+		p.item(method.Line())
+		p.write("proc " + method.Name)
+		p.proc(method.Func)
+		p.trailing(method.LastLine(), endOfSource)
+		p.last = method.LastLine()
+	}
+	p.leading(end)
+	p.indent--
+	p.nl()
+	p.write("end")
+}
+
+// tryStmt - prints a try statement with its catch and finally at the indent
+// of the try
+func (p *printer) tryStmt(st *qsa.TryStmt) {
+	p.write("try")
+	end := endKeyword(st)
+	if st.Catch != nil {
+		end = start(st.Catch)
+	} else if st.Finally != nil {
+		end = start(st.Finally)
+	}
+	p.body(st.Line(), st.Stmts, end)
+	if c := st.Catch; c != nil {
+		p.write("catch")
+		if len(c.Name) > 0 {
+			p.write(" " + c.Name)
+		}
+		p.write(" then")
+		end = endKeyword(st)
+		if st.Finally != nil {
+			end = start(st.Finally)
+		}
+		p.body(c.LastLine(), c.Stmts, end)
+	}
+	if f := st.Finally; f != nil {
+		p.write("finally")
+		p.body(f.LastLine(), f.Stmts, endKeyword(st))
+	}
+	p.write("end")
+}
+
+// proc - prints the parameters and statements of a proc, on one line when
+// it is written on one line
+func (p *printer) proc(fn *qsa.ProcExpr) {
+	p.write("(")
+	for i, name := range fn.ParList.Names {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(name)
+		if def := fn.ParList.Default(i); def != nil {
+			p.write(" = ")
+			p.expr(def, 0)
+		}
+	}
+	if fn.ParList.HasVargs {
+		if len(fn.ParList.Names) > 0 {
+			p.write(", ")
+		}
+		p.write("...")
+	}
+	p.write(")")
+	if fn.Line() == fn.LastLine() {
+		p.inline++
+		defer func() { p.inline-- }()
+	}
+	p.body(fn.Line(), fn.Stmts, endKeyword(fn))
+	p.write("end")
+}
+
+// exprs - prints a comma separated list of expressions
+func (p *printer) exprs(exprs []qsa.Expr) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expr(expr, 0)
+	}
+}
+
+// binary - prints an operator expression, the operand on the side of its
+// associativity may have the same precedence without parentheses
+func (p *printer) binary(lhs qsa.Expr, op string, rhs qsa.Expr, prec int, right bool) {
+	lprec, rprec := prec, prec+1
+	if right {
+		lprec, rprec = prec+1, prec
+	}
+	p.expr(lhs, lprec)
+	p.write(" " + op + " ")
+	p.expr(rhs, rprec)
+}
+
+// precedence - returns the precedence of an expression
+func precedence(expr qsa.Expr) int {
+	switch ex := expr.(type) {
+	case *qsa.LogicalOpExpr:
+		if ex.Operator == "or" {
+			return precOr
+		}
+		return precAnd
+	case *qsa.RelationalOpExpr:
+		return precCompare
+	case *qsa.StringConcatOpExpr:
+		return precConcat
+	case *qsa.ArithmeticOpExpr:
+		switch ex.Operator {
+		case "|":
+			return precBOr
+		case "~":
+			return precBXor
+		case "&":
+			return precBAnd
+		case "<<", ">>":
+			return precShift
+		case "+", "-":
+			return precAdd
+		case "^":
+			return precPow
+		}
+		return precMul
+	case *qsa.UnaryMinusOpExpr, *qsa.UnaryNotOpExpr, *qsa.UnaryLenOpExpr, *qsa.UnaryBNotOpExpr:
+		return precUnary
+	}
+	return precAtom
+}
+
+// isPrefix - reports whether an expression can be called or indexed
+// without parentheses
+func isPrefix(expr qsa.Expr) bool {
+	switch expr.(type) {
+	case *qsa.IdentExpr, *qsa.SuperExpr, *qsa.AttrGetExpr, *qsa.FuncCallExpr:
+		return true
+	}
+	return false
+}
+
+// startsWithParen - reports whether a statement is printed starting with
+// a parenthesis
+func startsWithParen(stmt qsa.Stmt) bool {
+	var expr qsa.Expr
+	switch st := stmt.(type) {
+	case *qsa.FuncCallStmt:
+		expr = st.Expr
+	case *qsa.AssignStmt:
+		expr = st.Lhs[0]
+	case *qsa.CompoundAssignStmt:
+		expr = st.Lhs
+	default:
+		return false
+	}
+	for {
+		switch ex := expr.(type) {
+		case *qsa.FuncCallExpr:
+			if ex.AdjustRet {
+				return true
+			}
+			if expr = ex.Func; expr == nil {
+				expr = ex.Receiver
+			}
+		case *qsa.AttrGetExpr:
+			expr = ex.Object
+		default:
+			return !isPrefix(expr)
+		}
+	}
+}
+
+// prefix - prints the object of a call or an index
+func (p *printer) prefix(expr qsa.Expr) {
+	if isPrefix(expr) {
+		p.expr(expr, precAtom)
+		return
+	}
+	p.write("(")
+	p.expr(expr, 0)
+	p.write(")")
+}
+
+// isName - reports whether s can be written as a name
+// leadingCall - reports whether expr is printed starting with a call of a
+// name, which after the colon of a named argument is read as a method call
+func leadingCall(expr qsa.Expr) bool {
+	switch ex := expr.(type) {
+	case *qsa.FuncCallExpr:
+		if ex.AdjustRet {
+			return false
+		}
+		if ex.Func == nil {
+			return leadingCall(ex.Receiver)
+		}
+		if _, ok := ex.Func.(*qsa.IdentExpr); ok {
+			return true
+		}
+		return leadingCall(ex.Func)
+	case *qsa.AttrGetExpr:
+		return leadingCall(ex.Object)
+	case *qsa.LogicalOpExpr:
+		return leadingCall(ex.Lhs)
+	case *qsa.RelationalOpExpr:
+		return leadingCall(ex.Lhs)
+	case *qsa.StringConcatOpExpr:
+		return leadingCall(ex.Lhs)
+	case *qsa.ArithmeticOpExpr:
+		return leadingCall(ex.Lhs)
+	}
+	return false
+}
+
+func isName(s string) bool {
+	if len(s) == 0 || qsp.IsReservedWord(s) || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// expr - prints an expression, in parentheses when its precedence is lower
+// than prec
+func (p *printer) expr(expr qsa.Expr, prec int) {
+	if precedence(expr) < prec {
+		p.write("(")
+		defer p.write(")")
+	}
+	switch ex := expr.(type) {
+	case *qsa.TrueExpr:
+		p.write("true")
+	case *qsa.FalseExpr:
+		p.write("false")
+	case *qsa.NilExpr:
+		p.write("nil")
+	case *qsa.NumberExpr:
+		p.write(ex.Value)
+	case *qsa.StringExpr:
+		p.write(p.str(ex))
+	case *qsa.FStringExpr:
+		// as written, its expressions are part of the string
+		p.write(p.source(start(ex), qsa.Position{Line: ex.LastLine(), Column: ex.LastColumn()}))
+	case *qsa.Comma3Expr:
+		p.write("...")
+	case *qsa.IdentExpr:
+		p.write(ex.Value)
+	case *qsa.SuperExpr:
+		p.write("super")
+	case *qsa.AttrGetExpr:
+		p.prefix(ex.Object)
+		if key, ok := ex.Key.(*qsa.StringExpr); ok && isName(key.Value) {
+			p.write("." + key.Value)
+		} else {
+			p.write("[")
+			p.expr(ex.Key, 0)
+			p.write("]")
+		}
+	case *qsa.OAListExpr:
+		p.list(ex)
+	case *qsa.FuncCallExpr:
+		if ex.AdjustRet {
+			p.write("(")
+		}
+		if ex.Func != nil {
+			p.prefix(ex.Func)
+		} else {
+			p.prefix(ex.Receiver)
+			p.write(":" + ex.Method)
+		}
+		p.write("(")
+		p.exprs(ex.Args)
+		for i, arg := range ex.Named {
+			if i > 0 || len(ex.Args) > 0 {
+				p.write(", ")
+			}
+			p.write(arg.Name + ": ")
+			if leadingCall(arg.Value) {
+				p.write("(")
+				p.expr(arg.Value, 0)
+				p.write(")")
+			} else {
+				p.expr(arg.Value, 0)
+			}
+		}
+		p.write(")")
+		if ex.AdjustRet {
+			p.write(")")
+		}
+	case *qsa.LogicalOpExpr:
+		p.binary(ex.Lhs, ex.Operator, ex.Rhs, precedence(ex), false)
+	case *qsa.RelationalOpExpr:
+		op := ex.Operator
+		if op == "~=" {
+			op = "!="
+		}
+		p.binary(ex.Lhs, op, ex.Rhs, precCompare, false)
+	case *qsa.StringConcatOpExpr:
+		p.binary(ex.Lhs, "..", ex.Rhs, precConcat, true)
+	case *qsa.ArithmeticOpExpr:
+		p.binary(ex.Lhs, ex.Operator, ex.Rhs, precedence(ex), ex.Operator == "^")
+	case *qsa.UnaryMinusOpExpr:
+		p.write("-")
+		if _, ok := ex.Expr.(*qsa.UnaryMinusOpExpr); ok {
+			p.write(" ")
+		}
+		p.expr(ex.Expr, precUnary)
+	case *qsa.UnaryNotOpExpr:
+		p.write("not ")
+		p.expr(ex.Expr, precUnary)
+	case *qsa.UnaryLenOpExpr:
+		p.write("#")
+		p.expr(ex.Expr, precUnary)
+	case *qsa.UnaryBNotOpExpr:
+		p.write("~")
+		p.expr(ex.Expr, precUnary)
+	case *qsa.ProcExpr:
+		p.write("proc")
+		p.proc(ex)
+	}
+}
+
+// str - returns a string literal as written, or quoted when it has no
+// source like the key of a name = value field
+func (p *printer) str(ex *qsa.StringExpr) string {
+	text := p.source(start(ex), qsa.Position{Line: ex.LastLine(), Column: ex.LastColumn()})
+	if len(text) > 1 && strings.ContainsAny(text[:1], "\"'`") {
+		return text
+	}
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(ex.Value); i++ {
+		switch c := ex.Value[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString("\\n")
+		case '\t':
+			buf.WriteString("\\t")
+		case '\r':
+			buf.WriteString("\\r")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// list - prints a list constructor, a field on each line when it is
+// written on more than one line
+func (p *printer) list(ex *qsa.OAListExpr) {
+	if len(ex.Fields) == 0 {
+		p.write("{}")
+		return
+	}
+	if ex.Line() == ex.LastLine() || p.inline > 0 {
+		p.write("{")
+		for i, field := range ex.Fields {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.field(field)
+		}
+		p.write("}")
+		return
+	}
+	p.write("{")
+	last := p.last
+	p.last = 0
+	p.indent++
+	for _, field := range ex.Fields {
+		pos := start(field.Value)
+		if field.Key != nil && field.Key.Line() > 0 {
+			pos = start(field.Key)
+		}
+		p.leading(pos)
+		p.item(pos.Line)
+		p.field(field)
+		p.write(",")
+		p.trailing(field.Value.LastLine(), endOfSource)
+		p.last = field.Value.LastLine()
+	}
+	p.leading(qsa.Position{Line: ex.LastLine(), Column: ex.LastColumn()})
+	p.indent--
+	p.nl()
+	p.write("}")
+	p.last = last
+}
+
+// field - prints a field of a list constructor
+func (p *printer) field(field *qsa.Field) {
+	if field.Key != nil {
+		if key, ok := field.Key.(*qsa.StringExpr); ok && isName(key.Value) {
+			p.write(key.Value)
+		} else {
+			p.write("[")
+			p.expr(field.Key, 0)
+			p.write("]")
+		}
+		p.write(" = ")
+	}
+	p.expr(field.Value, 0)
+}
@@ -0,0 +1,137 @@
+package qsfmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/x0ray/q/qs"
+	"github.com/x0ray/q/qs/qsp"
+)
+
+// corpus - a script with every statement form and comment style, written
+// out of the canonical form, it logs its results in the list out
+const corpus = `#!/usr/bin/env q
+// the corpus of every statement form
+out = {}
+proc log(...) for _,v in ipairs({...}) do out[#out+1]=tostring(v) end end
+/* a block
+   comment */
+dcl a,b=1,2 ; dcl s="x"
+global g = 3
+a+=1 s..="y"  // compound
+if a>b then log("gt") elseif a==b then log("eq") else log("lt") end
+while a<5 do a=a+1 if a==4 then continue end end
+repeat a=a-1 until a<=2
+for i=1,3,1 do log(i) end
+for k,v in pairs({x=1}) do log(k,v) end
+do dcl inner=a*(b+1)^2 log(inner, -inner, not inner, #s, ~1, 7\2, 5%3, 1<<2|1&3~2) end
+switch s case "xy","z" then log("case") case 1 then log(1) else log("else") end
+proc f(x,y=10) return x+y end
+log(f(1), f(1,y: 2), f(y: 3, x: 4))
+proc tryit()
+  try error("boom",0) catch e then log(e) finally log("finally") end
+end
+tryit()
+proc deferred() defer log("deferred") log("body") end
+deferred()
+dcl {x=px,...rest}={x=1,y=2} dcl [first,...others]={1,2,3}
+log(px, rest.y, first, #others)
+class Base proc init(n) self.n=n end proc get() return self.n end end
+class Derived extends Base proc init(n) super(n*2) end proc get() return super.get()+1 end end
+log(Derived(5):get())
+log(f"v={a} {s:%q}")
+dcl t={1,2,["k"]=3,k2={4}}  /* trailing block */
+log(t.k, t["k2"][1], (proc(n) return n*n end)(3))
+return
+`
+
+// run - runs the q source src and returns the results it logged in out
+func run(t *testing.T, name string, src []byte) string {
+	t.Helper()
+	L := qs.NewState()
+	defer L.Close()
+	if err := L.DoString(string(src)); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	out, ok := L.GetGlobal("out").(*qs.LOAList)
+	if !ok {
+		t.Fatalf("%s: no out list", name)
+	}
+	var logged []string
+	for i := 1; i <= out.Len(); i++ {
+		logged = append(logged, out.RawGetInt(i).String())
+	}
+	return strings.Join(logged, " ")
+}
+
+// comments - returns the texts of the comments of the q source src
+func comments(t *testing.T, src []byte) []string {
+	t.Helper()
+	_, cmts, err := qsp.ParseComments(bytes.NewReader(src), "corpus.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, c := range cmts {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+// TestFormatIdempotent - formatting the canonical form does not change it
+func TestFormatIdempotent(t *testing.T) {
+	once, err := Format([]byte(corpus), "corpus.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := Format(once, "corpus.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(once, twice) {
+		t.Errorf("formatted twice:\n%s\nonce:\n%s", twice, once)
+	}
+	if bytes.Equal(once, []byte(corpus)) {
+		t.Errorf("the corpus is already in the canonical form")
+	}
+}
+
+// TestFormatComments - the comments of every style are kept, in order
+func TestFormatComments(t *testing.T) {
+	out, err := Format([]byte(corpus), "corpus.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, got := comments(t, []byte(corpus)), comments(t, out)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("comments %q, want %q", got, want)
+	}
+	for _, style := range []string{"#!", "//", "/*"} {
+		if !strings.Contains(string(out), style) {
+			t.Errorf("no %s comment in:\n%s", style, out)
+		}
+	}
+}
+
+// TestFormatBehavior - the formatted program does what the source does
+func TestFormatBehavior(t *testing.T) {
+	out, err := Format([]byte(corpus), "corpus.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := run(t, "source", []byte(corpus))
+	if got := run(t, "formatted", out); got != want {
+		t.Errorf("formatted program logged %q, want %q", got, want)
+	}
+	if !strings.Contains(want, "boom finally") || !strings.Contains(want, "body deferred") {
+		t.Errorf("the corpus did not run every statement: %q", want)
+	}
+}
+
+// TestFormatError - a source that does not parse is an error
+func TestFormatError(t *testing.T) {
+	if _, err := Format([]byte("dcl x = = 1\n"), "bad.q"); err == nil {
+		t.Errorf("no error for a bad source")
+	}
+}
@@ -12,6 +12,8 @@ const (
 	VarArgNeedsArg uint8 = 4
 )
 
+// DbgLocalInfo - a local variable of a proc, in scope from the instruction
+// at StartPc to the one at EndPc, both included
 type DbgLocalInfo struct {
 	Name    string
 	StartPc int
@@ -23,6 +25,15 @@ type DbgCall struct {
 	Pc   int
 }
 
+// DbgSpan - the columns of the source an instruction was compiled from,
+// Column is on the line of the instruction and LastColumn on LastLine.
+// Columns are 0 when they are not known.
+type DbgSpan struct {
+	Column     int
+	LastLine   int
+	LastColumn int
+}
+
 type ProcProto struct {
 	SourceName       string
 	LineDefined      int
@@ -31,16 +42,87 @@ type ProcProto struct {
 	NumParameters    uint8
 	IsVarArg         uint8
 	NumUsedRegisters uint8
+	Strict           bool     // compiled in strict mode
+	StrictGlobals    []string // undeclared globals read in strict mode, an error when they have no value
 	Code             []uint32
 	Constants        []LValue
 	ProcPrototypes   []*ProcProto
+	SwitchTables     []*SwitchTable
+	CallNames        []*CallNames
+	RestFields       []*RestFields
 
 	DbgSourcePositions []int
+	DbgSourceSpans     []DbgSpan // the columns of DbgSourcePositions
 	DbgLocals          []*DbgLocalInfo
 	DbgCalls           []DbgCall
 	DbgUpvalues        []string
 
 	stringConstants []string
+	source          []byte // the source compiled, for error messages
+}
+
+// SwitchTable - the constant case values of a switch statement compiled
+// to an OP_SWITCH, and the pc offsets from it of the statements to run
+type SwitchTable struct {
+	Values  []LValue
+	Jumps   []int
+	Default int // the offset of the else statements, or the end
+
+	index map[LValue]int // the jumps by switchKey of the values
+}
+
+// switchKey - returns the key of a case value, a num with an exact
+// integer value has the key of the integer
+func switchKey(v LValue) LValue {
+	if n, ok := v.(LNumber); ok {
+		if i, ok := lvToInteger(n); ok {
+			return i
+		}
+	}
+	return v
+}
+
+// makeIndex - makes the index of the values, the first of equal values
+// is used
+func (st *SwitchTable) makeIndex() {
+	st.index = make(map[LValue]int, len(st.Values))
+	for i := len(st.Values) - 1; i >= 0; i-- {
+		st.index[switchKey(st.Values[i])] = st.Jumps[i]
+	}
+}
+
+// jump - returns the pc offset of the statements for the subject v
+func (st *SwitchTable) jump(v LValue) int {
+	if offset, ok := st.index[switchKey(v)]; ok {
+		return offset
+	}
+	return st.Default
+}
+
+// CallNames - the named arguments of a call compiled to an OP_NAMEDARGS,
+// they follow the Args given by position, self included
+type CallNames struct {
+	Args  int
+	Names []string
+}
+
+// RestFields - the fields a ...rest name of a pattern compiled to an
+// OP_REST does not get, the first Skip elements of a positional pattern,
+// or the Keys of a keyed pattern when Skip is -1
+type RestFields struct {
+	Skip int
+	Keys []string
+}
+
+// paramIndex - returns the index of the parameter name, self included,
+// or -1 when the proc has no such parameter
+func (fp *ProcProto) paramIndex(name string) int {
+	for i := 0; i < int(fp.NumParameters) && i < len(fp.DbgLocals); i++ {
+		if fp.DbgLocals[i].Name == name {
+			return i
+		}
+	}
+	return -1
 }
 
 type Upvalue struct {
@@ -94,6 +176,7 @@ func newProcProto(name string) *ProcProto {
 		ProcPrototypes:   make([]*ProcProto, 0, 16),
 
 		DbgSourcePositions: make([]int, 0, 128),
+		DbgSourceSpans:     make([]DbgSpan, 0, 128),
 		DbgLocals:          make([]*DbgLocalInfo, 0, 16),
 		DbgCalls:           make([]DbgCall, 0, 128),
 		DbgUpvalues:        make([]string, 0, 16),
@@ -163,13 +246,16 @@ func newLProcG(gfunc LGProc, env *LOAList, nupvalue int) *LProc {
 	}
 }
 
+// LocalName - returns the name of local regno, from 1, in scope at the
+// instruction at pc, the 0-based index of the instruction running or
+// about to run, that is the Pc of its frame less 1
 func (fn *LProc) LocalName(regno, pc int) (string, bool) {
 	if fn.IsG {
 		return "", false
 	}
 	p := fn.Proto
-	for i := 0; i < len(p.DbgLocals) && p.DbgLocals[i].StartPc < pc; i++ {
-		if pc < p.DbgLocals[i].EndPc {
+	for i := 0; i < len(p.DbgLocals) && p.DbgLocals[i].StartPc <= pc; i++ {
+		if pc <= p.DbgLocals[i].EndPc {
 			regno--
 			if regno == 0 {
 				return p.DbgLocals[i].Name, true
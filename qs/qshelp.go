@@ -34,19 +34,34 @@ const HelpText = `Usage: ` + PGM + `
    [ -exec ]    <script-segment> String of Q language statements.
    [ -lib ]     <q-lib-file>     Q library file name to access.
    [ -profile ] <profile-file>   File name to use for profile data.
+   [ -cover ]   <lcov-file>      File name for line coverage data of the Q program.
    [ -log ]     <log-file>       File name to use for logging.
+   [ -o ]       <qc-file>        Output file name used by the compile command.
+   [ -func ]    <name>           Name of the proc to list, used by the disasm command.
+   [ -json ]                     Write JSON output, used by the disasm and lint commands.
+   [ -port ]    <nnn>            TCP port the dap command listens on.
+   [ -w ]                        Rewrite the files in place, used by the fmt command.
+   [ -d ]                        Show the changes as a diff, used by the fmt command.
    [ -name ]    <name-string>    Name tag used in logging, and _NAME script variable.
    [ -limit ]   <nnn>            Sets a memory size limit for Q program.
    [ -inter ]                    Use interactive mode.
    [ -help | -h ]                Display this help then exit.
    [ -quiet ]                    Do not show output.
+   [ -strict ]                   Run Q scripts in strict mode, undeclared globals are errors.
    [ -version | -v ]             Show version information then exit.
    [ -verbose ]                  Show more information for functions with output.
    [ -debug ]                    Show debugging info	
 
 Commands:
+   compile:  Compile Q scripts to precompiled .qc files: compile [-o out.qc] file.q ...
+   dap:      Serve the Debug Adapter Protocol on stdio or a TCP port: dap [-port nnn]
+   debug:    Run a Q script under the interactive debugger: debug file.q [script-args]
+   disasm:   List the annotated instruction code of a Q script: disasm file.q [-func name] [-json]
+   fmt:      Print Q scripts in the canonical format: fmt [-w | -d] [file.q ...]
    help:     Display help information and quit.
    int:      Run ` + PGM + ` in interactive mode.
+   lint:     Report likely mistakes in Q scripts: lint file.q ... [-json]
+   lsp:      Serve the Language Server Protocol on stdio for editors.
    run:      Run the ` + PGM + ` script named on the -pgm option.
    version:  Display program version information and quit.
 	
@@ -68,7 +83,7 @@ Language syntax:
 
 const reservedWords = `
   Reserved words: 
-    and break dcl do else elseif end false for if in nil 
+    and break continue dcl do else elseif end false for if in nil 
 	not or func repeat return then true until while
 	
  `
@@ -97,11 +112,12 @@ const operators = `
   Operators: 
     Symbol  Function          Type     Association  Precedence
     ----------------------------------------------------------
-    +       addition          binary   left         5
-    -       subtraction       binary   left         5
-    *       multiplication    binary   left         6
-    /       division          binary   left         6
-    %       modulus           binary   left         6
+    +       addition          binary   left         9
+    -       subtraction       binary   left         9
+    *       multiplication    binary   left         10
+    /       division          binary   left         10
+    \       integer division  binary   left         10
+    %       modulus           binary   left         10
     and     logical and       binary   left         2
     or      logical or        binary   left         1
     <       less              binary   left         3 
@@ -110,13 +126,26 @@ const operators = `
     >=      greater or equal  binary   left         3 
     !=      not equal         binary   left         3  
     ==      equal             binary   left         3
-    ||      concatenate       binary   right        4
-    #       length            unary    left         7
-    not     logical not       unary    right        7   
-    -       unary negative    unary    right        7 
-    ^       exponent          binary   right        8
+    |       bitwise or        binary   left         4
+    ~       bitwise xor       binary   left         5
+    &       bitwise and       binary   left         6
+    <<      shift left        binary   left         7
+    >>      shift right       binary   left         7
+    ||      concatenate       binary   right        8
+    #       length            unary    left         11
+    not     logical not       unary    right        11
+    -       unary negative    unary    right        11
+    ~       bitwise not       unary    right        11
+    ^       exponent          binary   right        12
 
     A higher precedence is interpreted ahead of a lower precedence.
+
+    Numbers are either integers (64 bit, written without a fraction or 
+    exponent) or floats. Integer +, -, * wrap on overflow, / and ^ always 
+    give a float, \ and % round toward minus infinity. The bitwise 
+    operators need integers, or floats with an exact integer value; >> is 
+    a logical shift. Lists use the metamethods __idiv, __band, __bor, 
+    __bxor, __shl, __shr and __bnot for these operators.
 	
  `
 
@@ -163,7 +192,12 @@ const controlStructures = `
     - for name = <start-expression> , <end-expression> [, <inc-expression>] do <block> end 
 
     - break
+    - continue
     - return [values]
+
+    break and continue must be the last statement of their block. continue 
+    skips the rest of the loop body, in a repeat loop the until condition is 
+    still evaluated but may not use a dcl declared after the continue.
 	
  `
 
@@ -186,6 +220,15 @@ Language built in functions
 	collectgarbage( [a:str("stop"|"restart"|"collect"|"step"|"count"]) )
 		Runs specified mode of garbage collection to free used resources.
 	
+	z = dbgdisasm(a:proc[,b:str("text"|"json")])
+		Returns the annotated instruction listing of proc 'a' and its nested
+		procs in 'z', as text with source lines interleaved or as JSON.
+	
+	dbgsethook([a:proc[,b:str[,c:num]]])
+		Calls proc 'a' as a(event, line) for the events in 'b': "c" calls,
+		"r" returns, "l" new lines, and "count" after every 'c' instructions.
+		Without arguments the hook is removed.
+	
 	error(a:str)               
 		Issues error message 'a'.
 	
@@ -195,19 +238,34 @@ Language built in functions
 	z = getmetalist(a:list)
 		Returns meta info into 'z' for list 'a'.  
 	
+	t = go(a:proc,b:*,c:*,...)
+		Runs proc 'a' with args 'b', 'c', etc concurrently on its own state, 
+		returning task 't'. Only nums, strs, bools, chans and lists without a 
+		metalist can be passed as args or upvalues, or returned by 'a'. 
+		Globals are not shared. 
+		ok,r = t:wait() blocks until 'a' ends, 'ok' is true followed by the 
+		results of 'a', or false followed by the error. t:done() returns true 
+		if 'a' has ended.
+	
 	help() 
 		Displays this help text.
 		
-	z = load(a:func [,b:str])
+	z:bool = instanceof(a:*, b:list)
+		Returns true if 'a' is an object of class 'b', or of a class that 
+		extends 'b'.
+		
+	z = load(a:func [,b:str [,c:str]])
 		Loads func 'z', using func"nil", "bool", "num", "str", "func", "data", 
 		"thread", "list", "chan" 'a' to load multiple segment strings containing 
-		an Q script.
+		an Q script. Mode 'c' is "t" for source, the default, "b" for a 
+		precompiled segment or "bt" for either.
 		
-	z = loadfile(a:str)
-		Loads func 'z' from a file named 'a' which contains an Q script.
+	z = loadfile(a:str [,b:str])
+		Loads func 'z' from a file named 'a' which contains an Q script, or a 
+		precompiled segment unless mode 'b' is "t".
 	
-	z = loadstring(a:str)
-		Loads func 'z' from a string 'a'.
+	z = loadstring(a:str [,b:str [,c:str]])
+		Loads func 'z' from a string 'a', with the mode 'c' of load.
 	
 	log(a:str)
 		Writes message string 'a' on the log as an info message.
@@ -920,3 +978,78 @@ func PrtXHelpFlag(f *flag.Flag) {
 		}
 	}
 }
+
+// HelpDoc - the help of a built in proc, from the built in functions help
+type HelpDoc struct {
+	Name      string // as written in the help, like "put" or "i.open"
+	Signature string
+	Text      string
+}
+
+var helpDocs map[string]*HelpDoc
+
+// BuiltinHelp - returns the help of the built in proc name, like "put" or
+// "i.open". A name with a library prefix also matches the help written
+// without it, and the other way round.
+func BuiltinHelp(name string) (*HelpDoc, bool) {
+	if helpDocs == nil {
+		helpDocs = parseHelpDocs(builtInFuncs)
+	}
+	if doc, ok := helpDocs[name]; ok {
+		return doc, true
+	}
+	if i := strings.LastIndexAny(name, ".:"); i >= 0 {
+		doc, ok := helpDocs[name[i+1:]]
+		return doc, ok
+	}
+	return nil, false
+}
+
+// parseHelpDocs - parses the proc entries of the help text, a signature on
+// a line indented by one tab followed by lines indented by two tabs
+func parseHelpDocs(help string) map[string]*HelpDoc {
+	docs := map[string]*HelpDoc{}
+	var doc *HelpDoc
+	for _, line := range strings.Split(help, "\n") {
+		if strings.HasPrefix(line, "\t\t") && doc != nil {
+			if text := strings.TrimSpace(line); len(text) > 0 {
+				if len(doc.Text) > 0 {
+					doc.Text += "\n"
+				}
+				doc.Text += text
+			}
+			continue
+		}
+		doc = nil
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+		sig := strings.TrimSpace(line)
+		open := strings.Index(sig, "(")
+		if open < 0 || strings.HasPrefix(sig[open+1:], "\"") {
+			continue // not a proc, or an example call
+		}
+		// the name is the word before the '(', with its library prefix
+		start := open
+		for start > 0 && (isHelpNameChar(sig[start-1]) || sig[start-1] == '.' || sig[start-1] == ':') {
+			start--
+		}
+		name := strings.Trim(sig[start:open], ".:")
+		if len(name) == 0 {
+			continue
+		}
+		doc = &HelpDoc{Name: name, Signature: sig}
+		docs[name] = doc
+		if i := strings.LastIndexAny(name, ".:"); i >= 0 {
+			if _, ok := docs[name[i+1:]]; !ok {
+				docs[name[i+1:]] = doc
+			}
+		}
+	}
+	return docs
+}
+
+// isHelpNameChar - reports if c can be part of a proc name
+func isHelpNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
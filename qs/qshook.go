@@ -0,0 +1,116 @@
+// Package qs - q scripting language
+package qs
+
+// HookEvent - the event that caused a hook to be called
+type HookEvent int
+
+const (
+	HookCall   HookEvent = iota // a proc was called, before its first instruction
+	HookReturn                  // a proc is about to return
+	HookLine                    // a new line is about to run, or a loop jumped back
+	HookCount                   // the instruction count of the hook was reached
+)
+
+// String - returns the name of the event as used by dbgsethook
+func (ev HookEvent) String() string {
+	switch ev {
+	case HookCall:
+		return "call"
+	case HookReturn:
+		return "return"
+	case HookLine:
+		return "line"
+	case HookCount:
+		return "count"
+	}
+	return "unknown"
+}
+
+// HookMask - selects the events a hook is called for
+type HookMask int
+
+const (
+	MaskCall   HookMask = 1 << iota // call events
+	MaskReturn                      // return events
+	MaskLine                        // line events
+	MaskCount                       // every count instructions
+)
+
+// Hook - proc called for hook events. line is the line about to run for
+// HookLine events and -1 for the others. GetStack(0) returns the proc that
+// caused the event. Errors raised by the hook are raised in the script,
+// which is how a hook stops a script. Hooks are not called while a hook
+// is running.
+type Hook func(L *LState, event HookEvent, line int)
+
+// SetHook - sets fn to be called for the events in mask, MaskCount calls it
+// after every count instructions. A nil fn or empty mask removes the hook.
+// Coroutines created later inherit the hook.
+func (ls *LState) SetHook(mask HookMask, count int, fn Hook) {
+	if count <= 0 {
+		mask &^= MaskCount
+		count = 0
+	}
+	if fn == nil || mask == 0 {
+		mask, count, fn = 0, 0, nil
+	}
+	ls.hook = fn
+	ls.hookMask = mask
+	ls.hookCount = count
+	ls.hookLeft = count
+	ls.hookFrame = nil
+	ls.updateMainLoop()
+}
+
+// GetHook - returns the mask, count and proc set by SetHook
+func (ls *LState) GetHook() (HookMask, int, Hook) {
+	return ls.hookMask, ls.hookCount, ls.hook
+}
+
+// callHook - calls the hook for event, keeping the registry top of the
+// interrupted instruction
+func (ls *LState) callHook(event HookEvent, line int) {
+	if ls.inHook || ls.hook == nil {
+		return
+	}
+	ls.inHook = true
+	defer func() { ls.inHook = false }()
+	top := ls.reg.Top()
+	ls.hook(ls, event, line)
+	ls.reg.SetTop(top)
+}
+
+// instructionHook - calls the count and line hooks before the instruction
+// at cf.Pc-1 runs. Like Lua, a line event is raised when a proc starts, when
+// the line changes and when the code jumps back, also to the same line.
+func (ls *LState) instructionHook(cf *callFrame) {
+	if ls.inHook {
+		return
+	}
+	if ls.hookMask&MaskCount != 0 {
+		ls.hookLeft--
+		if ls.hookLeft <= 0 {
+			ls.hookLeft = ls.hookCount
+			ls.callHook(HookCount, -1)
+		}
+	}
+	if ls.hookMask&MaskLine != 0 {
+		pc := cf.Pc - 1
+		positions := cf.Fn.Proto.DbgSourcePositions
+		line := positions[pc]
+		var changed bool
+		switch {
+		case pc == 0:
+			changed = true
+		case cf != ls.hookFrame:
+			// returned to a caller, only report when the call ended its line
+			changed = line != positions[pc-1]
+		default:
+			changed = pc <= ls.hookPc || line != ls.hookLine
+		}
+		ls.hookFrame, ls.hookPc, ls.hookLine = cf, pc, line
+		if changed {
+			ls.callHook(HookLine, line)
+		}
+	}
+}
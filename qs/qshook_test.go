@@ -0,0 +1,122 @@
+package qs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHookEvents - dbgsethook reports calls, returns and lines in the order
+// they happen, a call and return of a Go proc included
+func TestHookEvents(t *testing.T) {
+	checkScript(t, "crl", `dcl ev = {}
+proc sq(n)
+  return n * n
+end
+dbgsethook(proc(e, line) ev[#ev + 1] = e .. (line and ":" .. line or "") end, "crl")
+dcl x = sq(3)
+dbgsethook()
+dcl got = concat(ev, " ")
+assert(got == "return line:6 call line:3 return line:7 call", got)`, "")
+	checkScript(t, "loop lines", `dcl lines = {}
+dbgsethook(proc(e, line) lines[#lines + 1] = line end, "l")
+for i = 1, 2 do
+  dcl y = i
+end
+dbgsethook()
+dcl got = concat(lines, " ")
+assert(got == "3 4 3 4 3 6", got)`, "")
+	checkScript(t, "bad event", `dbgsethook(proc() end, "x")`, "invalid hook event 'x'")
+}
+
+// hookCount - returns the number of count events of a script run with a
+// count hook every count instructions
+func hookCount(t *testing.T, count int) int {
+	L := NewState()
+	defer L.Close()
+	n := 0
+	L.SetHook(MaskCount, count, func(L *LState, event HookEvent, line int) {
+		if event != HookCount || line != -1 {
+			t.Errorf("count hook called for %v at %d", event, line)
+		}
+		n++
+	})
+	if err := L.DoString(`dcl s = 0
+for i = 1, 1000 do s = s + i end`); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestHookCount - a count hook is called once every count instructions
+func TestHookCount(t *testing.T) {
+	every := hookCount(t, 1)
+	if every < 2000 {
+		t.Fatalf("%d instructions counted for a loop of 1000", every)
+	}
+	for _, count := range []int{2, 7, 100} {
+		if got := hookCount(t, count); got != every/count {
+			t.Errorf("count %d: %d events, want %d", count, got, every/count)
+		}
+	}
+}
+
+// TestHookStop - an error raised by a Go hook stops the script
+func TestHookStop(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	lines := 0
+	L.SetHook(MaskLine, 0, func(L *LState, event HookEvent, line int) {
+		if lines++; lines > 100 {
+			L.RaiseError("stopped at line %d", line)
+		}
+	})
+	err := L.DoString(`dcl n = 0
+while true do
+  n = n + 1
+end`)
+	if err == nil || !strings.Contains(err.Error(), "stopped at line") {
+		t.Errorf("error %v, want stopped at line", err)
+	}
+	if mask, _, fn := L.GetHook(); mask != MaskLine || fn == nil {
+		t.Errorf("hook removed by the error")
+	}
+}
+
+// TestHookContext - a script run with both a hook and a context calls the
+// hook and stops when the context is done, also once the hook is removed
+func TestHookContext(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+	calls := 0
+	L.SetHook(MaskCount, 10, func(L *LState, event HookEvent, line int) {
+		if calls++; calls == 50 {
+			cancel()
+		}
+	})
+	err := L.DoString(`while true do end`)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("error %v, want %v", err, context.Canceled)
+	}
+	if calls < 50 {
+		t.Errorf("hook called %d times", calls)
+	}
+
+	L.SetHook(0, 0, nil)
+	tctx, tcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer tcancel()
+	L.SetContext(tctx)
+	err = L.DoString(`dcl lines = 0
+dbgsethook(proc() lines = lines + 1 end, "l")
+for i = 1, 10 do end
+dbgsethook()
+assert(lines > 10)
+while true do end`)
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -46,7 +46,14 @@ const (
 	OP_DIV        // A B C   R(A) := RK(B) / RK(C)
 	OP_MOD        // A B C   R(A) := RK(B) % RK(C)
 	OP_POW        // A B C   R(A) := RK(B) ^ RK(C)
+	OP_IDIV       // A B C   R(A) := RK(B) \ RK(C)
+	OP_BAND       // A B C   R(A) := RK(B) & RK(C)
+	OP_BOR        // A B C   R(A) := RK(B) | RK(C)
+	OP_BXOR       // A B C   R(A) := RK(B) ~ RK(C)
+	OP_SHL        // A B C   R(A) := RK(B) << RK(C)
+	OP_SHR        // A B C   R(A) := RK(B) >> RK(C)
 	OP_UNM        // A B     R(A) := -R(B)
+	OP_BNOT       // A B     R(A) := ~R(B)
 	OP_NOT        // A B     R(A) := not R(B)
 	OP_LEN        // A B     R(A) := length of R(B)
 	OP_LOADNIL    // A B     R(A) := ... := R(B) := nil
@@ -80,8 +87,21 @@ const (
 	OP_CALL       // A B C   R(A) ... R(A+C-2) := R(A)(R(A+1) ... R(A+B-1))
 	OP_TAILCALL   // A B C   return R(A)(R(A+1) ... R(A+B-1))
 	OP_SETLIST    // A B C   R(A)[(C-1)*FPF+i] := R(A+i) 1 <= i <= B
+	OP_SWITCH     // A Bx    pc+=SwitchTables[Bx] jump of R(A)
+	OP_TOSTRING   // A B C   R(A) := tostring(RK(B)), or format(RK(C), RK(B)) when RK(C) != ""
+	OP_TRY        // A sBx   try, on error R(A) := error; pc+=sBx
+	OP_FINALLY    // A sBx   R(A) := nil; try, on error or return R(A) := pending; pc+=sBx
+	OP_ENDTRY     // A       end the innermost try
+	OP_LEAVE      // A sBx   end the innermost try, R(A) := pending jump to pc; pc+=sBx
+	OP_ENDFINALLY // A       do the pending error, return or jump of R(A)
+	OP_DEFER      // A B C   deferred R(C) += R(A)(R(A+1) ... R(A+B-1))
+	OP_DEFERCLOSE // A B     deferred R(A) += R(B).__close(R(B))
+	OP_RUNDEFER   // A       run deferred R(A+1), last first
+	OP_NAMEDARGS  // A Bx    R(A+1) ... := the arguments of R(A) in the order of its parameters, CallNames[Bx]
+	OP_REST       // A B C   R(A) := the fields of R(B) not in RestFields[C]
+	OP_CLASS      // A B C   make R(A) a class, that extends R(B) if C
 )
-const opCodeMax = OP_SETLIST
+const opCodeMax = OP_CLASS
 
 type opArgMode int
 
@@ -112,46 +132,66 @@ type opProp struct {
 var opProps = []opProp{
 	opProp{"MOVE", false, true, opArgModeR, opArgModeN, opTypeABC},
 	opProp{"MOVEN", false, true, opArgModeR, opArgModeN, opTypeABC},
-	opProp{"LOADK", false, true, opArgModeK, opArgModeN, opTypeABx},
-	opProp{"LOADBOOL", false, true, opArgModeU, opArgModeU, opTypeABC},
-	opProp{"LOADNIL", false, true, opArgModeR, opArgModeN, opTypeABC},
-	opProp{"GETUPVAL", false, true, opArgModeU, opArgModeN, opTypeABC},
-	opProp{"GETGLOBAL", false, true, opArgModeK, opArgModeN, opTypeABx},
-	opProp{"GETTABLE", false, true, opArgModeR, opArgModeK, opTypeABC},
-	opProp{"GETTABLEKS", false, true, opArgModeR, opArgModeK, opTypeABC},
-	opProp{"SETGLOBAL", false, false, opArgModeK, opArgModeN, opTypeABx},
-	opProp{"SETUPVAL", false, false, opArgModeU, opArgModeN, opTypeABC},
-	opProp{"SETTABLE", false, false, opArgModeK, opArgModeK, opTypeABC},
-	opProp{"SETTABLEKS", false, false, opArgModeK, opArgModeK, opTypeABC},
-	opProp{"NEWTABLE", false, true, opArgModeU, opArgModeU, opTypeABC},
-	opProp{"SELF", false, true, opArgModeR, opArgModeK, opTypeABC},
 	opProp{"ADD", false, true, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"SUB", false, true, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"MUL", false, true, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"DIV", false, true, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"MOD", false, true, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"POW", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"IDIV", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"BAND", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"BOR", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"BXOR", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"SHL", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"SHR", false, true, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"UNM", false, true, opArgModeR, opArgModeN, opTypeABC},
+	opProp{"BNOT", false, true, opArgModeR, opArgModeN, opTypeABC},
 	opProp{"NOT", false, true, opArgModeR, opArgModeN, opTypeABC},
 	opProp{"LEN", false, true, opArgModeR, opArgModeN, opTypeABC},
-	opProp{"CONCAT", false, true, opArgModeR, opArgModeR, opTypeABC},
+	opProp{"LOADNIL", false, true, opArgModeR, opArgModeN, opTypeABC},
+	opProp{"GETUPVAL", false, true, opArgModeU, opArgModeN, opTypeABC},
+	opProp{"SETUPVAL", false, false, opArgModeU, opArgModeN, opTypeABC},
+	opProp{"RETURN", false, false, opArgModeU, opArgModeN, opTypeABC},
+	opProp{"VARARG", false, true, opArgModeU, opArgModeN, opTypeABC},
+	opProp{"CLOSE", false, false, opArgModeN, opArgModeN, opTypeABC},
+	opProp{"TEST", true, true, opArgModeR, opArgModeU, opTypeABC},
+	opProp{"TFORLOOP", true, false, opArgModeN, opArgModeU, opTypeABC},
 	opProp{"JMP", false, false, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"GETGLOBAL", false, true, opArgModeK, opArgModeN, opTypeABx},
+	opProp{"LOADK", false, true, opArgModeK, opArgModeN, opTypeABx},
+	opProp{"SETGLOBAL", false, false, opArgModeK, opArgModeN, opTypeABx},
+	opProp{"CLOSURE", false, true, opArgModeU, opArgModeN, opTypeABx},
+	opProp{"NOP", false, false, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"FORLOOP", false, true, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"FORPREP", false, true, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"LOADBOOL", false, true, opArgModeU, opArgModeU, opTypeABC},
+	opProp{"GETTABLE", false, true, opArgModeR, opArgModeK, opTypeABC},
+	opProp{"GETTABLEKS", false, true, opArgModeR, opArgModeK, opTypeABC},
+	opProp{"SETTABLE", false, false, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"SETTABLEKS", false, false, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"NEWTABLE", false, true, opArgModeU, opArgModeU, opTypeABC},
+	opProp{"SELF", false, true, opArgModeR, opArgModeK, opTypeABC},
+	opProp{"CONCAT", false, true, opArgModeR, opArgModeR, opTypeABC},
 	opProp{"EQ", true, false, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"LT", true, false, opArgModeK, opArgModeK, opTypeABC},
 	opProp{"LE", true, false, opArgModeK, opArgModeK, opTypeABC},
-	opProp{"TEST", true, true, opArgModeR, opArgModeU, opTypeABC},
 	opProp{"TESTSET", true, true, opArgModeR, opArgModeU, opTypeABC},
 	opProp{"CALL", false, true, opArgModeU, opArgModeU, opTypeABC},
 	opProp{"TAILCALL", false, true, opArgModeU, opArgModeU, opTypeABC},
-	opProp{"RETURN", false, false, opArgModeU, opArgModeN, opTypeABC},
-	opProp{"FORLOOP", false, true, opArgModeR, opArgModeN, opTypeASbx},
-	opProp{"FORPREP", false, true, opArgModeR, opArgModeN, opTypeASbx},
-	opProp{"TFORLOOP", true, false, opArgModeN, opArgModeU, opTypeABC},
 	opProp{"SETLIST", false, false, opArgModeU, opArgModeU, opTypeABC},
-	opProp{"CLOSE", false, false, opArgModeN, opArgModeN, opTypeABC},
-	opProp{"CLOSURE", false, true, opArgModeU, opArgModeN, opTypeABx},
-	opProp{"VARARG", false, true, opArgModeU, opArgModeN, opTypeABC},
-	opProp{"NOP", false, false, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"SWITCH", false, false, opArgModeU, opArgModeN, opTypeABx},
+	opProp{"TOSTRING", false, true, opArgModeK, opArgModeK, opTypeABC},
+	opProp{"TRY", false, false, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"FINALLY", false, true, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"ENDTRY", false, false, opArgModeN, opArgModeN, opTypeABC},
+	opProp{"LEAVE", false, true, opArgModeR, opArgModeN, opTypeASbx},
+	opProp{"ENDFINALLY", false, false, opArgModeN, opArgModeN, opTypeABC},
+	opProp{"DEFER", false, false, opArgModeU, opArgModeU, opTypeABC},
+	opProp{"DEFERCLOSE", false, true, opArgModeR, opArgModeN, opTypeABC},
+	opProp{"RUNDEFER", false, false, opArgModeN, opArgModeN, opTypeABC},
+	opProp{"NAMEDARGS", false, false, opArgModeU, opArgModeN, opTypeABx},
+	opProp{"REST", false, true, opArgModeR, opArgModeU, opTypeABC},
+	opProp{"CLASS", false, false, opArgModeR, opArgModeU, opTypeABC},
 }
 
 func opGetOpCode(inst uint32) int {
@@ -308,8 +348,22 @@ func opToString(inst uint32) string {
 		buf += fmt.Sprintf("; R(%v) := RK(%v) %% RK(%v)", arga, argb, argc)
 	case OP_POW:
 		buf += fmt.Sprintf("; R(%v) := RK(%v) ^ RK(%v)", arga, argb, argc)
+	case OP_IDIV:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) \\ RK(%v)", arga, argb, argc)
+	case OP_BAND:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) & RK(%v)", arga, argb, argc)
+	case OP_BOR:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) | RK(%v)", arga, argb, argc)
+	case OP_BXOR:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) ~ RK(%v)", arga, argb, argc)
+	case OP_SHL:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) << RK(%v)", arga, argb, argc)
+	case OP_SHR:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) >> RK(%v)", arga, argb, argc)
 	case OP_UNM:
 		buf += fmt.Sprintf("; R(%v) := -R(%v)", arga, argb)
+	case OP_BNOT:
+		buf += fmt.Sprintf("; R(%v) := ~R(%v)", arga, argb)
 	case OP_NOT:
 		buf += fmt.Sprintf("; R(%v) := not R(%v)", arga, argb)
 	case OP_LEN:
@@ -342,6 +396,32 @@ func opToString(inst uint32) string {
 		buf += fmt.Sprintf("; R(%v+3) ... R(%v+3+%v) := R(%v)(R(%v+1) R(%v+2)); if R(%v+3) ~= nil then { pc++; R(%v+2)=R(%v+3); }", arga, arga, argc, arga, arga, arga, arga, arga, arga)
 	case OP_SETLIST:
 		buf += fmt.Sprintf("; R(%v)[(%v-1)*FPF+i] := R(%v+i) 1 <= i <= %v", arga, argc, arga, argb)
+	case OP_SWITCH:
+		buf += fmt.Sprintf("; pc+=SwitchTables[%v] jump of R(%v)", argbx, arga)
+	case OP_TOSTRING:
+		buf += fmt.Sprintf("; R(%v) := tostring(RK(%v)) or format(RK(%v), RK(%v))", arga, argb, argc, argb)
+	case OP_TRY:
+		buf += fmt.Sprintf("; try, on error R(%v) := error; pc+=%v", arga, argsbx)
+	case OP_FINALLY:
+		buf += fmt.Sprintf("; R(%v) := nil; try, on error or return R(%v) := pending; pc+=%v", arga, arga, argsbx)
+	case OP_ENDTRY:
+		buf += "; end try"
+	case OP_LEAVE:
+		buf += fmt.Sprintf("; end try, R(%v) := pending jump to pc; pc+=%v", arga, argsbx)
+	case OP_ENDFINALLY:
+		buf += fmt.Sprintf("; do pending R(%v)", arga)
+	case OP_DEFER:
+		buf += fmt.Sprintf("; deferred R(%v) += R(%v)(R(%v+1) ... R(%v+%v-1))", argc, arga, arga, arga, argb)
+	case OP_DEFERCLOSE:
+		buf += fmt.Sprintf("; deferred R(%v) += R(%v).__close(R(%v))", arga, argb, argb)
+	case OP_RUNDEFER:
+		buf += fmt.Sprintf("; run deferred R(%v+1)", arga)
+	case OP_NAMEDARGS:
+		buf += fmt.Sprintf("; R(%v+1) ... := the arguments of R(%v) in the order of its parameters, CallNames[%v]", arga, arga, argbx)
+	case OP_REST:
+		buf += fmt.Sprintf("; R(%v) := the fields of R(%v) not in RestFields[%v]", arga, argb, argc)
+	case OP_CLASS:
+		buf += fmt.Sprintf("; make R(%v) a class, that extends R(%v) if %v", arga, argb, argc)
 	case OP_CLOSE:
 		buf += fmt.Sprintf("; close all variables in stack up to (>=) R(%v)", arga)
 	case OP_CLOSURE:
@@ -40,18 +40,24 @@ type oaLib struct {
 	libFunc LGProc
 }
 
-var oaLibs = []oaLib{
-	oaLib{LoadLibName, OpenPackage},
-	oaLib{BaseLibName, OpenBase},
-	// oaLib{TabLibName, OpenOAList},
-	oaLib{IoLibName, OpenIo},
-	// oaLib{OsLibName, OpenOs},
-	// oaLib{StringLibName, OpenString},
-	// oaLib{MathLibName, OpenMath},
-	// oaLib{DebugLibName, OpenDebug},
-	oaLib{ChannelLibName, OpenChannel},
-	oaLib{CoroutineLibName, OpenCoroutine},
-	// oaLib{EmiLibName, OpenEmi},
+var oaLibs []oaLib
+
+// init - builds the library list at run time, since go() in the base library
+// opens these libraries for its child states.
+func init() {
+	oaLibs = []oaLib{
+		oaLib{LoadLibName, OpenPackage},
+		oaLib{BaseLibName, OpenBase},
+		// oaLib{TabLibName, OpenOAList},
+		oaLib{IoLibName, OpenIo},
+		// oaLib{OsLibName, OpenOs},
+		// oaLib{StringLibName, OpenString},
+		// oaLib{MathLibName, OpenMath},
+		// oaLib{DebugLibName, OpenDebug},
+		oaLib{ChannelLibName, OpenChannel},
+		oaLib{CoroutineLibName, OpenCoroutine},
+		// oaLib{EmiLibName, OpenEmi},
+	}
 }
 
 // OpenLibs loads the built-in libraries. It is equivalent to running OpenLoad,
@@ -21,6 +21,9 @@ func (ls *LState) CheckInt(n int) int {
 	if intv, ok := v.(LNumber); ok {
 		return int(intv)
 	}
+	if intv, ok := v.(LInteger); ok {
+		return int(intv)
+	}
 	ls.TypeError(n, LTNumber)
 	return 0
 }
@@ -30,6 +33,9 @@ func (ls *LState) CheckInt64(n int) int64 {
 	if intv, ok := v.(LNumber); ok {
 		return int64(intv)
 	}
+	if intv, ok := v.(LInteger); ok {
+		return int64(intv)
+	}
 	ls.TypeError(n, LTNumber)
 	return 0
 }
@@ -39,6 +45,9 @@ func (ls *LState) CheckNumber(n int) LNumber {
 	if lv, ok := v.(LNumber); ok {
 		return lv
 	}
+	if lv, ok := v.(LInteger); ok {
+		return LNumber(lv)
+	}
 	ls.TypeError(n, LTNumber)
 	return 0
 }
@@ -137,6 +146,9 @@ func (ls *LState) OptInt(n int, d int) int {
 	if intv, ok := v.(LNumber); ok {
 		return int(intv)
 	}
+	if intv, ok := v.(LInteger); ok {
+		return int(intv)
+	}
 	ls.TypeError(n, LTNumber)
 	return 0
 }
@@ -149,6 +161,9 @@ func (ls *LState) OptInt64(n int, d int64) int64 {
 	if intv, ok := v.(LNumber); ok {
 		return int64(intv)
 	}
+	if intv, ok := v.(LInteger); ok {
+		return int64(intv)
+	}
 	ls.TypeError(n, LTNumber)
 	return 0
 }
@@ -161,6 +176,9 @@ func (ls *LState) OptNumber(n int, d LNumber) LNumber {
 	if lv, ok := v.(LNumber); ok {
 		return lv
 	}
+	if lv, ok := v.(LInteger); ok {
+		return LNumber(lv)
+	}
 	ls.TypeError(n, LTNumber)
 	return 0
 }
@@ -350,7 +368,7 @@ func (ls *LState) LoadFile(path string) (*LProc, error) {
 		}
 	}
 
-	return ls.Load(reader, path)
+	return ls.LoadMode(reader, path, "bt")
 }
 
 func (ls *LState) LoadString(source string) (*LProc, error) {
@@ -388,6 +406,16 @@ func (ls *LState) ToStringMeta(lv LValue) LValue {
 	}
 }
 
+// toString - ToStringMeta for tostring and f-strings, the string made from a
+// value that is not a string is charged to the memory budget
+func (ls *LState) toString(lv LValue) LValue {
+	sv := ls.ToStringMeta(lv)
+	if s, ok := sv.(LString); ok && lv.Type() != LTString {
+		ls.alloc.account(len(s))
+	}
+	return sv
+}
+
 // Set a module loader to the package.preload list.
 func (ls *LState) PreloadModule(name string, loader LGProc) {
 	preload := ls.GetField(ls.GetField(ls.Get(EnvironIndex), "package"), "preload")
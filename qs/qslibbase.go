@@ -52,7 +52,9 @@ var baseFuncs = map[string]LGProc{
 	"error":          baseError,
 	"getfenv":        baseGetFEnv,
 	"getmetalist":    baseGetMetalist,
+	"go":             channelGo,
 	"help":           baseHelp,
+	"instanceof":     baseInstanceOf,
 	"keys":           baseKeys,
 	"load":           baseLoad,
 	"loadfile":       baseLoadFile,
@@ -204,12 +206,14 @@ var baseFuncs = map[string]LGProc{
 	"uuidgen":    osUuidGen,
 	"uuidgenfmt": osUuidGenFmt,
 	// debug procs
+	"dbgdisasm":      debugDisasm,
 	"dbggetfenv":     debugGetFEnv,
 	"dbggetinfo":     debugGetInfo,
 	"dbggetlocal":    debugGetLocal,
 	"dbggetmetalist": debugGetMetalist,
 	"dbggetupvalue":  debugGetUpvalue,
 	"dbgsetfenv":     debugSetFEnv,
+	"dbgsethook":     debugSetHook,
 	"dbgsetlocal":    debugSetLocal,
 	"dbgsetmetalist": debugSetMetalist,
 	"dbgsetupvalue":  debugSetUpvalue,
@@ -277,8 +281,8 @@ func baseGetFEnv(L *LState) int {
 		return 1
 	}
 
-	if number, ok := value.(LNumber); ok {
-		level := int(float64(number))
+	if value.Type() == LTNumber {
+		level := int(LVAsNumber(value))
 		if level <= 0 {
 			L.Push(L.Env)
 		} else {
@@ -311,6 +315,11 @@ func baseHelp(L *LState) int {
 	return 0
 }
 
+func baseInstanceOf(L *LState) int {
+	L.Push(LBool(L.instanceOf(L.CheckAny(1), L.CheckOAList(2))))
+	return 1
+}
+
 func ipairsaux(L *LState) int {
 	lst := L.CheckOAList(1)
 	i := L.CheckInt(2)
@@ -346,8 +355,10 @@ func baseKeys(L *LState) int {
 	return 1
 }
 
-func loadaux(L *LState, reader io.Reader, segmentname string) int {
-	if fn, err := L.Load(reader, segmentname); err != nil {
+// loadaux - loads a segment from reader, allowing source or a precompiled
+// segment as mode does, see LState.LoadMode
+func loadaux(L *LState, reader io.Reader, segmentname, mode string) int {
+	if fn, err := L.LoadMode(reader, segmentname, mode); err != nil {
 		L.Push(LNil)
 		L.Push(LString(err.Error()))
 		return 2
@@ -360,6 +371,7 @@ func loadaux(L *LState, reader io.Reader, segmentname string) int {
 func baseLoad(L *LState) int {
 	fn := L.CheckProc(1)
 	segmentname := L.OptString(2, "?")
+	mode := L.OptString(3, "t")
 	top := L.GetTop()
 	buf := []string{}
 	for {
@@ -382,7 +394,7 @@ func baseLoad(L *LState) int {
 			return 2
 		}
 	}
-	return loadaux(L, strings.NewReader(strings.Join(buf, "")), segmentname)
+	return loadaux(L, strings.NewReader(strings.Join(buf, "")), segmentname, mode)
 }
 
 func baseLoadFile(L *LState) int {
@@ -402,11 +414,11 @@ func baseLoadFile(L *LState) int {
 		}
 		defer reader.(*os.File).Close()
 	}
-	return loadaux(L, reader, segmentname)
+	return loadaux(L, reader, segmentname, L.OptString(2, "bt"))
 }
 
 func baseLoadString(L *LState) int {
-	return loadaux(L, strings.NewReader(L.CheckString(1)), L.OptString(2, "<string>"))
+	return loadaux(L, strings.NewReader(L.CheckString(1)), L.OptString(2, "<string>"), L.OptString(3, "t"))
 }
 
 func baseLogInfo(L *LState) int {
@@ -545,9 +557,9 @@ func baseRawSet(L *LState) int {
 func baseSelect(L *LState) int {
 	L.CheckTypes(1, LTNumber, LTString)
 	switch lv := L.Get(1).(type) {
-	case LNumber:
-		idx := int(lv)
-		num := L.reg.Top() - L.indexToReg(int(lv)) - 1
+	case LNumber, LInteger:
+		idx := int(LVAsNumber(lv))
+		num := L.reg.Top() - L.indexToReg(idx) - 1
 		if idx < 0 {
 			num++
 		}
@@ -581,8 +593,8 @@ func baseSetFEnv(L *LState) int {
 		}
 	}
 
-	if number, ok := value.(LNumber); ok {
-		level := int(float64(number))
+	if value.Type() == LTNumber {
+		level := int(LVAsNumber(value))
 		if level <= 0 {
 			L.Env = env
 			return 0
@@ -631,7 +643,7 @@ func baseTerm(L *LState) int {
 func baseToNumber(L *LState) int {
 	base := L.OptInt(2, 10)
 	switch lv := L.CheckAny(1).(type) {
-	case LNumber:
+	case LNumber, LInteger:
 		L.Push(lv)
 	case LString:
 		str := strings.Trim(string(lv), " \n\t")
@@ -645,7 +657,7 @@ func baseToNumber(L *LState) int {
 			if v, err := strconv.ParseInt(str, base, LNumberBit); err != nil {
 				L.Push(LNil)
 			} else {
-				L.Push(LNumber(v))
+				L.Push(LInteger(v))
 			}
 		}
 	default:
@@ -656,7 +668,7 @@ func baseToNumber(L *LState) int {
 
 func baseToString(L *LState) int {
 	v1 := L.CheckAny(1)
-	L.Push(L.ToStringMeta(v1))
+	L.Push(L.toString(v1))
 	return 1
 }
 
@@ -2,9 +2,19 @@
 package qs
 
 import (
+	"fmt"
 	"reflect"
 )
 
+const lTaskClass = "TASK*"
+
+// lTask - a proc running on its own LState in a separate goroutine
+type lTask struct {
+	done    chan struct{}
+	results []LValue
+	err     error
+}
+
 func checkChannel(L *LState, idx int) reflect.Value {
 	ch := L.CheckChannel(idx)
 	return reflect.ValueOf(ch)
@@ -18,6 +28,26 @@ func checkGoroutineSafe(L *LState, idx int) LValue {
 	return v
 }
 
+// adopt - charges the growth of the lists in lv, and of the lists they hold,
+// to the memory budget of L, the state that gets them from another goroutine,
+// so a state never accounts memory from the goroutine of another
+func adopt(L *LState, lv LValue) {
+	adoptList(L, lv, map[*LOAList]bool{})
+}
+
+func adoptList(L *LState, lv LValue, seen map[*LOAList]bool) {
+	lst, ok := lv.(*LOAList)
+	if !ok || seen[lst] {
+		return
+	}
+	seen[lst] = true
+	lst.alloc = L.alloc
+	lst.ForEach(func(key, value LValue) {
+		adoptList(L, key, seen)
+		adoptList(L, value, seen)
+	})
+}
+
 func OpenChannel(L *LState) int {
 	var mod LValue
 	//_, ok := L.G.builtinMts[int(LTChannel)]
@@ -27,6 +57,9 @@ func OpenChannel(L *LState) int {
 	mt.RawSetString("__index", mt)
 	L.G.builtinMts[int(LTChannel)] = mt
 	//	}
+	tmt := L.NewTypeMetalist(lTaskClass)
+	tmt.RawSetString("__index", tmt)
+	L.SetFuncs(tmt, taskMethods)
 	L.Push(mod)
 	return 1
 }
@@ -80,7 +113,13 @@ func channelSelect(L *LState) int {
 		cases[i] = cas
 	}
 
+	if done := L.contextDone(); done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	}
 	pos, recv, rok := reflect.Select(cases)
+	if pos == top {
+		L.raiseContextError()
+	}
 	lv := LNil
 	if recv.Kind() != 0 {
 		lv, _ = recv.Interface().(LValue)
@@ -88,6 +127,7 @@ func channelSelect(L *LState) int {
 			lv = LNil
 		}
 	}
+	adopt(L, lv)
 	tbl := L.Get(pos + 1).(*LOAList)
 	last := tbl.RawGetInt(tbl.Len())
 	if last.Type() == LTProc {
@@ -126,10 +166,25 @@ var channelMethods = map[string]LGProc{
 
 func channelReceive(L *LState) int {
 	rch := checkChannel(L, 1)
-	v, ok := rch.Recv()
+	var v reflect.Value
+	var ok bool
+	if done := L.contextDone(); done != nil {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: rch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		}
+		var pos int
+		if pos, v, ok = reflect.Select(cases); pos == 1 {
+			L.raiseContextError()
+		}
+	} else {
+		v, ok = rch.Recv()
+	}
 	if ok {
+		lv := v.Interface().(LValue)
+		adopt(L, lv)
 		L.Push(LTrue)
-		L.Push(v.Interface().(LValue))
+		L.Push(lv)
 	} else {
 		L.Push(LFalse)
 		L.Push(LNil)
@@ -140,6 +195,16 @@ func channelReceive(L *LState) int {
 func channelSend(L *LState) int {
 	rch := checkChannel(L, 1)
 	v := checkGoroutineSafe(L, 2)
+	if done := L.contextDone(); done != nil {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: rch, Send: reflect.ValueOf(v)},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		}
+		if pos, _, _ := reflect.Select(cases); pos == 1 {
+			L.raiseContextError()
+		}
+		return 0
+	}
 	rch.Send(reflect.ValueOf(v))
 	return 0
 }
@@ -150,4 +215,127 @@ func channelClose(L *LState) int {
 	return 0
 }
 
-//
+// channelGo - runs a proc with its arguments on a new child LState in a
+// separate goroutine, returning a task that can be waited on. Only goroutine
+// safe values may be passed to the child, as arguments or upvalues, or be
+// returned by it.
+func channelGo(L *LState) int {
+	fn := L.CheckProc(1)
+	top := L.GetTop()
+	args := make([]LValue, 0, top-1)
+	for i := 2; i <= top; i++ {
+		v := L.Get(i)
+		if !isGoroutineSafe(v) {
+			L.ArgError(i, "can not pass a proc, userdata, thread or list that has a metalist")
+		}
+		args = append(args, v)
+	}
+
+	opts := L.Options
+	opts.SkipOpenLibs = false
+	child := NewState(opts)
+	if L.ctx != nil {
+		child.SetContext(L.ctx)
+	}
+	// each child gets a budget of its own, as large as the parent's, that
+	// the lists passed to it are charged to
+	child.SetMemoryLimit(L.MemoryLimit())
+	for _, arg := range args {
+		adopt(child, arg)
+	}
+	var cfn *LProc
+	if fn.IsG {
+		cfn = newLProcG(fn.GProc, child.Env, len(fn.Upvalues))
+	} else {
+		cfn = newLProcL(fn.Proto, child.Env, len(fn.Upvalues))
+	}
+	for i, uv := range fn.Upvalues {
+		v := uv.Value()
+		if !isGoroutineSafe(v) {
+			child.Close()
+			L.ArgError(1, "proc has an upvalue that can not be shared, a proc, userdata, thread or list that has a metalist")
+		}
+		adopt(child, v)
+		cfn.Upvalues[i] = &Upvalue{}
+		cfn.Upvalues[i].Close()
+		cfn.Upvalues[i].SetValue(v)
+	}
+
+	task := &lTask{done: make(chan struct{})}
+	go func() {
+		defer close(task.done)
+		defer child.Close()
+		child.Push(cfn)
+		for _, arg := range args {
+			child.Push(arg)
+		}
+		if err := child.PCall(len(args), MultRet, nil); err != nil {
+			task.err = err
+			return
+		}
+		nret := child.GetTop()
+		for i := 1; i <= nret; i++ {
+			v := child.Get(i)
+			if !isGoroutineSafe(v) {
+				task.err = fmt.Errorf("result %d can not be shared, a proc, userdata, thread or list that has a metalist", i)
+				task.results = nil
+				return
+			}
+			task.results = append(task.results, v)
+		}
+	}()
+
+	ud := L.NewUserData()
+	ud.Value = task
+	L.SetMetalist(ud, L.GetTypeMetalist(lTaskClass))
+	L.Push(ud)
+	return 1
+}
+
+func checkTask(L *LState) *lTask {
+	ud := L.CheckUserData(1)
+	if task, ok := ud.Value.(*lTask); ok {
+		return task
+	}
+	L.ArgError(1, "task expected")
+	return nil
+}
+
+var taskMethods = map[string]LGProc{
+	"wait": taskWait,
+	"done": taskDone,
+}
+
+// taskWait - blocks until the task ends, returning true and the procs
+// results, or false and the error message if it failed.
+func taskWait(L *LState) int {
+	task := checkTask(L)
+	select {
+	case <-task.done:
+	case <-L.contextDone():
+		L.raiseContextError()
+	}
+	if task.err != nil {
+		L.Push(LFalse)
+		L.Push(LString(task.err.Error()))
+		return 2
+	}
+	L.Push(LTrue)
+	for _, v := range task.results {
+		adopt(L, v)
+		L.Push(v)
+	}
+	return len(task.results) + 1
+}
+
+// taskDone - returns true if the task has ended without blocking
+func taskDone(L *LState) int {
+	task := checkTask(L)
+	select {
+	case <-task.done:
+		L.Push(LTrue)
+	default:
+		L.Push(LFalse)
+	}
+	return 1
+}
@@ -0,0 +1,56 @@
+package qs
+
+import (
+	"testing"
+)
+
+// TestTasks - procs run by go exchange values over channels, and only
+// values that can be shared are passed to them or returned by them
+func TestTasks(t *testing.T) {
+	checkScript(t, "results and channels", `dcl ch = c.make(10)
+proc work(n)
+  ch:send(n * n)
+  return n, {n, n + 1}
+end
+dcl t1, t2 = go(work, 2), go(work, 3)
+dcl ok1, n1, l1 = t1:wait()
+dcl ok2, n2 = t2:wait()
+assert(ok1 and n1 == 2 and l1[2] == 3)
+assert(ok2 and n2 == 3 and t2:done())
+dcl _, a = ch:receive()
+dcl _, b = ch:receive()
+assert(a + b == 13, a + b)`, "")
+	checkScript(t, "error", `dcl ok, err = go(proc() error("failed") end):wait()
+assert(not ok and find(err, "failed"), err)`, "")
+	checkScript(t, "unshared result", `dcl ok, err = go(proc() return put end):wait()
+assert(not ok and find(err, "result 1 can not be shared"), err)`, "")
+	checkScript(t, "unshared argument", `go(proc(f) end, put)`, "can not pass a proc")
+	checkScript(t, "unshared upvalue", `dcl mt = setmetalist({}, {})
+go(proc() return mt end)`, "proc has an upvalue that can not be shared")
+}
+
+// TestTaskMemory - a list passed to a task, or sent to it, grows on the
+// budget of the task, so the states account memory on their own goroutines.
+// Run it with go test -race -gcflags=all=-d=checkptr=0, the allocator does
+// pointer arithmetic that checkptr rejects
+func TestTaskMemory(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetMemoryLimit(1 << 26)
+	err := L.DoString(`dcl ch = c.make(1)
+proc fill(l)
+  for i = 1, 20000 do l[i] = i l["k" .. i] = i end
+  dcl _, sent = ch:receive()
+  for i = 1, 20000 do sent[i] = i end
+  return #l + #sent
+end
+dcl task = go(fill, {})
+ch:send({})
+dcl own = {}
+for i = 1, 20000 do own[i] = {i} own["k" .. i] = i end
+dcl ok, n = task:wait()
+assert(ok and n == 40000, n)`)
+	if err != nil {
+		t.Errorf("DoString: %v", err)
+	}
+}
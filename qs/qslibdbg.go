@@ -2,6 +2,7 @@
 package qs
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -23,8 +24,8 @@ func debugGetInfo(L *LState) int {
 	case *LProc:
 		dbg = &Debug{}
 		fn, err = L.GetInfo(">"+what, dbg, lv)
-	case LNumber:
-		dbg, ok = L.GetStack(int(lv))
+	case LNumber, LInteger:
+		dbg, ok = L.GetStack(int(LVAsNumber(lv)))
 		if !ok {
 			L.Push(LNil)
 			return 1
@@ -142,3 +143,70 @@ func debugTraceback(L *LState) int {
 	L.Push(LString(traceback))
 	return 1
 }
+
+// debugSetHook - dbgsethook([proc [, mask [, count]]]) calls proc with the
+// event name and, for line events, the line. mask has 'c' for calls, 'r'
+// for returns and 'l' for lines, a count above 0 calls proc after every
+// count instructions. Without a proc the hook is removed.
+func debugSetHook(L *LState) int {
+	if L.Get(1) == LNil {
+		L.SetHook(0, 0, nil)
+		return 0
+	}
+	fn := L.CheckProc(1)
+	events := L.OptString(2, "")
+	count := L.OptInt(3, 0)
+	var mask HookMask
+	for _, c := range events {
+		switch c {
+		case 'c':
+			mask |= MaskCall
+		case 'r':
+			mask |= MaskReturn
+		case 'l':
+			mask |= MaskLine
+		default:
+			L.ArgError(2, fmt.Sprintf("invalid hook event '%c'", c))
+		}
+	}
+	if count > 0 {
+		mask |= MaskCount
+	}
+	L.SetHook(mask, count, func(L *LState, event HookEvent, line int) {
+		L.Push(fn)
+		L.Push(LString(event.String()))
+		if event == HookLine {
+			L.Push(LNumber(line))
+		} else {
+			L.Push(LNil)
+		}
+		L.Call(2, 0)
+	})
+	return 0
+}
+
+func debugDisasm(L *LState) int {
+	fn := L.CheckProc(1)
+	format := L.OptString(2, "text")
+	if fn.IsG {
+		L.ArgError(1, "cannot disassemble a built in proc")
+	}
+	name := "main"
+	if fn.Proto.LineDefined > 0 {
+		name = fmt.Sprintf("proc@%d", fn.Proto.LineDefined)
+	}
+	dp := Disassemble(fn.Proto, name)
+	switch format {
+	case "text":
+		L.Push(LString(dp.Text(nil)))
+	case "json":
+		data, err := json.MarshalIndent(dp, "", "  ")
+		if err != nil {
+			L.RaiseError(err.Error())
+		}
+		L.Push(LString(data))
+	default:
+		L.ArgError(2, "format must be \"text\" or \"json\"")
+	}
+	return 1
+}
@@ -9,7 +9,9 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -32,9 +34,16 @@ const lFileClass = "FILE*"
 type lFile struct {
 	fp     *os.File
 	pp     *exec.Cmd
+	pipe   *os.File // stdout of a process
 	writer io.Writer
 	reader *bufio.Reader
 	closed bool
+
+	watch       <-chan struct{} // the done channel of the context watched for the reads
+	unwatch     chan struct{}   // closed when the file is closed, ends the watcher
+	mu          sync.Mutex      // guards watch, reading and interrupted
+	reading     bool            // a read the watcher can interrupt is running
+	interrupted bool            // the read deadline was set by the watcher
 }
 
 type lFileType int
@@ -99,6 +108,7 @@ func newProcess(L *LState, cmd string, wrilist, readable bool) (*LUserData, erro
 	if readable {
 		var reader io.Reader
 		reader, err = pp.StdoutPipe()
+		lfile.pipe, _ = reader.(*os.File)
 		lfile.reader = bufio.NewReaderSize(reader, fileDefaultReadBuffer)
 	}
 	if err != nil {
@@ -141,6 +151,86 @@ func (file *lFile) AbandonReadBuffer() error {
 	return nil
 }
 
+// isStd - reports if the file is one of the standard files, which the state
+// does not own
+func (file *lFile) isStd() bool {
+	for _, finfo := range stdFiles {
+		if file.fp != nil && file.fp == finfo.file {
+			return true
+		}
+	}
+	return false
+}
+
+// watchContext - interrupts a read of the file that is blocked on a pipe when
+// the context of L is done, the returned proc must be called once the read
+// has ended, it clears the deadline that interrupted the read. One watcher
+// runs for the file and context until either ends. Reads of regular files
+// can not be interrupted, and the standard files are left alone.
+func (file *lFile) watchContext(L *LState) func() {
+	done := L.contextDone()
+	fp := file.fp
+	if fp == nil {
+		fp = file.pipe
+	}
+	if done == nil || fp == nil || file.isStd() {
+		return func() {}
+	}
+	file.mu.Lock()
+	if file.watch != done {
+		if file.unwatch == nil {
+			file.unwatch = make(chan struct{})
+		}
+		file.watch = done
+		go file.watcher(fp, done, file.unwatch)
+	}
+	file.reading = true
+	select {
+	case <-done:
+		file.interrupt(fp)
+	default:
+	}
+	file.mu.Unlock()
+	return func() {
+		file.mu.Lock()
+		file.reading = false
+		if file.interrupted {
+			fp.SetReadDeadline(time.Time{})
+			file.interrupted = false
+		}
+		file.mu.Unlock()
+	}
+}
+
+// watcher - interrupts the read running when done is closed, until the file
+// is closed or is watched for another context
+func (file *lFile) watcher(fp *os.File, done <-chan struct{}, unwatch chan struct{}) {
+	select {
+	case <-done:
+		file.mu.Lock()
+		if file.reading && file.watch == done {
+			file.interrupt(fp)
+		}
+		file.mu.Unlock()
+	case <-unwatch:
+	}
+}
+
+// interrupt - makes the blocked read of fp return, file.mu must be held
+func (file *lFile) interrupt(fp *os.File) {
+	if !file.interrupted {
+		fp.SetReadDeadline(time.Now())
+		file.interrupted = true
+	}
+}
+
+// checkContext - raises the error of the context of L if it is done
+func checkContext(L *LState) {
+	if L.ctx != nil && L.ctx.Err() != nil {
+		L.raiseContextError()
+	}
+}
+
 func fileDefOut(L *LState) *LUserData {
 	return L.Get(UpvalueIndex(1)).(*LOAList).RawGetInt(fileDefOutIndex).(*LUserData)
 }
@@ -205,6 +295,7 @@ func OpenIo(L *LState) int {
 
 var fileMethods = map[string]LGProc{
 	"__tostring": fileToString,
+	"__close":    fileCloseMeta,
 	"write":      fileWrite,
 	"close":      fileClose,
 	"flush":      fileFlush,
@@ -262,6 +353,10 @@ errreturn:
 
 func fileCloseAux(L *LState, file *lFile) int {
 	file.closed = true
+	if file.unwatch != nil {
+		close(file.unwatch)
+		file.unwatch = nil
+	}
 	var err error
 	if file.writer != nil {
 		if bwriter, ok := file.writer.(*bufio.Writer); ok {
@@ -327,12 +422,14 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 	if L.GetTop() == idx-1 {
 		L.Push(LString("*l"))
 	}
+	checkContext(L)
+	defer file.watchContext(L)()
 	var err error
 	top := L.GetTop()
 	for i := idx; i <= top; i++ {
 		switch lv := L.Get(i).(type) {
-		case LNumber:
-			size := int64(lv)
+		case LNumber, LInteger:
+			size := int64(LVAsNumber(lv))
 			if size == 0 {
 				_, err = file.reader.ReadByte()
 				if err == io.EOF {
@@ -351,6 +448,7 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 			if err != nil {
 				goto errreturn
 			}
+			L.alloc.account(len(buf))
 			L.Push(LString(string(buf)))
 		case LString:
 			options := L.CheckString(i)
@@ -380,6 +478,7 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 					if err != nil {
 						goto errreturn
 					}
+					L.alloc.account(len(buf))
 					L.Push(LString(string(buf)))
 				case 'l':
 					var buf []byte
@@ -392,6 +491,7 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 					if err != nil {
 						goto errreturn
 					}
+					L.alloc.account(len(buf))
 					L.Push(LString(string(buf)))
 				default:
 					L.ArgError(2, "invalid options:"+string(opt))
@@ -403,6 +503,7 @@ normalreturn:
 	return L.GetTop() - top
 
 errreturn:
+	checkContext(L)
 	L.RaiseError(err.Error())
 	//L.Push(LNil)
 	//L.Push(LString(err.Error()))
@@ -457,6 +558,17 @@ func fileClose(L *LState) int {
 	return fileCloseAux(L, checkFile(L))
 }
 
+// fileCloseMeta - __close of a file, closes it when it is open and it is
+// not one of the standard files
+func fileCloseMeta(L *LState) int {
+	file := checkFile(L)
+	if file.closed || file.isStd() {
+		return 0
+	}
+	fileCloseAux(L, file)
+	return 0
+}
+
 func fileFlush(L *LState) int {
 	return fileFlushAux(L, checkFile(L))
 }
@@ -468,14 +580,19 @@ func fileLinesIter(L *LState) int {
 	} else {
 		file = L.Get(UpvalueIndex(2)).(*LUserData).Value.(*lFile)
 	}
+	checkContext(L)
+	stop := file.watchContext(L)
 	buf, _, err := file.reader.ReadLine()
+	stop()
 	if err != nil {
 		if err == io.EOF {
 			L.Push(LNil)
 			return 1
 		}
+		checkContext(L)
 		L.RaiseError(err.Error())
 	}
+	L.alloc.account(len(buf))
 	L.Push(LString(string(buf)))
 	return 1
 }
@@ -581,7 +698,10 @@ func ioLinesIter(L *LState) int {
 		file = L.Get(UpvalueIndex(2)).(*LUserData).Value.(*lFile)
 		toclose = true
 	}
+	checkContext(L)
+	stop := file.watchContext(L)
 	buf, _, err := file.reader.ReadLine()
+	stop()
 	if err != nil {
 		if err == io.EOF {
 			if toclose {
@@ -590,8 +710,10 @@ func ioLinesIter(L *LState) int {
 			L.Push(LNil)
 			return 1
 		}
+		checkContext(L)
 		L.RaiseError(err.Error())
 	}
+	L.alloc.account(len(buf))
 	L.Push(LString(string(buf)))
 	return 1
 }
@@ -0,0 +1,51 @@
+package qs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReadCancel - a read blocked on a pipe ends when the context is done,
+// and the file can be read again once the context is removed
+func TestReadCancel(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	L.SetContext(ctx)
+	start := time.Now()
+	err := L.DoString(`p = i.popen("sleep 1; echo done")
+dcl s = p:read("*a")`)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("read error %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("read interrupted after %v", elapsed)
+	}
+	L.RemoveContext()
+	if err := L.DoString(`dcl s = p:read("*a")
+assert(s == "done\n", s)
+p:close()`); err != nil {
+		t.Errorf("read after the context was removed: %v", err)
+	}
+}
+
+// TestLinesCancel - a lines loop over a pipe ends when the context is done
+func TestLinesCancel(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	L.SetContext(ctx)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	err := L.DoString(`dcl p = i.popen("echo a; echo b; sleep 5")
+dcl n = 0
+for line in p:lines() do n = n + 1 end`)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("lines error %v, want context canceled", err)
+	}
+}
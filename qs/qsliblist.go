@@ -117,7 +117,7 @@ func listMarshal(L *LState) int {
 	} else {
 		jsonout = jsonout + spcs + "}" + NL
 	}
-	L.Push(LString(jsonout))
+	L.Push(L.newString(jsonout))
 	return 1
 }
 
@@ -137,7 +137,7 @@ func (lst *LOAList) mjson(jsonout string, lev int) string {
 				switch v.(type) {
 				case LBool:
 					jsonout = jsonout + spcs + v.String()
-				case LNumber:
+				case LNumber, LInteger:
 					jsonout = jsonout + spcs + v.String()
 				case LString:
 					out, _ := json.Marshal(v.String())
@@ -167,7 +167,7 @@ func (lst *LOAList) mjson(jsonout string, lev int) string {
 				switch v.(type) {
 				case LBool:
 					jsonout = jsonout + spcs + "\"" + k + "\":" + v.String()
-				case LNumber:
+				case LNumber, LInteger:
 					jsonout = jsonout + spcs + "\"" + k + "\":" + v.String()
 				case LString:
 					out, _ := json.Marshal(v.String())
@@ -197,7 +197,7 @@ func (lst *LOAList) mjson(jsonout string, lev int) string {
 				switch v.(type) {
 				case LBool:
 					jsonout = jsonout + spcs + "\"" + k.String() + "\":" + v.String()
-				case LNumber:
+				case LNumber, LInteger:
 					jsonout = jsonout + spcs + "\"" + k.String() + "\":" + v.String()
 				case LString:
 					out, _ := json.Marshal(v.String())
@@ -235,14 +235,16 @@ func listUnMarshal(L *LState) int {
 	var object interface{}
 	var lst *LOAList
 	var err error
-	err = json.Unmarshal([]byte(jsonBlob), &object)
+	dec := json.NewDecoder(strings.NewReader(jsonBlob))
+	dec.UseNumber()
+	err = dec.Decode(&object)
 	if err != nil {
 		L.RaiseError(err.Error())
 	} else {
 		lst = L.NewOAList()
 		switch v := object.(type) {
-		case int:
-			lst.Append(LNumber(v))
+		case json.Number:
+			lst.Append(jsonNumber(v))
 		case float64:
 			lst.Append(LNumber(v))
 		case bool:
@@ -252,12 +254,12 @@ func listUnMarshal(L *LState) int {
 		case string:
 			lst.Append(LString(v))
 		case []interface{}:
-			ls := newLOAList(0, 0)
+			ls := newLOAList(lst.alloc, 0, 0)
 			lst.Append(LValue(ls))
 			ms := object.([]interface{})
 			err = ls.prs(ms)
 		case map[string]interface{}:
-			ls := newLOAList(0, 0)
+			ls := newLOAList(lst.alloc, 0, 0)
 			lst.Append(LValue(ls))
 			ms := object.(map[string]interface{})
 			err = ls.prm(ms)
@@ -275,12 +277,22 @@ func listUnMarshal(L *LState) int {
 	return 1
 }
 
+// jsonNumber - converts a JSON number to an integer when it has integer
+// syntax and fits in 64 bits, otherwise to a float
+func jsonNumber(n json.Number) LValue {
+	if i, err := n.Int64(); err == nil {
+		return LInteger(i)
+	}
+	f, _ := n.Float64()
+	return LNumber(f)
+}
+
 func (lst *LOAList) prm(obj map[string]interface{}) error {
 	var err error
 	for k, d := range obj {
 		switch v := d.(type) {
-		case int:
-			lst.RawSetString(k, LNumber(v))
+		case json.Number:
+			lst.RawSetString(k, jsonNumber(v))
 		case float64:
 			lst.RawSetString(k, LNumber(v))
 		case bool:
@@ -290,12 +302,12 @@ func (lst *LOAList) prm(obj map[string]interface{}) error {
 		case string:
 			lst.RawSetString(k, LString(v))
 		case []interface{}:
-			ls := newLOAList(0, 0)
+			ls := newLOAList(lst.alloc, 0, 0)
 			lst.RawSetString(k, LValue(ls))
 			ms := d.([]interface{})
 			err = ls.prs(ms)
 		case map[string]interface{}:
-			ls := newLOAList(0, 0)
+			ls := newLOAList(lst.alloc, 0, 0)
 			lst.RawSetString(k, LValue(ls))
 			ms := d.(map[string]interface{})
 			err = ls.prm(ms)
@@ -310,8 +322,8 @@ func (lst *LOAList) prs(obj []interface{}) error {
 	var err error
 	for i, d := range obj {
 		switch v := d.(type) {
-		case int:
-			lst.Append(LNumber(v))
+		case json.Number:
+			lst.Append(jsonNumber(v))
 		case float64:
 			lst.Append(LNumber(v))
 		case bool:
@@ -321,12 +333,12 @@ func (lst *LOAList) prs(obj []interface{}) error {
 		case string:
 			lst.Append(LString(v))
 		case []interface{}:
-			ls := newLOAList(0, 0)
+			ls := newLOAList(lst.alloc, 0, 0)
 			lst.Append(LValue(ls))
 			ms := d.([]interface{})
 			err = ls.prs(ms)
 		case map[string]interface{}:
-			ls := newLOAList(0, 0)
+			ls := newLOAList(lst.alloc, 0, 0)
 			lst.Append(LValue(ls))
 			ms := d.(map[string]interface{})
 			err = ls.prm(ms)
@@ -370,7 +382,7 @@ func (lst *LOAList) dumplist(lev int) {
 			if v != LNil {
 				x := i + 1
 				switch v.(type) {
-				case LNumber:
+				case LNumber, LInteger:
 					fmt.Printf("%s(num)%d: %v\n", spcs, x, v)
 				case LString:
 					fmt.Printf("%s(str)%d: \"%v\"\n", spcs, x, v)
@@ -390,7 +402,7 @@ func (lst *LOAList) dumplist(lev int) {
 		for k, v := range lst.strdict {
 			if v != LNil {
 				switch v.(type) {
-				case LNumber:
+				case LNumber, LInteger:
 					fmt.Printf("%s(num)%v: %v\n", spcs, k, v)
 				case LString:
 					fmt.Printf("%s(str)%v: \"%v\"\n", spcs, k, v)
@@ -410,7 +422,7 @@ func (lst *LOAList) dumplist(lev int) {
 		for k, v := range lst.dict {
 			if v != LNil {
 				switch v.(type) {
-				case LNumber:
+				case LNumber, LInteger:
 					fmt.Printf("%s(num)%v: %v\n", spcs, k, v)
 				case LString:
 					fmt.Printf("%s(str)%v: \"%v\"\n", spcs, k, v)
@@ -461,7 +473,7 @@ func listMarshalXml(L *LState) int {
 	xmlout = xmlout + spcs + "<" + name + ">" + NL
 	xmlout = list.mxml(xmlout, name, lev+1)
 	xmlout = xmlout + spcs + "</" + name + ">" + NL
-	L.Push(LString(xmlout))
+	L.Push(L.newString(xmlout))
 	return 1
 }
 
@@ -478,7 +490,7 @@ func (lst *LOAList) mxml(xmlout string, name string, lev int) string {
 				switch v.(type) {
 				case LBool:
 					xmlout = xmlout + spcs + "<" + name + ">" + v.String() + "</" + name + ">"
-				case LNumber:
+				case LNumber, LInteger:
 					xmlout = xmlout + spcs + "<" + name + ">" + v.String() + "</" + name + ">"
 				case LString:
 					out, _ := xml.Marshal(v.String())
@@ -505,7 +517,7 @@ func (lst *LOAList) mxml(xmlout string, name string, lev int) string {
 				switch v.(type) {
 				case LBool:
 					xmlout = xmlout + spcs + "<" + k + ">" + v.String() + "</" + k + ">"
-				case LNumber:
+				case LNumber, LInteger:
 					xmlout = xmlout + spcs + "<" + k + ">" + v.String() + "</" + k + ">"
 				case LString:
 					out, _ := xml.Marshal(v.String())
@@ -532,7 +544,7 @@ func (lst *LOAList) mxml(xmlout string, name string, lev int) string {
 				switch v.(type) {
 				case LBool:
 					xmlout = xmlout + spcs + "<" + k.String() + ">" + v.String() + "</" + k.String() + ">"
-				case LNumber:
+				case LNumber, LInteger:
 					xmlout = xmlout + spcs + "<" + k.String() + ">" + v.String() + "</" + k.String() + ">"
 				case LString:
 					out, _ := xml.Marshal(v.String())
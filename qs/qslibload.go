@@ -36,6 +36,9 @@ func loFindFile(L *LState, name, pname string) (string, string) {
 	messages := []string{}
 	for _, pattern := range strings.Split(string(path), ";") {
 		oapath := strings.Replace(pattern, "?", name, -1)
+		if qcpath := loPrecompiledPath(oapath); len(qcpath) != 0 {
+			return qcpath, ""
+		}
 		if _, err := os.Stat(oapath); err == nil {
 			return oapath, ""
 		} else {
@@ -45,6 +48,23 @@ func loFindFile(L *LState, name, pname string) (string, string) {
 	return "", strings.Join(messages, "\n\t")
 }
 
+// loPrecompiledPath - returns the .qc file for a .q source path when it
+// exists and is not older than the source, otherwise an empty string
+func loPrecompiledPath(oapath string) string {
+	if !strings.HasSuffix(oapath, EXTN) {
+		return ""
+	}
+	qcpath := strings.TrimSuffix(oapath, EXTN) + QcExtension
+	qcinfo, err := os.Stat(qcpath)
+	if err != nil {
+		return ""
+	}
+	if srcinfo, err := os.Stat(oapath); err == nil && qcinfo.ModTime().Before(srcinfo.ModTime()) {
+		return ""
+	}
+	return qcpath
+}
+
 func OpenPackage(L *LState) int {
 	packagemod := L.RegisterModule(LoadLibName, loFuncs)
 
@@ -28,8 +28,8 @@ func init() {
 
 func getIntField(L *LState, tb *LOAList, key string, v int) int {
 	ret := tb.RawGetString(key)
-	if ln, ok := ret.(LNumber); ok {
-		return int(ln)
+	if ret.Type() == LTNumber {
+		return int(LVAsNumber(ret))
 	}
 	return v
 }
@@ -155,7 +155,7 @@ func osFiles(L *LState) int {
 
 	err = filepath.Walk(baseDir, func(path string, f os.FileInfo, err error) error {
 		if err == nil {
-			ls := newLOAList(0, 0)
+			ls := newLOAList(L.alloc, 0, 0)
 			lst.RawSetString(path, LValue(ls))
 			ls.RawSetString("mode", LString(f.Mode().String()))
 			if !f.IsDir() {
@@ -359,6 +359,16 @@ func osSetEnv(L *LState) int {
 func osSleep(L *LState) int {
 	td := L.CheckNumber(1)
 	sd := int64(td * 1000000000)
+	if done := L.contextDone(); done != nil {
+		timer := time.NewTimer(time.Duration(sd))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-done:
+			L.raiseContextError()
+		}
+		return 1
+	}
 	time.Sleep(time.Duration(sd))
 	return 1
 }
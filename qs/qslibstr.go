@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"regexp"
 	"strings"
 	"unsafe"
@@ -101,7 +102,7 @@ func strChar(L *LState) int {
 	for i := 1; i <= top; i++ {
 		bytes[i-1] = uint8(L.CheckInt(i))
 	}
-	L.Push(LString(string(bytes)))
+	L.Push(L.newString(string(bytes)))
 	return 1
 }
 
@@ -140,7 +141,7 @@ func strDecodeBase64(L *LState) int {
 		if err != nil {
 			L.RaiseError("base64 decode error, " + err.Error())
 		} else {
-			L.Push(LString(dstr))
+			L.Push(L.newString(string(dstr)))
 		}
 	} else {
 		L.RaiseError("invalid base64 string")
@@ -153,7 +154,7 @@ func strDump(L *LState) int {
 	str := L.CheckString(1)
 	in := []byte(str)
 	str = hex.Dump(in)
-	L.Push(LString(str))
+	L.Push(L.newString(str))
 	return 1
 }
 
@@ -162,7 +163,7 @@ func strEncodeBase64(L *LState) int {
 	str := L.CheckString(1)
 	b := []byte(str) // make string byte slice
 	str = base64.StdEncoding.EncodeToString(b)
-	L.Push(LString(str))
+	L.Push(L.newString(str))
 	return 1
 }
 
@@ -170,7 +171,7 @@ func strEncodeBase64(L *LState) int {
 //   repleced with the the correct XML escape sequence. For example: < --> &lt;
 func strEscapeXmlData(L *LState) int {
 	str := L.CheckString(1)
-	L.Push(LString(EscapeXmlData(str)))
+	L.Push(L.newString(EscapeXmlData(str)))
 	return 1
 }
 
@@ -227,11 +228,17 @@ func strFormat(L *LState) int {
 	for i := 2; i <= top; i++ {
 		args[i-2] = L.Get(i)
 	}
-	npat := strings.Count(str, "%") - strings.Count(str, "%%")
-	L.Push(LString(fmt.Sprintf(str, args[:intMin(npat, len(args))]...)))
+	L.Push(L.newString(strFormatArgs(str, args)))
 	return 1
 }
 
+// strFormatArgs - formats args with the format str of string.format, the
+// args that the format has no verbs for are ignored
+func strFormatArgs(str string, args []interface{}) string {
+	npat := strings.Count(str, "%") - strings.Count(str, "%%")
+	return fmt.Sprintf(str, args[:intMin(npat, len(args))]...)
+}
+
 func strGsub(L *LState) int {
 	str := L.CheckString(1)
 	pat := L.CheckString(2)
@@ -250,11 +257,11 @@ func strGsub(L *LState) int {
 	}
 	switch lv := repl.(type) {
 	case LString:
-		L.Push(LString(strGsubStr(L, str, string(lv), mds)))
+		L.Push(L.newString(strGsubStr(L, str, string(lv), mds)))
 	case *LOAList:
-		L.Push(LString(strGsubOAList(L, str, lv, mds)))
+		L.Push(L.newString(strGsubOAList(L, str, lv, mds)))
 	case *LProc:
-		L.Push(LString(strGsubFunc(L, str, lv, mds)))
+		L.Push(L.newString(strGsubFunc(L, str, lv, mds)))
 	}
 	L.Push(LNumber(len(mds)))
 	return 2
@@ -507,7 +514,7 @@ func strLen(L *LState) int {
 // strLower - converts string str to lower case
 func strLower(L *LState) int {
 	str := L.CheckString(1)
-	L.Push(LString(strings.ToLower(str)))
+	L.Push(L.newString(strings.ToLower(str)))
 	return 1
 }
 
@@ -620,6 +627,12 @@ func strPrxChange(L *LState) int {
 func strRep(L *LState) int {
 	str := L.CheckString(1)
 	n := L.CheckInt(2)
+	if n > 0 && len(str) > 0 {
+		if len(str) > math.MaxInt32/n {
+			L.RaiseError("resulting string too large")
+		}
+		L.alloc.account(len(str) * n)
+	}
 	L.Push(LString(strings.Repeat(str, n)))
 	return 1
 }
@@ -631,7 +644,7 @@ func strReplace(L *LState) int {
 	news := L.CheckString(3)
 	n := L.CheckInt(4)
 	str = strings.Replace(str, olds, news, n)
-	L.Push(LString(str))
+	L.Push(L.newString(str))
 	return 1
 }
 
@@ -643,7 +656,7 @@ func strReverse(L *LState) int {
 	for i, j := 0, len(bts)-1; j >= 0; i, j = i+1, j-1 {
 		out[i] = bts[j]
 	}
-	L.Push(LString(string(out)))
+	L.Push(L.newString(string(out)))
 	return 1
 }
 
@@ -705,7 +718,7 @@ func strSubstr(L *LState) int {
 //   that begin words mapped to their title case.
 func strTitle(L *LState) int {
 	str := L.CheckString(1)
-	L.Push(LString(strings.Title(str)))
+	L.Push(L.newString(strings.Title(str)))
 	return 1
 }
 
@@ -766,14 +779,14 @@ func strTrimSuffix(L *LState) int {
 //   characters that were escaped. For example: &lt; --> <
 func strUnEscapeXmlData(L *LState) int {
 	str := L.CheckString(1)
-	L.Push(LString(UnEscapeXmlData(str)))
+	L.Push(L.newString(UnEscapeXmlData(str)))
 	return 1
 }
 
 // strUpper - converts string str to upper case
 func strUpper(L *LState) int {
 	str := L.CheckString(1)
-	L.Push(LString(strings.ToUpper(str)))
+	L.Push(L.newString(strings.ToUpper(str)))
 	return 1
 }
 
@@ -0,0 +1,772 @@
+// Package qs - q scripting language
+package qs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/x0ray/q/qs/qsa"
+	"github.com/x0ray/q/qs/qsp"
+)
+
+/*
+  Lint finds the common mistakes of a q script that compiles:
+
+    undefined    a global read that is neither a builtin nor assigned by
+                 the script, usually a typo
+    unused       a dcl local that is never read
+    shadow       a dcl local that hides a local of an enclosing block or proc
+    unreachable  a statement after a return, break, continue or error call
+    arity        a builtin called with too few or too many arguments
+
+  The locals of each block are kept in a varNamePool like the compiler does,
+  so a name is resolved the way funcContext resolves it. An issue on a line
+  is suppressed by a comment with lint:ignore on it, or on the line before
+  when that line is only the comment. The checks to suppress may follow,
+  like "// lint:ignore unused shadow", none suppresses them all.
+*/
+
+// LintIssue - a mistake found in a q script by Lint
+type LintIssue struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	LastLine   int    `json:"endLine"`
+	LastColumn int    `json:"endColumn"`
+	Check      string `json:"check"`
+	Message    string `json:"message"`
+}
+
+func (li *LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", li.File, li.Line, li.Column, li.Message, li.Check)
+}
+
+// lintArity - the minimum and maximum argument counts of the builtins of
+// baseFuncs, -1 for any number, as the builtins check them
+var lintArity = map[string][2]int{
+	// base procs
+	"assert":         {1, -1},
+	"bye":            {0, 1},
+	"collectgarbage": {0, 2},
+	"error":          {1, 2},
+	"getfenv":        {0, 1},
+	"getmetalist":    {1, 1},
+	"go":             {1, -1},
+	"help":           {0, 0},
+	"instanceof":     {2, 2},
+	"keys":           {1, 1},
+	"load":           {1, 3},
+	"loadfile":       {0, 2},
+	"loadstring":     {1, 3},
+	"logd":           {0, -1},
+	"loge":           {0, -1},
+	"logi":           {0, -1},
+	"logw":           {0, -1},
+	"next":           {1, 2},
+	"pcall":          {1, -1},
+	"put":            {0, -1},
+	"quit":           {0, 1},
+	"rawequal":       {2, 2},
+	"rawget":         {2, 2},
+	"rawset":         {3, 3},
+	"run":            {1, 1},
+	"select":         {1, -1},
+	"setfenv":        {2, 2},
+	"setmetalist":    {2, 2},
+	"stop":           {0, 1},
+	"tonumber":       {1, 2},
+	"tostring":       {1, 1},
+	"type":           {1, 1},
+	"unpack":         {1, 3},
+	"xpcall":         {2, 2},
+	// loadlib
+	"module":  {1, -1},
+	"require": {1, 1},
+	// string procs
+	"after":        {2, 2},
+	"before":       {2, 2},
+	"byte":         {1, 3},
+	"char":         {0, -1},
+	"contains":     {2, 2},
+	"containsany":  {2, 2},
+	"count":        {2, 2},
+	"decodebase64": {1, 1},
+	"dump":         {1, 1},
+	"encodebase64": {1, 1},
+	"escapexml":    {1, 1},
+	"find":         {2, 4},
+	"format":       {1, -1},
+	"gsub":         {3, 4},
+	"hasprefix":    {2, 2},
+	"hassuffix":    {2, 2},
+	"index":        {2, 2},
+	"indexany":     {2, 2},
+	"isname":       {1, 1},
+	"isxmltagname": {1, 1},
+	"lastindex":    {2, 2},
+	"lastindexany": {2, 2},
+	"length":       {1, 1},
+	"len":          {1, 1},
+	"lower":        {1, 1},
+	"makexmltag":   {1, 4},
+	"match":        {2, 3},
+	"prxmatch":     {2, 2},
+	"prxchange":    {3, 3},
+	"rep":          {2, 2},
+	"replace":      {4, 4},
+	"reverse":      {1, 1},
+	"scan":         {3, 3},
+	"scanall":      {2, 2},
+	"sub":          {2, 3},
+	"substr":       {2, 3},
+	"trim":         {2, 2},
+	"trimleft":     {2, 2},
+	"trimprefix":   {2, 2},
+	"trimright":    {2, 2},
+	"trimspace":    {1, 1},
+	"trimsuffix":   {2, 2},
+	"title":        {1, 1},
+	"unescapexml":  {1, 1},
+	"upper":        {1, 1},
+	// math procs
+	"abs":        {1, 1},
+	"acos":       {1, 1},
+	"asin":       {1, 1},
+	"atan":       {1, 1},
+	"atan2":      {2, 2},
+	"ceil":       {1, 1},
+	"cos":        {1, 1},
+	"cosh":       {1, 1},
+	"deg":        {1, 1},
+	"exp":        {1, 1},
+	"fact":       {1, 1},
+	"fib":        {1, 1},
+	"floor":      {1, 1},
+	"fmod":       {2, 2},
+	"frexp":      {1, 1},
+	"ldexp":      {2, 2},
+	"log":        {1, 1},
+	"log10":      {1, 1},
+	"max":        {1, -1},
+	"mean":       {1, -1},
+	"median":     {1, -1},
+	"min":        {1, -1},
+	"mod":        {2, 2},
+	"mode":       {1, -1},
+	"modf":       {1, 1},
+	"pow":        {2, 2},
+	"rad":        {1, 1},
+	"random":     {0, 2},
+	"randomseed": {1, 1},
+	"range":      {1, -1},
+	"rms":        {1, -1},
+	"sin":        {1, 1},
+	"sinh":       {1, 1},
+	"sqrt":       {1, 1},
+	"stddev":     {1, -1},
+	"sum":        {1, -1},
+	"tan":        {1, 1},
+	"tanh":       {1, 1},
+	"variance":   {1, -1},
+	// os procs
+	"argstr":     {0, 0},
+	"arglist":    {1, 1},
+	"argopts":    {1, 1},
+	"chdir":      {1, 1},
+	"clearenv":   {0, 0},
+	"clock":      {0, 0},
+	"date":       {0, 2},
+	"difftime":   {2, 2},
+	"embedded":   {0, 0},
+	"execute":    {1, 1},
+	"exist":      {1, 1},
+	"exit":       {0, 1},
+	"files":      {1, 1},
+	"getenv":     {1, 1},
+	"geteuid":    {0, 0},
+	"getpid":     {0, 0},
+	"getppid":    {0, 0},
+	"gethome":    {0, 0},
+	"getuid":     {0, 0},
+	"getuser":    {0, 0},
+	"getwd":      {0, 0},
+	"hostname":   {0, 0},
+	"remove":     {1, 1},
+	"rename":     {2, 2},
+	"setenv":     {2, 2},
+	"setlocale":  {0, 2},
+	"sleep":      {1, 1},
+	"stat":       {1, 1},
+	"statfs":     {1, 1},
+	"time":       {0, 1},
+	"tmpname":    {0, 0},
+	"unsetenv":   {1, 1},
+	"uuidgen":    {0, 0},
+	"uuidgenfmt": {0, 0},
+	// debug procs
+	"dbgdisasm":      {1, 2},
+	"dbggetfenv":     {1, 1},
+	"dbggetinfo":     {1, 2},
+	"dbggetlocal":    {2, 2},
+	"dbggetmetalist": {1, 1},
+	"dbggetupvalue":  {2, 2},
+	"dbgsetfenv":     {2, 2},
+	"dbgsethook":     {0, 3},
+	"dbgsetlocal":    {3, 3},
+	"dbgsetmetalist": {2, 2},
+	"dbgsetupvalue":  {3, 3},
+	"dbgtraceback":   {0, 2},
+	// list procs
+	"dumpl":      {1, 1},
+	"getn":       {1, 1},
+	"concat":     {1, 4},
+	"insert":     {2, 3},
+	"maxn":       {1, 1},
+	"erase":      {1, 2},
+	"marshal":    {1, 2},
+	"marshalxml": {1, 3},
+	"unmarshal":  {1, 1},
+	"sort":       {1, 2},
+}
+
+// lintVar - a local of the script
+type lintVar struct {
+	name string
+	pos  qsa.Node // the name in the source
+	dcl  bool     // declared by dcl, it is reported when unused
+	used bool
+}
+
+// lintScope - the locals of a block, as in a codeBlock
+type lintScope struct {
+	names  *varNamePool
+	vars   []*lintVar
+	parent *lintScope
+}
+
+// linter - the state of Lint
+type linter struct {
+	file     string
+	lines    []string
+	scope    *lintScope
+	assigned map[string]bool // the globals assigned by the script
+	reads    []*qsa.IdentExpr
+	calls    []*qsa.FuncCallExpr
+	issues   []*LintIssue
+}
+
+// Lint - returns the issues of the q source src of file, sorted by
+// position, or the error of a source that does not compile
+func Lint(src []byte, file string) ([]*LintIssue, error) {
+	segment, err := qsp.Parse(bytes.NewReader(src), file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := CompileSource(src, file); err != nil {
+		return nil, err
+	}
+	lt := &linter{file: file, lines: strings.Split(string(src), "\n"), assigned: map[string]bool{}}
+	lt.enter()
+	lt.block(segment)
+	lt.leave()
+	lt.globals()
+	issues := lt.suppress()
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues, nil
+}
+
+// LintErrorIssue - returns the error of a file that could not be linted as
+// an issue, of check "syntax" for a parse error, "compile" for a compile
+// error and "error" for others
+func LintErrorIssue(err error, file string) *LintIssue {
+	issue := &LintIssue{File: file, Check: "error", Message: strings.TrimSpace(err.Error())}
+	switch e := err.(type) {
+	case *qsp.Error:
+		issue.Check, issue.Message = "syntax", e.Message
+		if e.Pos.Line == qsp.EOF {
+			issue.Message += " at the end of the input"
+			break
+		}
+		if len(e.Token) > 0 {
+			issue.Message = fmt.Sprintf("%s near '%s'", e.Message, e.Token)
+		}
+		issue.Line, issue.Column = e.Pos.Line, e.Pos.Column
+		issue.LastLine, issue.LastColumn = e.Pos.Line, e.Pos.Column+len(e.Token)-1
+		if e.End.Line == e.Pos.Line && e.End.Column >= e.Pos.Column {
+			issue.LastColumn = e.End.Column
+		}
+	case *CompileError:
+		issue.Check, issue.Message = "compile", e.Message
+		issue.Line, issue.Column, issue.LastLine, issue.LastColumn = e.Line, e.Column, e.LastLine, e.LastColumn
+	}
+	return issue
+}
+
+// report - records an issue of check at pos
+func (lt *linter) report(pos qsa.PositionHolder, check, format string, args ...interface{}) {
+	lt.issues = append(lt.issues, &LintIssue{File: lt.file, Line: pos.Line(), Column: pos.Column(),
+		LastLine: pos.LastLine(), LastColumn: pos.LastColumn(), Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// enter - starts the scope of a block
+func (lt *linter) enter() {
+	lt.scope = &lintScope{names: newVarNamePool(0), parent: lt.scope}
+}
+
+// leave - ends the scope of a block, reporting its unused locals
+func (lt *linter) leave() {
+	for _, v := range lt.scope.vars {
+		if v.dcl && !v.used && !strings.HasPrefix(v.name, "_") {
+			lt.report(&v.pos, "unused", "local '%s' is declared but not used", v.name)
+		}
+	}
+	lt.scope = lt.scope.parent
+}
+
+// find - returns the visible local name, or nil
+func (lt *linter) find(name string) *lintVar {
+	for sc := lt.scope; sc != nil; sc = sc.parent {
+		if index := sc.names.Find(name); index > -1 {
+			return sc.vars[index]
+		}
+	}
+	return nil
+}
+
+// declare - adds the local name of the statement or expression pos
+func (lt *linter) declare(name string, pos qsa.PositionHolder, dcl bool) {
+	v := &lintVar{name: name, pos: lt.namePos(name, pos), dcl: dcl}
+	if old := lt.find(name); old != nil && dcl && name != "_" {
+		lt.report(&v.pos, "shadow", "declaration of '%s' shadows the one on line %d", name, old.pos.Line())
+	}
+	lt.scope.names.Register(name)
+	lt.scope.vars = append(lt.scope.vars, v)
+}
+
+// patterns - declares the names of the patterns of a dcl statement or for
+func (lt *linter) patterns(patterns []*qsa.Pattern, dcl bool) {
+	for _, pat := range patterns {
+		if pat == nil {
+			continue
+		}
+		for _, name := range pat.Names {
+			lt.declare(name, pat, dcl)
+		}
+		if pat.Rest != "" {
+			lt.declare(pat.Rest, pat, dcl)
+		}
+	}
+}
+
+// namePos - returns the position of name in the source from the start of
+// pos, or the position of pos when it is not found
+func (lt *linter) namePos(name string, pos qsa.PositionHolder) qsa.Node {
+	node := qsa.Node{}
+	node.SetSpan(pos, pos)
+	for line := pos.Line(); line <= pos.LastLine() && line <= len(lt.lines); line++ {
+		text := lt.lines[line-1]
+		from := 0
+		if line == pos.Line() && pos.Column() > 0 {
+			from = pos.Column() - 1
+		}
+		for from < len(text) {
+			i := strings.Index(text[from:], name)
+			if i < 0 {
+				break
+			}
+			i += from
+			end := i + len(name)
+			if (i == 0 || !isLintNameChar(text[i-1])) && (end == len(text) || !isLintNameChar(text[end])) {
+				node.SetPos(qsa.Position{Line: line, Column: i + 1})
+				node.SetEnd(qsa.Position{Line: line, Column: end})
+				return node
+			}
+			from = end
+		}
+	}
+	return node
+}
+
+// isLintNameChar - reports whether c can be part of a name
+func isLintNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// block - walks the statements of a block, the first statement after one
+// that always ends the block is unreachable
+func (lt *linter) block(stmts []qsa.Stmt) {
+	ended := false
+	for _, stmt := range stmts {
+		if ended {
+			lt.report(stmt, "unreachable", "unreachable code")
+			ended = false
+		}
+		lt.stmt(stmt)
+		if lt.ends(stmt) {
+			ended = true
+		}
+	}
+}
+
+// ends - reports whether the statement always ends its block
+func (lt *linter) ends(stmt qsa.Stmt) bool {
+	switch st := stmt.(type) {
+	case *qsa.ReturnStmt, *qsa.BreakStmt, *qsa.ContinueStmt:
+		return true
+	case *qsa.DoBlockStmt:
+		return lt.endsBlock(st.Stmts)
+	case *qsa.IfStmt:
+		return len(st.Else) > 0 && lt.endsBlock(st.Then) && lt.endsBlock(st.Else)
+	case *qsa.SwitchStmt:
+		for _, c := range st.Cases {
+			if !lt.endsBlock(c.Stmts) {
+				return false
+			}
+		}
+		return lt.endsBlock(st.Else)
+	case *qsa.FuncCallStmt:
+		call, ok := st.Expr.(*qsa.FuncCallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := call.Func.(*qsa.IdentExpr)
+		return ok && id.Value == "error" && lt.find(id.Value) == nil && !lt.assigned[id.Value]
+	}
+	return false
+}
+
+// endsBlock - reports whether the last statement of a block always ends it
+func (lt *linter) endsBlock(stmts []qsa.Stmt) bool {
+	return len(stmts) > 0 && lt.ends(stmts[len(stmts)-1])
+}
+
+// stmt - walks a statement
+func (lt *linter) stmt(stmt qsa.Stmt) {
+	switch st := stmt.(type) {
+	case *qsa.AssignStmt:
+		for _, expr := range st.Rhs {
+			lt.expr(expr)
+		}
+		for _, lhs := range st.Lhs {
+			lt.assign(lhs)
+		}
+	case *qsa.CompoundAssignStmt:
+		lt.expr(st.Lhs)
+		lt.expr(st.Rhs)
+	case *qsa.LocalAssignStmt:
+		if len(st.Names) == 1 && len(st.Exprs) == 1 && st.Patterns == nil {
+			if _, ok := st.Exprs[0].(*qsa.ProcExpr); ok {
+				lt.declare(st.Names[0], st, true)
+				lt.expr(st.Exprs[0])
+				return
+			}
+		}
+		for _, expr := range st.Exprs {
+			lt.expr(expr)
+		}
+		for i, name := range st.Names {
+			if st.Patterns == nil || st.Patterns[i] == nil {
+				lt.declare(name, st, !st.Close) // closed when the block ends
+			}
+		}
+		lt.patterns(st.Patterns, true)
+	case *qsa.GlobalStmt:
+		for _, name := range st.Names {
+			lt.assigned[name] = true
+		}
+		for _, expr := range st.Exprs {
+			lt.expr(expr)
+		}
+	case *qsa.FuncCallStmt:
+		lt.expr(st.Expr)
+	case *qsa.DeferStmt:
+		lt.expr(st.Expr)
+	case *qsa.DoBlockStmt:
+		lt.enter()
+		lt.block(st.Stmts)
+		lt.leave()
+	case *qsa.WhileStmt:
+		lt.expr(st.Condition)
+		lt.enter()
+		lt.block(st.Stmts)
+		lt.leave()
+	case *qsa.RepeatStmt:
+		lt.enter()
+		lt.block(st.Stmts)
+		lt.expr(st.Condition) // sees the locals of the block
+		lt.leave()
+	case *qsa.IfStmt:
+		lt.expr(st.Condition)
+		lt.enter()
+		lt.block(st.Then)
+		lt.leave()
+		lt.enter()
+		lt.block(st.Else)
+		lt.leave()
+	case *qsa.SwitchStmt:
+		lt.expr(st.Subject)
+		for _, c := range st.Cases {
+			for _, value := range c.Values {
+				lt.expr(value)
+			}
+			lt.enter()
+			lt.block(c.Stmts)
+			lt.leave()
+		}
+		lt.enter()
+		lt.block(st.Else)
+		lt.leave()
+	case *qsa.TryStmt:
+		lt.enter()
+		lt.block(st.Stmts)
+		lt.leave()
+		if c := st.Catch; c != nil {
+			lt.enter()
+			if len(c.Name) > 0 {
+				lt.declare(c.Name, c, false)
+			}
+			lt.block(c.Stmts)
+			lt.leave()
+		}
+		if f := st.Finally; f != nil {
+			lt.enter()
+			lt.block(f.Stmts)
+			lt.leave()
+		}
+	case *qsa.NumberForStmt:
+		lt.expr(st.Init)
+		lt.expr(st.Limit)
+		if st.Step != nil {
+			lt.expr(st.Step)
+		}
+		lt.enter()
+		lt.declare(st.Name, st, false)
+		lt.block(st.Stmts)
+		lt.leave()
+	case *qsa.GenericForStmt:
+		for _, expr := range st.Exprs {
+			lt.expr(expr)
+		}
+		lt.enter()
+		for i, name := range st.Names {
+			if st.Patterns == nil || st.Patterns[i] == nil {
+				lt.declare(name, st, false)
+			}
+		}
+		lt.patterns(st.Patterns, false)
+		lt.block(st.Stmts)
+		lt.leave()
+	case *qsa.FuncDefStmt:
+		if st.Name.Func != nil {
+			lt.assign(st.Name.Func)
+		} else {
+			lt.expr(st.Name.Receiver)
+		}
+		lt.proc(st.Func, len(st.Name.Method) > 0)
+	case *qsa.ClassStmt:
+		if st.Base != nil {
+			lt.expr(st.Base)
+		}
+		for _, method := range st.Methods {
+			lt.proc(method.Func, true)
+		}
+		lt.assign(st.Name)
+	case *qsa.ReturnStmt:
+		for _, expr := range st.Exprs {
+			lt.expr(expr)
+		}
+	}
+}
+
+// assign - walks the target of an assignment, a name that is not a local
+// is a global assigned by the script
+func (lt *linter) assign(lhs qsa.Expr) {
+	id, ok := lhs.(*qsa.IdentExpr)
+	if !ok {
+		lt.expr(lhs)
+		return
+	}
+	if lt.find(id.Value) == nil {
+		lt.assigned[id.Value] = true
+	}
+}
+
+// proc - walks the parameters and statements of a proc, a method has the
+// parameter self
+func (lt *linter) proc(fn *qsa.ProcExpr, method bool) {
+	lt.enter()
+	if method {
+		lt.declare("self", fn, false)
+	}
+	for i, name := range fn.ParList.Names {
+		if def := fn.ParList.Default(i); def != nil {
+			lt.expr(def) // sees the parameters before it
+		}
+		lt.declare(name, fn, false)
+	}
+	lt.block(fn.Stmts)
+	lt.leave()
+}
+
+// expr - walks an expression
+func (lt *linter) expr(expr qsa.Expr) {
+	switch ex := expr.(type) {
+	case *qsa.IdentExpr:
+		if v := lt.find(ex.Value); v != nil {
+			v.used = true
+		} else {
+			lt.reads = append(lt.reads, ex)
+		}
+	case *qsa.ProcExpr:
+		lt.proc(ex, false)
+	case *qsa.AttrGetExpr:
+		lt.expr(ex.Object)
+		lt.expr(ex.Key)
+	case *qsa.OAListExpr:
+		for _, field := range ex.Fields {
+			if field.Key != nil {
+				lt.expr(field.Key)
+			}
+			lt.expr(field.Value)
+		}
+	case *qsa.FuncCallExpr:
+		if ex.Func != nil {
+			if id, ok := ex.Func.(*qsa.IdentExpr); ok && lt.find(id.Value) == nil {
+				lt.calls = append(lt.calls, ex)
+			}
+			lt.expr(ex.Func)
+		} else {
+			lt.expr(ex.Receiver)
+		}
+		for _, arg := range ex.Args {
+			lt.expr(arg)
+		}
+		for _, arg := range ex.Named {
+			lt.expr(arg.Value)
+		}
+	case *qsa.LogicalOpExpr:
+		lt.expr(ex.Lhs)
+		lt.expr(ex.Rhs)
+	case *qsa.RelationalOpExpr:
+		lt.expr(ex.Lhs)
+		lt.expr(ex.Rhs)
+	case *qsa.StringConcatOpExpr:
+		lt.expr(ex.Lhs)
+		lt.expr(ex.Rhs)
+	case *qsa.FStringExpr:
+		for _, part := range ex.Parts {
+			lt.expr(part)
+		}
+	case *qsa.FStringValue:
+		lt.expr(ex.Expr)
+	case *qsa.ArithmeticOpExpr:
+		lt.expr(ex.Lhs)
+		lt.expr(ex.Rhs)
+	case *qsa.UnaryMinusOpExpr:
+		lt.expr(ex.Expr)
+	case *qsa.UnaryNotOpExpr:
+		lt.expr(ex.Expr)
+	case *qsa.UnaryLenOpExpr:
+		lt.expr(ex.Expr)
+	case *qsa.UnaryBNotOpExpr:
+		lt.expr(ex.Expr)
+	}
+}
+
+// globals - reports the reads of undefined globals and the builtin calls
+// with a wrong number of arguments, once the whole script has been walked
+func (lt *linter) globals() {
+	for _, id := range lt.reads {
+		if !lt.assigned[id.Value] && !defaultGlobals()[id.Value] {
+			lt.report(id, "undefined", "undefined global '%s'", id.Value)
+		}
+	}
+	for _, call := range lt.calls {
+		name := call.Func.(*qsa.IdentExpr).Value
+		arity, ok := lintArity[name]
+		if !ok || lt.assigned[name] {
+			continue
+		}
+		n, multi := len(call.Args), false
+		if len(call.Named) > 0 {
+			lt.report(call, "arity", "%s called with named arguments, it takes none", name)
+			continue
+		}
+		if n > 0 {
+			switch call.Args[n-1].(type) {
+			case *qsa.FuncCallExpr, *qsa.Comma3Expr:
+				n, multi = n-1, true // any number of values
+			}
+		}
+		if (n < arity[0] && !multi) || (arity[1] >= 0 && n > arity[1]) {
+			lt.report(call, "arity", "%s called with %s, it takes %s", name,
+				lintCount(n, "argument"), lintRange(arity[0], arity[1]))
+		}
+	}
+}
+
+// lintCount - returns like "1 argument" or "2 arguments"
+func lintCount(n int, what string) string {
+	if n == 1 {
+		return "1 " + what
+	}
+	return fmt.Sprintf("%d %ss", n, what)
+}
+
+// lintRange - returns the argument counts from min to max as text
+func lintRange(min, max int) string {
+	switch {
+	case max < 0:
+		return fmt.Sprintf("at least %d", min)
+	case min == max:
+		return fmt.Sprintf("%d", min)
+	}
+	return fmt.Sprintf("%d to %d", min, max)
+}
+
+// suppress - returns the issues not suppressed by a lint:ignore comment
+func (lt *linter) suppress() []*LintIssue {
+	ignore := map[int][]string{} // the checks ignored on a line, empty for all
+	for i, text := range lt.lines {
+		at := strings.Index(text, "lint:ignore")
+		if at < 0 || !strings.ContainsAny(text[:at], "-/#") {
+			continue
+		}
+		checks := strings.Fields(strings.Replace(text[at+len("lint:ignore"):], "*/", " ", -1))
+		if checks == nil {
+			checks = []string{}
+		}
+		ignore[i+1] = checks
+		if trim := strings.TrimSpace(text); strings.HasPrefix(trim, "--") || strings.HasPrefix(trim, "//") ||
+			strings.HasPrefix(trim, "#") || strings.HasPrefix(trim, "/*") {
+			ignore[i+2] = checks
+		}
+	}
+	issues := []*LintIssue{}
+	for _, issue := range lt.issues {
+		if checks, ok := ignore[issue.Line]; ok {
+			if len(checks) == 0 || containsString(checks, issue.Check) {
+				continue
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// containsString - reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package qs
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLintErrorIssue - sources that do not parse or compile are reported as
+// issues of check syntax or compile at the position of the error
+func TestLintErrorIssue(t *testing.T) {
+	for _, tc := range []struct {
+		src, check string
+		line       int
+		message    string
+	}{
+		{"dcl x = = 1\n", "syntax", 1, "near '='"},
+		{"proc f(\n", "syntax", 0, "at the end of the input"},
+		{"proc f()\n  continue\nend\n", "compile", 2, "no loop to continue"},
+	} {
+		_, err := Lint([]byte(tc.src), "t.q")
+		if err == nil {
+			t.Errorf("%q: no lint error", tc.src)
+			continue
+		}
+		issue := LintErrorIssue(err, "t.q")
+		if issue.File != "t.q" || issue.Check != tc.check || issue.Line != tc.line ||
+			!strings.Contains(issue.Message, tc.message) {
+			t.Errorf("%q: issue %+v, want check %s at line %d with %q", tc.src, issue, tc.check, tc.line, tc.message)
+		}
+	}
+}
+
+// TestLintArity - every builtin has argument counts, and calls with too few
+// or too many arguments are reported
+func TestLintArity(t *testing.T) {
+	for name := range baseFuncs {
+		if _, ok := lintArity[name]; !ok && name != "_printregs" {
+			t.Errorf("builtin %s has no argument counts", name)
+		}
+	}
+	issues, err := Lint([]byte(`put(abs(1, 2), abs(), rep("x"), format())
+put(abs(1), rep("x", 2), format("%d", 1), max(1, 2, 3), insert({}, 1))
+put(sort({}), random(), date("%c"), concat({}, ", "), unpack(keys({})))
+`), "t.q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"abs called with 2 arguments, it takes 1",
+		"abs called with 0 arguments, it takes 1",
+		"rep called with 1 argument, it takes 2",
+		"format called with 0 arguments, it takes at least 1",
+	}
+	var got []string
+	for _, issue := range issues {
+		if issue.Check == "arity" {
+			got = append(got, issue.Message)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("arity issues:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -1,6 +1,8 @@
 // Package qs - q scripting language
 package qs
 
+import "math"
+
 const defaultArrayCap = 32
 const defaultHashCap = 32
 
@@ -32,17 +34,39 @@ func (lv lValueArraySorter) Less(i, j int) bool {
 	return lessThan(lv.L, lv.Values[i], lv.Values[j])
 }
 
-// newLOAList - creates a new OAList
-func newLOAList(acap int, hcap int) *LOAList {
+// integerKey - returns the key used for an integer, nums that are exact
+// as a float share their key with the float
+func integerKey(v LInteger) LValue {
+	if v >= -(1<<53) && v <= 1<<53 {
+		return LNumber(v)
+	}
+	return v
+}
+
+// numberKey - returns the key used for a num, a float with the exact value
+// of an integer outside the range of integerKey shares its key with it
+func numberKey(v LNumber) LValue {
+	f := float64(v)
+	if (f > 1<<53 || f < -(1<<53)) && f >= -(1<<63) && f < 1<<63 && f == math.Trunc(f) {
+		return LInteger(int64(f))
+	}
+	return v
+}
+
+// newLOAList - creates a new OAList, its size and growth are charged to the
+// memory budget of al, which may be nil for lists that are not accounted
+func newLOAList(al *allocator, acap int, hcap int) *LOAList {
 	if acap < 0 {
 		acap = 0
 	}
 	if hcap < 0 {
 		hcap = 0
 	}
+	al.account(memListSize + acap*memSlotSize)
 	lst := &LOAList{}
 	lst.keys = nil
 	lst.k2i = nil
+	lst.alloc = al
 	lst.Metalist = LNil
 	if acap != 0 {
 		lst.array = make([]LValue, 0, acap)
@@ -53,6 +77,26 @@ func newLOAList(acap int, hcap int) *LOAList {
 	return lst
 }
 
+// reserve - makes room for n elements in the array part, the growth is
+// charged before it is allocated
+func (lst *LOAList) reserve(n int) {
+	c := cap(lst.array)
+	if n <= c {
+		return
+	}
+	nc := c * 2
+	if nc < n {
+		nc = n
+	}
+	if nc < defaultArrayCap {
+		nc = defaultArrayCap
+	}
+	lst.alloc.account((nc - c) * memSlotSize)
+	array := make([]LValue, len(lst.array), nc)
+	copy(array, lst.array)
+	lst.array = array
+}
+
 // Len - returns length of this LOAList.
 func (lst *LOAList) Len() int {
 	if lst.array == nil {
@@ -71,17 +115,13 @@ func (lst *LOAList) Len() int {
 
 // Append - appends a given LValue to this LOAList.
 func (lst *LOAList) Append(value LValue) {
-	if lst.array == nil {
-		lst.array = make([]LValue, 0, defaultArrayCap)
-	}
+	lst.reserve(len(lst.array) + 1)
 	lst.array = append(lst.array, value)
 }
 
 // Insert - inserts a given LValue at position `i` in this list.
 func (lst *LOAList) Insert(i int, value LValue) {
-	if lst.array == nil {
-		lst.array = make([]LValue, 0, defaultArrayCap)
-	}
+	lst.reserve(len(lst.array) + 1)
 	if i > len(lst.array) {
 		lst.RawSetInt(i, value)
 		return
@@ -137,13 +177,19 @@ func (lst *LOAList) Remove(pos int) LValue {
 // if you already know the given LValue is a string or number.
 func (lst *LOAList) RawSet(key LValue, value LValue) {
 	switch v := key.(type) {
+	case LInteger:
+		if v > 0 && v < LInteger(MaxArrayIndex) {
+			lst.RawSetInt(int(v), value)
+			return
+		}
+		key = integerKey(v)
 	case LNumber:
 		if isArrayKey(v) {
-			if lst.array == nil {
-				lst.array = make([]LValue, 0, defaultArrayCap)
-			}
 			index := int(v) - 1
 			alen := len(lst.array)
+			if index >= alen {
+				lst.reserve(index + 1)
+			}
 			switch {
 			case index == alen:
 				lst.array = append(lst.array, value)
@@ -157,6 +203,7 @@ func (lst *LOAList) RawSet(key LValue, value LValue) {
 			}
 			return
 		}
+		key = numberKey(v)
 	case LString:
 		lst.RawSetString(string(v), value)
 		return
@@ -171,11 +218,11 @@ func (lst *LOAList) RawSetInt(key int, value LValue) {
 		lst.RawSetH(LNumber(key), value)
 		return
 	}
-	if lst.array == nil {
-		lst.array = make([]LValue, 0, 32)
-	}
 	index := key - 1
 	alen := len(lst.array)
+	if index >= alen {
+		lst.reserve(index + 1)
+	}
 	switch {
 	case index == alen:
 		lst.array = append(lst.array, value)
@@ -197,7 +244,11 @@ func (lst *LOAList) RawSetString(key string, value LValue) {
 	if value == LNil {
 		delete(lst.strdict, key)
 	} else {
+		n := len(lst.strdict)
 		lst.strdict[key] = value
+		if len(lst.strdict) > n {
+			lst.alloc.account(memEntrySize + len(key))
+		}
 	}
 }
 
@@ -207,6 +258,12 @@ func (lst *LOAList) RawSetH(key LValue, value LValue) {
 		lst.RawSetString(string(s), value)
 		return
 	}
+	switch v := key.(type) {
+	case LInteger:
+		key = integerKey(v)
+	case LNumber:
+		key = numberKey(v)
+	}
 	if lst.dict == nil {
 		lst.dict = make(map[LValue]LValue, len(lst.strdict))
 	}
@@ -214,13 +271,22 @@ func (lst *LOAList) RawSetH(key LValue, value LValue) {
 	if value == LNil {
 		delete(lst.dict, key)
 	} else {
+		n := len(lst.dict)
 		lst.dict[key] = value
+		if len(lst.dict) > n {
+			lst.alloc.account(memEntrySize)
+		}
 	}
 }
 
 // RawGet - returns an LValue associated with a given key without __index metamethod.
 func (lst *LOAList) RawGet(key LValue) LValue {
 	switch v := key.(type) {
+	case LInteger:
+		if v > 0 && v < LInteger(MaxArrayIndex) {
+			return lst.RawGetInt(int(v))
+		}
+		key = integerKey(v)
 	case LNumber:
 		if isArrayKey(v) {
 			if lst.array == nil {
@@ -232,6 +298,7 @@ func (lst *LOAList) RawGet(key LValue) LValue {
 			}
 			return lst.array[index]
 		}
+		key = numberKey(v)
 	case LString:
 		if lst.strdict == nil {
 			return LNil
@@ -273,6 +340,12 @@ func (lst *LOAList) RawGetH(key LValue) LValue {
 		}
 		return LNil
 	}
+	switch v := key.(type) {
+	case LInteger:
+		key = integerKey(v)
+	case LNumber:
+		key = numberKey(v)
+	}
 	if lst.dict == nil {
 		return LNil
 	}
@@ -322,6 +395,12 @@ func (lst *LOAList) ForEach(cb func(LValue, LValue)) {
 func (lst *LOAList) Next(key LValue) (LValue, LValue) {
 	// TODO: inefficient way
 	init := false
+	switch v := key.(type) {
+	case LInteger:
+		key = integerKey(v)
+	case LNumber:
+		key = numberKey(v)
+	}
 	if key == LNil {
 		lst.keys = nil
 		lst.k2i = nil
@@ -0,0 +1,605 @@
+// package qslsp q language server protocol server
+package qslsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/x0ray/q/qs"
+	"github.com/x0ray/q/qs/qsp"
+)
+
+/*
+  The server speaks the Language Server Protocol used by editors like VS
+  Code and Neovim. Messages are JSON-RPC 2.0 with a Content-Length header.
+  Documents are synced whole, each change is parsed and compiled again and
+  the error is published as a diagnostic. Hover, completion, definitions
+  and document symbols use the symbols of the last version of a document
+  that parsed. The syntax tree has lines but no columns, so the column of
+  a declared name is found by searching its line.
+*/
+
+// LSP symbol and completion item kinds
+const (
+	symbolClass    = 5
+	symbolMethod   = 6
+	symbolFunction = 12
+	symbolVariable = 13
+
+	itemMethod   = 2
+	itemFunction = 3
+	itemVariable = 6
+	itemClass    = 7
+	itemModule   = 9
+
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+)
+
+// message - a JSON-RPC request, notification or response
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// position - a zero based line and character
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// span - an LSP range
+type span struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+// location - a range in a document
+type location struct {
+	URI   string `json:"uri"`
+	Range span   `json:"range"`
+}
+
+// diagnostic - an error in a document
+type diagnostic struct {
+	Range    span   `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// documentSymbol - a proc or dcl of a document
+type documentSymbol struct {
+	Name           string            `json:"name"`
+	Detail         string            `json:"detail,omitempty"`
+	Kind           int               `json:"kind"`
+	Range          span              `json:"range"`
+	SelectionRange span              `json:"selectionRange"`
+	Children       []*documentSymbol `json:"children,omitempty"`
+}
+
+// completionItem - a name offered for completion
+type completionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Detail        string `json:"detail,omitempty"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+// textPosition - the params of the requests at a position of a document
+type textPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+// document - an open document
+type document struct {
+	uri   string
+	lines []string
+	syms  *symbols // of the last version that parsed
+}
+
+// builtin - a global of a new state, with the members of a library
+type builtin struct {
+	name    string
+	kind    int
+	members []*builtin
+}
+
+// Server - a language server for one client
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	builtins map[string]*builtin
+}
+
+// NewServer - returns a server reading messages from r and writing to w
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{in: bufio.NewReader(r), out: w, docs: map[string]*document{}}
+}
+
+// Serve - handles messages until the exit notification or the end of the
+// input
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+// read - reads a message
+func (s *Server) read() (*message, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		if i := strings.Index(line, ":"); i > 0 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil {
+				return nil, fmt.Errorf("bad Content-Length header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.in, data); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("bad message: %v", err)
+	}
+	return msg, nil
+}
+
+// write - writes a message
+func (s *Server) write(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": msg["id"],
+			"error": map[string]interface{}{"code": -32603, "message": err.Error()}})
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// respond - writes the result of a request, result may be nil
+func (s *Server) respond(req *message, result interface{}) {
+	s.write(map[string]interface{}{"id": req.ID, "result": result})
+}
+
+// fail - writes an error response to a request
+func (s *Server) fail(req *message, code int, format string, a ...interface{}) {
+	s.write(map[string]interface{}{"id": req.ID,
+		"error": map[string]interface{}{"code": code, "message": fmt.Sprintf(format, a...)}})
+}
+
+// notify - writes a notification
+func (s *Server) notify(method string, params interface{}) {
+	s.write(map[string]interface{}{"method": method, "params": params})
+}
+
+// handle - handles a request or notification
+func (s *Server) handle(msg *message) {
+	isRequest := len(msg.ID) > 0
+	switch msg.Method {
+	case "initialize":
+		s.respond(msg, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // full
+				"hoverProvider":          true,
+				"completionProvider":     map[string]interface{}{"triggerCharacters": []string{".", ":"}},
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": qs.PGM, "version": qs.VER},
+		})
+	case "shutdown":
+		s.respond(msg, nil)
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params textPosition
+		if json.Unmarshal(msg.Params, &params) == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+				"uri": params.TextDocument.URI, "diagnostics": []diagnostic{}})
+		}
+	case "textDocument/hover", "textDocument/completion", "textDocument/definition", "textDocument/documentSymbol":
+		var params textPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.fail(msg, errInvalidParams, "bad params: %v", err)
+			return
+		}
+		doc := s.docs[params.TextDocument.URI]
+		if doc == nil {
+			s.respond(msg, nil)
+			return
+		}
+		switch msg.Method {
+		case "textDocument/hover":
+			s.respond(msg, s.hover(doc, params.Position))
+		case "textDocument/completion":
+			s.respond(msg, s.completion(doc, params.Position))
+		case "textDocument/definition":
+			s.respond(msg, s.definition(doc, params.Position))
+		default:
+			s.respond(msg, s.documentSymbols(doc))
+		}
+	default:
+		if isRequest {
+			s.fail(msg, errMethodNotFound, "method %s not supported", msg.Method)
+		}
+	}
+}
+
+// update - parses a new version of a document and publishes its errors
+func (s *Server) update(uri, text string) {
+	doc := s.docs[uri]
+	if doc == nil {
+		doc = &document{uri: uri}
+		s.docs[uri] = doc
+	}
+	doc.lines = strings.Split(text, "\n")
+	for i, line := range doc.lines {
+		doc.lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	diags := []diagnostic{}
+	name := uriPath(uri)
+	stmts, err := qsp.Parse(strings.NewReader(text), name)
+	if err == nil {
+		doc.syms = analyze(stmts, len(doc.lines))
+		_, err = qs.CompileSource([]byte(text), name)
+	}
+	if err != nil {
+		diags = append(diags, doc.diagnostic(err))
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diags})
+}
+
+// diagnostic - returns the diagnostic of a parse or compile error
+func (doc *document) diagnostic(err error) diagnostic {
+	d := diagnostic{Severity: 1, Source: "q", Message: strings.TrimSpace(err.Error())}
+	switch e := err.(type) {
+	case *qsp.Error:
+		d.Message = e.Message
+		if e.Pos.Line == qsp.EOF {
+			last := len(doc.lines) - 1
+			d.Message += " at the end of the input"
+			d.Range = span{position{last, 0}, position{last, len(doc.lines[last])}}
+			break
+		}
+		if len(e.Token) > 0 {
+			d.Message = fmt.Sprintf("%s near '%s'", e.Message, e.Token)
+		}
+		line, char := e.Pos.Line-1, e.Pos.Column-1
+		if char < 0 {
+			char = 0
+		}
+		width := len(e.Token)
+		if e.End.Line == e.Pos.Line && e.End.Column >= e.Pos.Column {
+			width = e.End.Column - e.Pos.Column + 1
+		}
+		if width == 0 {
+			width = 1
+		}
+		d.Range = span{position{line, char}, position{line, char + width}}
+	case *qs.CompileError:
+		d.Message = e.Message
+		d.Range = doc.lineSpan(e.Line)
+		if e.Column > 0 && e.LastLine >= e.Line {
+			d.Range = span{position{e.Line - 1, e.Column - 1}, position{e.LastLine - 1, e.LastColumn}}
+		}
+	}
+	return d
+}
+
+// lineSpan - returns the range of the text of a one based line
+func (doc *document) lineSpan(line int) span {
+	if line < 1 {
+		line = 1
+	}
+	if line > len(doc.lines) {
+		line = len(doc.lines)
+	}
+	text := doc.lines[line-1]
+	first := len(text) - len(strings.TrimLeft(text, " \t"))
+	return span{position{line - 1, first}, position{line - 1, len(text)}}
+}
+
+// nameSpan - returns the range of name on a one based line, a dotted name
+// is found by its last part
+func (doc *document) nameSpan(name string, line int) span {
+	if i := strings.LastIndexAny(name, ".:"); i >= 0 {
+		name = name[i+1:]
+	}
+	if line < 1 || line > len(doc.lines) {
+		return span{}
+	}
+	text := doc.lines[line-1]
+	for from := 0; from < len(text); {
+		i := strings.Index(text[from:], name)
+		if i < 0 {
+			break
+		}
+		start, end := from+i, from+i+len(name)
+		if (start == 0 || !isNameChar(text[start-1])) && (end == len(text) || !isNameChar(text[end])) {
+			return span{position{line - 1, start}, position{line - 1, end}}
+		}
+		from = end
+	}
+	return span{position{line - 1, 0}, position{line - 1, 0}}
+}
+
+// word - returns the name at pos with its library or list prefix, like
+// "i.open", and the part of it before pos
+func (doc *document) word(pos position) (word, before string) {
+	if pos.Line < 0 || pos.Line >= len(doc.lines) {
+		return "", ""
+	}
+	text := doc.lines[pos.Line]
+	at := pos.Character
+	if at > len(text) {
+		at = len(text)
+	}
+	start, end := at, at
+	for start > 0 && (isNameChar(text[start-1]) || (text[start-1] == '.' || text[start-1] == ':') &&
+		start > 1 && isNameChar(text[start-2])) {
+		start--
+	}
+	for end < len(text) && isNameChar(text[end]) {
+		end++
+	}
+	return text[start:end], text[start:at]
+}
+
+// isNameChar - reports if c can be part of a name
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// hover - returns the help of the name at pos
+func (s *Server) hover(doc *document, pos position) interface{} {
+	name, _ := doc.word(pos)
+	if len(name) == 0 {
+		return nil
+	}
+	var text string
+	if doc.syms != nil {
+		if sym := doc.syms.resolve(name, pos.Line+1); sym != nil {
+			text = "```q\n" + sym.detail + "\n```"
+		}
+	}
+	if len(text) == 0 {
+		if help, ok := s.builtinHelp(name); ok {
+			text = "```q\n" + help.Signature + "\n```\n" + help.Text
+		}
+	}
+	if len(text) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"contents": map[string]string{"kind": "markdown", "value": text}}
+}
+
+// builtinHelp - returns the help of a built in proc name, with the prefix
+// of a library or the receiver of a method call
+func (s *Server) builtinHelp(name string) (*qs.HelpDoc, bool) {
+	if i := strings.IndexAny(name, ".:"); i >= 0 && name[i] == '.' {
+		if lib := s.builtin(name[:i]); lib == nil || lib.kind != itemModule {
+			return nil, false
+		}
+	}
+	return qs.BuiltinHelp(name)
+}
+
+// builtin - returns the global name of a new state, or nil
+func (s *Server) builtin(name string) *builtin {
+	return s.loadBuiltins()[name]
+}
+
+// loadBuiltins - returns the globals of a new state, by name
+func (s *Server) loadBuiltins() map[string]*builtin {
+	if s.builtins != nil {
+		return s.builtins
+	}
+	s.builtins = map[string]*builtin{}
+	L := qs.NewState()
+	defer L.Close()
+	L.G.Global.ForEach(func(k, v qs.LValue) {
+		ks, ok := k.(qs.LString)
+		if !ok {
+			return
+		}
+		b := &builtin{name: string(ks), kind: valueKind(v)}
+		if lst, ok := v.(*qs.LOAList); ok {
+			lst.ForEach(func(mk, mv qs.LValue) {
+				if mks, ok := mk.(qs.LString); ok {
+					b.members = append(b.members, &builtin{name: string(mks), kind: valueKind(mv)})
+				}
+			})
+		}
+		s.builtins[b.name] = b
+	})
+	return s.builtins
+}
+
+// valueKind - returns the completion item kind of a value
+func valueKind(v qs.LValue) int {
+	switch v.Type() {
+	case qs.LTProc:
+		return itemFunction
+	case qs.LTOAList:
+		return itemModule
+	}
+	return itemVariable
+}
+
+// completion - returns the names that complete the word at pos
+func (s *Server) completion(doc *document, pos position) interface{} {
+	_, before := doc.word(pos)
+	prefix, partial := "", before
+	if i := strings.LastIndexAny(before, ".:"); i >= 0 {
+		prefix, partial = before[:i+1], before[i+1:]
+	}
+	items := []completionItem{}
+	seen := map[string]bool{}
+	add := func(item completionItem) {
+		if !seen[item.Label] && strings.HasPrefix(item.Label, partial) {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+	if doc.syms != nil {
+		if len(prefix) == 0 {
+			for _, sym := range doc.syms.visible(pos.Line + 1) {
+				add(completionItem{Label: sym.name, Kind: symItemKind(sym), Detail: sym.detail})
+			}
+		}
+		for _, sym := range doc.syms.globals {
+			if len(prefix) > 0 && strings.HasPrefix(sym.name, prefix) && !strings.ContainsAny(sym.name[len(prefix):], ".:") {
+				kind := symItemKind(sym)
+				if strings.HasSuffix(prefix, ":") {
+					kind = itemMethod
+				}
+				add(completionItem{Label: sym.name[len(prefix):], Kind: kind, Detail: sym.detail})
+			} else if len(prefix) == 0 && !strings.ContainsAny(sym.name, ".:") {
+				add(completionItem{Label: sym.name, Kind: symItemKind(sym), Detail: sym.detail})
+			}
+		}
+	}
+	var builtins []*builtin
+	if len(prefix) == 0 {
+		for _, b := range s.loadBuiltins() {
+			builtins = append(builtins, b)
+		}
+	} else if lib := s.builtin(prefix[:len(prefix)-1]); lib != nil && strings.HasSuffix(prefix, ".") {
+		builtins = lib.members
+	}
+	sort.Slice(builtins, func(i, j int) bool { return builtins[i].name < builtins[j].name })
+	for _, b := range builtins {
+		item := completionItem{Label: b.name, Kind: b.kind}
+		if help, ok := qs.BuiltinHelp(prefix + b.name); ok && b.kind == itemFunction {
+			item.Detail, item.Documentation = help.Signature, help.Text
+		}
+		add(item)
+	}
+	return items
+}
+
+// symItemKind - returns the completion item kind of a symbol
+func symItemKind(sym *symbol) int {
+	switch sym.kind {
+	case symProc, symMethod:
+		return itemFunction
+	case symClass:
+		return itemClass
+	}
+	return itemVariable
+}
+
+// definition - returns the location of the declaration of the name at pos
+func (s *Server) definition(doc *document, pos position) interface{} {
+	name, _ := doc.word(pos)
+	if len(name) == 0 || doc.syms == nil {
+		return nil
+	}
+	sym := doc.syms.resolve(name, pos.Line+1)
+	if sym == nil {
+		return nil
+	}
+	return location{URI: doc.uri, Range: doc.nameSpan(sym.name, sym.line)}
+}
+
+// documentSymbols - returns the procs and dcls of a document
+func (s *Server) documentSymbols(doc *document) interface{} {
+	if doc.syms == nil {
+		return []*documentSymbol{}
+	}
+	return doc.symbolTree(doc.syms.tree)
+}
+
+// symbolTree - returns the document symbols of syms and their children
+func (doc *document) symbolTree(syms []*symbol) []*documentSymbol {
+	dss := []*documentSymbol{}
+	for _, sym := range syms {
+		ds := &documentSymbol{Name: sym.name, Detail: sym.detail, Kind: symbolVariable,
+			SelectionRange: doc.nameSpan(sym.name, sym.line)}
+		switch sym.kind {
+		case symProc:
+			ds.Kind = symbolFunction
+			if strings.Contains(sym.name, ":") {
+				ds.Kind = symbolMethod
+			}
+		case symMethod:
+			ds.Kind = symbolMethod
+		case symClass:
+			ds.Kind = symbolClass
+		}
+		ds.Range = doc.lineSpan(sym.line)
+		if sym.last > sym.line {
+			ds.Range.End = doc.lineSpan(sym.last).End
+		}
+		if ds.SelectionRange.Start.Character < ds.Range.Start.Character {
+			ds.Range.Start = ds.SelectionRange.Start
+		}
+		if len(sym.children) > 0 {
+			ds.Children = doc.symbolTree(sym.children)
+		}
+		dss = append(dss, ds)
+	}
+	return dss
+}
+
+// uriPath - returns the file path of a file URI, or the URI
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
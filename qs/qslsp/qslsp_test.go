@@ -0,0 +1,236 @@
+package qslsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testURI = "file:///tmp/lsp.q"
+
+const testScript = `// lsp test script
+proc add(a, b)
+  dcl s = a + b
+  return s
+end
+dcl total = add(1, 2)
+put(total)
+`
+
+// testClient - a scripted LSP client talking to a server over pipes
+type testClient struct {
+	t             *testing.T
+	w             io.Writer
+	r             *bufio.Reader
+	msgs          chan map[string]interface{}
+	id            int
+	notifications []map[string]interface{}
+	done          chan error
+}
+
+// newTestClient - starts a server for the client
+func newTestClient(t *testing.T) *testClient {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	c := &testClient{t: t, w: cw, r: bufio.NewReader(cr), done: make(chan error, 1),
+		msgs: make(chan map[string]interface{}, 100)}
+	go func() {
+		err := NewServer(sr, sw).Serve()
+		sw.Close()
+		c.done <- err
+	}()
+	go c.readAll()
+	return c
+}
+
+// readAll - reads the messages from the server, so the server never waits
+// for the client to read them
+func (c *testClient) readAll() {
+	defer close(c.msgs)
+	for {
+		length := -1
+		for {
+			line, err := c.r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if len(line) == 0 {
+				break
+			}
+			if strings.HasPrefix(line, "Content-Length:") {
+				length, _ = strconv.Atoi(strings.TrimSpace(line[len("Content-Length:"):]))
+			}
+		}
+		if length < 0 {
+			return
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return
+		}
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			msg = map[string]interface{}{"method": "bad", "data": string(data)}
+		}
+		c.msgs <- msg
+	}
+}
+
+// read - returns the next message from the server
+func (c *testClient) read() map[string]interface{} {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	return nil
+}
+
+// send - writes a message to the server
+func (c *testClient) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	data, _ := json.Marshal(msg)
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// notify - sends a notification
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+// request - sends a request and returns its result, keeping the
+// notifications read before it
+func (c *testClient) request(method string, params interface{}) interface{} {
+	c.id++
+	c.send(map[string]interface{}{"id": c.id, "method": method, "params": params})
+	for {
+		msg := c.read()
+		if _, ok := msg["id"]; !ok {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if id, _ := msg["id"].(float64); int(id) != c.id {
+			c.t.Fatalf("unexpected message %v", msg)
+		}
+		if msg["error"] != nil {
+			c.t.Fatalf("%s failed: %v", method, msg["error"])
+		}
+		return msg["result"]
+	}
+}
+
+// diagnostics - waits for the next diagnostics published for a document
+func (c *testClient) diagnostics() []interface{} {
+	msg := c.read()
+	if msg["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("unexpected message %v", msg)
+	}
+	params := msg["params"].(map[string]interface{})
+	if params["uri"] != testURI {
+		c.t.Fatalf("diagnostics for %v", params["uri"])
+	}
+	return params["diagnostics"].([]interface{})
+}
+
+// jsonText - returns v as JSON, with the keys of objects sorted
+func jsonText(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// at - returns the params of a request at a position of the test document
+func at(line, char int) map[string]interface{} {
+	return map[string]interface{}{"textDocument": map[string]string{"uri": testURI},
+		"position": map[string]int{"line": line, "character": char}}
+}
+
+// TestRoundTrip - a session opens a document with an error, fixes it and
+// asks for hover, definition and document symbols
+func TestRoundTrip(t *testing.T) {
+	c := newTestClient(t)
+	result := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	caps := result.(map[string]interface{})["capabilities"].(map[string]interface{})
+	for _, cap := range []string{"hoverProvider", "definitionProvider", "documentSymbolProvider"} {
+		if caps[cap] != true {
+			t.Errorf("capability %s is %v", cap, caps[cap])
+		}
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	broken := strings.Replace(testScript, "a + b", "a +", 1)
+	c.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": testURI, "languageId": "q", "version": 1, "text": broken}})
+	diags := c.diagnostics()
+	want := `[{"message":"syntax error near 'return'","range":{"end":{"character":8,"line":3},"start":{"character":2,"line":3}},"severity":1,"source":"q"}]`
+	if got := jsonText(diags); got != want {
+		t.Errorf("didOpen diagnostics %s, want %s", got, want)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []interface{}{map[string]string{"text": testScript}}})
+	if diags = c.diagnostics(); len(diags) != 0 {
+		t.Errorf("didChange diagnostics %s, want none", jsonText(diags))
+	}
+
+	hovers := []struct {
+		line, char int
+		want       string
+	}{
+		{5, 13, "```q\nproc add(a, b)\n```"},             // a proc of the document
+		{6, 1, "```q\nput(a:str,b:str,...)\n```\nWrite"}, // a built in proc
+	}
+	for _, h := range hovers {
+		result := c.request("textDocument/hover", at(h.line, h.char))
+		hover, _ := result.(map[string]interface{})
+		contents, _ := hover["contents"].(map[string]interface{})
+		if value, _ := contents["value"].(string); !strings.HasPrefix(value, h.want) {
+			t.Errorf("hover at %d:%d is %q, want %q", h.line, h.char, value, h.want)
+		}
+	}
+	if result := c.request("textDocument/hover", at(0, 0)); result != nil {
+		t.Errorf("hover in a comment is %s", jsonText(result))
+	}
+
+	want = `{"range":{"end":{"character":9,"line":5},"start":{"character":4,"line":5}},"uri":"` + testURI + `"}`
+	if got := jsonText(c.request("textDocument/definition", at(6, 6))); got != want {
+		t.Errorf("definition of total %s, want %s", got, want)
+	}
+
+	want = `[{"children":[{"detail":"dcl s","kind":13,"name":"s",` +
+		`"range":{"end":{"character":15,"line":2},"start":{"character":2,"line":2}},` +
+		`"selectionRange":{"end":{"character":7,"line":2},"start":{"character":6,"line":2}}}],` +
+		`"detail":"proc add(a, b)","kind":12,"name":"add",` +
+		`"range":{"end":{"character":3,"line":4},"start":{"character":0,"line":1}},` +
+		`"selectionRange":{"end":{"character":8,"line":1},"start":{"character":5,"line":1}}},` +
+		`{"detail":"dcl total","kind":13,"name":"total",` +
+		`"range":{"end":{"character":21,"line":5},"start":{"character":0,"line":5}},` +
+		`"selectionRange":{"end":{"character":9,"line":5},"start":{"character":4,"line":5}}}]`
+	if got := jsonText(c.request("textDocument/documentSymbol", at(0, 0))); got != want {
+		t.Errorf("document symbols\n%s\nwant\n%s", got, want)
+	}
+	if len(c.notifications) != 0 {
+		t.Errorf("unexpected notifications %s", jsonText(c.notifications))
+	}
+
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not exit")
+	}
+}
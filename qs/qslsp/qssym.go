@@ -0,0 +1,436 @@
+// package qslsp q language server protocol server
+package qslsp
+
+import (
+	"strings"
+
+	"github.com/x0ray/q/qs/qsa"
+)
+
+/*
+  The symbols of a document are found by walking its syntax tree. A local,
+  declared by dcl, a proc parameter or a for statement, is visible from its
+  declaration line to the last line of the block holding it. A global is
+  named by a proc statement or by the first assignment to a name that is
+  not a visible local.
+*/
+
+type symKind int
+
+const (
+	symVar symKind = iota
+	symProc
+	symParam
+	symClass
+	symMethod // a proc of a class
+)
+
+// symbol - a name declared in a document
+type symbol struct {
+	name     string // like "add", "M.add" or "obj:show"
+	kind     symKind
+	local    bool
+	line     int // line of the declaration
+	last     int // last line of the declaration, the end of a proc
+	scope    int // last line a local is visible on
+	detail   string
+	children []*symbol // the procs and dcls in a proc
+}
+
+// symbols - the symbols of a document
+type symbols struct {
+	locals  []*symbol
+	globals []*symbol // in order of definition
+	global  map[string]*symbol
+	tree    []*symbol // the procs and dcls, for document symbols
+}
+
+// analyze - returns the symbols of the statements of a document with
+// lines lines
+func analyze(stmts []qsa.Stmt, lines int) *symbols {
+	s := &symbols{global: map[string]*symbol{}}
+	s.block(stmts, lines, &s.tree)
+	return s
+}
+
+// lookup - returns the local name visible on line, or nil
+func (s *symbols) lookup(name string, line int) *symbol {
+	var found *symbol
+	for _, sym := range s.locals {
+		if sym.name == name && sym.line <= line && line <= sym.scope {
+			if found == nil || sym.line >= found.line {
+				found = sym
+			}
+		}
+	}
+	return found
+}
+
+// visible - returns the locals visible on line, the innermost one of each
+// name
+func (s *symbols) visible(line int) []*symbol {
+	var syms []*symbol
+	seen := map[string]bool{}
+	for i := len(s.locals) - 1; i >= 0; i-- {
+		sym := s.locals[i]
+		if seen[sym.name] || sym.line > line || line > sym.scope {
+			continue
+		}
+		if inner := s.lookup(sym.name, line); inner != nil {
+			seen[sym.name] = true
+			syms = append(syms, inner)
+		}
+	}
+	return syms
+}
+
+// resolve - returns the symbol name refers to on line, a visible local
+// before a global
+func (s *symbols) resolve(name string, line int) *symbol {
+	if !strings.ContainsAny(name, ".:") {
+		if sym := s.lookup(name, line); sym != nil {
+			return sym
+		}
+	}
+	return s.global[name]
+}
+
+// addGlobal - records the first definition of a global
+func (s *symbols) addGlobal(sym *symbol) {
+	if _, ok := s.global[sym.name]; !ok {
+		s.global[sym.name] = sym
+		s.globals = append(s.globals, sym)
+	}
+}
+
+// addLocal - records a local visible to the line scope
+func (s *symbols) addLocal(name string, kind symKind, line, scope int, detail string) *symbol {
+	sym := &symbol{name: name, kind: kind, local: true, line: line, last: line, scope: scope, detail: detail}
+	s.locals = append(s.locals, sym)
+	return sym
+}
+
+// patternNames - returns the names a destructuring pattern declares
+func patternNames(pat *qsa.Pattern) []string {
+	if pat.Rest == "" {
+		return pat.Names
+	}
+	return append(append([]string{}, pat.Names...), pat.Rest)
+}
+
+// block - walks the statements of a block ending on line end
+func (s *symbols) block(stmts []qsa.Stmt, end int, tree *[]*symbol) {
+	for _, stmt := range stmts {
+		s.stmt(stmt, end, tree)
+	}
+}
+
+// stmt - walks a statement of a block ending on line end
+func (s *symbols) stmt(stmt qsa.Stmt, end int, tree *[]*symbol) {
+	switch st := stmt.(type) {
+	case *qsa.LocalAssignStmt:
+		syms := make([]*symbol, len(st.Names))
+		for i, name := range st.Names {
+			if st.Patterns != nil && st.Patterns[i] != nil {
+				for _, name := range patternNames(st.Patterns[i]) {
+					sym := s.addLocal(name, symVar, st.Line(), end, "dcl "+name)
+					sym.last = st.LastLine()
+					*tree = append(*tree, sym)
+				}
+				continue
+			}
+			sym := s.addLocal(name, symVar, st.Line(), end, "dcl "+name)
+			if st.LastLine() > sym.last {
+				sym.last = st.LastLine()
+			}
+			if i < len(st.Exprs) {
+				if fn, ok := st.Exprs[i].(*qsa.ProcExpr); ok {
+					sym.kind = symProc
+					sym.detail = "dcl proc " + name + parText(fn.ParList)
+					if fn.LastLine() > sym.last {
+						sym.last = fn.LastLine()
+					}
+				}
+			}
+			syms[i] = sym
+			*tree = append(*tree, sym)
+		}
+		for i, expr := range st.Exprs {
+			if fn, ok := expr.(*qsa.ProcExpr); ok && i < len(syms) && syms[i] != nil {
+				s.proc(fn, false, &syms[i].children)
+			} else {
+				s.expr(expr, tree)
+			}
+		}
+	case *qsa.GlobalStmt:
+		for i, name := range st.Names {
+			sym := &symbol{name: name, kind: symVar, line: st.Line(), last: st.LastLine(), detail: "global " + name}
+			if i < len(st.Exprs) {
+				if fn, ok := st.Exprs[i].(*qsa.ProcExpr); ok {
+					sym.kind = symProc
+					sym.detail = "global proc " + name + parText(fn.ParList)
+				}
+			}
+			s.addGlobal(sym)
+			*tree = append(*tree, sym)
+		}
+		for i, expr := range st.Exprs {
+			if fn, ok := expr.(*qsa.ProcExpr); ok && i < len(st.Names) {
+				s.proc(fn, false, &s.global[st.Names[i]].children)
+			} else {
+				s.expr(expr, tree)
+			}
+		}
+	case *qsa.FuncDefStmt:
+		name := funcName(st.Name)
+		sym := &symbol{name: name, kind: symProc, line: st.Line(), last: st.Func.LastLine(),
+			detail: "proc " + name + parText(st.Func.ParList)}
+		if id, ok := st.Name.Func.(*qsa.IdentExpr); ok && s.lookup(id.Value, st.Line()) != nil {
+			sym.local = true // sets a local proc
+		} else if len(name) > 0 {
+			s.addGlobal(sym)
+		}
+		*tree = append(*tree, sym)
+		s.proc(st.Func, len(st.Name.Method) > 0, &sym.children)
+	case *qsa.ClassStmt:
+		s.expr(st.Base, tree)
+		name := st.Name.Value
+		sym := &symbol{name: name, kind: symClass, line: st.Line(), last: st.LastLine(), detail: "class " + name}
+		if s.lookup(name, st.Line()) != nil {
+			sym.local = true // sets a local class
+		} else {
+			s.addGlobal(sym)
+		}
+		*tree = append(*tree, sym)
+		for _, method := range st.Methods {
+			msym := &symbol{name: method.Name, kind: symMethod, line: method.Line(), last: method.LastLine(),
+				detail: "proc " + name + ":" + method.Name + parText(method.Func.ParList)}
+			sym.children = append(sym.children, msym)
+			s.proc(method.Func, true, &msym.children)
+		}
+	case *qsa.AssignStmt:
+		for i, lhs := range st.Lhs {
+			if id, ok := lhs.(*qsa.IdentExpr); ok {
+				if s.lookup(id.Value, st.Line()) == nil {
+					sym := &symbol{name: id.Value, kind: symVar, line: st.Line(), last: st.Line(), detail: "global " + id.Value}
+					if i < len(st.Rhs) {
+						if fn, ok := st.Rhs[i].(*qsa.ProcExpr); ok {
+							sym.kind = symProc
+							sym.last = fn.LastLine()
+							sym.detail = "proc " + id.Value + parText(fn.ParList)
+						}
+					}
+					s.addGlobal(sym)
+				}
+				continue
+			}
+			s.expr(lhs, tree)
+		}
+		for _, expr := range st.Rhs {
+			s.expr(expr, tree)
+		}
+	case *qsa.CompoundAssignStmt:
+		s.expr(st.Lhs, tree)
+		s.expr(st.Rhs, tree)
+	case *qsa.FuncCallStmt:
+		s.expr(st.Expr, tree)
+	case *qsa.DeferStmt:
+		s.expr(st.Expr, tree)
+	case *qsa.DoBlockStmt:
+		s.block(st.Stmts, st.LastLine(), tree)
+	case *qsa.WhileStmt:
+		s.expr(st.Condition, tree)
+		s.block(st.Stmts, st.LastLine(), tree)
+	case *qsa.RepeatStmt:
+		s.block(st.Stmts, st.LastLine(), tree)
+		s.expr(st.Condition, tree)
+	case *qsa.IfStmt:
+		s.ifStmt(st, end, tree)
+	case *qsa.SwitchStmt:
+		s.expr(st.Subject, tree)
+		for i, c := range st.Cases {
+			for _, value := range c.Values {
+				s.expr(value, tree)
+			}
+			caseEnd := st.LastLine()
+			if i+1 < len(st.Cases) {
+				caseEnd = st.Cases[i+1].Line() - 1
+			} else if len(st.Else) > 0 {
+				caseEnd = st.Else[0].Line() - 1
+			}
+			s.block(c.Stmts, caseEnd, tree)
+		}
+		s.block(st.Else, st.LastLine(), tree)
+	case *qsa.TryStmt:
+		tryEnd := st.LastLine()
+		if st.Catch != nil {
+			tryEnd = st.Catch.Line() - 1
+		} else if st.Finally != nil {
+			tryEnd = st.Finally.Line() - 1
+		}
+		s.block(st.Stmts, tryEnd, tree)
+		if c := st.Catch; c != nil {
+			catchEnd := st.LastLine()
+			if st.Finally != nil {
+				catchEnd = st.Finally.Line() - 1
+			}
+			if len(c.Name) > 0 {
+				s.addLocal(c.Name, symVar, c.Line(), catchEnd, "catch "+c.Name)
+			}
+			s.block(c.Stmts, catchEnd, tree)
+		}
+		if st.Finally != nil {
+			s.block(st.Finally.Stmts, st.LastLine(), tree)
+		}
+	case *qsa.NumberForStmt:
+		s.expr(st.Init, tree)
+		s.expr(st.Limit, tree)
+		s.expr(st.Step, tree)
+		s.addLocal(st.Name, symVar, st.Line(), st.LastLine(), "for "+st.Name)
+		s.block(st.Stmts, st.LastLine(), tree)
+	case *qsa.GenericForStmt:
+		for _, expr := range st.Exprs {
+			s.expr(expr, tree)
+		}
+		for i, name := range st.Names {
+			if st.Patterns != nil && st.Patterns[i] != nil {
+				for _, name := range patternNames(st.Patterns[i]) {
+					s.addLocal(name, symVar, st.Line(), st.LastLine(), "for "+name)
+				}
+				continue
+			}
+			s.addLocal(name, symVar, st.Line(), st.LastLine(), "for "+name)
+		}
+		s.block(st.Stmts, st.LastLine(), tree)
+	case *qsa.ReturnStmt:
+		for _, expr := range st.Exprs {
+			s.expr(expr, tree)
+		}
+	}
+}
+
+// ifStmt - walks an if statement, an elseif is an if statement ending
+// with the end of the one before in its else part
+func (s *symbols) ifStmt(st *qsa.IfStmt, end int, tree *[]*symbol) {
+	last := st.LastLine()
+	if last == 0 {
+		last = end
+	}
+	s.expr(st.Condition, tree)
+	thenEnd := last
+	if len(st.Else) > 0 {
+		thenEnd = st.Else[0].Line() - 1
+	}
+	s.block(st.Then, thenEnd, tree)
+	if len(st.Else) == 1 {
+		if elseif, ok := st.Else[0].(*qsa.IfStmt); ok && elseif.LastLine() == st.LastLine() &&
+			elseif.LastColumn() == st.LastColumn() {
+			s.ifStmt(elseif, last, tree)
+			return
+		}
+	}
+	s.block(st.Else, last, tree)
+}
+
+// proc - walks the parameters and statements of a proc, a method has the
+// parameter self
+func (s *symbols) proc(fn *qsa.ProcExpr, method bool, tree *[]*symbol) {
+	if method {
+		s.addLocal("self", symParam, fn.Line(), fn.LastLine(), "param self")
+	}
+	for i, name := range fn.ParList.Names {
+		s.expr(fn.ParList.Default(i), tree)
+		s.addLocal(name, symParam, fn.Line(), fn.LastLine(), "param "+name)
+	}
+	s.block(fn.Stmts, fn.LastLine(), tree)
+}
+
+// expr - walks an expression for the procs in it
+func (s *symbols) expr(expr qsa.Expr, tree *[]*symbol) {
+	switch ex := expr.(type) {
+	case *qsa.ProcExpr:
+		s.proc(ex, false, tree)
+	case *qsa.AttrGetExpr:
+		s.expr(ex.Object, tree)
+		s.expr(ex.Key, tree)
+	case *qsa.OAListExpr:
+		for _, field := range ex.Fields {
+			s.expr(field.Key, tree)
+			s.expr(field.Value, tree)
+		}
+	case *qsa.FuncCallExpr:
+		s.expr(ex.Func, tree)
+		s.expr(ex.Receiver, tree)
+		for _, arg := range ex.Args {
+			s.expr(arg, tree)
+		}
+		for _, arg := range ex.Named {
+			s.expr(arg.Value, tree)
+		}
+	case *qsa.LogicalOpExpr:
+		s.expr(ex.Lhs, tree)
+		s.expr(ex.Rhs, tree)
+	case *qsa.RelationalOpExpr:
+		s.expr(ex.Lhs, tree)
+		s.expr(ex.Rhs, tree)
+	case *qsa.StringConcatOpExpr:
+		s.expr(ex.Lhs, tree)
+		s.expr(ex.Rhs, tree)
+	case *qsa.FStringExpr:
+		for _, part := range ex.Parts {
+			s.expr(part, tree)
+		}
+	case *qsa.FStringValue:
+		s.expr(ex.Expr, tree)
+	case *qsa.ArithmeticOpExpr:
+		s.expr(ex.Lhs, tree)
+		s.expr(ex.Rhs, tree)
+	case *qsa.UnaryMinusOpExpr:
+		s.expr(ex.Expr, tree)
+	case *qsa.UnaryNotOpExpr:
+		s.expr(ex.Expr, tree)
+	case *qsa.UnaryLenOpExpr:
+		s.expr(ex.Expr, tree)
+	case *qsa.UnaryBNotOpExpr:
+		s.expr(ex.Expr, tree)
+	}
+}
+
+// funcName - returns the name of a proc statement, like "add", "M.add"
+// or "obj:show"
+func funcName(fn *qsa.FuncName) string {
+	if fn.Func != nil {
+		return exprName(fn.Func)
+	}
+	name := exprName(fn.Receiver)
+	if len(name) == 0 {
+		return ""
+	}
+	return name + ":" + fn.Method
+}
+
+// exprName - returns the dotted name of a name or list item expression,
+// or "" when it is not one
+func exprName(expr qsa.Expr) string {
+	switch ex := expr.(type) {
+	case *qsa.IdentExpr:
+		return ex.Value
+	case *qsa.AttrGetExpr:
+		key, ok := ex.Key.(*qsa.StringExpr)
+		obj := exprName(ex.Object)
+		if !ok || len(obj) == 0 {
+			return ""
+		}
+		return obj + "." + key.Value
+	}
+	return ""
+}
+
+// parText - returns the parameter list of a proc as written
+func parText(pars *qsa.ParList) string {
+	names := append([]string{}, pars.Names...)
+	if pars.HasVargs {
+		names = append(names, "...")
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
@@ -17,19 +17,30 @@ const EOF = -1
 const whitespace1 = 1<<'\t' | 1<<'\r' | 1<<' '
 const whitespace2 = 1<<'\t' | 1<<'\n' | 1<<'\r' | 1<<' '
 
+// Error - a scan or parse error at the token from Pos to End, Text is the
+// source line of Pos when it is known
 type Error struct {
 	Pos     qsa.Position
 	Message string
 	Token   string
+	End     qsa.Position
+	Text    string
 }
 
 func (e *Error) Error() string {
 	pos := e.Pos
 	if pos.Line == EOF {
 		return fmt.Sprintf("%v End input - %s\n", pos.Source, e.Message)
-	} else {
-		return fmt.Sprintf("%v (%d,%d) '%v'? - %s\n", pos.Source, pos.Line, pos.Column, e.Token, e.Message)
 	}
+	msg := fmt.Sprintf("%v (%d,%d) '%v'? - %s\n", pos.Source, pos.Line, pos.Column, e.Token, e.Message)
+	if len(e.Text) > 0 {
+		last := pos.Column
+		if e.End.Line == pos.Line && e.End.Column > last {
+			last = e.End.Column
+		}
+		msg += qsa.Excerpt(pos.Line, e.Text, pos.Column, last) + "\n"
+	}
+	return msg
 }
 
 func writeChar(buf *bytes.Buffer, c int) { buf.WriteByte(byte(c)) }
@@ -56,9 +67,13 @@ func NewScanner(reader io.Reader, source string) *Scanner {
 	}
 }
 
-func (sc *Scanner) Error(tok string, msg string) *Error { return &Error{sc.Pos, msg, tok} }
+func (sc *Scanner) Error(tok string, msg string) *Error {
+	return &Error{Pos: sc.Pos, Message: msg, Token: tok, End: sc.Pos}
+}
 
-func (sc *Scanner) TokenError(tok qsa.Token, msg string) *Error { return &Error{tok.Pos, msg, tok.Str} }
+func (sc *Scanner) TokenError(tok qsa.Token, msg string) *Error {
+	return &Error{Pos: tok.Pos, Message: msg, Token: tok.Str, End: tok.End}
+}
 
 func (sc *Scanner) readNext() int {
 	ch, err := sc.reader.ReadByte()
@@ -103,6 +118,56 @@ func (sc *Scanner) Peek() int {
 	return ch
 }
 
+// namedArg - reports whether the name just scanned is that of a named
+// argument, followed by a colon, and moves past the colon. A colon followed
+// by a name and the arguments of a call, as in obj:m() or obj: m(), is that
+// of a method call
+func (sc *Scanner) namedArg() bool {
+	at := func(i int) int {
+		next, err := sc.reader.Peek(i + 1)
+		if err != nil || len(next) <= i {
+			return EOF
+		}
+		return int(next[i])
+	}
+	isSpace := func(ch int) bool {
+		return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+	}
+	if at(0) != ':' {
+		return false
+	}
+	i := 1
+	for isSpace(at(i)) {
+		i++
+	}
+	if isIdent(at(i), 0) {
+		if i == 1 {
+			return false
+		}
+		j := i
+		for isIdent(at(j), j-i) {
+			j++
+		}
+		name := make([]byte, 0, j-i)
+		for k := i; k < j; k++ {
+			name = append(name, byte(at(k)))
+		}
+		_, reserved := reservedWords[string(name)]
+		fstring := string(name) == "f" && (at(j) == '"' || at(j) == '\'')
+		for isSpace(at(j)) {
+			j++
+		}
+		switch at(j) {
+		case '(', '{', '"', '\'', '`':
+			if !reserved && !fstring {
+				return false
+			}
+		}
+	}
+	sc.Next()
+	return true
+}
+
 func (sc *Scanner) skipWhiteSpace(whitespace int64) int {
 	ch := sc.Next()
 	for ; whitespace&(1<<uint(ch)) != 0; ch = sc.Next() {
@@ -110,29 +175,35 @@ func (sc *Scanner) skipWhiteSpace(whitespace int64) int {
 	return ch
 }
 
-func (sc *Scanner) skipCGoComments(ch int) error {
+func (sc *Scanner) skipCGoComments(ch int, buf *bytes.Buffer) error {
 	// skip /* */ style comments (ch contains first '*')
-	// eat contents of multi-line comment
+	// eat contents of multi-line comment into buf
+	writeChar(buf, ch)
 	ch = sc.Next()
 	for {
+		if ch == EOF {
+			return sc.Error(buf.String(), "comment not terminated")
+		}
+		writeChar(buf, ch)
 		if ch == '*' && sc.Peek() == '/' { // end of comments
-			ch = sc.Next() // eat last '/'
+			writeChar(buf, sc.Next()) // eat last '/'
 			break
-		} else {
-			ch = sc.Next() // get next byte
 		}
+		ch = sc.Next() // get next byte
 	}
 	return nil
 }
 
-func (sc *Scanner) skipCppGoComments(ch int) error {
+func (sc *Scanner) skipCppGoComments(ch int, buf *bytes.Buffer) error {
 	// skip //..\n style comments (ch contains second '/')
-	// eat contents of single line comment
+	// eat contents of single line comment into buf
+	writeChar(buf, ch)
 	ch = sc.Next()
 	for {
-		if ch == '\n' || ch == '\r' { // end of line == end of comments
+		if ch == '\n' || ch == '\r' || ch == EOF { // end of line == end of comments
 			break
 		}
+		writeChar(buf, ch)
 		ch = sc.Next() // get next byte
 	}
 	return nil
@@ -205,6 +276,46 @@ func (sc *Scanner) scanString(quote int, buf *bytes.Buffer) error {
 	return nil
 }
 
+// scanFString - scans the body of an f-string as it is written, up to its
+// closing quote, the quotes of strings in its {expressions} do not close it
+func (sc *Scanner) scanFString(quote int, buf *bytes.Buffer) error {
+	depth := 0
+	inner := 0 // the quote of a string in an expression
+	for {
+		ch := sc.Next()
+		if ch == '\n' || ch < 0 {
+			return sc.Error(buf.String(), "truncated string")
+		}
+		switch {
+		case inner != 0:
+			if ch == '\\' {
+				writeChar(buf, ch)
+				ch = sc.Next()
+			} else if ch == inner {
+				inner = 0
+			}
+		case ch == quote && depth == 0:
+			return nil
+		case ch == '\\' && depth == 0:
+			writeChar(buf, ch)
+			ch = sc.Next()
+		case (ch == '{' || ch == '}') && depth == 0 && sc.Peek() == ch:
+			writeChar(buf, ch) // {{ or }}
+			ch = sc.Next()
+		case ch == '{':
+			depth++
+		case ch == '}' && depth > 0:
+			depth--
+		case depth > 0 && (ch == '"' || ch == '\''):
+			inner = ch
+		}
+		if ch == '\n' || ch < 0 {
+			return sc.Error(buf.String(), "truncated string")
+		}
+		writeChar(buf, ch)
+	}
+}
+
 func (sc *Scanner) scanEscape(ch int, buf *bytes.Buffer) error {
 	ch = sc.Next()
 	switch ch {
@@ -272,11 +383,27 @@ func (sc *Scanner) scanMultilineGoString(ch int, buf *bytes.Buffer) error {
 }
 
 var reservedWords = map[string]int{
-	"and": TAnd, "break": TBreak, "do": TDo, "else": TElse, "elseif": TElseIf,
-	"end": TEnd, "false": TFalse, "for": TFor, "func": TProc, "proc": TProc,
+	"and": TAnd, "break": TBreak, "case": TCase, "catch": TCatch, "class": TClass, "continue": TContinue, "defer": TDefer, "do": TDo, "else": TElse, "elseif": TElseIf,
+	"end": TEnd, "extends": TExtends, "false": TFalse, "finally": TFinally, "for": TFor, "func": TProc, "global": TGlobal, "proc": TProc,
 	"if": TIf, "in": TIn, "dcl": TLocal, "nil": TNil, "not": TNot, "or": TOr,
-	"return": TReturn, "repeat": TRepeat, "then": TThen, "true": TTrue,
-	"until": TUntil, "while": TWhile}
+	"return": TReturn, "repeat": TRepeat, "super": TSuper, "switch": TSwitch, "then": TThen, "true": TTrue,
+	"try": TTry, "until": TUntil, "while": TWhile}
+
+// IsReservedWord - reports whether name is a reserved word, which cannot
+// be used as a name
+func IsReservedWord(name string) bool {
+	_, ok := reservedWords[name]
+	return ok
+}
+
+// opAssign - makes the operator token tok a compound assignment, like +=,
+// when it is followed by =, its Str is the operator without the =
+func (sc *Scanner) opAssign(tok *qsa.Token) {
+	if sc.Peek() == '=' {
+		sc.Next()
+		tok.Type = TOpAssign
+	}
+}
 
 func (sc *Scanner) Scan(lexer *Lexer) (qsa.Token, error) {
 redo:
@@ -308,6 +435,13 @@ redo:
 		}
 		if typ, ok := reservedWords[tok.Str]; ok {
 			tok.Type = typ
+		} else if tok.Str == "f" && (sc.Peek() == '"' || sc.Peek() == '\'') {
+			tok.Type = TFString
+			buf.Reset()
+			err = sc.scanFString(sc.Next(), buf)
+			tok.Str = buf.String()
+		} else if t := lexer.Token.Type; (t == '(' || t == ',') && sc.namedArg() {
+			tok.Type = TNamed
 		}
 	case isDecimal(ch):
 		tok.Type = TNumber
@@ -320,31 +454,39 @@ redo:
 		case '-':
 			tok.Type = ch
 			tok.Str = string(ch)
+			sc.opAssign(&tok)
 		case '/': // skip C, Cpp, or Go style comments
 			pk := sc.Peek()
 			if pk == '*' { // multi line /*..*/ comment
-				err = sc.skipCGoComments(sc.Next())
+				writeChar(buf, ch)
+				err = sc.skipCGoComments(sc.Next(), buf)
 				if err != nil {
 					goto finally
 				}
+				lexer.comment(buf.String(), tok.Pos, sc.Pos)
 				goto redo
 			} else if pk == '/' { // single line //..\n comment
-				err = sc.skipCppGoComments(sc.Next())
+				writeChar(buf, ch)
+				err = sc.skipCppGoComments(sc.Next(), buf)
 				if err != nil {
 					goto finally
 				}
+				lexer.lineComment(buf.String(), tok.Pos)
 				goto redo
 			} else {
 				tok.Type = ch
 				tok.Str = string(ch)
+				sc.opAssign(&tok)
 			}
 		case '#': // skip Bash,sh style (first line) comments
 			pk := sc.Peek()
 			if pk == '!' { // single line #!..\n comment
-				err = sc.skipCppGoComments(sc.Next())
+				writeChar(buf, ch)
+				err = sc.skipCppGoComments(sc.Next(), buf)
 				if err != nil {
 					goto finally
 				}
+				lexer.lineComment(buf.String(), tok.Pos)
 				goto redo
 			} else { // allow #length unary operator
 				tok.Type = ch
@@ -383,6 +525,10 @@ redo:
 				tok.Type = TLte
 				tok.Str = "<="
 				sc.Next()
+			} else if sc.Peek() == '<' {
+				tok.Type = TShl
+				tok.Str = "<<"
+				sc.Next()
 			} else {
 				tok.Type = ch
 				tok.Str = string(ch)
@@ -392,6 +538,10 @@ redo:
 				tok.Type = TGte
 				tok.Str = ">="
 				sc.Next()
+			} else if sc.Peek() == '>' {
+				tok.Type = TShr
+				tok.Str = ">>"
+				sc.Next()
 			} else {
 				tok.Type = ch
 				tok.Str = string(ch)
@@ -416,6 +566,9 @@ redo:
 				tok.Type = '.'
 			}
 			tok.Str = buf.String()
+			if tok.Type == T2Comma {
+				sc.opAssign(&tok)
+			}
 		case '|': /* force concatenation token to be || as well as .. */
 			ch2 := sc.Peek()
 			switch {
@@ -425,10 +578,18 @@ redo:
 				writeChar(buf, '.')
 				tok.Type = T2Comma
 			default:
-				tok.Type = '.'
+				writeChar(buf, ch)
+				tok.Type = ch
 			}
 			tok.Str = buf.String()
-		case '+', '*', '%', '^', '(', ')', '{', '}', ']', ';', ':', ',':
+			if tok.Type == T2Comma {
+				sc.opAssign(&tok)
+			}
+		case '+', '*', '%', '^':
+			tok.Type = ch
+			tok.Str = string(ch)
+			sc.opAssign(&tok)
+		case '&', '~', '\\', '(', ')', '{', '}', ']', ';', ':', ',':
 			tok.Type = ch
 			tok.Str = string(ch)
 		default:
@@ -440,6 +601,10 @@ redo:
 
 finally:
 	tok.Name = TokenName(int(tok.Type))
+	tok.End = sc.Pos
+	if tok.End.Line != tok.Pos.Line && tok.End.Line == EOF {
+		tok.End = tok.Pos
+	}
 	return tok, err
 }
 
@@ -448,40 +613,200 @@ type Lexer struct {
 	Stmts    []qsa.Stmt
 	PNewLine bool
 	Token    qsa.Token
+	Comments []*qsa.Comment // in source order
+	pending  []qsa.Token    // tokens to return before scanning
+	end      *qsa.Position  // the position of EOF in an embedded expression
+}
+
+// comment - records a comment from pos to end
+func (lx *Lexer) comment(text string, pos, end qsa.Position) {
+	lx.Comments = append(lx.Comments, &qsa.Comment{Text: text, Pos: pos, End: end})
+}
+
+// lineComment - records a comment from pos to the end of its line
+func (lx *Lexer) lineComment(text string, pos qsa.Position) {
+	end := pos
+	end.Column += len(text) - 1
+	lx.comment(text, pos, end)
 }
 
 func (lx *Lexer) Lex(lval *yySymType) int {
-	tok, err := lx.scanner.Scan(lx)
-	if err != nil {
-		panic(err)
+	var tok qsa.Token
+	if len(lx.pending) > 0 {
+		tok = lx.pending[0]
+		lx.pending = lx.pending[1:]
+	} else {
+		var err error
+		tok, err = lx.scanner.Scan(lx)
+		if err != nil {
+			panic(err)
+		}
+		if tok.Type == EOF && lx.end != nil {
+			tok.Pos, tok.End = *lx.end, *lx.end
+		}
 	}
+	lx.Token = tok
 	if tok.Type < 0 {
 		return 0
 	}
 	lval.token = tok
-	lx.Token = tok
 	return int(tok.Type)
 }
 
+// fstring - parses the body of the f-string token tok into the literal
+// strings and embedded expressions of an FStringExpr
+func (lx *Lexer) fstring(tok qsa.Token) qsa.Expr {
+	ex := &qsa.FStringExpr{Parts: []qsa.Expr{}}
+	ex.SetPos(tok.Pos)
+	ex.SetEnd(tok.End)
+	pos := tok.Pos
+	pos.Column++ // the f, the first Next moves past the quote
+	sc := &Scanner{Pos: pos, reader: bufio.NewReader(strings.NewReader(tok.Str))}
+
+	var lit bytes.Buffer
+	var first, last qsa.Position // of the literal
+	literal := func() {
+		if lit.Len() > 0 {
+			str := &qsa.StringExpr{Value: lit.String()}
+			str.SetPos(first)
+			str.SetEnd(last)
+			ex.Parts = append(ex.Parts, str)
+			lit.Reset()
+		}
+	}
+	for ch := sc.Next(); ch != EOF; ch = sc.Next() {
+		if lit.Len() == 0 {
+			first = sc.Pos
+		}
+		switch {
+		case ch == '\\':
+			if err := sc.scanEscape(ch, &lit); err != nil {
+				panic(err)
+			}
+		case (ch == '{' || ch == '}') && sc.Peek() == ch:
+			writeChar(&lit, sc.Next())
+		case ch == '}':
+			panic(sc.Error("}", "single '}' in f-string, use '}}'"))
+		case ch == '{':
+			literal()
+			ex.Parts = append(ex.Parts, lx.fstringValue(sc))
+			continue
+		default:
+			writeChar(&lit, ch)
+		}
+		last = sc.Pos
+	}
+	literal()
+	return ex
+}
+
+// fstringValue - parses the {expr} or {expr:format} of an f-string that
+// sc has read the { of, a format starts with :% so that method calls,
+// like {t:name()}, can be embedded
+func (lx *Lexer) fstringValue(sc *Scanner) qsa.Expr {
+	open := sc.Pos
+	var src, format bytes.Buffer
+	depth := 0
+	inner := 0 // the quote of a string in the expression
+	ch := sc.Next()
+	for ; inner != 0 || depth > 0 || ch != '}' && !(ch == ':' && sc.Peek() == '%'); ch = sc.Next() {
+		if ch == EOF {
+			panic(&Error{Pos: open, Message: "'}' expected in f-string", Token: "{", End: open})
+		}
+		switch {
+		case inner != 0:
+			if ch == '\\' {
+				writeChar(&src, ch)
+				ch = sc.Next()
+			} else if ch == inner {
+				inner = 0
+			}
+		case ch == '"' || ch == '\'':
+			inner = ch
+		case ch == '(' || ch == '{' || ch == '[':
+			depth++
+		case ch == ')' || ch == '}' || ch == ']':
+			depth--
+		}
+		writeChar(&src, ch)
+	}
+	end := sc.Pos
+	if ch == ':' {
+		for ch = sc.Next(); ch != '}'; ch = sc.Next() {
+			if ch == EOF {
+				panic(&Error{Pos: open, Message: "'}' expected in f-string", Token: "{", End: open})
+			}
+			writeChar(&format, ch)
+		}
+	}
+	value := &qsa.FStringValue{Expr: lx.embedded(src.String(), open, end), Format: format.String()}
+	value.SetPos(open)
+	value.SetEnd(sc.Pos)
+	return value
+}
+
+// embedded - parses src, an expression embedded in the source after pos,
+// and ending before end, as the expression of a return statement
+func (lx *Lexer) embedded(src string, pos, end qsa.Position) qsa.Expr {
+	ret := qsa.Token{Type: TReturn, Name: TokenName(TReturn), Str: "return", Pos: pos, End: pos}
+	sub := &Lexer{scanner: &Scanner{Pos: pos, reader: bufio.NewReader(strings.NewReader(src))},
+		Token: ret, pending: []qsa.Token{ret}, end: &end}
+	yyParse(sub)
+	if len(sub.Stmts) == 1 {
+		if st, ok := sub.Stmts[0].(*qsa.ReturnStmt); ok && len(st.Exprs) == 1 {
+			return st.Exprs[0]
+		}
+	}
+	panic(&Error{Pos: pos, Message: "one expression expected in f-string", Token: "{" + src + "}", End: end})
+}
+
+// Error - raises a parse error at the last token read
 func (lx *Lexer) Error(message string) {
-	panic(lx.scanner.Error(lx.Token.Str, message))
+	panic(lx.scanner.TokenError(lx.Token, message))
 }
 
 func (lx *Lexer) TokenError(tok qsa.Token, message string) {
 	panic(lx.scanner.TokenError(tok, message))
 }
 
-func Parse(reader io.Reader, name string) (segment []qsa.Stmt, err error) {
-	lexer := &Lexer{NewScanner(reader, name), nil, false, qsa.Token{Str: ""}}
-	segment = nil
+// Parse - parses the q source read from reader, the error of a source
+// that does not parse is an *Error with the source line of the error
+func Parse(reader io.Reader, name string) ([]qsa.Stmt, error) {
+	lexer, err := parse(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	return lexer.Stmts, nil
+}
+
+// ParseComments - parses like Parse, and also returns the comments of the
+// source in the order they appear
+func ParseComments(reader io.Reader, name string) ([]qsa.Stmt, []*qsa.Comment, error) {
+	lexer, err := parse(reader, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lexer.Stmts, lexer.Comments, nil
+}
+
+// parse - returns the lexer that parsed the q source read from reader
+func parse(reader io.Reader, name string) (lexer *Lexer, err error) {
+	src, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	lexer = &Lexer{scanner: NewScanner(bytes.NewReader(src), name), Token: qsa.Token{Str: ""}}
 	defer func() {
 		if e := recover(); e != nil {
+			lexer = nil
 			err, _ = e.(error)
+			if perr, ok := e.(*Error); ok && perr.Pos.Line != EOF {
+				perr.Text = qsa.SourceLine(src, perr.Pos.Line)
+			}
 		}
 	}()
 	yyParse(lexer)
-	segment = lexer.Stmts
-	return
+	return lexer, nil
 }
 
 func isInlineDumpNode(rv reflect.Value) bool {
@@ -1,19 +1,40 @@
-// package qsp q language parser - generated from qsp.go.y
+// Code generated by goyacc -o qsp.go qsp.go.y. DO NOT EDIT.
+
+//line qsp.go.y:2
 package qsp
 
-import (
-	__yyfmt__ "fmt"
+import __yyfmt__ "fmt"
 
+//line qsp.go.y:2
+
+import (
 	"github.com/x0ray/q/qs/qsa"
 )
 
-//line parser.go.y:34
+// callArgs - the arguments of a proc call, last spans the end of the call
+type callArgs struct {
+	exprs []qsa.Expr
+	named []*qsa.NamedArg
+	last  qsa.Node
+}
+
+// bindings - the names a dcl statement or for declares, with the pattern
+// of each name, nil for a plain name, last spans the last one
+type bindings struct {
+	names    []string
+	patterns []*qsa.Pattern
+	last     qsa.PositionHolder
+}
+
+//line qsp.go.y:61
 type yySymType struct {
 	yys   int
 	token qsa.Token
 
-	stmts []qsa.Stmt
-	stmt  qsa.Stmt
+	stmts  []qsa.Stmt
+	stmt   qsa.Stmt
+	cases  []*qsa.SwitchCase
+	clause *qsa.TryClause
 
 	funcname *qsa.FuncName
 	funcexpr *qsa.ProcExpr
@@ -25,45 +46,70 @@ type yySymType struct {
 	field     *qsa.Field
 	fieldsep  string
 
-	namelist []string
-	parlist  *qsa.ParList
+	tokens  []qsa.Token
+	parlist *qsa.ParList
+	args    callArgs
+	named   []*qsa.NamedArg
+	binds   bindings
+	pattern *qsa.Pattern
+	methods []*qsa.ClassMethod
 }
 
 const TAnd = 57346
 const TBreak = 57347
-const TDo = 57348
-const TElse = 57349
-const TElseIf = 57350
-const TEnd = 57351
-const TFalse = 57352
-const TFor = 57353
-const TProc = 57354
-const TIf = 57355
-const TIn = 57356
-const TLocal = 57357
-const TNil = 57358
-const TNot = 57359
-const TOr = 57360
-const TReturn = 57361
-const TRepeat = 57362
-const TThen = 57363
-const TTrue = 57364
-const TUntil = 57365
-const TWhile = 57366
-const TEqeq = 57367
-const TNeq = 57368
-const TLte = 57369
-const TGte = 57370
-const T2Comma = 57371
-const T3Comma = 57372
-const TIdent = 57373
-const TNumber = 57374
-const TString = 57375
-const UNARY = 57376
-
-var yyToknames = []string{
+const TContinue = 57348
+const TDo = 57349
+const TElse = 57350
+const TElseIf = 57351
+const TEnd = 57352
+const TFalse = 57353
+const TFor = 57354
+const TProc = 57355
+const TIf = 57356
+const TIn = 57357
+const TLocal = 57358
+const TGlobal = 57359
+const TNil = 57360
+const TNot = 57361
+const TOr = 57362
+const TReturn = 57363
+const TRepeat = 57364
+const TSwitch = 57365
+const TCase = 57366
+const TThen = 57367
+const TTrue = 57368
+const TUntil = 57369
+const TWhile = 57370
+const TTry = 57371
+const TCatch = 57372
+const TFinally = 57373
+const TDefer = 57374
+const TClass = 57375
+const TExtends = 57376
+const TSuper = 57377
+const TOpAssign = 57378
+const TEqeq = 57379
+const TNeq = 57380
+const TLte = 57381
+const TGte = 57382
+const TShl = 57383
+const TShr = 57384
+const T2Comma = 57385
+const T3Comma = 57386
+const TIdent = 57387
+const TNamed = 57388
+const TNumber = 57389
+const TString = 57390
+const TFString = 57391
+const UNARY = 57392
+
+var yyToknames = [...]string{
+	"$end",
+	"error",
+	"$unk",
 	"TAnd",
 	"TBreak",
+	"TContinue",
 	"TDo",
 	"TElse",
 	"TElseIf",
@@ -74,279 +120,506 @@ var yyToknames = []string{
 	"TIf",
 	"TIn",
 	"TLocal",
+	"TGlobal",
 	"TNil",
 	"TNot",
 	"TOr",
 	"TReturn",
 	"TRepeat",
+	"TSwitch",
+	"TCase",
 	"TThen",
 	"TTrue",
 	"TUntil",
 	"TWhile",
+	"TTry",
+	"TCatch",
+	"TFinally",
+	"TDefer",
+	"TClass",
+	"TExtends",
+	"TSuper",
+	"TOpAssign",
 	"TEqeq",
 	"TNeq",
 	"TLte",
 	"TGte",
+	"TShl",
+	"TShr",
 	"T2Comma",
 	"T3Comma",
 	"TIdent",
+	"TNamed",
 	"TNumber",
 	"TString",
-	" {",
-	" (",
-	" >",
-	" <",
-	" +",
-	" -",
-	" *",
-	" /",
-	" %",
+	"TFString",
+	"'{'",
+	"'('",
+	"')'",
+	"'['",
+	"']'",
+	"'}'",
+	"'-'",
+	"'#'",
+	"'~'",
+	"'>'",
+	"'<'",
+	"'|'",
+	"'&'",
+	"'+'",
+	"'*'",
+	"'/'",
+	"'\\\\'",
+	"'%'",
 	"UNARY",
-	" ^",
+	"'^'",
+	"';'",
+	"'='",
+	"','",
+	"':'",
+	"'.'",
 }
-var yyStatenames = []string{}
+
+var yyStatenames = [...]string{}
 
 const yyEofCode = 1
 const yyErrCode = 2
-const yyMaxDepth = 200
+const yyInitialStackSize = 16
+
+//line qsp.go.y:839
+
+// tokenNode - returns a node spanning the token tok
+func tokenNode(tok qsa.Token) *qsa.Node {
+	node := &qsa.Node{}
+	node.SetPos(tok.Pos)
+	node.SetEnd(tok.End)
+	return node
+}
+
+// tokenNames - returns the names of the tokens of a name list
+func tokenNames(toks []qsa.Token) []string {
+	names := make([]string, len(toks))
+	for i, tok := range toks {
+		names[i] = tok.Str
+	}
+	return names
+}
+
+// bind - returns the bindings with the name and its pattern added
+func (b bindings) bind(name string, pat *qsa.Pattern, last qsa.PositionHolder) bindings {
+	if pat != nil && b.patterns == nil {
+		b.patterns = make([]*qsa.Pattern, len(b.names))
+	}
+	b.names = append(b.names, name)
+	if b.patterns != nil {
+		b.patterns = append(b.patterns, pat)
+	}
+	b.last = last
+	return b
+}
+
+// patternName - adds the name tok to the pattern, loaded from the field
+// key when key is not "", a name after the ...rest name is an error
+func patternName(yylex yyLexer, pat *qsa.Pattern, key string, tok qsa.Token) *qsa.Pattern {
+	if pat.Rest != "" {
+		yylex.(*Lexer).TokenError(tok, "'..."+pat.Rest+"' must be the last name of a pattern")
+	}
+	if key != "" {
+		pat.Keys = append(pat.Keys, key)
+	}
+	pat.Names = append(pat.Names, tok.Str)
+	return pat
+}
+
+// patternRest - sets the ...rest name tok of the pattern
+func patternRest(yylex yyLexer, pat *qsa.Pattern, tok qsa.Token) *qsa.Pattern {
+	if pat.Rest != "" {
+		yylex.(*Lexer).TokenError(tok, "'..."+pat.Rest+"' must be the last name of a pattern")
+	}
+	pat.Rest = tok.Str
+	return pat
+}
+
+// classMethod - adds the method tok of a class, a method declared twice,
+// or one named __index, that the class sets to itself, is an error
+func classMethod(yylex yyLexer, methods []*qsa.ClassMethod, tok qsa.Token, fn *qsa.ProcExpr) []*qsa.ClassMethod {
+	if tok.Str == "__index" {
+		yylex.(*Lexer).TokenError(tok, "a class cannot declare __index, it is the class")
+	}
+	for _, m := range methods {
+		if m.Name == tok.Str {
+			yylex.(*Lexer).TokenError(tok, "method '"+tok.Str+"' declared twice")
+		}
+	}
+	return append(methods, &qsa.ClassMethod{Name: tok.Str, Func: fn})
+}
+
+// yyTokOffset - number of names goyacc puts in yyToknames before TAnd
+const yyTokOffset = 3
 
-//line parser.go.y:514
 func TokenName(c int) string {
-	if c >= TAnd && c-TAnd < len(yyToknames) {
-		if yyToknames[c-TAnd] != "" {
-			return yyToknames[c-TAnd]
+	if c >= TAnd && c-TAnd+yyTokOffset < len(yyToknames) {
+		if yyToknames[c-TAnd+yyTokOffset] != "" {
+			return yyToknames[c-TAnd+yyTokOffset]
 		}
 	}
 	return string([]byte{byte(c)})
 }
 
 //line yacctab:1
-var yyExca = []int{
+var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 17,
-	46, 31,
-	47, 31,
-	-2, 68,
-	-1, 93,
-	46, 32,
-	47, 32,
-	-2, 68,
+	-1, 10,
+	71, 50,
+	72, 50,
+	-2, 114,
+	-1, 121,
+	71, 51,
+	72, 51,
+	-2, 114,
 }
 
-const yyNprod = 95
 const yyPrivate = 57344
 
-var yyTokenNames []string
-var yyStates []string
-
-const yyLast = 579
-
-var yyAct = []int{
-
-	24, 88, 50, 23, 45, 84, 56, 65, 137, 153,
-	136, 113, 52, 142, 54, 53, 33, 134, 65, 132,
-	62, 63, 32, 61, 108, 109, 48, 111, 106, 41,
-	42, 105, 49, 155, 166, 81, 82, 83, 138, 104,
-	22, 91, 131, 80, 95, 92, 162, 74, 48, 85,
-	150, 99, 165, 148, 49, 149, 75, 76, 77, 78,
-	79, 67, 80, 107, 106, 148, 114, 115, 116, 117,
-	118, 119, 120, 121, 122, 123, 124, 125, 126, 127,
-	128, 129, 72, 73, 71, 70, 74, 65, 39, 40,
-	47, 139, 133, 68, 69, 75, 76, 77, 78, 79,
-	60, 80, 141, 144, 143, 146, 145, 31, 67, 147,
-	9, 48, 110, 97, 48, 152, 151, 49, 38, 62,
-	49, 17, 66, 77, 78, 79, 96, 80, 59, 72,
-	73, 71, 70, 74, 154, 102, 91, 156, 55, 157,
-	68, 69, 75, 76, 77, 78, 79, 21, 80, 187,
-	94, 20, 26, 184, 37, 179, 163, 112, 25, 35,
-	178, 93, 170, 172, 27, 171, 164, 173, 19, 159,
-	175, 174, 29, 89, 28, 39, 40, 20, 182, 181,
-	100, 34, 135, 183, 67, 39, 40, 47, 186, 64,
-	51, 1, 90, 87, 36, 130, 86, 30, 66, 18,
-	46, 44, 43, 8, 58, 72, 73, 71, 70, 74,
-	57, 67, 168, 169, 167, 3, 68, 69, 75, 76,
-	77, 78, 79, 160, 80, 66, 4, 2, 0, 0,
-	0, 158, 72, 73, 71, 70, 74, 0, 0, 0,
-	0, 0, 0, 68, 69, 75, 76, 77, 78, 79,
-	26, 80, 37, 0, 0, 0, 25, 35, 140, 0,
-	0, 0, 27, 0, 0, 0, 0, 0, 0, 0,
-	29, 21, 28, 39, 40, 20, 26, 0, 37, 34,
-	0, 0, 25, 35, 0, 0, 0, 0, 27, 0,
-	0, 0, 36, 98, 0, 0, 29, 89, 28, 39,
-	40, 20, 26, 0, 37, 34, 0, 0, 25, 35,
-	0, 0, 0, 0, 27, 67, 90, 176, 36, 0,
-	0, 0, 29, 21, 28, 39, 40, 20, 0, 66,
-	0, 34, 0, 0, 0, 0, 72, 73, 71, 70,
-	74, 0, 67, 0, 36, 0, 0, 68, 69, 75,
-	76, 77, 78, 79, 0, 80, 66, 0, 177, 0,
-	0, 0, 0, 72, 73, 71, 70, 74, 0, 67,
-	0, 185, 0, 0, 68, 69, 75, 76, 77, 78,
-	79, 0, 80, 66, 0, 161, 0, 0, 0, 0,
-	72, 73, 71, 70, 74, 0, 67, 0, 0, 0,
-	0, 68, 69, 75, 76, 77, 78, 79, 0, 80,
-	66, 0, 0, 180, 0, 0, 0, 72, 73, 71,
-	70, 74, 0, 67, 0, 0, 0, 0, 68, 69,
-	75, 76, 77, 78, 79, 0, 80, 66, 0, 0,
-	103, 0, 0, 0, 72, 73, 71, 70, 74, 0,
-	67, 0, 101, 0, 0, 68, 69, 75, 76, 77,
-	78, 79, 0, 80, 66, 0, 0, 0, 0, 0,
-	0, 72, 73, 71, 70, 74, 0, 67, 0, 0,
-	0, 0, 68, 69, 75, 76, 77, 78, 79, 0,
-	80, 66, 0, 0, 0, 0, 0, 0, 72, 73,
-	71, 70, 74, 0, 0, 0, 0, 0, 0, 68,
-	69, 75, 76, 77, 78, 79, 0, 80, 72, 73,
-	71, 70, 74, 0, 0, 0, 0, 0, 0, 68,
-	69, 75, 76, 77, 78, 79, 0, 80, 7, 10,
-	0, 0, 0, 0, 14, 15, 13, 0, 16, 0,
-	0, 0, 6, 12, 0, 0, 0, 11, 0, 0,
-	0, 0, 0, 0, 21, 0, 0, 0, 20, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 5,
+const yyLast = 1138
+
+var yyAct = [...]int16{
+	32, 31, 159, 130, 54, 116, 112, 79, 65, 133,
+	41, 190, 40, 286, 56, 256, 58, 59, 216, 57,
+	146, 147, 275, 249, 62, 86, 193, 235, 192, 84,
+	220, 39, 240, 236, 25, 217, 82, 289, 83, 234,
+	105, 106, 95, 108, 109, 110, 111, 236, 221, 25,
+	82, 119, 83, 120, 123, 97, 137, 104, 30, 233,
+	103, 102, 96, 98, 99, 100, 101, 285, 107, 86,
+	86, 98, 99, 100, 101, 145, 107, 282, 154, 150,
+	86, 152, 153, 158, 122, 149, 138, 163, 164, 165,
+	166, 167, 168, 169, 170, 171, 172, 173, 174, 175,
+	176, 177, 178, 179, 180, 181, 182, 183, 184, 51,
+	52, 270, 262, 138, 241, 218, 194, 136, 107, 195,
+	48, 49, 50, 81, 113, 77, 238, 197, 162, 264,
+	196, 202, 198, 82, 74, 83, 214, 212, 297, 213,
+	211, 66, 207, 284, 67, 80, 78, 215, 71, 187,
+	189, 226, 95, 47, 229, 225, 10, 186, 228, 267,
+	268, 237, 283, 205, 232, 97, 76, 82, 259, 83,
+	261, 260, 96, 98, 99, 100, 101, 250, 107, 63,
+	73, 258, 257, 230, 66, 66, 29, 67, 67, 227,
+	210, 239, 119, 144, 143, 243, 24, 242, 48, 49,
+	50, 81, 28, 248, 224, 247, 121, 141, 140, 251,
+	209, 223, 222, 219, 156, 254, 82, 155, 83, 151,
+	148, 70, 61, 105, 106, 95, 53, 131, 126, 206,
+	134, 135, 253, 27, 163, 308, 263, 200, 97, 199,
+	104, 64, 269, 265, 102, 96, 98, 99, 100, 101,
+	135, 107, 11, 201, 276, 305, 280, 277, 279, 300,
+	278, 281, 85, 204, 72, 287, 203, 296, 288, 204,
+	60, 290, 274, 266, 292, 252, 245, 291, 208, 88,
+	293, 124, 294, 191, 272, 273, 271, 298, 55, 1,
+	299, 115, 188, 185, 38, 87, 303, 26, 142, 302,
+	139, 75, 9, 69, 68, 3, 304, 132, 128, 246,
+	4, 307, 93, 94, 92, 91, 105, 106, 95, 2,
+	0, 0, 0, 0, 0, 0, 0, 88, 0, 0,
+	0, 97, 0, 104, 89, 90, 103, 102, 96, 98,
+	99, 100, 101, 87, 107, 0, 0, 295, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	93, 94, 92, 91, 105, 106, 95, 0, 0, 0,
+	0, 0, 0, 0, 0, 88, 0, 0, 306, 97,
+	0, 104, 89, 90, 103, 102, 96, 98, 99, 100,
+	101, 87, 107, 0, 0, 255, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 93, 94,
+	92, 91, 105, 106, 95, 0, 0, 0, 0, 0,
+	0, 0, 0, 88, 0, 0, 0, 97, 0, 104,
+	89, 90, 103, 102, 96, 98, 99, 100, 101, 87,
+	107, 0, 0, 0, 301, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 93, 94, 92, 91,
+	105, 106, 95, 0, 0, 0, 0, 0, 0, 0,
+	0, 88, 0, 0, 0, 97, 0, 104, 89, 90,
+	103, 102, 96, 98, 99, 100, 101, 87, 107, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 93, 94, 92, 91, 105, 106,
+	95, 0, 0, 0, 0, 0, 0, 0, 0, 88,
+	0, 244, 0, 97, 0, 104, 89, 90, 103, 102,
+	96, 98, 99, 100, 101, 87, 107, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 93, 94, 92, 91, 105, 106, 95, 0,
+	0, 0, 0, 0, 0, 0, 0, 88, 0, 231,
+	0, 97, 0, 104, 89, 90, 103, 102, 96, 98,
+	99, 100, 101, 87, 107, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	93, 94, 92, 91, 105, 106, 95, 0, 0, 0,
+	0, 0, 0, 0, 0, 161, 0, 88, 0, 97,
+	0, 104, 89, 90, 103, 102, 96, 98, 99, 100,
+	101, 0, 107, 87, 0, 0, 0, 129, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	93, 94, 92, 91, 105, 106, 95, 0, 0, 0,
+	0, 0, 0, 0, 0, 88, 0, 0, 0, 97,
+	0, 104, 89, 90, 103, 102, 96, 98, 99, 100,
+	101, 87, 107, 0, 0, 0, 127, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 93, 94,
+	92, 91, 105, 106, 95, 0, 0, 0, 0, 0,
+	0, 0, 0, 88, 0, 0, 125, 97, 0, 104,
+	89, 90, 103, 102, 96, 98, 99, 100, 101, 87,
+	107, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 93, 94, 92, 91,
+	105, 106, 95, 0, 0, 0, 0, 0, 0, 0,
+	0, 88, 0, 0, 0, 97, 0, 104, 89, 90,
+	103, 102, 96, 98, 99, 100, 101, 87, 107, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 93, 94, 92, 91, 105, 106,
+	95, 88, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 97, 0, 104, 89, 90, 103, 102,
+	96, 98, 99, 100, 101, 0, 107, 0, 0, 0,
+	0, 0, 0, 0, 93, 94, 92, 91, 105, 106,
+	95, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 97, 0, 104, 89, 90, 103, 102,
+	96, 98, 99, 100, 101, 0, 107, 7, 8, 12,
+	0, 0, 0, 0, 20, 21, 15, 0, 22, 23,
+	0, 0, 0, 6, 14, 16, 0, 0, 0, 0,
+	13, 19, 0, 0, 17, 18, 0, 29, 93, 94,
+	92, 91, 105, 106, 95, 0, 0, 24, 0, 0,
+	0, 0, 0, 28, 105, 106, 95, 97, 0, 104,
+	89, 90, 103, 102, 96, 98, 99, 100, 101, 97,
+	107, 0, 5, 0, 0, 102, 96, 98, 99, 100,
+	101, 0, 107, 105, 106, 95, 34, 0, 46, 0,
+	0, 0, 0, 33, 43, 0, 0, 0, 97, 0,
+	0, 35, 0, 0, 0, 96, 98, 99, 100, 101,
+	29, 107, 0, 0, 0, 0, 0, 0, 0, 37,
+	24, 160, 36, 48, 49, 50, 28, 157, 34, 0,
+	46, 42, 44, 45, 0, 33, 43, 0, 0, 0,
+	0, 0, 0, 35, 0, 0, 0, 0, 0, 0,
+	0, 0, 29, 0, 0, 0, 0, 0, 0, 0,
+	0, 37, 117, 0, 36, 48, 49, 50, 28, 34,
+	118, 46, 114, 42, 44, 45, 33, 43, 0, 0,
+	0, 0, 0, 0, 35, 0, 0, 0, 0, 0,
+	0, 0, 0, 29, 0, 0, 0, 0, 0, 0,
+	0, 0, 37, 24, 160, 36, 48, 49, 50, 28,
+	34, 0, 46, 0, 42, 44, 45, 33, 43, 0,
+	0, 0, 0, 0, 0, 35, 0, 0, 0, 0,
+	34, 0, 46, 0, 29, 0, 0, 33, 43, 0,
+	0, 0, 0, 37, 117, 35, 36, 48, 49, 50,
+	28, 0, 118, 0, 29, 42, 44, 45, 0, 0,
+	0, 0, 0, 37, 24, 0, 36, 48, 49, 50,
+	28, 0, 0, 0, 0, 42, 44, 45,
 }
-var yyPact = []int{
-
-	-1000, -1000, 533, -5, -1000, -1000, 292, -1000, -17, 152,
-	-1000, 292, -1000, 292, 107, 97, 88, -1000, -1000, -1000,
-	292, -1000, -1000, -29, 473, -1000, -1000, -1000, -1000, -1000,
-	-1000, 152, -1000, -1000, 292, 292, 292, 14, -1000, -1000,
-	142, 292, 116, 292, 95, -1000, 82, 240, -1000, -1000,
-	171, -1000, 446, 112, 419, -7, 17, 14, -24, -1000,
-	81, -19, -1000, 104, -42, 292, 292, 292, 292, 292,
-	292, 292, 292, 292, 292, 292, 292, 292, 292, 292,
-	292, -1, -1, -1, -1000, -11, -1000, -37, -1000, -8,
-	292, 473, -29, -1000, 152, 207, -1000, 55, -1000, -40,
-	-1000, -1000, 292, -1000, 292, 292, 34, -1000, 24, 19,
-	14, 292, -1000, -1000, 473, 57, 493, 18, 18, 18,
-	18, 18, 18, 18, 83, 83, -1, -1, -1, -1,
-	-44, -1000, -1000, -14, -1000, 266, -1000, -1000, 292, 180,
-	-1000, -1000, -1000, 160, 473, -1000, 338, 40, -1000, -1000,
-	-1000, -1000, -29, -1000, 157, 22, -1000, 473, -12, -1000,
-	205, 292, -1000, 154, -1000, -1000, 292, -1000, -1000, 292,
-	311, 151, -1000, 473, 146, 392, -1000, 292, -1000, -1000,
-	-1000, 144, 365, -1000, -1000, -1000, 140, -1000,
+
+var yyPact = [...]int16{
+	-32768, -32768, 862, -12, -32768, -32768, 1079, -32768, -32768, 38,
+	190, -32768, -32768, 1079, -32768, 1079, 1079, 151, 177, -32768,
+	134, 176, 135, 121, -32768, 72, -32768, -32768, 1079, -32768,
+	-32768, -47, 757, -32768, -32768, -32768, -32768, -32768, -32768, 72,
+	-32768, -32768, 1079, 1079, 1079, 1079, 73, -32768, -32768, -32768,
+	977, 1079, 151, 1079, 271, -32768, 709, 201, 661, 613,
+	-32768, 193, 200, 46, 41, -32768, 163, 149, 73, -53,
+	-32768, 175, 14, 19, 174, 10, -32768, 1079, 172, -32768,
+	169, 935, -32768, -32768, 563, 76, 1079, 1079, 1079, 1079,
+	1079, 1079, 1079, 1079, 1079, 1079, 1079, 1079, 1079, 1079,
+	1079, 1079, 1079, 1079, 1079, 1079, 1079, 1079, 49, 49,
+	49, 49, -32768, 105, -32768, -44, -32768, 45, 1079, 757,
+	-47, -32768, 72, 757, -32768, -32768, 1079, -32768, 229, 1079,
+	256, 151, 219, 268, 165, -32768, 1079, 1079, 91, -37,
+	44, 168, -24, -32768, 167, -32768, 166, 159, 73, 1079,
+	144, 73, 1079, 138, 515, -32768, 150, -32768, -13, -25,
+	1079, -32768, -32768, 757, 797, 861, -1, -1, -1, -1,
+	-1, -1, 109, 7, 7, 49, 49, 49, 49, 902,
+	182, 873, 109, 109, 49, 74, -32768, -32768, -40, 43,
+	-32768, 1059, -32768, -32768, 1079, 467, 266, 757, -32768, -32768,
+	-32768, 1079, -2, -32768, 132, 72, -32768, 265, -32768, 207,
+	-32768, -32768, 323, 8, -32768, -32768, -32768, 137, 123, -32768,
+	-32768, 126, -32768, -32768, -32768, -32768, -47, 53, -32768, -47,
+	-32768, -32768, -32768, 1018, -32768, -32768, 83, 757, -32768, 263,
+	115, 1079, -32768, 757, 40, -32768, 276, 262, -3, -32768,
+	73, 250, -32768, -32768, -32768, 1079, -32768, 6, 117, -32768,
+	-32768, 98, -4, -39, 1079, 258, -32768, -32768, -34, 757,
+	1079, -32768, -32768, 1079, -32768, -32768, -32768, -32768, -32768, -32768,
+	275, 257, 93, -32768, -32768, 1079, -32768, 757, -32768, 1079,
+	757, 249, 419, -32768, -32768, 1079, -32768, -32768, -47, 757,
+	-32768, -32768, 245, 371, -32768, -32768, -32768, 225, -32768,
 }
-var yyPgo = []int{
 
-	0, 190, 227, 2, 226, 223, 215, 210, 204, 203,
-	118, 6, 3, 0, 22, 107, 168, 199, 4, 197,
-	5, 195, 16, 193, 1, 182,
+var yyPgo = [...]int16{
+	0, 288, 319, 4, 310, 309, 308, 307, 9, 305,
+	304, 303, 302, 153, 301, 241, 8, 300, 298, 3,
+	1, 0, 12, 31, 233, 252, 297, 7, 294, 6,
+	293, 292, 2, 10, 291, 5, 283,
 }
-var yyR1 = []int{
 
+var yyR1 = [...]int8{
 	0, 1, 1, 1, 2, 2, 2, 3, 4, 4,
 	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
-	4, 4, 5, 5, 6, 6, 6, 7, 7, 8,
-	8, 9, 9, 10, 10, 10, 11, 11, 12, 12,
-	13, 13, 13, 13, 13, 13, 13, 13, 13, 13,
-	13, 13, 13, 13, 13, 13, 13, 13, 13, 13,
-	13, 13, 13, 13, 13, 13, 13, 14, 15, 15,
-	15, 15, 17, 16, 16, 18, 18, 18, 18, 19,
-	20, 20, 21, 21, 21, 22, 22, 23, 23, 23,
-	24, 24, 24, 25, 25,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 5, 5, 6, 6, 7,
+	7, 8, 9, 9, 9, 9, 10, 10, 11, 11,
+	12, 12, 13, 13, 13, 14, 14, 15, 15, 15,
+	15, 19, 19, 16, 16, 17, 17, 17, 17, 17,
+	17, 18, 18, 18, 18, 20, 20, 21, 21, 21,
+	21, 21, 21, 21, 21, 21, 21, 21, 21, 21,
+	21, 21, 21, 21, 21, 21, 21, 21, 21, 21,
+	21, 21, 21, 21, 21, 21, 21, 21, 21, 21,
+	21, 22, 22, 25, 23, 23, 23, 23, 23, 26,
+	24, 24, 27, 27, 27, 27, 27, 27, 28, 29,
+	29, 30, 30, 30, 31, 31, 31, 31, 32, 32,
+	33, 33, 34, 34, 34, 35, 35, 35, 36, 36,
 }
-var yyR2 = []int{
 
-	0, 1, 2, 3, 0, 2, 2, 1, 3, 1,
-	3, 5, 4, 6, 8, 9, 11, 7, 3, 4,
-	4, 2, 0, 5, 1, 2, 1, 1, 3, 1,
-	3, 1, 3, 1, 4, 3, 1, 3, 1, 3,
-	1, 1, 1, 1, 1, 1, 1, 1, 1, 3,
+var yyR2 = [...]int8{
+	0, 1, 2, 3, 0, 2, 2, 1, 3, 3,
+	1, 3, 5, 4, 6, 8, 4, 6, 2, 4,
+	6, 4, 4, 5, 9, 11, 7, 3, 4, 4,
+	7, 2, 4, 4, 2, 0, 5, 4, 5, 4,
+	3, 2, 1, 2, 1, 1, 1, 3, 1, 3,
+	1, 3, 1, 4, 3, 1, 3, 1, 1, 3,
+	3, 0, 4, 3, 3, 1, 3, 2, 3, 5,
+	4, 1, 2, 3, 4, 1, 3, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 2, 2, 2, 1, 1, 1,
-	1, 3, 3, 2, 4, 2, 3, 1, 1, 2,
-	5, 4, 1, 1, 3, 2, 3, 1, 3, 2,
-	3, 5, 1, 1, 1,
+	3, 3, 3, 3, 3, 3, 3, 2, 2, 2,
+	2, 1, 1, 1, 1, 1, 1, 3, 1, 3,
+	2, 4, 2, 3, 3, 5, 1, 1, 2, 5,
+	4, 1, 1, 3, 1, 3, 3, 5, 2, 4,
+	2, 3, 1, 3, 2, 3, 5, 1, 1, 1,
 }
-var yyChk = []int{
-
-	-1000, -1, -2, -6, -4, 45, 19, 5, -9, -15,
-	6, 24, 20, 13, 11, 12, 15, -10, -17, -16,
-	35, 31, 45, -12, -13, 16, 10, 22, 32, 30,
-	-19, -15, -14, -22, 39, 17, 52, 12, -10, 33,
-	34, 46, 47, 50, 49, -18, 48, 35, -22, -14,
-	-3, -1, -13, -3, -13, 31, -11, -7, -8, 31,
-	12, -11, 31, -13, -16, 47, 18, 4, 36, 37,
-	28, 27, 25, 26, 29, 38, 39, 40, 41, 42,
-	44, -13, -13, -13, -20, 35, 54, -23, -24, 31,
-	50, -13, -12, -10, -15, -13, 31, 31, 53, -12,
-	9, 6, 23, 21, 46, 14, 47, -20, 48, 49,
-	31, 46, 53, 53, -13, -13, -13, -13, -13, -13,
-	-13, -13, -13, -13, -13, -13, -13, -13, -13, -13,
-	-21, 53, 30, -11, 54, -25, 47, 45, 46, -13,
-	51, -18, 53, -3, -13, -3, -13, -12, 31, 31,
-	31, -20, -12, 53, -3, 47, -24, -13, 51, 9,
-	-5, 47, 6, -3, 9, 30, 46, 9, 7, 8,
-	-13, -3, 9, -13, -3, -13, 6, 47, 9, 9,
-	21, -3, -13, -3, 9, 6, -3, 9,
+
+var yyChk = [...]int16{
+	-32768, -1, -2, -9, -4, 70, 21, 5, 6, -12,
+	-13, -25, 7, 28, 22, 14, 23, 32, 33, 29,
+	12, 13, 16, 17, 45, -23, -26, -24, 51, 35,
+	70, -20, -21, 18, 11, 26, 47, 44, -28, -23,
+	-22, -33, 56, 19, 57, 58, 13, -13, 48, 49,
+	50, 71, 72, 36, -3, -1, -21, -3, -21, -21,
+	-25, 45, -3, 45, -15, -16, 50, 53, -10, -11,
+	45, 13, -15, 45, 13, -14, 45, 53, 74, -27,
+	73, 51, -33, -22, -21, -24, 72, 20, 4, 59,
+	60, 40, 39, 37, 38, 43, 63, 56, 64, 65,
+	66, 67, 62, 61, 58, 41, 42, 69, -21, -21,
+	-21, -21, -29, 51, 55, -34, -35, 45, 53, -21,
+	-20, -13, -23, -21, 10, 7, 27, 25, -6, 24,
+	-19, 34, -7, -8, 30, 31, 71, 15, 72, -17,
+	45, 44, -18, 45, 44, -29, 73, 74, 45, 71,
+	60, 45, 71, 72, -21, 45, 45, 52, -20, -32,
+	46, 52, 52, -21, -21, -21, -21, -21, -21, -21,
+	-21, -21, -21, -21, -21, -21, -21, -21, -21, -21,
+	-21, -21, -21, -21, -21, -30, 52, 44, -31, 45,
+	55, -36, 72, 70, 71, -21, -3, -21, -3, 10,
+	8, 24, -20, 10, 13, -23, 10, -8, 10, 45,
+	25, -3, -21, -20, 45, -16, 55, 72, 71, 45,
+	54, 72, 45, 45, 45, -29, -20, 45, -29, -20,
+	45, 54, -27, 72, 52, 52, 72, -21, 52, -3,
+	72, 71, -35, -21, 54, 10, -5, -3, -20, 25,
+	45, -19, 10, 25, -3, 72, 7, 45, 44, 45,
+	45, 44, 59, -32, 46, -3, 10, 44, 45, -21,
+	71, 10, 8, 9, 10, 25, -3, -29, 10, -3,
+	-21, -3, 71, 45, 45, 71, 52, -21, 10, 71,
+	-21, -3, -21, -3, 7, 72, 10, 45, -20, -21,
+	10, 25, -3, -21, -3, 10, 7, -3, 10,
 }
-var yyDef = []int{
-
-	4, -2, 1, 2, 5, 6, 24, 26, 0, 9,
-	4, 0, 4, 0, 0, 0, 0, -2, 69, 70,
-	0, 33, 3, 25, 38, 40, 41, 42, 43, 44,
-	45, 46, 47, 48, 0, 0, 0, 0, 68, 67,
-	0, 0, 0, 0, 0, 73, 0, 0, 77, 78,
-	0, 7, 0, 0, 0, 36, 0, 0, 27, 29,
-	0, 21, 36, 0, 70, 0, 0, 0, 0, 0,
+
+var yyDef = [...]int16{
+	4, -2, 1, 2, 5, 6, 42, 44, 45, 0,
+	-2, 10, 4, 0, 4, 0, 0, 0, 0, 4,
+	0, 0, 0, 0, 52, 113, 115, 116, 0, 118,
+	3, 43, 75, 77, 78, 79, 80, 81, 82, 83,
+	84, 85, 0, 0, 0, 0, 0, 114, 111, 112,
+	0, 0, 0, 0, 0, 7, 0, 0, 0, 0,
+	18, 61, 0, 57, 0, 58, 0, 0, 0, 46,
+	48, 0, 31, 57, 0, 34, 55, 0, 0, 120,
+	0, 0, 126, 127, 0, 116, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 64, 65, 66, 79, 0, 85, 0, 87, 33,
-	0, 92, 8, -2, 0, 0, 35, 0, 75, 0,
-	10, 4, 0, 4, 0, 0, 0, 18, 0, 0,
-	0, 0, 71, 72, 39, 49, 50, 51, 52, 53,
-	54, 55, 56, 57, 58, 59, 60, 61, 62, 63,
-	0, 4, 82, 83, 86, 89, 93, 94, 0, 0,
-	34, 74, 76, 0, 12, 22, 0, 0, 37, 28,
-	30, 19, 20, 4, 0, 0, 88, 90, 0, 11,
-	0, 0, 4, 0, 81, 84, 0, 13, 4, 0,
-	0, 0, 80, 91, 0, 0, 4, 0, 17, 14,
-	4, 0, 0, 23, 15, 4, 0, 16,
+	0, 0, 0, 0, 0, 0, 0, 0, 107, 108,
+	109, 110, 128, 0, 140, 0, 142, 52, 0, 147,
+	8, -2, 0, 9, 11, 4, 0, 4, 0, 0,
+	0, 0, 0, 0, 0, 4, 0, 0, 0, 0,
+	65, 0, 0, 71, 0, 27, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 54, 0, 122, 0, 0,
+	0, 117, 119, 76, 86, 87, 88, 89, 90, 91,
+	92, 93, 94, 95, 96, 97, 98, 99, 100, 101,
+	102, 103, 104, 105, 106, 0, 4, 131, 132, 134,
+	141, 144, 148, 149, 0, 0, 0, 13, 35, 16,
+	4, 0, 0, 19, 0, 61, 21, 0, 22, 0,
+	4, 41, 0, 0, 59, 60, 63, 0, 0, 67,
+	64, 0, 72, 47, 49, 28, 29, 0, 32, 33,
+	56, 53, 121, 0, 123, 124, 0, 138, 4, 0,
+	0, 0, 143, 145, 0, 12, 0, 0, 0, 4,
+	0, 0, 23, 4, 40, 0, 4, 68, 0, 66,
+	73, 0, 0, 0, 0, 0, 130, 133, 136, 135,
+	0, 14, 4, 0, 17, 4, 37, 62, 20, 39,
+	0, 0, 0, 70, 74, 0, 125, 139, 129, 0,
+	146, 0, 0, 38, 4, 0, 26, 69, 30, 137,
+	15, 4, 0, 0, 36, 24, 4, 0, 25,
 }
-var yyTok1 = []int{
 
+var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 52, 3, 42, 3, 3,
-	35, 53, 40, 38, 47, 39, 49, 41, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 48, 45,
-	37, 46, 36, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 57, 3, 67, 62, 3,
+	51, 52, 64, 63, 72, 56, 74, 65, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 73, 70,
+	60, 71, 59, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 50, 3, 51, 44, 3, 3, 3, 3, 3,
+	3, 53, 66, 54, 69, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 34, 3, 54,
+	3, 3, 3, 50, 61, 55, 58,
 }
-var yyTok2 = []int{
 
+var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
-	32, 33, 43,
+	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
+	42, 43, 44, 45, 46, 47, 48, 49, 68,
 }
-var yyTok3 = []int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
+var yyErrorMessages = [...]struct {
+	state int
+	token int
+	msg   string
+}{}
+
 //line yaccpar:1
 
 /*	parser for yacc output	*/
 
-var yyDebug = 0
+var (
+	yyDebug        = 0
+	yyErrorVerbose = false
+)
 
 type yyLexer interface {
 	Lex(lval *yySymType) int
 	Error(s string)
 }
 
-const yyFlag = -1000
+type yyParser interface {
+	Parse(yyLexer) int
+	Lookahead() int
+}
+
+type yyParserImpl struct {
+	lval  yySymType
+	stack [yyInitialStackSize]yySymType
+	char  int
+}
+
+func (p *yyParserImpl) Lookahead() int {
+	return p.char
+}
+
+func yyNewParser() yyParser {
+	return &yyParserImpl{}
+}
+
+const yyFlag = -32768
 
 func yyTokname(c int) string {
-	// 4 is TOKSTART above
-	if c >= 4 && c-4 < len(yyToknames) {
-		if yyToknames[c-4] != "" {
-			return yyToknames[c-4]
+	if c >= 1 && c-1 < len(yyToknames) {
+		if yyToknames[c-1] != "" {
+			return yyToknames[c-1]
 		}
 	}
 	return __yyfmt__.Sprintf("tok-%v", c)
@@ -361,51 +634,127 @@ func yyStatname(s int) string {
 	return __yyfmt__.Sprintf("state-%v", s)
 }
 
-func yylex1(lex yyLexer, lval *yySymType) int {
-	c := 0
-	char := lex.Lex(lval)
+func yyErrorMessage(state, lookAhead int) string {
+	const TOKSTART = 4
+
+	if !yyErrorVerbose {
+		return "syntax error"
+	}
+
+	for _, e := range yyErrorMessages {
+		if e.state == state && e.token == lookAhead {
+			return "syntax error: " + e.msg
+		}
+	}
+
+	res := "syntax error: unexpected " + yyTokname(lookAhead)
+
+	// To match Bison, suggest at most four expected tokens.
+	expected := make([]int, 0, 4)
+
+	// Look for shiftable tokens.
+	base := int(yyPact[state])
+	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
+			if len(expected) == cap(expected) {
+				return res
+			}
+			expected = append(expected, tok)
+		}
+	}
+
+	if yyDef[state] == -2 {
+		i := 0
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
+			i += 2
+		}
+
+		// Look for tokens that we accept or reduce.
+		for i += 2; yyExca[i] >= 0; i += 2 {
+			tok := int(yyExca[i])
+			if tok < TOKSTART || yyExca[i+1] == 0 {
+				continue
+			}
+			if len(expected) == cap(expected) {
+				return res
+			}
+			expected = append(expected, tok)
+		}
+
+		// If the default action is to accept or reduce, give up.
+		if yyExca[i+1] != 0 {
+			return res
+		}
+	}
+
+	for i, tok := range expected {
+		if i == 0 {
+			res += ", expecting "
+		} else {
+			res += " or "
+		}
+		res += yyTokname(tok)
+	}
+	return res
+}
+
+func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
+	token = 0
+	char = lex.Lex(lval)
 	if char <= 0 {
-		c = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		c = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			c = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		c = yyTok3[i+0]
-		if c == char {
-			c = yyTok3[i+1]
+		token = int(yyTok3[i+0])
+		if token == char {
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
-	if c == 0 {
-		c = yyTok2[1] /* unknown char */
+	if token == 0 {
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
-		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(c), uint(char))
+		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
 	}
-	return c
+	return char, token
 }
 
 func yyParse(yylex yyLexer) int {
+	return yyNewParser().Parse(yylex)
+}
+
+func (yyrcvr *yyParserImpl) Parse(yylex yyLexer) int {
 	var yyn int
-	var yylval yySymType
 	var yyVAL yySymType
-	yyS := make([]yySymType, yyMaxDepth)
+	var yyDollar []yySymType
+	_ = yyDollar // silence set and not used
+	yyS := yyrcvr.stack[:]
 
 	Nerrs := 0   /* number of errors */
 	Errflag := 0 /* error recovery flag */
 	yystate := 0
-	yychar := -1
+	yyrcvr.char = -1
+	yytoken := -1 // yyrcvr.char translated into internal numbering
+	defer func() {
+		// Make sure we report no lookahead when not parsing.
+		yystate = -1
+		yyrcvr.char = -1
+		yytoken = -1
+	}()
 	yyp := -1
 	goto yystack
 
@@ -418,7 +767,7 @@ ret1:
 yystack:
 	/* put a state and value onto the stack */
 	if yyDebug >= 4 {
-		__yyfmt__.Printf("char %v in %v\n", yyTokname(yychar), yyStatname(yystate))
+		__yyfmt__.Printf("char %v in %v\n", yyTokname(yytoken), yyStatname(yystate))
 	}
 
 	yyp++
@@ -431,21 +780,22 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
-	if yychar < 0 {
-		yychar = yylex1(yylex, &yylval)
+	if yyrcvr.char < 0 {
+		yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
 	}
-	yyn += yychar
+	yyn += yytoken
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yychar { /* valid shift */
-		yychar = -1
-		yyVAL = yylval
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
+		yyrcvr.char = -1
+		yytoken = -1
+		yyVAL = yyrcvr.lval
 		yystate = yyn
 		if Errflag > 0 {
 			Errflag--
@@ -455,27 +805,27 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
-		if yychar < 0 {
-			yychar = yylex1(yylex, &yylval)
+		if yyrcvr.char < 0 {
+			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
 		}
 
-		/* look through exception list */
+		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
-			if yyn < 0 || yyn == yychar {
+			yyn = int(yyExca[xi+0])
+			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -484,11 +834,11 @@ yydefault:
 		/* error ... attempt to resume parsing */
 		switch Errflag {
 		case 0: /* brand new error */
-			yylex.Error("syntax error")
+			yylex.Error(yyErrorMessage(yystate, yytoken))
 			Nerrs++
 			if yyDebug >= 1 {
 				__yyfmt__.Printf("%s", yyStatname(yystate))
-				__yyfmt__.Printf(" saw %s\n", yyTokname(yychar))
+				__yyfmt__.Printf(" saw %s\n", yyTokname(yytoken))
 			}
 			fallthrough
 
@@ -497,10 +847,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -516,12 +866,13 @@ yydefault:
 
 		case 3: /* no shift yet; clobber input char */
 			if yyDebug >= 2 {
-				__yyfmt__.Printf("error recovery discards %s\n", yyTokname(yychar))
+				__yyfmt__.Printf("error recovery discards %s\n", yyTokname(yytoken))
 			}
-			if yychar == yyEofCode {
+			if yytoken == yyEofCode {
 				goto ret1
 			}
-			yychar = -1
+			yyrcvr.char = -1
+			yytoken = -1
 			goto yynewstate /* try again in the same state */
 		}
 	}
@@ -535,599 +886,1128 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
+	// yyp is now the index of $0. Perform the default action. Iff the
+	// reduced production is ε, $1 is possibly out of range.
+	if yyp+1 >= len(yyS) {
+		nyys := make([]yySymType, len(yyS)*2)
+		copy(nyys, yyS)
+		yyS = nyys
+	}
 	yyVAL = yyS[yyp+1]
 
-	/* consult goto list to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	/* consult goto table to find next state */
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
 	switch yynt {
 
 	case 1:
-		//line parser.go.y:73
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:111
 		{
-			yyVAL.stmts = yyS[yypt-0].stmts
+			yyVAL.stmts = yyDollar[1].stmts
 			if l, ok := yylex.(*Lexer); ok {
 				l.Stmts = yyVAL.stmts
 			}
 		}
 	case 2:
-		//line parser.go.y:79
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:117
 		{
-			yyVAL.stmts = append(yyS[yypt-1].stmts, yyS[yypt-0].stmt)
+			yyVAL.stmts = append(yyDollar[1].stmts, yyDollar[2].stmt)
 			if l, ok := yylex.(*Lexer); ok {
 				l.Stmts = yyVAL.stmts
 			}
 		}
 	case 3:
-		//line parser.go.y:85
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:123
 		{
-			yyVAL.stmts = append(yyS[yypt-2].stmts, yyS[yypt-1].stmt)
+			yyVAL.stmts = append(yyDollar[1].stmts, yyDollar[2].stmt)
 			if l, ok := yylex.(*Lexer); ok {
 				l.Stmts = yyVAL.stmts
 			}
 		}
 	case 4:
-		//line parser.go.y:93
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line qsp.go.y:131
 		{
 			yyVAL.stmts = []qsa.Stmt{}
 		}
 	case 5:
-		//line parser.go.y:96
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:134
 		{
-			yyVAL.stmts = append(yyS[yypt-1].stmts, yyS[yypt-0].stmt)
+			yyVAL.stmts = append(yyDollar[1].stmts, yyDollar[2].stmt)
 		}
 	case 6:
-		//line parser.go.y:99
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:137
 		{
-			yyVAL.stmts = yyS[yypt-1].stmts
+			yyVAL.stmts = yyDollar[1].stmts
 		}
 	case 7:
-		//line parser.go.y:104
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:142
 		{
-			yyVAL.stmts = yyS[yypt-0].stmts
+			yyVAL.stmts = yyDollar[1].stmts
 		}
 	case 8:
-		//line parser.go.y:109
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:147
 		{
-			yyVAL.stmt = &qsa.AssignStmt{Lhs: yyS[yypt-2].exprlist, Rhs: yyS[yypt-0].exprlist}
-			yyVAL.stmt.SetLine(yyS[yypt-2].exprlist[0].Line())
+			yyVAL.stmt = &qsa.AssignStmt{Lhs: yyDollar[1].exprlist, Rhs: yyDollar[3].exprlist}
+			yyVAL.stmt.SetSpan(yyDollar[1].exprlist[0], yyDollar[3].exprlist[len(yyDollar[3].exprlist)-1])
 		}
 	case 9:
-		//line parser.go.y:114
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:151
 		{
-			if _, ok := yyS[yypt-0].expr.(*qsa.FuncCallExpr); !ok {
-				yylex.(*Lexer).Error("parse error")
-			} else {
-				yyVAL.stmt = &qsa.FuncCallStmt{Expr: yyS[yypt-0].expr}
-				yyVAL.stmt.SetLine(yyS[yypt-0].expr.Line())
-			}
+			yyVAL.stmt = &qsa.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: yyDollar[2].token.Str, Rhs: yyDollar[3].expr}
+			yyVAL.stmt.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 10:
-		//line parser.go.y:122
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:156
 		{
-			yyVAL.stmt = &qsa.DoBlockStmt{Stmts: yyS[yypt-1].stmts}
-			yyVAL.stmt.SetLine(yyS[yypt-2].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			if _, ok := yyDollar[1].expr.(*qsa.FuncCallExpr); !ok {
+				yylex.(*Lexer).Error("parse error")
+			} else {
+				yyVAL.stmt = &qsa.FuncCallStmt{Expr: yyDollar[1].expr}
+				yyVAL.stmt.SetSpan(yyDollar[1].expr, yyDollar[1].expr)
+			}
 		}
 	case 11:
-		//line parser.go.y:127
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:164
 		{
-			yyVAL.stmt = &qsa.WhileStmt{Condition: yyS[yypt-3].expr, Stmts: yyS[yypt-1].stmts}
-			yyVAL.stmt.SetLine(yyS[yypt-4].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.DoBlockStmt{Stmts: yyDollar[2].stmts}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[3].token.End)
 		}
 	case 12:
-		//line parser.go.y:132
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:169
 		{
-			yyVAL.stmt = &qsa.RepeatStmt{Condition: yyS[yypt-0].expr, Stmts: yyS[yypt-2].stmts}
-			yyVAL.stmt.SetLine(yyS[yypt-3].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].expr.Line())
+			yyVAL.stmt = &qsa.WhileStmt{Condition: yyDollar[2].expr, Stmts: yyDollar[4].stmts}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[5].token.End)
 		}
 	case 13:
-		//line parser.go.y:137
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:174
 		{
-			yyVAL.stmt = &qsa.IfStmt{Condition: yyS[yypt-4].expr, Then: yyS[yypt-2].stmts}
-			cur := yyVAL.stmt
-			for _, elseif := range yyS[yypt-1].stmts {
-				cur.(*qsa.IfStmt).Else = []qsa.Stmt{elseif}
-				cur = elseif
-			}
-			yyVAL.stmt.SetLine(yyS[yypt-5].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.RepeatStmt{Condition: yyDollar[4].expr, Stmts: yyDollar[2].stmts}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[4].expr)
 		}
 	case 14:
-		//line parser.go.y:147
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line qsp.go.y:178
 		{
-			yyVAL.stmt = &qsa.IfStmt{Condition: yyS[yypt-6].expr, Then: yyS[yypt-4].stmts}
+			yyVAL.stmt = &qsa.IfStmt{Condition: yyDollar[2].expr, Then: yyDollar[4].stmts}
 			cur := yyVAL.stmt
-			for _, elseif := range yyS[yypt-3].stmts {
+			for _, elseif := range yyDollar[5].stmts {
+				elseif.SetEnd(yyDollar[6].token.End)
 				cur.(*qsa.IfStmt).Else = []qsa.Stmt{elseif}
 				cur = elseif
 			}
-			cur.(*qsa.IfStmt).Else = yyS[yypt-1].stmts
-			yyVAL.stmt.SetLine(yyS[yypt-7].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[6].token.End)
 		}
 	case 15:
-		//line parser.go.y:158
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line qsp.go.y:189
 		{
-			yyVAL.stmt = &qsa.NumberForStmt{Name: yyS[yypt-7].token.Str, Init: yyS[yypt-5].expr, Limit: yyS[yypt-3].expr, Stmts: yyS[yypt-1].stmts}
-			yyVAL.stmt.SetLine(yyS[yypt-8].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.IfStmt{Condition: yyDollar[2].expr, Then: yyDollar[4].stmts}
+			cur := yyVAL.stmt
+			for _, elseif := range yyDollar[5].stmts {
+				elseif.SetEnd(yyDollar[8].token.End)
+				cur.(*qsa.IfStmt).Else = []qsa.Stmt{elseif}
+				cur = elseif
+			}
+			cur.(*qsa.IfStmt).Else = yyDollar[7].stmts
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[8].token.End)
 		}
 	case 16:
-		//line parser.go.y:163
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:201
 		{
-			yyVAL.stmt = &qsa.NumberForStmt{Name: yyS[yypt-9].token.Str, Init: yyS[yypt-7].expr, Limit: yyS[yypt-5].expr, Step: yyS[yypt-3].expr, Stmts: yyS[yypt-1].stmts}
-			yyVAL.stmt.SetLine(yyS[yypt-10].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.SwitchStmt{Subject: yyDollar[2].expr, Cases: yyDollar[3].cases}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[4].token.End)
 		}
 	case 17:
-		//line parser.go.y:168
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line qsp.go.y:206
 		{
-			yyVAL.stmt = &qsa.GenericForStmt{Names: yyS[yypt-5].namelist, Exprs: yyS[yypt-3].exprlist, Stmts: yyS[yypt-1].stmts}
-			yyVAL.stmt.SetLine(yyS[yypt-6].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.SwitchStmt{Subject: yyDollar[2].expr, Cases: yyDollar[3].cases, Else: yyDollar[5].stmts}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[6].token.End)
 		}
 	case 18:
-		//line parser.go.y:173
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:211
 		{
-			yyVAL.stmt = &qsa.FuncDefStmt{Name: yyS[yypt-1].funcname, Func: yyS[yypt-0].funcexpr}
-			yyVAL.stmt.SetLine(yyS[yypt-2].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].funcexpr.LastLine())
+			if _, ok := yyDollar[2].expr.(*qsa.FuncCallExpr); !ok {
+				yylex.(*Lexer).TokenError(yyDollar[1].token, "proc call expected after defer")
+			}
+			yyVAL.stmt = &qsa.DeferStmt{Expr: yyDollar[2].expr}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].expr)
 		}
 	case 19:
-		//line parser.go.y:178
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:218
 		{
-			yyVAL.stmt = &qsa.LocalAssignStmt{Names: []string{yyS[yypt-1].token.Str}, Exprs: []qsa.Expr{yyS[yypt-0].funcexpr}}
-			yyVAL.stmt.SetLine(yyS[yypt-3].token.Pos.Line)
-			yyVAL.stmt.SetLastLine(yyS[yypt-0].funcexpr.LastLine())
+			name := &qsa.IdentExpr{Value: yyDollar[2].token.Str}
+			name.SetPos(yyDollar[2].token.Pos)
+			name.SetEnd(yyDollar[2].token.End)
+			yyVAL.stmt = &qsa.ClassStmt{Name: name, Methods: yyDollar[3].methods}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[4].token.End)
 		}
 	case 20:
-		//line parser.go.y:183
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line qsp.go.y:226
 		{
-			yyVAL.stmt = &qsa.LocalAssignStmt{Names: yyS[yypt-2].namelist, Exprs: yyS[yypt-0].exprlist}
-			yyVAL.stmt.SetLine(yyS[yypt-3].token.Pos.Line)
+			name := &qsa.IdentExpr{Value: yyDollar[2].token.Str}
+			name.SetPos(yyDollar[2].token.Pos)
+			name.SetEnd(yyDollar[2].token.End)
+			yyVAL.stmt = &qsa.ClassStmt{Name: name, Base: yyDollar[4].expr, Methods: yyDollar[5].methods}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[6].token.End)
 		}
 	case 21:
-		//line parser.go.y:187
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:234
 		{
-			yyVAL.stmt = &qsa.LocalAssignStmt{Names: yyS[yypt-0].namelist, Exprs: []qsa.Expr{}}
-			yyVAL.stmt.SetLine(yyS[yypt-1].token.Pos.Line)
+			yyVAL.stmt = &qsa.TryStmt{Stmts: yyDollar[2].stmts, Catch: yyDollar[3].clause}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[4].token.End)
 		}
 	case 22:
-		//line parser.go.y:193
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:239
 		{
-			yyVAL.stmts = []qsa.Stmt{}
+			yyVAL.stmt = &qsa.TryStmt{Stmts: yyDollar[2].stmts, Finally: yyDollar[3].clause}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[4].token.End)
 		}
 	case 23:
-		//line parser.go.y:196
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:244
 		{
-			yyVAL.stmts = append(yyS[yypt-4].stmts, &qsa.IfStmt{Condition: yyS[yypt-2].expr, Then: yyS[yypt-0].stmts})
-			yyVAL.stmts[len(yyVAL.stmts)-1].SetLine(yyS[yypt-3].token.Pos.Line)
+			yyVAL.stmt = &qsa.TryStmt{Stmts: yyDollar[2].stmts, Catch: yyDollar[3].clause, Finally: yyDollar[4].clause}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[5].token.End)
 		}
 	case 24:
-		//line parser.go.y:202
+		yyDollar = yyS[yypt-9 : yypt+1]
+//line qsp.go.y:249
 		{
-			yyVAL.stmt = &qsa.ReturnStmt{Exprs: nil}
-			yyVAL.stmt.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.NumberForStmt{Name: yyDollar[2].token.Str, Init: yyDollar[4].expr, Limit: yyDollar[6].expr, Stmts: yyDollar[8].stmts}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[9].token.End)
 		}
 	case 25:
-		//line parser.go.y:206
+		yyDollar = yyS[yypt-11 : yypt+1]
+//line qsp.go.y:254
 		{
-			yyVAL.stmt = &qsa.ReturnStmt{Exprs: yyS[yypt-0].exprlist}
-			yyVAL.stmt.SetLine(yyS[yypt-1].token.Pos.Line)
+			yyVAL.stmt = &qsa.NumberForStmt{Name: yyDollar[2].token.Str, Init: yyDollar[4].expr, Limit: yyDollar[6].expr, Step: yyDollar[8].expr, Stmts: yyDollar[10].stmts}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[11].token.End)
 		}
 	case 26:
-		//line parser.go.y:210
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line qsp.go.y:259
 		{
-			yyVAL.stmt = &qsa.BreakStmt{}
-			yyVAL.stmt.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.GenericForStmt{Names: yyDollar[2].binds.names, Exprs: yyDollar[4].exprlist, Patterns: yyDollar[2].binds.patterns, Stmts: yyDollar[6].stmts}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[7].token.End)
 		}
 	case 27:
-		//line parser.go.y:216
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:264
 		{
-			yyVAL.funcname = yyS[yypt-0].funcname
+			yyVAL.stmt = &qsa.FuncDefStmt{Name: yyDollar[2].funcname, Func: yyDollar[3].funcexpr}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[3].funcexpr)
 		}
 	case 28:
-		//line parser.go.y:219
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:268
 		{
-			yyVAL.funcname = &qsa.FuncName{Func: nil, Receiver: yyS[yypt-2].funcname.Func, Method: yyS[yypt-0].token.Str}
+			yyVAL.stmt = &qsa.LocalAssignStmt{Names: []string{yyDollar[3].token.Str}, Exprs: []qsa.Expr{yyDollar[4].funcexpr}}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[4].funcexpr)
 		}
 	case 29:
-		//line parser.go.y:224
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:272
 		{
-			yyVAL.funcname = &qsa.FuncName{Func: &qsa.IdentExpr{Value: yyS[yypt-0].token.Str}}
-			yyVAL.funcname.Func.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.LocalAssignStmt{Names: yyDollar[2].binds.names, Exprs: yyDollar[4].exprlist, Patterns: yyDollar[2].binds.patterns}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[4].exprlist[len(yyDollar[4].exprlist)-1])
 		}
 	case 30:
-		//line parser.go.y:228
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line qsp.go.y:276
 		{
-			key := &qsa.StringExpr{Value: yyS[yypt-0].token.Str}
-			key.SetLine(yyS[yypt-0].token.Pos.Line)
-			fn := &qsa.AttrGetExpr{Object: yyS[yypt-2].funcname.Func, Key: key}
-			fn.SetLine(yyS[yypt-0].token.Pos.Line)
-			yyVAL.funcname = &qsa.FuncName{Func: fn}
+			if yyDollar[4].token.Str != "close" {
+				yylex.(*Lexer).TokenError(yyDollar[4].token, "unknown attribute '"+yyDollar[4].token.Str+"'")
+			}
+			yyVAL.stmt = &qsa.LocalAssignStmt{Names: []string{yyDollar[2].token.Str}, Exprs: yyDollar[7].exprlist, Close: true}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[7].exprlist[len(yyDollar[7].exprlist)-1])
 		}
 	case 31:
-		//line parser.go.y:237
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:283
 		{
-			yyVAL.exprlist = []qsa.Expr{yyS[yypt-0].expr}
+			if yyDollar[2].binds.patterns != nil {
+				yylex.(*Lexer).TokenError(yyDollar[1].token, "dcl of a pattern needs a value")
+			}
+			yyVAL.stmt = &qsa.LocalAssignStmt{Names: yyDollar[2].binds.names, Exprs: []qsa.Expr{}}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].binds.last)
 		}
 	case 32:
-		//line parser.go.y:240
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:290
 		{
-			yyVAL.exprlist = append(yyS[yypt-2].exprlist, yyS[yypt-0].expr)
+			yyVAL.stmt = &qsa.GlobalStmt{Names: []string{yyDollar[3].token.Str}, Exprs: []qsa.Expr{yyDollar[4].funcexpr}}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[4].funcexpr)
 		}
 	case 33:
-		//line parser.go.y:245
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:294
 		{
-			yyVAL.expr = &qsa.IdentExpr{Value: yyS[yypt-0].token.Str}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.GlobalStmt{Names: tokenNames(yyDollar[2].tokens), Exprs: yyDollar[4].exprlist}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[4].exprlist[len(yyDollar[4].exprlist)-1])
 		}
 	case 34:
-		//line parser.go.y:249
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:298
 		{
-			yyVAL.expr = &qsa.AttrGetExpr{Object: yyS[yypt-3].expr, Key: yyS[yypt-1].expr}
-			yyVAL.expr.SetLine(yyS[yypt-3].expr.Line())
+			yyVAL.stmt = &qsa.GlobalStmt{Names: tokenNames(yyDollar[2].tokens), Exprs: []qsa.Expr{}}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[2].tokens[len(yyDollar[2].tokens)-1].End)
 		}
 	case 35:
-		//line parser.go.y:253
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line qsp.go.y:305
 		{
-			key := &qsa.StringExpr{Value: yyS[yypt-0].token.Str}
-			key.SetLine(yyS[yypt-0].token.Pos.Line)
-			yyVAL.expr = &qsa.AttrGetExpr{Object: yyS[yypt-2].expr, Key: key}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.stmts = []qsa.Stmt{}
 		}
 	case 36:
-		//line parser.go.y:261
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:308
 		{
-			yyVAL.namelist = []string{yyS[yypt-0].token.Str}
+			yyVAL.stmts = append(yyDollar[1].stmts, &qsa.IfStmt{Condition: yyDollar[3].expr, Then: yyDollar[5].stmts})
+			yyVAL.stmts[len(yyVAL.stmts)-1].SetPos(yyDollar[2].token.Pos)
 		}
 	case 37:
-		//line parser.go.y:264
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:314
 		{
-			yyVAL.namelist = append(yyS[yypt-2].namelist, yyS[yypt-0].token.Str)
+			yyVAL.cases = []*qsa.SwitchCase{&qsa.SwitchCase{Values: yyDollar[2].exprlist, Stmts: yyDollar[4].stmts}}
+			yyVAL.cases[0].SetPos(yyDollar[1].token.Pos)
+			yyVAL.cases[0].SetEnd(yyDollar[3].token.End)
 		}
 	case 38:
-		//line parser.go.y:269
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:319
 		{
-			yyVAL.exprlist = []qsa.Expr{yyS[yypt-0].expr}
+			yyVAL.cases = append(yyDollar[1].cases, &qsa.SwitchCase{Values: yyDollar[3].exprlist, Stmts: yyDollar[5].stmts})
+			yyVAL.cases[len(yyVAL.cases)-1].SetPos(yyDollar[2].token.Pos)
+			yyVAL.cases[len(yyVAL.cases)-1].SetEnd(yyDollar[4].token.End)
 		}
 	case 39:
-		//line parser.go.y:272
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:326
 		{
-			yyVAL.exprlist = append(yyS[yypt-2].exprlist, yyS[yypt-0].expr)
+			yyVAL.clause = &qsa.TryClause{Name: yyDollar[2].token.Str, Stmts: yyDollar[4].stmts}
+			yyVAL.clause.SetPos(yyDollar[1].token.Pos)
+			yyVAL.clause.SetEnd(yyDollar[3].token.End)
 		}
 	case 40:
-		//line parser.go.y:277
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:331
 		{
-			yyVAL.expr = &qsa.NilExpr{}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.clause = &qsa.TryClause{Stmts: yyDollar[3].stmts}
+			yyVAL.clause.SetPos(yyDollar[1].token.Pos)
+			yyVAL.clause.SetEnd(yyDollar[2].token.End)
 		}
 	case 41:
-		//line parser.go.y:281
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:338
 		{
-			yyVAL.expr = &qsa.FalseExpr{}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.clause = &qsa.TryClause{Stmts: yyDollar[2].stmts}
+			yyVAL.clause.SetPos(yyDollar[1].token.Pos)
+			yyVAL.clause.SetEnd(yyDollar[1].token.End)
 		}
 	case 42:
-		//line parser.go.y:285
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:345
 		{
-			yyVAL.expr = &qsa.TrueExpr{}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.ReturnStmt{Exprs: nil}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[1].token.End)
 		}
 	case 43:
-		//line parser.go.y:289
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:350
 		{
-			yyVAL.expr = &qsa.NumberExpr{Value: yyS[yypt-0].token.Str}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.ReturnStmt{Exprs: yyDollar[2].exprlist}
+			yyVAL.stmt.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].exprlist[len(yyDollar[2].exprlist)-1])
 		}
 	case 44:
-		//line parser.go.y:293
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:354
 		{
-			yyVAL.expr = &qsa.Comma3Expr{}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.stmt = &qsa.BreakStmt{}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[1].token.End)
 		}
 	case 45:
-		//line parser.go.y:297
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:359
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.stmt = &qsa.ContinueStmt{}
+			yyVAL.stmt.SetPos(yyDollar[1].token.Pos)
+			yyVAL.stmt.SetEnd(yyDollar[1].token.End)
 		}
 	case 46:
-		//line parser.go.y:300
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:366
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.funcname = yyDollar[1].funcname
 		}
 	case 47:
-		//line parser.go.y:303
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:369
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.funcname = &qsa.FuncName{Func: nil, Receiver: yyDollar[1].funcname.Func, Method: yyDollar[3].token.Str}
 		}
 	case 48:
-		//line parser.go.y:306
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:374
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.funcname = &qsa.FuncName{Func: &qsa.IdentExpr{Value: yyDollar[1].token.Str}}
+			yyVAL.funcname.Func.SetPos(yyDollar[1].token.Pos)
+			yyVAL.funcname.Func.SetEnd(yyDollar[1].token.End)
 		}
 	case 49:
-		//line parser.go.y:309
-		{
-			yyVAL.expr = &qsa.LogicalOpExpr{Lhs: yyS[yypt-2].expr, Operator: "or", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:379
+		{
+			key := &qsa.StringExpr{Value: yyDollar[3].token.Str}
+			key.SetPos(yyDollar[3].token.Pos)
+			key.SetEnd(yyDollar[3].token.End)
+			fn := &qsa.AttrGetExpr{Object: yyDollar[1].funcname.Func, Key: key}
+			fn.SetSpan(yyDollar[1].funcname.Func, key)
+			yyVAL.funcname = &qsa.FuncName{Func: fn}
 		}
 	case 50:
-		//line parser.go.y:313
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:389
 		{
-			yyVAL.expr = &qsa.LogicalOpExpr{Lhs: yyS[yypt-2].expr, Operator: "and", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.exprlist = []qsa.Expr{yyDollar[1].expr}
 		}
 	case 51:
-		//line parser.go.y:317
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:392
 		{
-			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyS[yypt-2].expr, Operator: ">", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.exprlist = append(yyDollar[1].exprlist, yyDollar[3].expr)
 		}
 	case 52:
-		//line parser.go.y:321
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:397
 		{
-			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyS[yypt-2].expr, Operator: "<", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.expr = &qsa.IdentExpr{Value: yyDollar[1].token.Str}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
 		}
 	case 53:
-		//line parser.go.y:325
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:402
 		{
-			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyS[yypt-2].expr, Operator: ">=", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.expr = &qsa.AttrGetExpr{Object: yyDollar[1].expr, Key: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, tokenNode(yyDollar[4].token))
 		}
 	case 54:
-		//line parser.go.y:329
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:406
 		{
-			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyS[yypt-2].expr, Operator: "<=", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			key := &qsa.StringExpr{Value: yyDollar[3].token.Str}
+			key.SetPos(yyDollar[3].token.Pos)
+			key.SetEnd(yyDollar[3].token.End)
+			yyVAL.expr = &qsa.AttrGetExpr{Object: yyDollar[1].expr, Key: key}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, key)
 		}
 	case 55:
-		//line parser.go.y:333
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:415
 		{
-			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyS[yypt-2].expr, Operator: "==", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.tokens = []qsa.Token{yyDollar[1].token}
 		}
 	case 56:
-		//line parser.go.y:337
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:418
 		{
-			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyS[yypt-2].expr, Operator: "~=", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.tokens = append(yyDollar[1].tokens, yyDollar[3].token)
 		}
 	case 57:
-		//line parser.go.y:341
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:423
 		{
-			yyVAL.expr = &qsa.StringConcatOpExpr{Lhs: yyS[yypt-2].expr, Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.binds = bindings{names: []string{yyDollar[1].token.Str}, last: tokenNode(yyDollar[1].token)}
 		}
 	case 58:
-		//line parser.go.y:345
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:426
 		{
-			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyS[yypt-2].expr, Operator: "+", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.binds = bindings{names: []string{qsa.PatternName}, patterns: []*qsa.Pattern{yyDollar[1].pattern}, last: yyDollar[1].pattern}
 		}
 	case 59:
-		//line parser.go.y:349
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:429
 		{
-			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyS[yypt-2].expr, Operator: "-", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.binds = yyDollar[1].binds.bind(yyDollar[3].token.Str, nil, tokenNode(yyDollar[3].token))
 		}
 	case 60:
-		//line parser.go.y:353
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:432
 		{
-			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyS[yypt-2].expr, Operator: "*", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.binds = yyDollar[1].binds.bind(qsa.PatternName, yyDollar[3].pattern, yyDollar[3].pattern)
 		}
 	case 61:
-		//line parser.go.y:357
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line qsp.go.y:437
 		{
-			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyS[yypt-2].expr, Operator: "/", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.methods = []*qsa.ClassMethod{}
 		}
 	case 62:
-		//line parser.go.y:361
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:440
 		{
-			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyS[yypt-2].expr, Operator: "%", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.methods = classMethod(yylex, yyDollar[1].methods, yyDollar[3].token, yyDollar[4].funcexpr)
+			yyVAL.methods[len(yyVAL.methods)-1].SetSpan(tokenNode(yyDollar[2].token), yyDollar[4].funcexpr)
 		}
 	case 63:
-		//line parser.go.y:365
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:446
 		{
-			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyS[yypt-2].expr, Operator: "^", Rhs: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-2].expr.Line())
+			yyVAL.pattern = yyDollar[2].pattern
+			yyVAL.pattern.SetPos(yyDollar[1].token.Pos)
+			yyVAL.pattern.SetEnd(yyDollar[3].token.End)
 		}
 	case 64:
-		//line parser.go.y:369
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:451
 		{
-			yyVAL.expr = &qsa.UnaryMinusOpExpr{Expr: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-0].expr.Line())
+			yyVAL.pattern = yyDollar[2].pattern
+			yyVAL.pattern.Positional = true
+			yyVAL.pattern.SetPos(yyDollar[1].token.Pos)
+			yyVAL.pattern.SetEnd(yyDollar[3].token.End)
 		}
 	case 65:
-		//line parser.go.y:373
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:459
 		{
-			yyVAL.expr = &qsa.UnaryNotOpExpr{Expr: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-0].expr.Line())
+			yyVAL.pattern = patternName(yylex, &qsa.Pattern{}, yyDollar[1].token.Str, yyDollar[1].token)
 		}
 	case 66:
-		//line parser.go.y:377
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:462
 		{
-			yyVAL.expr = &qsa.UnaryLenOpExpr{Expr: yyS[yypt-0].expr}
-			yyVAL.expr.SetLine(yyS[yypt-0].expr.Line())
+			yyVAL.pattern = patternName(yylex, &qsa.Pattern{}, yyDollar[1].token.Str, yyDollar[3].token)
 		}
 	case 67:
-		//line parser.go.y:383
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:465
 		{
-			yyVAL.expr = &qsa.StringExpr{Value: yyS[yypt-0].token.Str}
-			yyVAL.expr.SetLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.pattern = patternRest(yylex, &qsa.Pattern{}, yyDollar[2].token)
 		}
 	case 68:
-		//line parser.go.y:389
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:468
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.pattern = patternName(yylex, yyDollar[1].pattern, yyDollar[3].token.Str, yyDollar[3].token)
 		}
 	case 69:
-		//line parser.go.y:392
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:471
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.pattern = patternName(yylex, yyDollar[1].pattern, yyDollar[3].token.Str, yyDollar[5].token)
 		}
 	case 70:
-		//line parser.go.y:395
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:474
 		{
-			yyVAL.expr = yyS[yypt-0].expr
+			yyVAL.pattern = patternRest(yylex, yyDollar[1].pattern, yyDollar[4].token)
 		}
 	case 71:
-		//line parser.go.y:398
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:479
 		{
-			yyVAL.expr = yyS[yypt-1].expr
-			yyVAL.expr.SetLine(yyS[yypt-2].token.Pos.Line)
+			yyVAL.pattern = patternName(yylex, &qsa.Pattern{}, "", yyDollar[1].token)
 		}
 	case 72:
-		//line parser.go.y:404
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:482
 		{
-			yyS[yypt-1].expr.(*qsa.FuncCallExpr).AdjustRet = true
-			yyVAL.expr = yyS[yypt-1].expr
+			yyVAL.pattern = patternRest(yylex, &qsa.Pattern{}, yyDollar[2].token)
 		}
 	case 73:
-		//line parser.go.y:410
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:485
 		{
-			yyVAL.expr = &qsa.FuncCallExpr{Func: yyS[yypt-1].expr, Args: yyS[yypt-0].exprlist}
-			yyVAL.expr.SetLine(yyS[yypt-1].expr.Line())
+			yyVAL.pattern = patternName(yylex, yyDollar[1].pattern, "", yyDollar[3].token)
 		}
 	case 74:
-		//line parser.go.y:414
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:488
 		{
-			yyVAL.expr = &qsa.FuncCallExpr{Method: yyS[yypt-1].token.Str, Receiver: yyS[yypt-3].expr, Args: yyS[yypt-0].exprlist}
-			yyVAL.expr.SetLine(yyS[yypt-3].expr.Line())
+			yyVAL.pattern = patternRest(yylex, yyDollar[1].pattern, yyDollar[4].token)
 		}
 	case 75:
-		//line parser.go.y:420
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:493
 		{
-			if yylex.(*Lexer).PNewLine {
-				yylex.(*Lexer).TokenError(yyS[yypt-1].token, "ambiguous syntax (proc call x new statement)")
-			}
-			yyVAL.exprlist = []qsa.Expr{}
+			yyVAL.exprlist = []qsa.Expr{yyDollar[1].expr}
 		}
 	case 76:
-		//line parser.go.y:426
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:496
 		{
-			if yylex.(*Lexer).PNewLine {
-				yylex.(*Lexer).TokenError(yyS[yypt-2].token, "ambiguous syntax (proc call x new statement)")
-			}
-			yyVAL.exprlist = yyS[yypt-1].exprlist
+			yyVAL.exprlist = append(yyDollar[1].exprlist, yyDollar[3].expr)
 		}
 	case 77:
-		//line parser.go.y:432
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:501
 		{
-			yyVAL.exprlist = []qsa.Expr{yyS[yypt-0].expr}
+			yyVAL.expr = &qsa.NilExpr{}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
 		}
 	case 78:
-		//line parser.go.y:435
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:506
 		{
-			yyVAL.exprlist = []qsa.Expr{yyS[yypt-0].expr}
+			yyVAL.expr = &qsa.FalseExpr{}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
 		}
 	case 79:
-		//line parser.go.y:440
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:511
 		{
-			yyVAL.expr = &qsa.ProcExpr{ParList: yyS[yypt-0].funcexpr.ParList, Stmts: yyS[yypt-0].funcexpr.Stmts}
-			yyVAL.expr.SetLine(yyS[yypt-1].token.Pos.Line)
-			yyVAL.expr.SetLastLine(yyS[yypt-0].funcexpr.LastLine())
+			yyVAL.expr = &qsa.TrueExpr{}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
 		}
 	case 80:
-		//line parser.go.y:447
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:516
 		{
-			yyVAL.funcexpr = &qsa.ProcExpr{ParList: yyS[yypt-3].parlist, Stmts: yyS[yypt-1].stmts}
-			yyVAL.funcexpr.SetLine(yyS[yypt-4].token.Pos.Line)
-			yyVAL.funcexpr.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.expr = &qsa.NumberExpr{Value: yyDollar[1].token.Str}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
 		}
 	case 81:
-		//line parser.go.y:452
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:521
 		{
-			yyVAL.funcexpr = &qsa.ProcExpr{ParList: &qsa.ParList{HasVargs: false, Names: []string{}}, Stmts: yyS[yypt-1].stmts}
-			yyVAL.funcexpr.SetLine(yyS[yypt-3].token.Pos.Line)
-			yyVAL.funcexpr.SetLastLine(yyS[yypt-0].token.Pos.Line)
+			yyVAL.expr = &qsa.Comma3Expr{}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
 		}
 	case 82:
-		//line parser.go.y:459
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:526
 		{
-			yyVAL.parlist = &qsa.ParList{HasVargs: true, Names: []string{}}
+			yyVAL.expr = yyDollar[1].expr
 		}
 	case 83:
-		//line parser.go.y:462
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:529
 		{
-			yyVAL.parlist = &qsa.ParList{HasVargs: false, Names: []string{}}
-			yyVAL.parlist.Names = append(yyVAL.parlist.Names, yyS[yypt-0].namelist...)
+			yyVAL.expr = yyDollar[1].expr
 		}
 	case 84:
-		//line parser.go.y:466
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:532
 		{
-			yyVAL.parlist = &qsa.ParList{HasVargs: true, Names: []string{}}
-			yyVAL.parlist.Names = append(yyVAL.parlist.Names, yyS[yypt-2].namelist...)
+			yyVAL.expr = yyDollar[1].expr
 		}
 	case 85:
-		//line parser.go.y:473
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:535
 		{
-			yyVAL.expr = &qsa.OAListExpr{Fields: []*qsa.Field{}}
-			yyVAL.expr.SetLine(yyS[yypt-1].token.Pos.Line)
+			yyVAL.expr = yyDollar[1].expr
 		}
 	case 86:
-		//line parser.go.y:477
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:538
 		{
-			yyVAL.expr = &qsa.OAListExpr{Fields: yyS[yypt-1].fieldlist}
-			yyVAL.expr.SetLine(yyS[yypt-2].token.Pos.Line)
+			yyVAL.expr = &qsa.LogicalOpExpr{Lhs: yyDollar[1].expr, Operator: "or", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 87:
-		//line parser.go.y:484
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:542
 		{
-			yyVAL.fieldlist = []*qsa.Field{yyS[yypt-0].field}
+			yyVAL.expr = &qsa.LogicalOpExpr{Lhs: yyDollar[1].expr, Operator: "and", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 88:
-		//line parser.go.y:487
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:546
 		{
-			yyVAL.fieldlist = append(yyS[yypt-2].fieldlist, yyS[yypt-0].field)
+			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: ">", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 89:
-		//line parser.go.y:490
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:550
 		{
-			yyVAL.fieldlist = yyS[yypt-1].fieldlist
+			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "<", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 90:
-		//line parser.go.y:495
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:554
 		{
-			yyVAL.field = &qsa.Field{Key: &qsa.StringExpr{Value: yyS[yypt-2].token.Str}, Value: yyS[yypt-0].expr}
-			yyVAL.field.Key.SetLine(yyS[yypt-2].token.Pos.Line)
+			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: ">=", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 91:
-		//line parser.go.y:499
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:558
 		{
-			yyVAL.field = &qsa.Field{Key: yyS[yypt-3].expr, Value: yyS[yypt-0].expr}
+			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "<=", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 92:
-		//line parser.go.y:502
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:562
 		{
-			yyVAL.field = &qsa.Field{Value: yyS[yypt-0].expr}
+			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "==", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 93:
-		//line parser.go.y:507
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:566
 		{
-			yyVAL.fieldsep = ","
+			yyVAL.expr = &qsa.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "~=", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 94:
-		//line parser.go.y:510
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:570
+		{
+			yyVAL.expr = &qsa.StringConcatOpExpr{Lhs: yyDollar[1].expr, Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 95:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:574
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "+", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 96:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:578
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "-", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 97:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:582
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "*", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 98:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:586
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "/", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 99:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:590
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "\\", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 100:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:594
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "%", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 101:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:598
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "&", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 102:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:602
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "|", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 103:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:606
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "~", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 104:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:610
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "<<", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 105:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:614
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: ">>", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 106:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:618
+		{
+			yyVAL.expr = &qsa.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "^", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 107:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:622
+		{
+			yyVAL.expr = &qsa.UnaryMinusOpExpr{Expr: yyDollar[2].expr}
+			yyVAL.expr.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].expr)
+		}
+	case 108:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:626
+		{
+			yyVAL.expr = &qsa.UnaryNotOpExpr{Expr: yyDollar[2].expr}
+			yyVAL.expr.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].expr)
+		}
+	case 109:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:630
+		{
+			yyVAL.expr = &qsa.UnaryLenOpExpr{Expr: yyDollar[2].expr}
+			yyVAL.expr.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].expr)
+		}
+	case 110:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:634
+		{
+			yyVAL.expr = &qsa.UnaryBNotOpExpr{Expr: yyDollar[2].expr}
+			yyVAL.expr.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].expr)
+		}
+	case 111:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:640
+		{
+			yyVAL.expr = &qsa.StringExpr{Value: yyDollar[1].token.Str}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
+		}
+	case 112:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:645
+		{
+			yyVAL.expr = yylex.(*Lexer).fstring(yyDollar[1].token)
+		}
+	case 113:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:652
+		{
+			yyVAL.expr = yyDollar[1].expr
+		}
+	case 114:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:657
+		{
+			yyVAL.expr = yyDollar[1].expr
+		}
+	case 115:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:660
+		{
+			yyVAL.expr = yyDollar[1].expr
+		}
+	case 116:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:663
+		{
+			yyVAL.expr = yyDollar[1].expr
+		}
+	case 117:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:666
+		{
+			yyVAL.expr = yyDollar[2].expr
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[3].token.End)
+		}
+	case 118:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:671
+		{
+			yyVAL.expr = &qsa.SuperExpr{}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[1].token.End)
+		}
+	case 119:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:678
+		{
+			yyDollar[2].expr.(*qsa.FuncCallExpr).AdjustRet = true
+			yyVAL.expr = yyDollar[2].expr
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[3].token.End)
+		}
+	case 120:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:686
+		{
+			yyVAL.expr = &qsa.FuncCallExpr{Func: yyDollar[1].expr, Args: yyDollar[2].args.exprs, Named: yyDollar[2].args.named}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, &yyDollar[2].args.last)
+		}
+	case 121:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:690
+		{
+			yyVAL.expr = &qsa.FuncCallExpr{Method: yyDollar[3].token.Str, Receiver: yyDollar[1].expr, Args: yyDollar[4].args.exprs, Named: yyDollar[4].args.named}
+			yyVAL.expr.SetSpan(yyDollar[1].expr, &yyDollar[4].args.last)
+		}
+	case 122:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:696
+		{
+			if yylex.(*Lexer).PNewLine {
+				yylex.(*Lexer).TokenError(yyDollar[1].token, "ambiguous syntax (proc call x new statement)")
+			}
+			yyVAL.args = callArgs{exprs: []qsa.Expr{}}
+			yyVAL.args.last.SetEnd(yyDollar[2].token.End)
+		}
+	case 123:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:703
+		{
+			if yylex.(*Lexer).PNewLine {
+				yylex.(*Lexer).TokenError(yyDollar[1].token, "ambiguous syntax (proc call x new statement)")
+			}
+			yyVAL.args = callArgs{exprs: yyDollar[2].exprlist}
+			yyVAL.args.last.SetEnd(yyDollar[3].token.End)
+		}
+	case 124:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:710
+		{
+			if yylex.(*Lexer).PNewLine {
+				yylex.(*Lexer).TokenError(yyDollar[1].token, "ambiguous syntax (proc call x new statement)")
+			}
+			yyVAL.args = callArgs{exprs: []qsa.Expr{}, named: yyDollar[2].named}
+			yyVAL.args.last.SetEnd(yyDollar[3].token.End)
+		}
+	case 125:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:717
+		{
+			if yylex.(*Lexer).PNewLine {
+				yylex.(*Lexer).TokenError(yyDollar[1].token, "ambiguous syntax (proc call x new statement)")
+			}
+			yyVAL.args = callArgs{exprs: yyDollar[2].exprlist, named: yyDollar[4].named}
+			yyVAL.args.last.SetEnd(yyDollar[5].token.End)
+		}
+	case 126:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:724
+		{
+			yyVAL.args = callArgs{exprs: []qsa.Expr{yyDollar[1].expr}}
+			yyVAL.args.last.SetSpan(yyDollar[1].expr, yyDollar[1].expr)
+		}
+	case 127:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:728
+		{
+			yyVAL.args = callArgs{exprs: []qsa.Expr{yyDollar[1].expr}}
+			yyVAL.args.last.SetSpan(yyDollar[1].expr, yyDollar[1].expr)
+		}
+	case 128:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:734
+		{
+			yyVAL.expr = &qsa.ProcExpr{ParList: yyDollar[2].funcexpr.ParList, Stmts: yyDollar[2].funcexpr.Stmts}
+			yyVAL.expr.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].funcexpr)
+		}
+	case 129:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:740
+		{
+			yyVAL.funcexpr = &qsa.ProcExpr{ParList: yyDollar[2].parlist, Stmts: yyDollar[4].stmts}
+			yyVAL.funcexpr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.funcexpr.SetEnd(yyDollar[5].token.End)
+		}
+	case 130:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:745
+		{
+			yyVAL.funcexpr = &qsa.ProcExpr{ParList: &qsa.ParList{HasVargs: false, Names: []string{}}, Stmts: yyDollar[3].stmts}
+			yyVAL.funcexpr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.funcexpr.SetEnd(yyDollar[4].token.End)
+		}
+	case 131:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:752
+		{
+			yyVAL.parlist = &qsa.ParList{HasVargs: true, Names: []string{}}
+		}
+	case 132:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:755
+		{
+			yyVAL.parlist = yyDollar[1].parlist
+		}
+	case 133:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:758
+		{
+			yyVAL.parlist = yyDollar[1].parlist
+			yyVAL.parlist.HasVargs = true
+		}
+	case 134:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:764
+		{
+			yyVAL.parlist = &qsa.ParList{HasVargs: false, Names: []string{yyDollar[1].token.Str}, Defaults: []qsa.Expr{nil}}
+		}
+	case 135:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:767
+		{
+			yyVAL.parlist = &qsa.ParList{HasVargs: false, Names: []string{yyDollar[1].token.Str}, Defaults: []qsa.Expr{yyDollar[3].expr}}
+		}
+	case 136:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:770
+		{
+			yyVAL.parlist = yyDollar[1].parlist
+			yyVAL.parlist.Names = append(yyVAL.parlist.Names, yyDollar[3].token.Str)
+			yyVAL.parlist.Defaults = append(yyVAL.parlist.Defaults, nil)
+		}
+	case 137:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:775
+		{
+			yyVAL.parlist = yyDollar[1].parlist
+			yyVAL.parlist.Names = append(yyVAL.parlist.Names, yyDollar[3].token.Str)
+			yyVAL.parlist.Defaults = append(yyVAL.parlist.Defaults, yyDollar[5].expr)
+		}
+	case 138:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:783
+		{
+			arg := &qsa.NamedArg{Name: yyDollar[1].token.Str, Value: yyDollar[2].expr}
+			arg.SetSpan(tokenNode(yyDollar[1].token), yyDollar[2].expr)
+			yyVAL.named = []*qsa.NamedArg{arg}
+		}
+	case 139:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line qsp.go.y:788
+		{
+			arg := &qsa.NamedArg{Name: yyDollar[3].token.Str, Value: yyDollar[4].expr}
+			arg.SetSpan(tokenNode(yyDollar[3].token), yyDollar[4].expr)
+			yyVAL.named = append(yyDollar[1].named, arg)
+		}
+	case 140:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:795
+		{
+			yyVAL.expr = &qsa.OAListExpr{Fields: []*qsa.Field{}}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[2].token.End)
+		}
+	case 141:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:800
+		{
+			yyVAL.expr = &qsa.OAListExpr{Fields: yyDollar[2].fieldlist}
+			yyVAL.expr.SetPos(yyDollar[1].token.Pos)
+			yyVAL.expr.SetEnd(yyDollar[3].token.End)
+		}
+	case 142:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:808
+		{
+			yyVAL.fieldlist = []*qsa.Field{yyDollar[1].field}
+		}
+	case 143:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:811
+		{
+			yyVAL.fieldlist = append(yyDollar[1].fieldlist, yyDollar[3].field)
+		}
+	case 144:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line qsp.go.y:814
+		{
+			yyVAL.fieldlist = yyDollar[1].fieldlist
+		}
+	case 145:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line qsp.go.y:819
+		{
+			yyVAL.field = &qsa.Field{Key: &qsa.StringExpr{Value: yyDollar[1].token.Str}, Value: yyDollar[3].expr}
+			yyVAL.field.Key.SetPos(yyDollar[1].token.Pos)
+			yyVAL.field.Key.SetEnd(yyDollar[1].token.End)
+		}
+	case 146:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line qsp.go.y:824
+		{
+			yyVAL.field = &qsa.Field{Key: yyDollar[2].expr, Value: yyDollar[5].expr}
+		}
+	case 147:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:827
+		{
+			yyVAL.field = &qsa.Field{Value: yyDollar[1].expr}
+		}
+	case 148:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:832
+		{
+			yyVAL.fieldsep = ","
+		}
+	case 149:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line qsp.go.y:835
 		{
 			yyVAL.fieldsep = ";"
 		}
@@ -4,6 +4,21 @@ package qsp
 import (
 	"github.com/x0ray/q/qs/qsa"
 )
+
+// callArgs - the arguments of a proc call, last spans the end of the call
+type callArgs struct {
+	exprs []qsa.Expr
+	named []*qsa.NamedArg
+	last  qsa.Node
+}
+
+// bindings - the names a dcl statement or for declares, with the pattern
+// of each name, nil for a plain name, last spans the last one
+type bindings struct {
+	names    []string
+	patterns []*qsa.Pattern
+	last     qsa.PositionHolder
+}
 %}
 
 %type<stmts> segment
@@ -11,22 +26,33 @@ import (
 %type<stmts> block
 %type<stmt>  stat
 %type<stmts> elseifs
+%type<cases> cases
+%type<clause> trycatch
+%type<clause> tryfinally
 %type<stmt>  laststat
 %type<funcname> funcname
 %type<funcname> funcname1
 %type<exprlist> varlist
 %type<expr> var
-%type<namelist> namelist
+%type<tokens> namelist
+%type<binds> bindlist
+%type<pattern> pattern
+%type<pattern> fieldnames
+%type<pattern> itemnames
+%type<methods> classbody
 %type<exprlist> exprlist
 %type<expr> expr
 %type<expr> string
 %type<expr> prefixexp
 %type<expr> proccall
+%type<expr> callexpr
 %type<expr> aproccall
-%type<exprlist> args
+%type<args> args
 %type<expr> proc
 %type<funcexpr> funcbody
 %type<parlist> parlist
+%type<parlist> params
+%type<named> namedargs
 %type<expr> listconstructor
 %type<fieldlist> fieldlist
 %type<field> field
@@ -37,9 +63,11 @@ import (
 
   stmts    []qsa.Stmt
   stmt     qsa.Stmt
+  cases    []*qsa.SwitchCase
+  clause   *qsa.TryClause
 
   funcname *qsa.FuncName
-  funcexpr *qsa.FunctionExpr
+  funcexpr *qsa.ProcExpr
 
   exprlist []qsa.Expr
   expr   qsa.Expr
@@ -48,24 +76,33 @@ import (
   field     *qsa.Field
   fieldsep  string
 
-  namelist []string
+  tokens   []qsa.Token
   parlist  *qsa.ParList
+  args     callArgs
+  named    []*qsa.NamedArg
+  binds    bindings
+  pattern  *qsa.Pattern
+  methods  []*qsa.ClassMethod
 }
 
 /* Reserved words */
-%token<token> TAnd TBreak TDo TElse TElseIf TEnd TFalse TFor TProc TIf TIn TLocal TNil TNot TOr TReturn TRepeat TThen TTrue TUntil TWhile 
+%token<token> TAnd TBreak TContinue TDo TElse TElseIf TEnd TFalse TFor TProc TIf TIn TLocal TGlobal TNil TNot TOr TReturn TRepeat TSwitch TCase TThen TTrue TUntil TWhile TTry TCatch TFinally TDefer TClass TExtends TSuper
 
 /* Literals */
-%token<token> TEqeq TNeq TLte TGte T2Comma T3Comma TIdent TNumber TString '{' '('
+%token<token> TOpAssign TEqeq TNeq TLte TGte TShl TShr T2Comma T3Comma TIdent TNamed TNumber TString TFString '{' '(' ')' '[' ']' '}' '-' '#' '~'
 
 /* Operators */
 %left TOr
 %left TAnd
 %left '>' '<' TGte TLte TEqeq TNeq
+%left '|'
+%left '~'
+%left '&'
+%left TShl TShr
 %right T2Comma
 %left '+' '-'
-%left '*' '/' '%'
-%right UNARY /* not # -(unary) */
+%left '*' '/' '\\' '%'
+%right UNARY /* not # -(unary) ~(unary) */
 %right '^'
 
 %%
@@ -109,85 +146,159 @@ block:
 stat:
         varlist '=' exprlist {
             $$ = &qsa.AssignStmt{Lhs: $1, Rhs: $3}
-            $$.SetLine($1[0].Line())
+            $$.SetSpan($1[0], $3[len($3)-1])
+        } |
+        var TOpAssign expr {
+            $$ = &qsa.CompoundAssignStmt{Lhs: $1, Operator: $2.Str, Rhs: $3}
+            $$.SetSpan($1, $3)
         } |
         /* 'stat = proccal' causes a reduce/reduce conflict */
-        prefixexp {
+        callexpr {
             if _, ok := $1.(*qsa.FuncCallExpr); !ok {
                yylex.(*Lexer).Error("parse error")
             } else {
               $$ = &qsa.FuncCallStmt{Expr: $1}
-              $$.SetLine($1.Line())
+              $$.SetSpan($1, $1)
             }
         } |
         TDo block TEnd {
             $$ = &qsa.DoBlockStmt{Stmts: $2}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($3.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
         } |
         TWhile expr TDo block TEnd {
             $$ = &qsa.WhileStmt{Condition: $2, Stmts: $4}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($5.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($5.End)
         } |
         TRepeat block TUntil expr {
             $$ = &qsa.RepeatStmt{Condition: $4, Stmts: $2}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($4.Line())
+            $$.SetSpan(tokenNode($1), $4)
         } |
         TIf expr TThen block elseifs TEnd {
             $$ = &qsa.IfStmt{Condition: $2, Then: $4}
             cur := $$
             for _, elseif := range $5 {
+                elseif.SetEnd($6.End)
                 cur.(*qsa.IfStmt).Else = []qsa.Stmt{elseif}
                 cur = elseif
             }
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($6.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($6.End)
         } |
         TIf expr TThen block elseifs TElse block TEnd {
             $$ = &qsa.IfStmt{Condition: $2, Then: $4}
             cur := $$
             for _, elseif := range $5 {
+                elseif.SetEnd($8.End)
                 cur.(*qsa.IfStmt).Else = []qsa.Stmt{elseif}
                 cur = elseif
             }
             cur.(*qsa.IfStmt).Else = $7
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($8.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($8.End)
+        } |
+        TSwitch expr cases TEnd {
+            $$ = &qsa.SwitchStmt{Subject: $2, Cases: $3}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($4.End)
+        } |
+        TSwitch expr cases TElse block TEnd {
+            $$ = &qsa.SwitchStmt{Subject: $2, Cases: $3, Else: $5}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($6.End)
+        } |
+        TDefer callexpr {
+            if _, ok := $2.(*qsa.FuncCallExpr); !ok {
+               yylex.(*Lexer).TokenError($1, "proc call expected after defer")
+            }
+            $$ = &qsa.DeferStmt{Expr: $2}
+            $$.SetSpan(tokenNode($1), $2)
+        } |
+        TClass TIdent classbody TEnd {
+            name := &qsa.IdentExpr{Value: $2.Str}
+            name.SetPos($2.Pos)
+            name.SetEnd($2.End)
+            $$ = &qsa.ClassStmt{Name: name, Methods: $3}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($4.End)
+        } |
+        TClass TIdent TExtends prefixexp classbody TEnd {
+            name := &qsa.IdentExpr{Value: $2.Str}
+            name.SetPos($2.Pos)
+            name.SetEnd($2.End)
+            $$ = &qsa.ClassStmt{Name: name, Base: $4, Methods: $5}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($6.End)
+        } |
+        TTry block trycatch TEnd {
+            $$ = &qsa.TryStmt{Stmts: $2, Catch: $3}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($4.End)
+        } |
+        TTry block tryfinally TEnd {
+            $$ = &qsa.TryStmt{Stmts: $2, Finally: $3}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($4.End)
+        } |
+        TTry block trycatch tryfinally TEnd {
+            $$ = &qsa.TryStmt{Stmts: $2, Catch: $3, Finally: $4}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($5.End)
         } |
         TFor TIdent '=' expr ',' expr TDo block TEnd {
             $$ = &qsa.NumberForStmt{Name: $2.Str, Init: $4, Limit: $6, Stmts: $8}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($9.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($9.End)
         } |
         TFor TIdent '=' expr ',' expr ',' expr TDo block TEnd {
             $$ = &qsa.NumberForStmt{Name: $2.Str, Init: $4, Limit: $6, Step:$8, Stmts: $10}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($11.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($11.End)
         } |
-        TFor namelist TIn exprlist TDo block TEnd {
-            $$ = &qsa.GenericForStmt{Names:$2, Exprs:$4, Stmts: $6}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($7.Pos.Line)
+        TFor bindlist TIn exprlist TDo block TEnd {
+            $$ = &qsa.GenericForStmt{Names: $2.names, Exprs:$4, Patterns: $2.patterns, Stmts: $6}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($7.End)
         } |
         TProc funcname funcbody {
             $$ = &qsa.FuncDefStmt{Name: $2, Func: $3}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($3.LastLine())
+            $$.SetSpan(tokenNode($1), $3)
         } |
         TLocal TProc TIdent funcbody {
             $$ = &qsa.LocalAssignStmt{Names:[]string{$3.Str}, Exprs: []qsa.Expr{$4}}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($4.LastLine())
+            $$.SetSpan(tokenNode($1), $4)
         } | 
-        TLocal namelist '=' exprlist {
-            $$ = &qsa.LocalAssignStmt{Names: $2, Exprs:$4}
-            $$.SetLine($1.Pos.Line)
+        TLocal bindlist '=' exprlist {
+            $$ = &qsa.LocalAssignStmt{Names: $2.names, Exprs:$4, Patterns: $2.patterns}
+            $$.SetSpan(tokenNode($1), $4[len($4)-1])
         } |
-        TLocal namelist {
-            $$ = &qsa.LocalAssignStmt{Names: $2, Exprs:[]qsa.Expr{}}
-            $$.SetLine($1.Pos.Line)
+        TLocal TIdent '<' TIdent '>' '=' exprlist {
+            if $4.Str != "close" {
+               yylex.(*Lexer).TokenError($4, "unknown attribute '"+$4.Str+"'")
+            }
+            $$ = &qsa.LocalAssignStmt{Names: []string{$2.Str}, Exprs: $7, Close: true}
+            $$.SetSpan(tokenNode($1), $7[len($7)-1])
+        } |
+        TLocal bindlist {
+            if $2.patterns != nil {
+               yylex.(*Lexer).TokenError($1, "dcl of a pattern needs a value")
+            }
+            $$ = &qsa.LocalAssignStmt{Names: $2.names, Exprs:[]qsa.Expr{}}
+            $$.SetSpan(tokenNode($1), $2.last)
+        } |
+        TGlobal TProc TIdent funcbody {
+            $$ = &qsa.GlobalStmt{Names:[]string{$3.Str}, Exprs: []qsa.Expr{$4}}
+            $$.SetSpan(tokenNode($1), $4)
+        } | 
+        TGlobal namelist '=' exprlist {
+            $$ = &qsa.GlobalStmt{Names: tokenNames($2), Exprs:$4}
+            $$.SetSpan(tokenNode($1), $4[len($4)-1])
+        } |
+        TGlobal namelist {
+            $$ = &qsa.GlobalStmt{Names: tokenNames($2), Exprs:[]qsa.Expr{}}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($2[len($2)-1].End)
         }
 
 elseifs: 
@@ -196,21 +307,59 @@ elseifs:
         } | 
         elseifs TElseIf expr TThen block {
             $$ = append($1, &qsa.IfStmt{Condition: $3, Then: $5})
-            $$[len($$)-1].SetLine($2.Pos.Line)
+            $$[len($$)-1].SetPos($2.Pos)
+        }
+
+cases: 
+        TCase exprlist TThen block {
+            $$ = []*qsa.SwitchCase{&qsa.SwitchCase{Values: $2, Stmts: $4}}
+            $$[0].SetPos($1.Pos)
+            $$[0].SetEnd($3.End)
+        } | 
+        cases TCase exprlist TThen block {
+            $$ = append($1, &qsa.SwitchCase{Values: $3, Stmts: $5})
+            $$[len($$)-1].SetPos($2.Pos)
+            $$[len($$)-1].SetEnd($4.End)
+        }
+
+trycatch:
+        TCatch TIdent TThen block {
+            $$ = &qsa.TryClause{Name: $2.Str, Stmts: $4}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
+        } |
+        TCatch TThen block {
+            $$ = &qsa.TryClause{Stmts: $3}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($2.End)
+        }
+
+tryfinally:
+        TFinally block {
+            $$ = &qsa.TryClause{Stmts: $2}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         }
 
 laststat:
         TReturn {
             $$ = &qsa.ReturnStmt{Exprs:nil}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } |
         TReturn exprlist {
             $$ = &qsa.ReturnStmt{Exprs:$2}
-            $$.SetLine($1.Pos.Line)
+            $$.SetSpan(tokenNode($1), $2[len($2)-1])
         } |
         TBreak  {
             $$ = &qsa.BreakStmt{}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
+        } |
+        TContinue  {
+            $$ = &qsa.ContinueStmt{}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         }
 
 funcname: 
@@ -224,13 +373,15 @@ funcname:
 funcname1:
         TIdent {
             $$ = &qsa.FuncName{Func: &qsa.IdentExpr{Value:$1.Str}}
-            $$.Func.SetLine($1.Pos.Line)
+            $$.Func.SetPos($1.Pos)
+            $$.Func.SetEnd($1.End)
         } | 
         funcname1 '.' TIdent {
             key:= &qsa.StringExpr{Value:$3.Str}
-            key.SetLine($3.Pos.Line)
+            key.SetPos($3.Pos)
+            key.SetEnd($3.End)
             fn := &qsa.AttrGetExpr{Object: $1.Func, Key: key}
-            fn.SetLine($3.Pos.Line)
+            fn.SetSpan($1.Func, key)
             $$ = &qsa.FuncName{Func: fn}
         }
 
@@ -245,25 +396,97 @@ varlist:
 var:
         TIdent {
             $$ = &qsa.IdentExpr{Value:$1.Str}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } |
         prefixexp '[' expr ']' {
             $$ = &qsa.AttrGetExpr{Object: $1, Key: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, tokenNode($4))
         } | 
         prefixexp '.' TIdent {
             key := &qsa.StringExpr{Value:$3.Str}
-            key.SetLine($3.Pos.Line)
+            key.SetPos($3.Pos)
+            key.SetEnd($3.End)
             $$ = &qsa.AttrGetExpr{Object: $1, Key: key}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, key)
         }
 
 namelist:
         TIdent {
-            $$ = []string{$1.Str}
+            $$ = []qsa.Token{$1}
         } | 
         namelist ','  TIdent {
-            $$ = append($1, $3.Str)
+            $$ = append($1, $3)
+        }
+
+bindlist:
+        TIdent {
+            $$ = bindings{names: []string{$1.Str}, last: tokenNode($1)}
+        } |
+        pattern {
+            $$ = bindings{names: []string{qsa.PatternName}, patterns: []*qsa.Pattern{$1}, last: $1}
+        } |
+        bindlist ',' TIdent {
+            $$ = $1.bind($3.Str, nil, tokenNode($3))
+        } |
+        bindlist ',' pattern {
+            $$ = $1.bind(qsa.PatternName, $3, $3)
+        }
+
+classbody:
+        {
+            $$ = []*qsa.ClassMethod{}
+        } |
+        classbody TProc TIdent funcbody {
+            $$ = classMethod(yylex, $1, $3, $4)
+            $$[len($$)-1].SetSpan(tokenNode($2), $4)
+        }
+
+pattern:
+        '{' fieldnames '}' {
+            $$ = $2
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
+        } |
+        '[' itemnames ']' {
+            $$ = $2
+            $$.Positional = true
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
+        }
+
+fieldnames:
+        TIdent {
+            $$ = patternName(yylex, &qsa.Pattern{}, $1.Str, $1)
+        } |
+        TIdent '=' TIdent {
+            $$ = patternName(yylex, &qsa.Pattern{}, $1.Str, $3)
+        } |
+        T3Comma TIdent {
+            $$ = patternRest(yylex, &qsa.Pattern{}, $2)
+        } |
+        fieldnames ',' TIdent {
+            $$ = patternName(yylex, $1, $3.Str, $3)
+        } |
+        fieldnames ',' TIdent '=' TIdent {
+            $$ = patternName(yylex, $1, $3.Str, $5)
+        } |
+        fieldnames ',' T3Comma TIdent {
+            $$ = patternRest(yylex, $1, $4)
+        }
+
+itemnames:
+        TIdent {
+            $$ = patternName(yylex, &qsa.Pattern{}, "", $1)
+        } |
+        T3Comma TIdent {
+            $$ = patternRest(yylex, &qsa.Pattern{}, $2)
+        } |
+        itemnames ',' TIdent {
+            $$ = patternName(yylex, $1, "", $3)
+        } |
+        itemnames ',' T3Comma TIdent {
+            $$ = patternRest(yylex, $1, $4)
         }
 
 exprlist:
@@ -277,23 +500,28 @@ exprlist:
 expr:
         TNil {
             $$ = &qsa.NilExpr{}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } | 
         TFalse {
             $$ = &qsa.FalseExpr{}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } | 
         TTrue {
             $$ = &qsa.TrueExpr{}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } | 
         TNumber {
             $$ = &qsa.NumberExpr{Value: $1.Str}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } | 
         T3Comma {
             $$ = &qsa.Comma3Expr{}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         } |
         proc {
             $$ = $1
@@ -309,82 +537,121 @@ expr:
         } |
         expr TOr expr {
             $$ = &qsa.LogicalOpExpr{Lhs: $1, Operator: "or", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr TAnd expr {
             $$ = &qsa.LogicalOpExpr{Lhs: $1, Operator: "and", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr '>' expr {
             $$ = &qsa.RelationalOpExpr{Lhs: $1, Operator: ">", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr '<' expr {
             $$ = &qsa.RelationalOpExpr{Lhs: $1, Operator: "<", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr TGte expr {
             $$ = &qsa.RelationalOpExpr{Lhs: $1, Operator: ">=", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr TLte expr {
             $$ = &qsa.RelationalOpExpr{Lhs: $1, Operator: "<=", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr TEqeq expr {
             $$ = &qsa.RelationalOpExpr{Lhs: $1, Operator: "==", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr TNeq expr {
             $$ = &qsa.RelationalOpExpr{Lhs: $1, Operator: "~=", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr T2Comma expr {
             $$ = &qsa.StringConcatOpExpr{Lhs: $1, Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr '+' expr {
             $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "+", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr '-' expr {
             $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "-", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr '*' expr {
             $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "*", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         expr '/' expr {
             $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "/", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
+        } |
+        expr '\\' expr {
+            $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "\\", Rhs: $3}
+            $$.SetSpan($1, $3)
         } |
         expr '%' expr {
             $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "%", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
+        } |
+        expr '&' expr {
+            $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "&", Rhs: $3}
+            $$.SetSpan($1, $3)
+        } |
+        expr '|' expr {
+            $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "|", Rhs: $3}
+            $$.SetSpan($1, $3)
+        } |
+        expr '~' expr {
+            $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "~", Rhs: $3}
+            $$.SetSpan($1, $3)
+        } |
+        expr TShl expr {
+            $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "<<", Rhs: $3}
+            $$.SetSpan($1, $3)
+        } |
+        expr TShr expr {
+            $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: ">>", Rhs: $3}
+            $$.SetSpan($1, $3)
         } |
         expr '^' expr {
             $$ = &qsa.ArithmeticOpExpr{Lhs: $1, Operator: "^", Rhs: $3}
-            $$.SetLine($1.Line())
+            $$.SetSpan($1, $3)
         } |
         '-' expr %prec UNARY {
             $$ = &qsa.UnaryMinusOpExpr{Expr: $2}
-            $$.SetLine($2.Line())
+            $$.SetSpan(tokenNode($1), $2)
         } |
         TNot expr %prec UNARY {
             $$ = &qsa.UnaryNotOpExpr{Expr: $2}
-            $$.SetLine($2.Line())
+            $$.SetSpan(tokenNode($1), $2)
         } |
         '#' expr %prec UNARY {
             $$ = &qsa.UnaryLenOpExpr{Expr: $2}
-            $$.SetLine($2.Line())
+            $$.SetSpan(tokenNode($1), $2)
+        } |
+        '~' expr %prec UNARY {
+            $$ = &qsa.UnaryBNotOpExpr{Expr: $2}
+            $$.SetSpan(tokenNode($1), $2)
         }
 
 string: 
         TString {
             $$ = &qsa.StringExpr{Value: $1.Str}
-            $$.SetLine($1.Pos.Line)
-        } 
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
+        } |
+        TFString {
+            $$ = yylex.(*Lexer).fstring($1)
+        }
+
+/* the call of a call statement or defer, both parsed in the same state so
+   they share its conflict on '(' */
+callexpr:
+        prefixexp {
+            $$ = $1
+        }
 
 prefixexp:
         var {
@@ -398,23 +665,31 @@ prefixexp:
         } |
         '(' expr ')' {
             $$ = $2
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
+        } |
+        TSuper {
+            $$ = &qsa.SuperExpr{}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($1.End)
         }
 
 aproccall:
         '(' proccall ')' {
             $2.(*qsa.FuncCallExpr).AdjustRet = true
             $$ = $2
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
         }
 
 proccall:
         prefixexp args {
-            $$ = &qsa.FuncCallExpr{Func: $1, Args: $2}
-            $$.SetLine($1.Line())
+            $$ = &qsa.FuncCallExpr{Func: $1, Args: $2.exprs, Named: $2.named}
+            $$.SetSpan($1, &$2.last)
         } |
         prefixexp ':' TIdent args {
-            $$ = &qsa.FuncCallExpr{Method: $3.Str, Receiver: $1, Args: $4}
-            $$.SetLine($1.Line())
+            $$ = &qsa.FuncCallExpr{Method: $3.Str, Receiver: $1, Args: $4.exprs, Named: $4.named}
+            $$.SetSpan($1, &$4.last)
         }
 
 args:
@@ -422,62 +697,110 @@ args:
             if yylex.(*Lexer).PNewLine {
                yylex.(*Lexer).TokenError($1, "ambiguous syntax (proc call x new statement)")
             }
-            $$ = []qsa.Expr{}
+            $$ = callArgs{exprs: []qsa.Expr{}}
+            $$.last.SetEnd($2.End)
         } |
         '(' exprlist ')' {
             if yylex.(*Lexer).PNewLine {
                yylex.(*Lexer).TokenError($1, "ambiguous syntax (proc call x new statement)")
             }
-            $$ = $2
+            $$ = callArgs{exprs: $2}
+            $$.last.SetEnd($3.End)
+        } |
+        '(' namedargs ')' {
+            if yylex.(*Lexer).PNewLine {
+               yylex.(*Lexer).TokenError($1, "ambiguous syntax (proc call x new statement)")
+            }
+            $$ = callArgs{exprs: []qsa.Expr{}, named: $2}
+            $$.last.SetEnd($3.End)
+        } |
+        '(' exprlist ',' namedargs ')' {
+            if yylex.(*Lexer).PNewLine {
+               yylex.(*Lexer).TokenError($1, "ambiguous syntax (proc call x new statement)")
+            }
+            $$ = callArgs{exprs: $2, named: $4}
+            $$.last.SetEnd($5.End)
         } |
         listconstructor {
-            $$ = []qsa.Expr{$1}
+            $$ = callArgs{exprs: []qsa.Expr{$1}}
+            $$.last.SetSpan($1, $1)
         } | 
         string {
-            $$ = []qsa.Expr{$1}
+            $$ = callArgs{exprs: []qsa.Expr{$1}}
+            $$.last.SetSpan($1, $1)
         }
 
 proc:
         TProc funcbody {
-            $$ = &qsa.FunctionExpr{ParList:$2.ParList, Stmts: $2.Stmts}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($2.LastLine())
+            $$ = &qsa.ProcExpr{ParList:$2.ParList, Stmts: $2.Stmts}
+            $$.SetSpan(tokenNode($1), $2)
         }
 
 funcbody:
         '(' parlist ')' block TEnd {
-            $$ = &qsa.FunctionExpr{ParList: $2, Stmts: $4}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($5.Pos.Line)
+            $$ = &qsa.ProcExpr{ParList: $2, Stmts: $4}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($5.End)
         } | 
         '(' ')' block TEnd {
-            $$ = &qsa.FunctionExpr{ParList: &qsa.ParList{HasVargs: false, Names: []string{}}, Stmts: $3}
-            $$.SetLine($1.Pos.Line)
-            $$.SetLastLine($4.Pos.Line)
+            $$ = &qsa.ProcExpr{ParList: &qsa.ParList{HasVargs: false, Names: []string{}}, Stmts: $3}
+            $$.SetPos($1.Pos)
+            $$.SetEnd($4.End)
         }
 
 parlist:
         T3Comma {
             $$ = &qsa.ParList{HasVargs: true, Names: []string{}}
         } | 
-        namelist {
-          $$ = &qsa.ParList{HasVargs: false, Names: []string{}}
-          $$.Names = append($$.Names, $1...)
+        params {
+          $$ = $1
         } | 
-        namelist ',' T3Comma {
-          $$ = &qsa.ParList{HasVargs: true, Names: []string{}}
-          $$.Names = append($$.Names, $1...)
+        params ',' T3Comma {
+          $$ = $1
+          $$.HasVargs = true
+        }
+
+params:
+        TIdent {
+          $$ = &qsa.ParList{HasVargs: false, Names: []string{$1.Str}, Defaults: []qsa.Expr{nil}}
+        } |
+        TIdent '=' expr {
+          $$ = &qsa.ParList{HasVargs: false, Names: []string{$1.Str}, Defaults: []qsa.Expr{$3}}
+        } |
+        params ',' TIdent {
+          $$ = $1
+          $$.Names = append($$.Names, $3.Str)
+          $$.Defaults = append($$.Defaults, nil)
+        } |
+        params ',' TIdent '=' expr {
+          $$ = $1
+          $$.Names = append($$.Names, $3.Str)
+          $$.Defaults = append($$.Defaults, $5)
         }
 
 
+namedargs:
+        TNamed expr {
+            arg := &qsa.NamedArg{Name: $1.Str, Value: $2}
+            arg.SetSpan(tokenNode($1), $2)
+            $$ = []*qsa.NamedArg{arg}
+        } |
+        namedargs ',' TNamed expr {
+            arg := &qsa.NamedArg{Name: $3.Str, Value: $4}
+            arg.SetSpan(tokenNode($3), $4)
+            $$ = append($1, arg)
+        }
+
 listconstructor:
         '{' '}' {
             $$ = &qsa.OAListExpr{Fields: []*qsa.Field{}}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($2.End)
         } |
         '{' fieldlist '}' {
             $$ = &qsa.OAListExpr{Fields: $2}
-            $$.SetLine($1.Pos.Line)
+            $$.SetPos($1.Pos)
+            $$.SetEnd($3.End)
         }
 
 
@@ -495,7 +818,8 @@ fieldlist:
 field:
         TIdent '=' expr {
             $$ = &qsa.Field{Key: &qsa.StringExpr{Value:$1.Str}, Value: $3}
-            $$.Key.SetLine($1.Pos.Line)
+            $$.Key.SetPos($1.Pos)
+            $$.Key.SetEnd($1.End)
         } | 
         '[' expr ']' '=' expr {
             $$ = &qsa.Field{Key: $2, Value: $5}
@@ -514,10 +838,79 @@ fieldsep:
 
 %%
 
+// tokenNode - returns a node spanning the token tok
+func tokenNode(tok qsa.Token) *qsa.Node {
+	node := &qsa.Node{}
+	node.SetPos(tok.Pos)
+	node.SetEnd(tok.End)
+	return node
+}
+
+// tokenNames - returns the names of the tokens of a name list
+func tokenNames(toks []qsa.Token) []string {
+	names := make([]string, len(toks))
+	for i, tok := range toks {
+		names[i] = tok.Str
+	}
+	return names
+}
+
+// bind - returns the bindings with the name and its pattern added
+func (b bindings) bind(name string, pat *qsa.Pattern, last qsa.PositionHolder) bindings {
+	if pat != nil && b.patterns == nil {
+		b.patterns = make([]*qsa.Pattern, len(b.names))
+	}
+	b.names = append(b.names, name)
+	if b.patterns != nil {
+		b.patterns = append(b.patterns, pat)
+	}
+	b.last = last
+	return b
+}
+
+// patternName - adds the name tok to the pattern, loaded from the field
+// key when key is not "", a name after the ...rest name is an error
+func patternName(yylex yyLexer, pat *qsa.Pattern, key string, tok qsa.Token) *qsa.Pattern {
+	if pat.Rest != "" {
+		yylex.(*Lexer).TokenError(tok, "'..."+pat.Rest+"' must be the last name of a pattern")
+	}
+	if key != "" {
+		pat.Keys = append(pat.Keys, key)
+	}
+	pat.Names = append(pat.Names, tok.Str)
+	return pat
+}
+
+// patternRest - sets the ...rest name tok of the pattern
+func patternRest(yylex yyLexer, pat *qsa.Pattern, tok qsa.Token) *qsa.Pattern {
+	if pat.Rest != "" {
+		yylex.(*Lexer).TokenError(tok, "'..."+pat.Rest+"' must be the last name of a pattern")
+	}
+	pat.Rest = tok.Str
+	return pat
+}
+
+// classMethod - adds the method tok of a class, a method declared twice,
+// or one named __index, that the class sets to itself, is an error
+func classMethod(yylex yyLexer, methods []*qsa.ClassMethod, tok qsa.Token, fn *qsa.ProcExpr) []*qsa.ClassMethod {
+	if tok.Str == "__index" {
+		yylex.(*Lexer).TokenError(tok, "a class cannot declare __index, it is the class")
+	}
+	for _, m := range methods {
+		if m.Name == tok.Str {
+			yylex.(*Lexer).TokenError(tok, "method '"+tok.Str+"' declared twice")
+		}
+	}
+	return append(methods, &qsa.ClassMethod{Name: tok.Str, Func: fn})
+}
+
+// yyTokOffset - number of names goyacc puts in yyToknames before TAnd
+const yyTokOffset = 3
+
 func TokenName(c int) string {
-	if c >= TAnd && c-TAnd < len(yyToknames) {
-		if yyToknames[c-TAnd] != "" {
-			return yyToknames[c-TAnd]
+	if c >= TAnd && c-TAnd+yyTokOffset < len(yyToknames) {
+		if yyToknames[c-TAnd+yyTokOffset] != "" {
+			return yyToknames[c-TAnd+yyTokOffset]
 		}
 	}
     return string([]byte{byte(c)})
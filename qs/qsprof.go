@@ -0,0 +1,299 @@
+// Package qs - q scripting language
+package qs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+/*
+  The profiler samples the q call stacks of a state and its coroutines. A
+  ticker marks a sample as due every period, the hook main loop takes it
+  before the next instruction, charging the time since the last sample to
+  the stack of the running thread. Built in procs take a due sample when they return, so
+  time spent in them is charged to them. Allocations charged to
+  the memory budget (see qsalloc.go) are sampled every ProfileAllocRate
+  bytes. The result is written in the pprof protobuf format, with q procs
+  as functions and q source lines as locations.
+*/
+
+// profFunc - a q proc or built in proc as a pprof function
+type profFunc struct {
+	name  string
+	file  string
+	start int
+}
+
+// profLoc - a line of a proc as a pprof location
+type profLoc struct {
+	fn   profFunc
+	line int
+}
+
+// profSample - the values of all samples with the same stack
+type profSample struct {
+	locs   []uint64
+	values [4]int64 // samples, time, alloc objects, alloc space
+}
+
+// Profiler - samples the time and allocations of q procs and source lines
+type Profiler struct {
+	period     time.Duration
+	start      time.Time
+	last       time.Time
+	stop       time.Time
+	due        int32 // set by the ticker, a sample is taken when it is 1
+	ticker     *time.Ticker
+	done       chan struct{}
+	allocBytes int64
+	allocCount int64
+	samples    map[string]*profSample
+	order      []*profSample
+	locs       map[profLoc]uint64
+	locList    []profLoc
+	funcs      map[profFunc]uint64
+	funcList   []profFunc
+}
+
+// StartProfiler - starts sampling the q procs of this state and of the
+// coroutines it creates, every period of run time. A period of 0 uses
+// ProfilePeriod.
+func (ls *LState) StartProfiler(period time.Duration) *Profiler {
+	if period <= 0 {
+		period = ProfilePeriod
+	}
+	p := &Profiler{
+		period:  period,
+		start:   time.Now(),
+		last:    time.Now(),
+		ticker:  time.NewTicker(period),
+		done:    make(chan struct{}),
+		samples: make(map[string]*profSample),
+		locs:    make(map[profLoc]uint64),
+		funcs:   make(map[profFunc]uint64),
+	}
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				atomic.StoreInt32(&p.due, 1)
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	ls.G.prof = p
+	ls.updateMainLoop()
+	return p
+}
+
+// StopProfiler - stops the profiler started by StartProfiler and returns it
+func (ls *LState) StopProfiler() *Profiler {
+	p := ls.G.prof
+	if p != nil {
+		p.stop = time.Now()
+		p.ticker.Stop()
+		close(p.done)
+		ls.G.prof = nil
+		ls.updateMainLoop()
+	}
+	return p
+}
+
+// tick - called before each instruction by the hook loop and when built in
+// procs return, charges the time since the last sample to the stack of L
+// when a sample is due
+func (p *Profiler) tick(L *LState) {
+	if atomic.LoadInt32(&p.due) == 0 {
+		return
+	}
+	atomic.StoreInt32(&p.due, 0)
+	now := time.Now()
+	d := now.Sub(p.last)
+	p.last = now
+	p.add(L, [4]int64{1, int64(d), 0, 0})
+}
+
+// allocated - charges n allocated bytes, sampled every ProfileAllocRate bytes
+func (p *Profiler) allocated(L *LState, n int) {
+	p.allocBytes += int64(n)
+	p.allocCount++
+	if p.allocBytes < int64(ProfileAllocRate) {
+		return
+	}
+	p.add(L, [4]int64{0, 0, p.allocCount, p.allocBytes})
+	p.allocBytes = 0
+	p.allocCount = 0
+}
+
+// add - adds values to the sample of the current stack of L, the stacks of
+// the threads that resumed L are included below it
+func (p *Profiler) add(L *LState, values [4]int64) {
+	var locs []uint64
+	for ls := L; ls != nil; ls = ls.Parent {
+		for i := ls.stack.Sp() - 1; i >= 0; i-- {
+			locs = append(locs, p.location(ls, ls.stack.At(i)))
+		}
+	}
+	if len(locs) == 0 {
+		return
+	}
+	key := make([]byte, 0, len(locs)*binary.MaxVarintLen64)
+	for _, id := range locs {
+		key = appendUvarint(key, id)
+	}
+	s, ok := p.samples[string(key)]
+	if !ok {
+		s = &profSample{locs: locs}
+		p.samples[string(key)] = s
+		p.order = append(p.order, s)
+	}
+	for i, v := range values {
+		s.values[i] += v
+	}
+}
+
+// location - returns the id of the location of frame fr of thread ls
+func (p *Profiler) location(ls *LState, fr *callFrame) uint64 {
+	name, _ := ls.frameFuncName(fr)
+	var loc profLoc
+	if fr.Fn.IsG {
+		loc.fn = profFunc{name: name, file: "[G]"}
+	} else {
+		proto := fr.Fn.Proto
+		loc.fn = profFunc{name: name, file: proto.SourceName, start: proto.LineDefined}
+		loc.line = proto.LineDefined
+		if fr.Pc > 0 && fr.Pc <= len(proto.DbgSourcePositions) {
+			loc.line = proto.DbgSourcePositions[fr.Pc-1]
+		}
+	}
+	if id, ok := p.locs[loc]; ok {
+		return id
+	}
+	if _, ok := p.funcs[loc.fn]; !ok {
+		p.funcList = append(p.funcList, loc.fn)
+		p.funcs[loc.fn] = uint64(len(p.funcList))
+	}
+	p.locList = append(p.locList, loc)
+	id := uint64(len(p.locList))
+	p.locs[loc] = id
+	return id
+}
+
+// appendUvarint - appends v to b as a varint
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// protoBuf - minimal protocol buffer encoder for the pprof messages
+type protoBuf struct {
+	data []byte
+}
+
+func (pb *protoBuf) varint(field int, v uint64) {
+	pb.data = appendUvarint(pb.data, uint64(field)<<3)
+	pb.data = appendUvarint(pb.data, v)
+}
+
+func (pb *protoBuf) bytes(field int, b []byte) {
+	pb.data = appendUvarint(pb.data, uint64(field)<<3|2)
+	pb.data = appendUvarint(pb.data, uint64(len(b)))
+	pb.data = append(pb.data, b...)
+}
+
+func (pb *protoBuf) packed(field int, vs []uint64) {
+	var inner protoBuf
+	for _, v := range vs {
+		inner.data = appendUvarint(inner.data, v)
+	}
+	pb.bytes(field, inner.data)
+}
+
+// Write - writes the profile to w as a gzipped pprof protobuf, which can be
+// read with 'go tool pprof'
+func (p *Profiler) Write(w io.Writer) error {
+	strs := map[string]int{"": 0}
+	strList := []string{""}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return uint64(i)
+		}
+		strs[s] = len(strList)
+		strList = append(strList, s)
+		return uint64(len(strList) - 1)
+	}
+	valueType := func(typ, unit string) []byte {
+		var vt protoBuf
+		vt.varint(1, str(typ))
+		vt.varint(2, str(unit))
+		return vt.data
+	}
+
+	var pb protoBuf
+	pb.bytes(1, valueType("samples", "count"))
+	pb.bytes(1, valueType("time", "nanoseconds"))
+	pb.bytes(1, valueType("alloc_objects", "count"))
+	pb.bytes(1, valueType("alloc_space", "bytes"))
+	for _, s := range p.order {
+		var sp protoBuf
+		sp.packed(1, s.locs)
+		values := make([]uint64, len(s.values))
+		for i, v := range s.values {
+			values[i] = uint64(v)
+		}
+		sp.packed(2, values)
+		pb.bytes(2, sp.data)
+	}
+	for i, loc := range p.locList {
+		var line protoBuf
+		line.varint(1, p.funcs[loc.fn])
+		line.varint(2, uint64(loc.line))
+		var lp protoBuf
+		lp.varint(1, uint64(i+1))
+		lp.bytes(4, line.data)
+		pb.bytes(4, lp.data)
+	}
+	for i, fn := range p.funcList {
+		var fp protoBuf
+		fp.varint(1, uint64(i+1))
+		fp.varint(2, str(fn.name))
+		fp.varint(3, str(fn.name))
+		fp.varint(4, str(fn.file))
+		fp.varint(5, uint64(fn.start))
+		pb.bytes(5, fp.data)
+	}
+	stop := p.stop
+	if stop.IsZero() {
+		stop = time.Now()
+	}
+	period := valueType("time", "nanoseconds")
+	deflt := str("time")
+	for _, s := range strList {
+		pb.bytes(6, []byte(s))
+	}
+	pb.varint(9, uint64(p.start.UnixNano()))
+	pb.varint(10, uint64(stop.Sub(p.start)))
+	pb.bytes(11, period)
+	pb.varint(12, uint64(p.period))
+	pb.varint(14, deflt)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(pb.data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("writing profile: %v", err)
+	}
+	return nil
+}
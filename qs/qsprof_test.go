@@ -0,0 +1,206 @@
+package qs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profField - a field of a protocol buffer message, v is set for varints
+// and b for length delimited fields
+type profField struct {
+	num int
+	v   uint64
+	b   []byte
+}
+
+// profFields - decodes the fields of a protocol buffer message, only the
+// wire types the profiler writes are accepted
+func profFields(t *testing.T, data []byte) []profField {
+	t.Helper()
+	var fields []profField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad field key in %x", data)
+		}
+		data = data[n:]
+		f := profField{num: int(key >> 3)}
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad varint in field %d", f.num)
+		}
+		data = data[n:]
+		switch key & 7 {
+		case 0:
+			f.v = v
+		case 2:
+			if uint64(len(data)) < v {
+				t.Fatalf("field %d of %d bytes has %d left", f.num, v, len(data))
+			}
+			f.b = data[:v]
+			data = data[v:]
+		default:
+			t.Fatalf("field %d has wire type %d", f.num, key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// profScript - spends its time in the loop of spin, called by outer
+const profScript = `proc spin(n)
+  dcl s = 0
+  for i = 1, n do s = s + i % 7 end
+  return s
+end
+proc outer()
+  dcl t = 0
+  for k = 1, 40 do t = t + spin(20000) end
+  return t
+end
+outer()`
+
+// TestProfilerWrite - the written profile is a gzipped pprof protobuf with
+// the q procs as functions and their source lines as locations
+func TestProfilerWrite(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	fn, err := L.Load(strings.NewReader(profScript), "prof.q")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	L.StartProfiler(time.Millisecond)
+	L.Push(fn)
+	err = L.PCall(0, 0, nil)
+	p := L.StopProfiler()
+	if err != nil {
+		t.Fatalf("PCall: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+
+	var strs []string
+	var samples, locs, funcs [][]byte
+	for _, f := range profFields(t, data) {
+		switch f.num {
+		case 2:
+			samples = append(samples, f.b)
+		case 4:
+			locs = append(locs, f.b)
+		case 5:
+			funcs = append(funcs, f.b)
+		case 6:
+			strs = append(strs, string(f.b))
+		}
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table %q does not start with an empty string", strs)
+	}
+	str := func(i uint64) string {
+		if i >= uint64(len(strs)) {
+			t.Fatalf("string %d of %d", i, len(strs))
+		}
+		return strs[i]
+	}
+	if len(samples) == 0 {
+		t.Fatal("no samples")
+	}
+
+	// function id -> name and file
+	names := map[uint64]string{}
+	files := map[uint64]string{}
+	for _, b := range funcs {
+		var id uint64
+		var name, file string
+		for _, f := range profFields(t, b) {
+			switch f.num {
+			case 1:
+				id = f.v
+			case 2:
+				name = str(f.v)
+			case 4:
+				file = str(f.v)
+			}
+		}
+		names[id] = name
+		files[id] = file
+	}
+	// location id -> proc name @ file:line
+	where := map[uint64]string{}
+	for _, b := range locs {
+		var id uint64
+		var at string
+		for _, f := range profFields(t, b) {
+			switch f.num {
+			case 1:
+				id = f.v
+			case 4:
+				var fnID, line uint64
+				for _, lf := range profFields(t, f.b) {
+					switch lf.num {
+					case 1:
+						fnID = lf.v
+					case 2:
+						line = lf.v
+					}
+				}
+				if _, ok := names[fnID]; !ok {
+					t.Errorf("location %d names function %d", id, fnID)
+				}
+				at = fmt.Sprintf("%s @ %s:%d", names[fnID], files[fnID], line)
+			}
+		}
+		where[id] = at
+	}
+
+	// every sample stack resolves, and the loop of spin called from outer
+	// is one of them
+	var stacks []string
+	for _, b := range samples {
+		var stack []string
+		for _, f := range profFields(t, b) {
+			if f.num != 1 {
+				continue
+			}
+			for ids := f.b; len(ids) > 0; {
+				id, n := binary.Uvarint(ids)
+				if n <= 0 {
+					t.Fatalf("bad location id in %x", f.b)
+				}
+				ids = ids[n:]
+				at, ok := where[id]
+				if !ok {
+					t.Fatalf("sample names location %d of %d", id, len(where))
+				}
+				stack = append(stack, at)
+			}
+		}
+		stacks = append(stacks, strings.Join(stack, " < "))
+	}
+	want := "spin @ prof.q:3 < outer @ prof.q:8"
+	found := false
+	for _, s := range stacks {
+		if strings.HasPrefix(s, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no sample stack starts with %q in\n%s", want, strings.Join(stacks, "\n"))
+	}
+}
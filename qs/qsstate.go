@@ -2,6 +2,8 @@
 package qs
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -9,9 +11,8 @@ import (
 	"runtime"
 	"strings"
 	"sync/atomic"
-	"time"
 
-	"github.com/x0ray/q/qs/qsp"
+	"github.com/x0ray/q/qs/qsa"
 )
 
 const MultRet = -1
@@ -25,10 +26,13 @@ type ApiError struct {
 	StackTrace string
 	// Underlying error. This attribute is set only if the Type is ApiErrorFile or ApiErrorSyntax
 	Cause error
+	// Source line of a run time error with a caret under the failing
+	// expression, "" when the source is not known
+	Source string
 }
 
 func newApiError(code ApiErrorType, object LValue) *ApiError {
-	return &ApiError{code, object, "", nil}
+	return &ApiError{Type: code, Object: object}
 }
 
 func newApiErrorS(code ApiErrorType, message string) *ApiError {
@@ -36,14 +40,18 @@ func newApiErrorS(code ApiErrorType, message string) *ApiError {
 }
 
 func newApiErrorE(code ApiErrorType, err error) *ApiError {
-	return &ApiError{code, LString(err.Error()), "", err}
+	return &ApiError{Type: code, Object: LString(err.Error()), Cause: err}
 }
 
 func (e *ApiError) Error() string {
+	msg := e.Object.String()
+	if len(e.Source) > 0 {
+		msg += "\n" + e.Source
+	}
 	if len(e.StackTrace) > 0 {
-		return fmt.Sprintf("%s\n%s", e.Object.String(), e.StackTrace)
+		msg += "\n" + e.StackTrace
 	}
-	return e.Object.String()
+	return msg
 }
 
 type ApiErrorType int
@@ -54,6 +62,7 @@ const (
 	ApiErrorRun
 	ApiErrorError
 	ApiErrorPanic
+	ApiErrorMemory // the memory limit set by SetMemoryLimit was exceeded
 )
 
 type ResumeState int
@@ -263,11 +272,18 @@ func (rg *registry) SetNumber(reg int, val LNumber) {
 	}
 }
 
+func (rg *registry) SetInteger(reg int, val LInteger) {
+	rg.array[reg] = rg.alloc.LInteger2I(val)
+	if reg >= rg.top {
+		rg.top = reg + 1
+	}
+}
+
 func newGlobal() *Global {
 	return &Global{
 		MainThread: nil,
-		Registry:   newLOAList(0, 32),
-		Global:     newLOAList(0, 64),
+		Registry:   newLOAList(nil, 0, 32),
+		Global:     newLOAList(nil, 0, 64),
 		builtinMts: make(map[int]LValue),
 		tempFiles:  make([]*os.File, 0, 10),
 	}
@@ -275,12 +291,14 @@ func newGlobal() *Global {
 
 func panicWithTraceback(L *LState) {
 	err := newApiError(ApiErrorRun, L.Get(-1))
+	err.Source = L.errorSource(err.Object)
 	err.StackTrace = L.stackTrace(0)
 	panic(err)
 }
 
 func panicWithoutTraceback(L *LState) {
 	err := newApiError(ApiErrorRun, L.Get(-1))
+	err.Source = L.errorSource(err.Object)
 	panic(err)
 }
 
@@ -294,6 +312,8 @@ func newLState(options Options) *LState {
 		Options: options,
 
 		stop:         0,
+		ctx:          nil,
+		mainLoop:     mainLoop,
 		reg:          newRegistry(options.RegistrySize, al),
 		stack:        newCallFrameStack(options.CallStackSize),
 		alloc:        al,
@@ -302,6 +322,9 @@ func newLState(options Options) *LState {
 		uvcache:      nil,
 		hasErrorFunc: false,
 	}
+	al.mem = &memBudget{ls: ls}
+	ls.G.Registry.alloc = al
+	ls.G.Global.alloc = al
 	ls.Env = ls.G.Global
 	return ls
 }
@@ -351,7 +374,7 @@ func (ls *LState) closeAllUpvalues() {
 
 func (ls *LState) raiseError(level int, format string, args ...interface{}) {
 	if !ls.hasErrorFunc {
-		ls.closeAllUpvalues()
+		ls.closeUnwound()
 	}
 	message := format
 	if len(args) > 0 {
@@ -359,11 +382,23 @@ func (ls *LState) raiseError(level int, format string, args ...interface{}) {
 	}
 	if level > 0 {
 		message = fmt.Sprintf("%v %v", ls.where(level-1, true), message)
+		ls.errMessage, ls.errSource = message, ls.whereSource(level-1)
 	}
 	ls.reg.Push(LString(message))
 	ls.Panic(ls)
 }
 
+// errorSource - returns the source excerpt of the error obj when it is the
+// message of the last error raised, and forgets the excerpt
+func (ls *LState) errorSource(obj LValue) string {
+	src := ""
+	if s, ok := obj.(LString); ok && len(ls.errSource) > 0 && string(s) == ls.errMessage {
+		src = ls.errSource
+	}
+	ls.errMessage, ls.errSource = "", ""
+	return src
+}
+
 func (ls *LState) findLocal(frame *callFrame, no int) string {
 	fn := frame.Fn
 	if !fn.IsG {
@@ -405,6 +440,34 @@ func (ls *LState) where(level int, skipg bool) string {
 	return fmt.Sprintf("%v:%v", sourcename, line)
 }
 
+// whereSource - returns the source line of the instruction running at
+// level with a caret under its expression, "" when the source is not known
+func (ls *LState) whereSource(level int) string {
+	dbg, ok := ls.GetStack(level)
+	if !ok {
+		return ""
+	}
+	proto := dbg.frame.Fn.Proto
+	if proto == nil {
+		return ls.whereSource(level + 1)
+	}
+	pc := dbg.frame.Pc - 1
+	if proto.source == nil || pc < 0 || pc >= len(proto.DbgSourceSpans) {
+		return ""
+	}
+	line := proto.DbgSourcePositions[pc]
+	span := proto.DbgSourceSpans[pc]
+	text := qsa.SourceLine(proto.source, line)
+	if len(text) == 0 {
+		return ""
+	}
+	last := span.LastColumn
+	if span.LastLine != line {
+		last = len(text)
+	}
+	return qsa.Excerpt(line, text, span.Column, last)
+}
+
 func (ls *LState) stackTrace(level int) string {
 	buf := []string{}
 	header := "stack traceback:"
@@ -621,6 +684,82 @@ func (ls *LState) metaOp2(value1, value2 LValue, event string) LValue {
 	return LNil
 }
 
+// nameArgs - puts the named arguments of cn, in the registers after those
+// given by position of the call of the proc in register RA, in the
+// registers of their parameters, the arguments end at the register top
+func (ls *LState) nameArgs(RA int, cn *CallNames) {
+	fn, meta := ls.metaCall(ls.reg.Get(RA))
+	if fn == nil {
+		ls.RaiseError("attempt to call a non-proc object")
+	}
+	if fn == ls.G.classNew { // the arguments of a class are those of its init
+		if init, ok := ls.GetField(ls.reg.Get(RA), "init").(*LProc); ok {
+			fn = init
+		}
+	}
+	if fn.IsG {
+		ls.RaiseError("named arguments to a Go proc")
+	}
+	offset := 0
+	if meta {
+		offset = 1 // the object called is the first argument
+	}
+	args := make([]LValue, cn.Args, cn.Args+len(cn.Names))
+	for i := range args {
+		args[i] = ls.reg.Get(RA + 1 + i)
+	}
+	named := make([]bool, 0, cap(args))
+	for i, name := range cn.Names {
+		j := fn.Proto.paramIndex(name) - offset
+		if j < 0 {
+			ls.RaiseError("proc has no parameter '%s'", name)
+		}
+		for len(args) <= j {
+			args = append(args, LNil)
+		}
+		for len(named) <= j {
+			named = append(named, false)
+		}
+		if j < cn.Args || named[j] {
+			ls.RaiseError("argument '%s' given twice", name)
+		}
+		args[j], named[j] = ls.reg.Get(RA+1+cn.Args+i), true
+	}
+	for i, arg := range args {
+		ls.reg.Set(RA+1+i, arg)
+	}
+	ls.reg.SetTop(RA + 1 + len(args))
+}
+
+// restFields - returns a new list of the fields of the list lv a pattern
+// does not load, its elements after the first rf.Skip, or the fields
+// without the keys rf.Keys
+func (ls *LState) restFields(lv LValue, rf *RestFields) *LOAList {
+	lst, ok := lv.(*LOAList)
+	if !ok {
+		ls.RaiseError("attempt to take the rest of a non-list object(%v)", lv.Type().String())
+	}
+	if rf.Skip >= 0 {
+		rest := ls.NewOAList()
+		for i, n := rf.Skip+1, lst.Len(); i <= n; i++ {
+			rest.Append(lst.RawGetInt(i))
+		}
+		return rest
+	}
+	rest := ls.NewOAList()
+	lst.ForEach(func(key, value LValue) {
+		if s, ok := key.(LString); ok {
+			for _, k := range rf.Keys {
+				if string(s) == k {
+					return
+				}
+			}
+		}
+		rest.RawSet(key, value)
+	})
+	return rest
+}
+
 func (ls *LState) metaCall(lvalue LValue) (*LProc, bool) {
 	if fn, ok := lvalue.(*LProc); ok {
 		return fn, false
@@ -683,7 +822,7 @@ func (ls *LState) initCallFrame(cf *callFrame) {
 			if CompatVarArg {
 				ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 				if (proto.IsVarArg & VarArgNeedsArg) != 0 {
-					argtb := newLOAList(nvarargs, 0)
+					argtb := newLOAList(ls.alloc, nvarargs, 0)
 					for i := 0; i < nvarargs; i++ {
 						argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 					}
@@ -772,7 +911,7 @@ func (ls *LState) pushCallFrame(cf callFrame, fn LValue, meta bool) {
 				if CompatVarArg {
 					ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 					if (proto.IsVarArg & VarArgNeedsArg) != 0 {
-						argtb := newLOAList(nvarargs, 0)
+						argtb := newLOAList(ls.alloc, nvarargs, 0)
 						for i := 0; i < nvarargs; i++ {
 							argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 						}
@@ -789,6 +928,9 @@ func (ls *LState) pushCallFrame(cf callFrame, fn LValue, meta bool) {
 		}
 	}
 	ls.currentFrame = newcf
+	if ls.hookMask&MaskCall != 0 {
+		ls.callHook(HookCall, -1)
+	}
 }
 
 func (ls *LState) callR(nargs, nret, rbase int) {
@@ -812,9 +954,9 @@ func (ls *LState) callR(nargs, nret, rbase int) {
 	if ls.G.MainThread == nil {
 		ls.G.MainThread = ls
 		ls.G.CurrentThread = ls
-		mainLoop(ls, nil)
+		ls.runLoop(nil)
 	} else {
-		mainLoop(ls, ls.currentFrame)
+		ls.runLoop(ls.currentFrame)
 	}
 	if nret != MultRet {
 		ls.reg.SetTop(rbase + nret)
@@ -970,6 +1112,72 @@ func NewState(opts ...Options) *LState {
 	return ls
 }
 
+// SetContext - sets the context that can cancel the running script, ctx must
+// not be nil. Once ctx is done the script gets a "context canceled" or
+// "context deadline exceeded" error, which may be caught to clean up for
+// ContextGrace instructions, after which the error is raised on every
+// instruction until the script ends.
+func (ls *LState) SetContext(ctx context.Context) {
+	ls.ctx = ctx
+	ls.ctxRaised = false
+	ls.updateMainLoop()
+}
+
+// Context - returns the context set by SetContext, or nil
+func (ls *LState) Context() context.Context {
+	return ls.ctx
+}
+
+// RemoveContext - removes the context set by SetContext and returns it
+func (ls *LState) RemoveContext() context.Context {
+	oldctx := ls.ctx
+	ls.ctx = nil
+	ls.updateMainLoop()
+	return oldctx
+}
+
+// hookLoop - reports if the line or count hooks, the profiler or coverage
+// need the hook main loop
+func (ls *LState) hookLoop() bool {
+	return ls.hookMask&(MaskLine|MaskCount) != 0 || ls.G.prof != nil || ls.G.cover != nil
+}
+
+// updateMainLoop - selects the main loop needed by the context and hooks.
+// When they are changed by a running script, loopChanged makes the calls of
+// built in procs check if the running loop has to be replaced.
+func (ls *LState) updateMainLoop() {
+	switch {
+	case ls.hookLoop():
+		ls.mainLoop = mainLoopWithHook
+	case ls.ctx != nil:
+		ls.mainLoop = mainLoopWithContext
+	default:
+		ls.mainLoop = mainLoop
+		ls.loopChanged = false
+		return
+	}
+	ls.loopChanged = ls.currentFrame != nil
+}
+
+// contextDone - returns the done channel of the context, nil when there is no
+// context, so it can be used as a select case that never fires
+func (ls *LState) contextDone() <-chan struct{} {
+	if ls.ctx == nil {
+		return nil
+	}
+	return ls.ctx.Done()
+}
+
+// raiseContextError - raises the error of the done context, the first time
+// the script is allowed ContextGrace more instructions to handle it
+func (ls *LState) raiseContextError() {
+	if !ls.ctxRaised {
+		ls.ctxRaised = true
+		ls.ctxGrace = ContextGrace
+	}
+	ls.RaiseError(ls.ctx.Err().Error())
+}
+
 func (ls *LState) Close() {
 	atomic.AddInt32(&ls.stop, 1)
 	for _, file := range ls.G.tempFiles {
@@ -1127,17 +1335,26 @@ func (ls *LState) Remove(index int) {
 
 func (ls *LState) NewOAList() *LOAList {
 	// TODO change size
-	return newLOAList(32, 32)
+	return newLOAList(ls.alloc, 32, 32)
 }
 
 func (ls *LState) CreateOAList(acap, hcap int) *LOAList {
-	return newLOAList(acap, hcap)
+	return newLOAList(ls.alloc, acap, hcap)
 }
 
 func (ls *LState) NewThread() *LState {
 	thread := newLState(ls.Options)
 	thread.G = ls.G
 	thread.Env = ls.Env
+	thread.updateMainLoop()
+	thread.alloc.mem = ls.alloc.mem
+	if ls.hook != nil {
+		thread.SetHook(ls.hookMask, ls.hookCount, ls.hook)
+	}
+	ls.alloc.account(len(thread.reg.array)*memSlotSize + len(thread.stack.array)*memFrameSize)
+	if ls.ctx != nil {
+		thread.SetContext(ls.ctx)
+	}
 	return thread
 }
 
@@ -1167,24 +1384,21 @@ func (ls *LState) ToBool(n int) bool {
 }
 
 func (ls *LState) ToInt(n int) int {
-	if lv, ok := ls.Get(n).(LNumber); ok {
-		return int(lv)
-	}
-	if lv, ok := ls.Get(n).(LString); ok {
-		if num, err := parseNumber(string(lv)); err == nil {
-			return int(num)
-		}
-	}
-	return 0
+	return int(ls.ToInt64(n))
 }
 
 func (ls *LState) ToInt64(n int) int64 {
-	if lv, ok := ls.Get(n).(LNumber); ok {
+	switch lv := ls.Get(n).(type) {
+	case LNumber:
 		return int64(lv)
-	}
-	if lv, ok := ls.Get(n).(LString); ok {
-		if num, err := parseNumber(string(lv)); err == nil {
-			return int64(num)
+	case LInteger:
+		return int64(lv)
+	case LString:
+		if num, err := parseNumberValue(string(lv)); err == nil {
+			if it, ok := num.(LInteger); ok {
+				return int64(it)
+			}
+			return int64(num.(LNumber))
 		}
 	}
 	return 0
@@ -1233,11 +1447,12 @@ func (ls *LState) RaiseError(format string, args ...interface{}) {
 
 // Error -
 func (ls *LState) Error(lv LValue, level int) {
+	ls.rethrow(lv)
 	if str, ok := lv.(LString); ok {
 		ls.raiseError(level, string(str))
 	} else {
 		if !ls.hasErrorFunc {
-			ls.closeAllUpvalues()
+			ls.closeUnwound()
 		}
 		ls.Push(lv)
 		ls.Panic(ls)
@@ -1453,7 +1668,7 @@ func (ls *LState) ObjLen(v1 LValue) int {
 		ls.Call(1, 1)
 		ret := ls.reg.Pop()
 		if ret.Type() == LTNumber {
-			return int(ret.(LNumber))
+			return int(LVAsNumber(ret))
 		}
 	} else if v1.Type() == LTOAList {
 		return v1.(*LOAList).Len()
@@ -1487,12 +1702,45 @@ func (ls *LState) Register(name string, fn LGProc) {
 	ls.SetGlobal(name, ls.NewProc(fn))
 }
 
+// Load - compiles the q source read from reader, a precompiled segment is
+// refused, see LoadMode
 func (ls *LState) Load(reader io.Reader, name string) (*LProc, error) {
-	segment, err := qsp.Parse(reader, name)
+	return ls.LoadMode(reader, name, "t")
+}
+
+// LoadMode - compiles q source, or loads a precompiled segment, read from
+// reader. The mode is "t" to allow only source, "b" to allow only a
+// precompiled segment, or "bt" to allow both.
+func (ls *LState) LoadMode(reader io.Reader, name, mode string) (*LProc, error) {
+	br, ok := reader.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(reader)
+	}
+	head, _ := br.Peek(len(QcSignature))
+	binary := IsPrecompiled(head)
+	kind, allowed := "text", "t"
+	if binary {
+		kind, allowed = "binary", "b"
+	}
+	if !strings.Contains(mode, allowed) {
+		return nil, newApiErrorE(ApiErrorFile, fmt.Errorf("attempt to load a %s segment (mode is '%s')", kind, mode))
+	}
+	if binary {
+		proto, err := UndumpProto(br, name)
+		if err != nil {
+			return nil, newApiErrorE(ApiErrorFile, err)
+		}
+		return newLProcL(proto, ls.currentEnv(), 0), nil
+	}
+	src, err := io.ReadAll(br)
 	if err != nil {
-		return nil, newApiErrorE(ApiErrorSyntax, err)
+		return nil, newApiErrorE(ApiErrorFile, err)
+	}
+	sm := newStrictMode(ls.G.strict, ls.G.allowed)
+	sm.known = func(name string) bool {
+		return ls.G.Global.RawGetString(name) != LNil || defaultGlobals()[name]
 	}
-	proto, err := Compile(segment, name)
+	proto, err := compileSource(src, name, sm)
 	if err != nil {
 		return nil, newApiErrorE(ApiErrorSyntax, err)
 	}
@@ -1554,6 +1802,7 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LProc) (err error) {
 				err.(*ApiError).StackTrace = ls.stackTrace(0)
 			}
 			ls.reg.SetTop(base)
+			ls.trimTries(sp)
 		}
 		ls.stack.SetSp(sp)
 		if sp == 0 {
@@ -1698,23 +1947,60 @@ func (ls *LState) XMoveTo(other *LState, n int) {
 	ls.SetTop(top - n)
 }
 
-// Set maximum memory size. This proc can only be called from the main thread.
+// SetMemoryLimit - limits the memory used by the lists, strings and threads
+// of this state and its coroutines to about limit bytes, 0 removes the limit.
+// Exceeding it raises a "not enough memory" error that scripts can catch with
+// pcall, and that reaches the host as an ApiError of type ApiErrorMemory.
+func (ls *LState) SetMemoryLimit(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	m := ls.alloc.mem
+	m.limit = limit
+	m.since = 0
+	if limit > 0 {
+		m.used = ls.memoryInUse()
+	}
+}
+
+// MemoryLimit - returns the memory limit set by SetMemoryLimit, 0 if none
+func (ls *LState) MemoryLimit() int64 {
+	return ls.alloc.mem.limit
+}
+
+// MemoryInUse - returns an estimate of the memory, in bytes, reachable from
+// this state and its coroutines
+func (ls *LState) MemoryInUse() int64 {
+	return ls.memoryInUse()
+}
+
+// raiseMemoryError - raises the error for an exceeded memory limit
+func (ls *LState) raiseMemoryError(limit int64) {
+	if !ls.hasErrorFunc {
+		ls.closeAllUpvalues()
+	}
+	message := fmt.Sprintf("not enough memory, limit of %d bytes exceeded", limit)
+	if where := ls.where(0, true); where != "" {
+		message = where + " " + message
+	}
+	panic(newApiErrorS(ApiErrorMemory, message))
+}
+
+// SetStrict - loads the scripts that follow in strict mode, as if they
+// had the strict pragma comment, allowing them to use the globals named
+// without declaring them
+func (ls *LState) SetStrict(globals ...string) {
+	ls.G.strict = true
+	ls.G.allowed = append(ls.G.allowed, globals...)
+}
+
+// SetMx - sets the memory limit of this state in MB, see SetMemoryLimit.
+// This proc can only be called from the main thread.
 func (ls *LState) SetMx(mx int) {
 	if ls.Parent != nil {
 		ls.RaiseError("sub threads are not allowed to set a memory limit")
 	}
-	go func() {
-		limit := uint64(mx * 1024 * 1024) //MB
-		var s runtime.MemStats
-		for ls.stop == 0 {
-			runtime.ReadMemStats(&s)
-			if s.Alloc >= limit {
-				fmt.Println("out of memory")
-				os.Exit(3)
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-	}()
+	ls.SetMemoryLimit(int64(mx) * 1024 * 1024)
 }
 
 // Converts the Oa value at the given acceptable index to the chan LValue.
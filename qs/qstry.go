@@ -0,0 +1,185 @@
+// Package qs - q scripting language
+package qs
+
+// tryHandler - an active try statement of a running proc, an error raised
+// while it is active resumes the proc at its catch or finally block, and a
+// return from the proc runs its finally block first
+type tryHandler struct {
+	sp      int  // the call stack size with the proc running the try on top
+	reg     int  // the register set to the error or the pending action
+	pc      int  // of the catch or finally block
+	finally bool // a finally handler
+}
+
+// tryPending - what a finally block does after it ends, other than going
+// on after the try statement, it is held by the (finally) register
+type tryPending struct {
+	err    *ApiError // raise err again
+	ret    bool      // return values
+	values []LValue
+	pc     int // jump to pc, when it is not an error or return
+}
+
+// pushTry - starts a try statement of the running proc
+func (ls *LState) pushTry(reg, pc int, finally bool) {
+	ls.tries = append(ls.tries, tryHandler{sp: ls.stack.Sp(), reg: reg, pc: pc, finally: finally})
+}
+
+// popTry - ends the innermost try statement
+func (ls *LState) popTry() {
+	if n := len(ls.tries); n > 0 {
+		ls.tries = ls.tries[:n-1]
+	}
+}
+
+// trimTries - drops the try statements of procs above call stack size sp,
+// which an error raised from them has left
+func (ls *LState) trimTries(sp int) {
+	n := len(ls.tries)
+	for n > 0 && ls.tries[n-1].sp > sp {
+		n--
+	}
+	ls.tries = ls.tries[:n]
+}
+
+// setPending - sets register reg to the pending action of a finally block
+func (ls *LState) setPending(reg int, pending *tryPending) {
+	ud := ls.NewUserData()
+	ud.Value = pending
+	ls.reg.Set(reg, ud)
+}
+
+// resetTop - sets the register top of the running proc above its registers,
+// where it is while the proc runs
+func (ls *LState) resetTop() {
+	cf := ls.currentFrame
+	ls.reg.SetTop(cf.LocalBase + int(cf.Fn.Proto.NumUsedRegisters))
+}
+
+// closeUnwound - closes the upvalues of the registers an error leaves, those
+// of the innermost try statement, or all of them when there is none
+func (ls *LState) closeUnwound() {
+	if n := len(ls.tries); n > 0 {
+		ls.closeUpvalues(ls.tries[n-1].reg)
+	} else {
+		ls.closeAllUpvalues()
+	}
+}
+
+// runLoop - runs the main loop from baseframe, an error raised in a try
+// statement of a proc it runs resumes the loop at the catch or finally
+// block of the try
+func (ls *LState) runLoop(baseframe *callFrame) {
+	for !ls.tryLoop(baseframe) {
+	}
+}
+
+// tryLoop - runs the main loop, done is false when it stopped at an error
+// that a try statement caught
+func (ls *LState) tryLoop(baseframe *callFrame) (done bool) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err, ok := rcv.(*ApiError)
+			if !ok || !ls.catch(err, baseframe) {
+				panic(rcv)
+			}
+		}
+	}()
+	ls.mainLoop(ls, baseframe)
+	return true
+}
+
+// catch - resumes the proc of the innermost try statement at its catch or
+// finally block, when the proc is run by the main loop from baseframe
+func (ls *LState) catch(err *ApiError, baseframe *callFrame) bool {
+	n := len(ls.tries)
+	if n == 0 {
+		return false
+	}
+	h := ls.tries[n-1]
+	if baseframe != nil && h.sp-1 < baseframe.Idx {
+		return false // a try of a proc that called the loop
+	}
+	ls.tries = ls.tries[:n-1]
+	if len(err.StackTrace) == 0 {
+		err.StackTrace = ls.stackTrace(0)
+	}
+	ls.closeUpvalues(h.reg)
+	ls.stack.SetSp(h.sp)
+	ls.currentFrame = ls.stack.Last()
+	ls.resetTop()
+	if h.finally {
+		ls.setPending(h.reg, &tryPending{err: err})
+	} else {
+		ls.caught = err
+		ls.reg.Set(h.reg, err.Object)
+	}
+	ls.currentFrame.Pc = h.pc
+	return true
+}
+
+// rethrow - raises err again, the last error caught, when lv is its value,
+// so that it keeps the traceback of where it was first raised
+func (ls *LState) rethrow(lv LValue) {
+	if err := ls.caught; err != nil && err.Object == lv {
+		if !ls.hasErrorFunc {
+			ls.closeUnwound()
+		}
+		panic(err)
+	}
+}
+
+// returnFinally - runs the finally block of the innermost try statement of
+// the proc returning the registers from RA, nret of them, before it returns,
+// the other try statements of the proc are ended
+func (ls *LState) returnFinally(RA, nret int) bool {
+	sp := ls.stack.Sp()
+	for n := len(ls.tries); n > 0 && ls.tries[n-1].sp == sp; n = len(ls.tries) {
+		h := ls.tries[n-1]
+		ls.tries = ls.tries[:n-1]
+		if !h.finally {
+			continue
+		}
+		values := make([]LValue, nret)
+		for i := range values {
+			values[i] = ls.reg.Get(RA + i)
+		}
+		ls.closeUpvalues(h.reg)
+		ls.resetTop()
+		ls.setPending(h.reg, &tryPending{ret: true, values: values})
+		ls.currentFrame.Pc = h.pc
+		return true
+	}
+	return false
+}
+
+// endFinally - does the pending action of register RA at the end of a
+// finally block, it returns the result of the instruction that does it
+func (ls *LState) endFinally(RA int, baseframe *callFrame) int {
+	ud, ok := ls.reg.Get(RA).(*LUserData)
+	if !ok {
+		return 0
+	}
+	pending, ok := ud.Value.(*tryPending)
+	if !ok {
+		return 0
+	}
+	ls.reg.Set(RA, LNil)
+	switch {
+	case pending.err != nil:
+		if !ls.hasErrorFunc {
+			ls.closeUnwound()
+		}
+		panic(pending.err)
+	case pending.ret:
+		for i, v := range pending.values {
+			ls.reg.Set(RA+i, v)
+		}
+		ls.reg.SetTop(RA + len(pending.values))
+		A := RA - ls.currentFrame.LocalBase
+		return jumpOAList[OP_RETURN](ls, opCreateABC(OP_RETURN, A, 0, 0), baseframe)
+	default:
+		ls.currentFrame.Pc = pending.pc
+	}
+	return 0
+}
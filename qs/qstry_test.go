@@ -0,0 +1,64 @@
+package qs
+
+import (
+	"testing"
+)
+
+// TestTry - catch gets the error raised in the block and finally runs
+// however the block is left, then the error, return, break or continue is done
+func TestTry(t *testing.T) {
+	checkScript(t, "catch", `dcl got
+try
+  error({code = 7})
+catch err then
+  got = err.code
+end
+assert(got == 7)`, "")
+	checkScript(t, "catch error of a called proc", `proc fail() error("bad", 0) end
+dcl got
+try fail() catch e then got = e end
+assert(got == "bad")`, "")
+	checkScript(t, "no error", `dcl log = {}
+try log[#log + 1] = "body" catch then log[#log + 1] = "catch" finally log[#log + 1] = "finally" end
+assert(concat(log, " ") == "body finally", concat(log, " "))`, "")
+	checkScript(t, "finally with return", `dcl log = {}
+proc f()
+  try
+    return "ret"
+  finally
+    log[#log + 1] = "finally"
+  end
+  return "after"
+end
+assert(f() == "ret" and log[1] == "finally")`, "")
+	checkScript(t, "finally with break and continue", `dcl n, fin = 0, 0
+for i = 1, 10 do
+  try
+    if i == 2 then continue end
+    if i == 4 then break end
+    n = n + i
+  finally
+    fin = fin + 1
+  end
+end
+assert(n == 4 and fin == 4, n .. " " .. fin)`, "")
+	checkScript(t, "finally reraises", `dcl fin = false
+dcl ok, err = pcall(proc()
+  try error("raised", 0) finally fin = true end
+end)
+assert(not ok and err == "raised" and fin)`, "")
+	checkScript(t, "error in catch", `dcl fin = false
+dcl ok, err = pcall(proc()
+  try error("first", 0) catch then error("second", 0) finally fin = true end
+end)
+assert(not ok and err == "second" and fin, err)`, "")
+	checkScript(t, "error in finally replaces", `dcl ok, err = pcall(proc()
+  try error("first", 0) finally error("second", 0) end
+end)
+assert(not ok and err == "second", err)`, "")
+	checkScript(t, "rethrow", `dcl ok, err = pcall(proc()
+  try error("again", 0) catch e then error(e) end
+end)
+assert(not ok and err == "again", err)`, "")
+	checkScript(t, "no catch or finally", `try dcl x = 1 end`, "syntax error")
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -384,3 +385,36 @@ func UnEscapeXmlData(v string) string {
 	v = strings.Replace(v, "&#xD;", "\r", -1)
 	return v
 }
+
+// parseNumberValue - converts string to a num, an integer if the string has
+// integer syntax and fits in 64 bits otherwise a float
+func parseNumberValue(number string) (LValue, error) {
+	number = strings.Trim(number, " \t\n")
+	if v, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return LInteger(v), nil
+	}
+	v, err := strconv.ParseFloat(number, LNumberBit)
+	if err != nil {
+		return LNumber(0), err
+	}
+	return LNumber(v), nil
+}
+
+// lvToInteger - converts a num, or a string holding a num, to an integer if
+// it has an exact integer representation
+func lvToInteger(lv LValue) (LInteger, bool) {
+	switch v := lv.(type) {
+	case LInteger:
+		return v, true
+	case LNumber:
+		f := float64(v)
+		if f >= -9223372036854775808.0 && f < 9223372036854775808.0 && f == math.Floor(f) {
+			return LInteger(f), true
+		}
+	case LString:
+		if n, err := parseNumberValue(string(v)); err == nil {
+			return lvToInteger(n)
+		}
+	}
+	return 0, false
+}
@@ -2,8 +2,10 @@
 package qs
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 )
 
 type LValueType int
@@ -47,7 +49,7 @@ func LVAsBool(v LValue) bool { return v != LNil && v != LFalse }
 // if the LValue is a string or number, otherwise an empty string.
 func LVAsString(v LValue) string {
 	switch sn := v.(type) {
-	case LString, LNumber:
+	case LString, LNumber, LInteger:
 		return sn.String()
 	default:
 		return ""
@@ -58,7 +60,7 @@ func LVAsString(v LValue) string {
 // otherwise false.
 func LVCanConvToString(v LValue) bool {
 	switch v.(type) {
-	case LString, LNumber:
+	case LString, LNumber, LInteger:
 		return true
 	default:
 		return false
@@ -70,6 +72,8 @@ func LVAsNumber(v LValue) LNumber {
 	switch lv := v.(type) {
 	case LNumber:
 		return lv
+	case LInteger:
+		return LNumber(lv)
 	case LString:
 		if num, err := parseNumber(string(lv)); err == nil {
 			return num
@@ -158,6 +162,29 @@ func (nm LNumber) Format(f fmt.State, c rune) {
 	}
 }
 
+// LInteger is the integer subtype of num, its Type is LTNumber.
+type LInteger int64
+
+func (it LInteger) String() string                 { return strconv.FormatInt(int64(it), 10) }
+func (it LInteger) Type() LValueType               { return LTNumber }
+func (it LInteger) assertFloat64() (float64, bool) { return float64(it), true }
+func (it LInteger) assertString() (string, bool)   { return "", false }
+func (it LInteger) assertProc() (*LProc, bool)     { return nil, false }
+
+// fmt.Formatter interface
+func (it LInteger) Format(f fmt.State, c rune) {
+	switch c {
+	case 'q', 's':
+		defaultFormat(it.String(), f, c)
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		defaultFormat(float64(it), f, c)
+	case 'i':
+		defaultFormat(int64(it), f, 'd')
+	default:
+		defaultFormat(int64(it), f, c)
+	}
+}
+
 type LOAList struct {
 	Metalist LValue
 
@@ -166,6 +193,7 @@ type LOAList struct {
 	strdict map[string]LValue
 	keys    []LValue
 	k2i     map[LValue]int
+	alloc   *allocator
 }
 
 func (lst *LOAList) String() string                 { return fmt.Sprintf("list: %p", lst) }
@@ -196,8 +224,13 @@ type Global struct {
 	Global        *LOAList
 
 	builtinMts map[int]LValue
+	prof       *Profiler
+	cover      *Coverage
 	tempFiles  []*os.File
 	gccount    int32
+	strict     bool     // scripts are loaded in strict mode
+	allowed    []string // the globals scripts in strict mode may use undeclared
+	classNew   *LProc   // the __call of the metalists of classes
 }
 
 type LState struct {
@@ -209,6 +242,19 @@ type LState struct {
 	Options Options
 
 	stop         int32
+	ctx          context.Context
+	ctxRaised    bool
+	ctxGrace     int
+	mainLoop     func(*LState, *callFrame)
+	loopChanged  bool
+	hook         Hook
+	hookMask     HookMask
+	hookCount    int
+	hookLeft     int
+	hookFrame    *callFrame
+	hookPc       int
+	hookLine     int
+	inHook       bool
 	reg          *registry
 	stack        *callFrameStack
 	alloc        *allocator
@@ -216,6 +262,10 @@ type LState struct {
 	wrapped      bool
 	uvcache      *Upvalue
 	hasErrorFunc bool
+	errMessage   string       // the message and source excerpt of the last
+	errSource    string       // error raised, for the ApiError of it
+	tries        []tryHandler // the active try statements, innermost last
+	caught       *ApiError    // the last error caught by a try statement
 }
 
 func (ls *LState) String() string                 { return fmt.Sprintf("thread: %p", ls) }